@@ -3,48 +3,135 @@ package main
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 
 	"github.com/gotway/gotway/internal/cache"
 	cfg "github.com/gotway/gotway/internal/config"
 	"github.com/gotway/gotway/internal/healthcheck"
 	"github.com/gotway/gotway/internal/http"
+	httpError "github.com/gotway/gotway/internal/http/error"
+	"github.com/gotway/gotway/internal/invalidation"
 	"github.com/gotway/gotway/internal/middleware"
+	accesslogMw "github.com/gotway/gotway/internal/middleware/accesslog"
 	cacheMw "github.com/gotway/gotway/internal/middleware/cache"
+	compressionMw "github.com/gotway/gotway/internal/middleware/compression"
+	errorpageMw "github.com/gotway/gotway/internal/middleware/errorpage"
 	gatewayMw "github.com/gotway/gotway/internal/middleware/gateway"
+	limitsMw "github.com/gotway/gotway/internal/middleware/limits"
 	matchingressMw "github.com/gotway/gotway/internal/middleware/matchingress"
+	metricsMw "github.com/gotway/gotway/internal/middleware/metrics"
+	requestidMw "github.com/gotway/gotway/internal/middleware/requestid"
+	tracingMw "github.com/gotway/gotway/internal/middleware/tracing"
+	validationMw "github.com/gotway/gotway/internal/middleware/validation"
+	"github.com/gotway/gotway/internal/model"
 	"github.com/gotway/gotway/internal/repository"
+	"github.com/gotway/gotway/internal/warming"
+	"github.com/gotway/gotway/pkg/kubernetes/configmap"
 	kubeCtrl "github.com/gotway/gotway/pkg/kubernetes/controller"
 	clientsetv1alpha1 "github.com/gotway/gotway/pkg/kubernetes/crd/v1alpha1/apis/clientset/versioned"
 	"github.com/gotway/gotway/pkg/log"
 	"github.com/gotway/gotway/pkg/metrics"
 	"github.com/gotway/gotway/pkg/pprof"
 	"github.com/gotway/gotway/pkg/redis"
+	"github.com/gotway/gotway/pkg/tracing"
 
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
-
-	goRedis "github.com/go-redis/redis/v8"
 )
 
 func configureMiddlewares(
 	config cfg.Config,
 	kubeCtrl *kubeCtrl.Controller,
+	configMaps *configmap.Store,
 	cacheController cache.Controller,
+	errorRenderer *httpError.Renderer,
+	accessLogWriter io.Writer,
 	logger log.Logger,
-) []middleware.Middleware {
+) ([]middleware.Middleware, error) {
 
 	middlewares := []middleware.Middleware{
+		requestidMw.New(
+			logger.WithField("middleware", "request-id"),
+		),
+	}
+	if config.AccessLog.Enabled {
+		accessLog, err := accesslogMw.New(
+			accesslogMw.Options{
+				Format:     config.AccessLog.Format,
+				Template:   config.AccessLog.Template,
+				SampleRate: config.AccessLog.SampleRate,
+			},
+			accessLogWriter,
+			logger.WithField("middleware", "access-log"),
+		)
+		if err != nil {
+			return nil, err
+		}
+		middlewares = append(middlewares, accessLog)
+	}
+	middlewares = append(middlewares,
+		tracingMw.New(
+			logger.WithField("middleware", "tracing"),
+		),
+		errorpageMw.New(
+			errorRenderer,
+			logger.WithField("middleware", "error-page"),
+		),
 		matchingressMw.New(
 			kubeCtrl,
 			logger.WithField("middleware", "match-service"),
 		),
+	)
+	// requests rejected by the following middlewares are observed too
+	if config.Metrics.Enabled {
+		middlewares = append(middlewares,
+			metricsMw.New(
+				logger.WithField("middleware", "metrics"),
+			),
+		)
 	}
+	middlewares = append(middlewares,
+		compressionMw.New(
+			compressionMw.Options{
+				Enabled:      config.Compression.Enabled,
+				MinSize:      config.Compression.MinSize,
+				ContentTypes: config.Compression.ContentTypes,
+				Level:        config.Compression.Level,
+			},
+			logger.WithField("middleware", "compression"),
+		),
+		limitsMw.New(
+			limitsMw.Options{
+				MaxRequestBodyBytes: config.Limits.MaxRequestBodyBytes,
+				MaxHeaderBytes:      config.Limits.MaxHeaderBytes,
+				MaxURLLength:        config.Limits.MaxURLLength,
+			},
+			logger.WithField("middleware", "limits"),
+		),
+		validationMw.New(
+			configMaps,
+			logger.WithField("middleware", "validation"),
+		),
+	)
 	if config.Cache.Enabled {
+		debugNetworks, err := cacheMw.ParseNetworks(config.Cache.Debug.TrustedIPs)
+		if err != nil {
+			return nil, err
+		}
 		middlewares = append(middlewares,
 			cacheMw.NewCacheIn(
+				cacheMw.CacheInOptions{
+					Coalescing:            config.Cache.Coalescing,
+					DistributedCoalescing: config.Cache.DistributedCoalescing,
+					LockTimeout:           config.Cache.LockTimeout,
+					Debug:                 config.Cache.Debug.Enabled,
+					DebugNetworks:         debugNetworks,
+				},
 				cacheController,
 				logger.WithField("middleware", "cache-in"),
 			),
@@ -59,37 +146,63 @@ func configureMiddlewares(
 	if config.Cache.Enabled {
 		middlewares = append(middlewares,
 			cacheMw.NewCacheOut(
+				cacheMw.CacheOutOptions{InvalidateTimeout: config.Cache.InvalidateTimeout},
 				cacheController,
 				logger.WithField("middleware", "cache-out"),
 			),
 		)
 	}
 
-	return middlewares
+	return middlewares, nil
 }
 
-func getClientSet(
-	config cfg.Config,
-) (*clientsetv1alpha1.Clientset, error) {
-	var restConfig *rest.Config
-	var err error
-	if config.Kubernetes.KubeConfig != "" {
-		restConfig, err = clientcmd.BuildConfigFromFlags("", config.Kubernetes.KubeConfig)
-	} else {
-		restConfig, err = rest.InClusterConfig()
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
+
+// getAccessLogWriter opens the access log output, standard streams are not closed along with it
+func getAccessLogWriter(output string) (io.WriteCloser, error) {
+	switch output {
+	case "stdout":
+		return nopCloser{os.Stdout}, nil
+	case "stderr":
+		return nopCloser{os.Stderr}, nil
+	default:
+		return os.OpenFile(output, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
 	}
-	if err != nil {
-		return nil, err
+}
+
+func getRestConfig(config cfg.Config) (*rest.Config, error) {
+	if config.Kubernetes.KubeConfig != "" {
+		return clientcmd.BuildConfigFromFlags("", config.Kubernetes.KubeConfig)
 	}
-	return clientsetv1alpha1.NewForConfig(restConfig)
+	return rest.InClusterConfig()
 }
 
 func getRedisClient(ctx context.Context, config cfg.Config) (redis.Cmdable, error) {
-	opts, err := goRedis.ParseURL(config.RedisUrl)
+	client, err := redis.NewUniversalClient(redis.Options{
+		Mode:             config.Redis.Mode,
+		URL:              config.Redis.URL,
+		Addrs:            config.Redis.Addrs,
+		MasterName:       config.Redis.MasterName,
+		Username:         config.Redis.Username,
+		Password:         config.Redis.Password,
+		SentinelPassword: config.Redis.SentinelPassword,
+		DB:               config.Redis.DB,
+		TLS: redis.TLSOptions{
+			Enabled:            config.Redis.TLS.Enabled,
+			CAFile:             config.Redis.TLS.CA,
+			CertFile:           config.Redis.TLS.Cert,
+			KeyFile:            config.Redis.TLS.Key,
+			ServerName:         config.Redis.TLS.ServerName,
+			InsecureSkipVerify: config.Redis.TLS.InsecureSkipVerify,
+		},
+	})
 	if err != nil {
-		return nil, fmt.Errorf("error getting redis options %v", err)
+		return nil, err
 	}
-	client := goRedis.NewClient(opts)
 	if err := client.Ping(ctx).Err(); err != nil {
 		client.Close()
 		return nil, fmt.Errorf("error connecting to redis %v", err)
@@ -97,6 +210,58 @@ func getRedisClient(ctx context.Context, config cfg.Config) (redis.Cmdable, erro
 	return redis.New(client), nil
 }
 
+func getCacheRepo(ctx context.Context, config cfg.Config, logger log.Logger) (repository.CacheRepo, error) {
+	memoryOptions := repository.MemoryOptions{
+		MaxBytes: config.Cache.Memory.MaxBytes,
+		Eviction: config.Cache.Memory.Eviction,
+	}
+
+	switch config.Cache.Backend {
+	case cfg.CacheBackendMemory:
+		return repository.NewCacheRepoMemory(memoryOptions), nil
+	case cfg.CacheBackendDisk:
+		diskRepo, err := repository.NewCacheRepoDisk(
+			repository.DiskOptions{
+				Path:          config.Cache.Disk.Path,
+				SweepInterval: config.Cache.Disk.SweepInterval,
+				MaxBytes:      config.Cache.Limits.MaxBytes,
+			},
+			logger.WithField("type", "cache-disk"),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error opening disk cache %v", err)
+		}
+		go diskRepo.Start(ctx)
+		return diskRepo, nil
+	case cfg.CacheBackendRedis:
+		redisClient, err := getRedisClient(ctx, config)
+		if err != nil {
+			return nil, err
+		}
+		cacheRepo := repository.NewCacheRepoRedis(
+			redisClient,
+			repository.RedisOptions{
+				Compression:        config.Cache.Compression.Enabled,
+				CompressionMinSize: config.Cache.Compression.MinSize,
+				MaxBytes:           config.Cache.Limits.MaxBytes,
+			},
+		)
+		if !config.Cache.Enabled || !config.Cache.Memory.Enabled {
+			return cacheRepo, nil
+		}
+		tieredRepo := repository.NewCacheRepoTiered(
+			memoryOptions,
+			cacheRepo,
+			redisClient,
+			logger.WithField("type", "cache-memory"),
+		)
+		go tieredRepo.Start(ctx)
+		return tieredRepo, nil
+	default:
+		return nil, fmt.Errorf("unknown cache backend %s", config.Cache.Backend)
+	}
+}
+
 func main() {
 	config, err := cfg.GetConfig()
 	if err != nil {
@@ -113,13 +278,17 @@ func main() {
 		syscall.SIGQUIT}...,
 	)
 
-	clientSet, err := getClientSet(config)
+	restConfig, err := getRestConfig(config)
+	if err != nil {
+		logger.Fatal("error getting kubernetes config ", err)
+	}
+	clientSet, err := clientsetv1alpha1.NewForConfig(restConfig)
 	if err != nil {
 		logger.Fatal("error getting kubernetes client set ", err)
 	}
-	redisClient, err := getRedisClient(ctx, config)
+	kubeClientSet, err := kubernetes.NewForConfig(restConfig)
 	if err != nil {
-		logger.Fatal("error getting redis client: ", err)
+		logger.Fatal("error getting kubernetes client set ", err)
 	}
 
 	kubeCtrl := kubeCtrl.New(
@@ -130,18 +299,77 @@ func main() {
 		clientSet,
 		logger.WithField("type", "kubernetes"),
 	)
+	configMaps := configmap.New(
+		configmap.Options{
+			Namespace:    config.Kubernetes.Namespace,
+			ResyncPeriod: config.Kubernetes.ResyncPeriod,
+		},
+		kubeClientSet,
+		logger.WithField("type", "configmap"),
+	)
 
-	cacheRepo := repository.NewCacheRepoRedis(redisClient)
+	// the cache outlives the server and the repository outlives the cache, so pending responses are flushed
+	cacheCtx, stopCache := context.WithCancel(context.Background())
+	repoCtx, stopRepo := context.WithCancel(context.Background())
+	cacheRepo, err := getCacheRepo(repoCtx, config, logger)
+	if err != nil {
+		logger.Fatal("error getting cache repository: ", err)
+	}
 	cacheCtrl := cache.NewController(
 		cache.Options{
-			NumWorkers: config.Cache.NumWorkers,
-			BufferSize: config.Cache.BufferSize,
+			NumWorkers:         config.Cache.NumWorkers,
+			BufferSize:         config.Cache.BufferSize,
+			QueuePolicy:        config.Cache.QueuePolicy,
+			QueueTimeout:       config.Cache.QueueTimeout,
+			ShutdownTimeout:    config.Cache.ShutdownTimeout,
+			RevalidationWindow: config.Cache.RevalidationWindow,
+			MaxEntryBytes:      config.Cache.Limits.MaxEntryBytes,
+			Quota: model.CacheQuota{
+				MaxBytes:   config.Cache.Limits.ServiceMaxBytes,
+				MaxEntries: config.Cache.Limits.ServiceMaxEntries,
+			},
 		},
 		cacheRepo,
 		logger.WithField("type", "cache"),
 	)
+	var cacheWg sync.WaitGroup
 	if config.Cache.Enabled {
-		go cacheCtrl.Start(ctx)
+		cacheWg.Add(1)
+		go func() {
+			defer cacheWg.Done()
+			cacheCtrl.Start(cacheCtx)
+		}()
+
+		invalidationCtrl := invalidation.NewController(
+			invalidation.Options{
+				Namespace:    config.Kubernetes.Namespace,
+				ResyncPeriod: config.Kubernetes.ResyncPeriod,
+				ClaimTimeout: config.Cache.Invalidation.ClaimTimeout,
+			},
+			clientSet,
+			cacheCtrl,
+			logger.WithField("type", "cache-invalidation"),
+		)
+		go func() {
+			if err := invalidationCtrl.Run(ctx); err != nil {
+				logger.Error("error starting cache invalidation controller ", err)
+			}
+		}()
+	}
+	var warmingCtrl *warming.Controller
+	if config.Cache.Enabled && config.Cache.Warming.Enabled {
+		warmingCtrl = warming.NewController(
+			warming.Options{
+				Interval:        config.Cache.Warming.Interval,
+				RefreshBefore:   config.Cache.Warming.RefreshBefore,
+				SitemapInterval: config.Cache.Warming.SitemapInterval,
+				Timeout:         config.Cache.Warming.Timeout,
+				Concurrency:     config.Cache.Warming.Concurrency,
+			},
+			kubeCtrl,
+			cacheCtrl,
+			logger.WithField("type", "cache-warming"),
+		)
 	}
 
 	healthCtrl := healthcheck.NewController(
@@ -167,6 +395,25 @@ func main() {
 		defer m.Stop()
 	}
 
+	if config.Tracing.Enabled {
+		t, err := tracing.New(
+			ctx,
+			tracing.Options{
+				ServiceName:  "gotway",
+				Exporter:     config.Tracing.Exporter,
+				Endpoint:     config.Tracing.Endpoint,
+				Insecure:     config.Tracing.Insecure,
+				Sampler:      config.Tracing.Sampler,
+				SamplerRatio: config.Tracing.SamplerRatio,
+			},
+			logger.WithField("type", "tracing"),
+		)
+		if err != nil {
+			logger.Fatal("error configuring tracing ", err)
+		}
+		defer t.Stop()
+	}
+
 	if config.PProf.Enabled {
 		p := pprof.New(
 			pprof.Options{Port: config.PProf.Port},
@@ -184,26 +431,68 @@ func main() {
 			logger.Fatalf("error starting Kubernetes controller: %v", err)
 		}
 	}()
+	go func() {
+		if err := configMaps.Run(ctx); err != nil {
+			logger.Fatalf("error starting configmap informer: %v", err)
+		}
+	}()
+
+	accessLogWriter, err := getAccessLogWriter(config.AccessLog.Output)
+	if err != nil {
+		logger.Fatal("error opening access log ", err)
+	}
+	defer accessLogWriter.Close()
+	// the gateway and the API render their errors alike
+	errorRenderer := httpError.NewRenderer(
+		httpError.Options{
+			Format: config.Errors.Format,
+			Template: httpError.TemplateRef{
+				Namespace: config.Kubernetes.Namespace,
+				Name:      config.Errors.TemplateConfigMap,
+				Key:       config.Errors.TemplateKey,
+			},
+			InterceptUpstream: config.Errors.InterceptUpstream,
+		},
+		configMaps,
+		logger.WithField("type", "error-renderer"),
+	)
+	middlewares, err := configureMiddlewares(
+		config,
+		kubeCtrl,
+		configMaps,
+		cacheCtrl,
+		errorRenderer,
+		accessLogWriter,
+		logger.WithField("type", "middleware"),
+	)
+	if err != nil {
+		logger.Fatal("error configuring middlewares ", err)
+	}
 
 	server := http.NewServer(
 		http.ServerOptions{
-			Port:       config.Port,
-			TLSenabled: config.TLS.Enabled,
-			TLScert:    config.TLS.Cert,
-			TLSkey:     config.TLS.Key,
+			Port:           config.Port,
+			MaxHeaderBytes: int(config.Limits.MaxHeaderBytes),
+			TLSenabled:     config.TLS.Enabled,
+			TLScert:        config.TLS.Cert,
+			TLSkey:         config.TLS.Key,
 		},
-		configureMiddlewares(
-			config,
-			kubeCtrl,
-			cacheCtrl,
-			logger.WithField("type", "middleware"),
-		),
+		middlewares,
+		errorRenderer,
 		kubeCtrl,
 		cacheCtrl,
+		warmingCtrl,
 		logger.WithField("type", "http"),
 	)
 	go server.Start()
-	defer server.Stop()
+
+	if warmingCtrl != nil {
+		go warmingCtrl.Start(ctx, server.GatewayHandler())
+	}
 
 	<-ctx.Done()
+	server.Stop()
+	stopCache()
+	cacheWg.Wait()
+	stopRepo()
 }
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/gotway/gotway/internal/openapi"
+	crdv1alpha1 "github.com/gotway/gotway/pkg/kubernetes/crd/v1alpha1"
+	clientsetv1alpha1 "github.com/gotway/gotway/pkg/kubernetes/crd/v1alpha1/apis/clientset/versioned"
+	"github.com/gotway/gotway/pkg/log"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/yaml"
+)
+
+type flags struct {
+	file         string
+	configMap    string
+	configMapKey string
+	namespace    string
+	kubeConfig   string
+	host         string
+	service      crdv1alpha1.Service
+	dryRun       bool
+	prune        bool
+}
+
+func parseFlags() flags {
+	var f flags
+	flag.StringVar(&f.file, "file", "", "OpenAPI 3 document file, in JSON or YAML")
+	flag.StringVar(&f.configMap, "configmap", "", "ConfigMap containing the OpenAPI 3 document")
+	flag.StringVar(&f.configMapKey, "configmap-key", "openapi.yaml", "ConfigMap key containing the OpenAPI 3 document")
+	flag.StringVar(&f.namespace, "namespace", "default", "Namespace of the ConfigMap and the generated ingresses")
+	flag.StringVar(&f.kubeConfig, "kubeconfig", os.Getenv("KUBECONFIG"), "Kubeconfig path, in-cluster config is used when empty")
+	flag.StringVar(&f.host, "host", "", "Host matched by the generated ingresses")
+	flag.StringVar(&f.service.Name, "service-name", "", "Name of the service")
+	flag.StringVar(&f.service.URL, "service-url", "", "URL of the service")
+	flag.StringVar(&f.service.HealthPath, "health-path", "/health", "Health path of the service")
+	flag.BoolVar(&f.dryRun, "dry-run", false, "Print the generated ingresses instead of applying them")
+	flag.BoolVar(&f.prune, "prune", false, "Delete ingresses generated for the service that are no longer in the document")
+	flag.Parse()
+	return f
+}
+
+func getRestConfig(kubeConfig string) (*rest.Config, error) {
+	if kubeConfig != "" {
+		return clientcmd.BuildConfigFromFlags("", kubeConfig)
+	}
+	return rest.InClusterConfig()
+}
+
+func readDocument(ctx context.Context, f flags) ([]byte, error) {
+	if f.file != "" {
+		return ioutil.ReadFile(f.file)
+	}
+	if f.configMap == "" {
+		return nil, fmt.Errorf("either -file or -configmap must be specified")
+	}
+	restConfig, err := getRestConfig(f.kubeConfig)
+	if err != nil {
+		return nil, err
+	}
+	clientSet, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, err
+	}
+	configMap, err := clientSet.CoreV1().ConfigMaps(f.namespace).Get(ctx, f.configMap, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	data, ok := configMap.Data[f.configMapKey]
+	if !ok {
+		return nil, fmt.Errorf("key '%s' not found in configmap '%s'", f.configMapKey, f.configMap)
+	}
+	return []byte(data), nil
+}
+
+func printIngresses(ingresses []crdv1alpha1.IngressHTTP) error {
+	for _, ingress := range ingresses {
+		bytes, err := yaml.Marshal(ingress)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("---\n%s", bytes)
+	}
+	return nil
+}
+
+func main() {
+	f := parseFlags()
+	logger := log.NewLogger(log.Fields{
+		"service": "openapi-import",
+	}, "local", "info", os.Stderr)
+	ctx := context.Background()
+
+	data, err := readDocument(ctx, f)
+	if err != nil {
+		logger.Fatal("error reading OpenAPI document: ", err)
+	}
+	doc, err := openapi.Parse(data)
+	if err != nil {
+		logger.Fatal("error parsing OpenAPI document: ", err)
+	}
+	ingresses, err := doc.Ingresses(openapi.Options{
+		Namespace: f.namespace,
+		Host:      f.host,
+		Service:   f.service,
+	})
+	if err != nil {
+		logger.Fatal("error generating ingresses: ", err)
+	}
+
+	if f.dryRun {
+		if err := printIngresses(ingresses); err != nil {
+			logger.Fatal("error printing ingresses: ", err)
+		}
+		return
+	}
+
+	restConfig, err := getRestConfig(f.kubeConfig)
+	if err != nil {
+		logger.Fatal("error getting kubernetes config: ", err)
+	}
+	clientSet, err := clientsetv1alpha1.NewForConfig(restConfig)
+	if err != nil {
+		logger.Fatal("error getting kubernetes client set: ", err)
+	}
+	result, err := openapi.Sync(ctx, clientSet, f.namespace, f.service.Name, ingresses, f.prune)
+	if err != nil {
+		logger.Fatal("error syncing ingresses: ", err)
+	}
+	logger.Infof(
+		"synced ingresses for service '%s': created %v, updated %v, deleted %v",
+		f.service.Name,
+		result.Created,
+		result.Updated,
+		result.Deleted,
+	)
+}
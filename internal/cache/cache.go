@@ -3,21 +3,48 @@ package cache
 import (
 	"bytes"
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"sync"
+	"time"
 
 	"github.com/gotway/gotway/internal/model"
 	"github.com/gotway/gotway/internal/repository"
+	"github.com/gotway/gotway/internal/requestcontext"
 	"github.com/gotway/gotway/pkg/log"
-	"github.com/pquerna/cachecontrol/cacheobject"
+	"github.com/gotway/gotway/pkg/metrics"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const cacheQueue = "cache"
+
+const (
+	// QueuePolicyDrop does not cache the responses that do not fit in the queue
+	QueuePolicyDrop = "drop"
+	// QueuePolicyWait waits up to the queue timeout for room in the queue before dropping a response
+	QueuePolicyWait = "wait"
 )
 
 type Options struct {
 	NumWorkers int
 	BufferSize int
+	// QueuePolicy and QueueTimeout determine what happens to the responses to cache when the queue is full,
+	// requests never wait for longer than the timeout
+	QueuePolicy  string
+	QueueTimeout time.Duration
+	// ShutdownTimeout bounds how long the queued responses are flushed for when stopping
+	ShutdownTimeout time.Duration
+	// RevalidationWindow is how long responses with validators are kept after expiring,
+	// so they can be revalidated with a conditional request instead of downloaded again
+	RevalidationWindow time.Duration
+	// MaxEntryBytes and Quota are the defaults of every service, zero values mean unlimited
+	MaxEntryBytes int64
+	Quota         model.CacheQuota
 }
 
 type Params struct {
@@ -25,90 +52,325 @@ type Params struct {
 	TTL      int64
 	Statuses []int
 	Tags     []string
+	Key      KeyOptions
+	// StaleWhileRevalidate and StaleIfError are the defaults in seconds,
+	// they are overridden by the Cache-Control header of the response
+	StaleWhileRevalidate int64
+	StaleIfError         int64
+	// IgnoreOriginHeaders caches responses regardless of their Cache-Control and Expires headers
+	IgnoreOriginHeaders bool
+	Invalidate          InvalidateOptions
+	// MaxEntryBytes and Quota override the defaults of the controller when they are not zero
+	MaxEntryBytes int64
+	Quota         model.CacheQuota
 }
 
 type Controller interface {
 	Start(ctx context.Context)
-	HandleResponse(r *http.Response, params Params) error
+	HandleResponse(r *http.Request, res *http.Response, params Params) error
+	Revalidate(r *http.Request, cache model.Cache, res *http.Response, params Params) (*http.Response, error)
 	IsCacheableRequest(r *http.Request) bool
-	IsCacheableResponse(r *http.Response, params Params) bool
-	GetCache(r *http.Request, service string) (model.Cache, error)
-	DeleteCacheByPath(paths []model.CachePath) error
-	DeleteCacheByTags(tags []string) error
+	IsCacheableResponse(r *http.Request, res *http.Response, params Params) bool
+	IsInvalidatingResponse(r *http.Response, params Params) bool
+	Invalidate(ctx context.Context, r *http.Request, res *http.Response, params Params) (int64, error)
+	GetCache(r *http.Request, params Params) (model.Cache, error)
+	PeekCache(r *http.Request, params Params) (model.Cache, error)
+	DeleteCacheByPath(ctx context.Context, paths []model.CachePath) error
+	DeleteCacheByTags(ctx context.Context, tags []string) (int64, error)
+	DeleteCacheByFilter(ctx context.Context, filter model.CacheFilter) (int64, error)
+	FindCache(ctx context.Context, filter model.CacheFilter, page model.CachePage) (model.CacheList, error)
+	CountCache(ctx context.Context, filter model.CacheFilter) (model.CacheCount, error)
+	Lock(r *http.Request, params Params, ttl time.Duration) (release func(), acquired bool, err error)
+	Warm(ctx context.Context, task WarmTask) error
+}
+
+// WarmTask requests a response so it is cached before any client requests it
+type WarmTask func(ctx context.Context) error
+
+type warmTask struct {
+	ctx  context.Context
+	task WarmTask
+	done chan error
 }
 
 type response struct {
+	ctx          context.Context
+	key          string
+	createdAt    time.Time
 	httpResponse *http.Response
 	bodyBytes    []byte
 	params       Params
+	tags         []string
+	result       *StoreResult
 }
 
 type BasicController struct {
 	options      Options
 	cacheRepo    repository.CacheRepo
 	pendingCache chan response
-	logger       log.Logger
+	pendingWarm  chan warmTask
+	warmSlots    chan struct{}
+	// stopping is closed when the controller stops accepting responses
+	stopping chan struct{}
+	logger   log.Logger
 }
 
-// ListenResponses starts listening for responses
+// Start caches the queued responses until the context is done, then flushes
+// the ones still queued and returns
 func (c BasicController) Start(ctx context.Context) {
 	c.logger.Info("starting cache controller")
-	var logOnce sync.Once
 
+	var wg sync.WaitGroup
 	for i := 0; i < c.options.NumWorkers; i++ {
+		wg.Add(1)
 		go func() {
+			defer wg.Done()
 			for {
 				select {
 				case <-ctx.Done():
-					logOnce.Do(func() {
-						c.logger.Info("stopping cache controller")
-					})
 					return
 				case response := <-c.pendingCache:
-					c.logger.Debug("caching response")
-					if err := c.cacheResponse(response); err != nil {
-						c.logger.Error("error caching response", err)
-					}
+					metrics.QueueDepth.WithLabelValues(cacheQueue).Set(float64(len(c.pendingCache)))
+					c.store(response)
+				case warm := <-c.pendingWarm:
+					warm.done <- warm.task(warm.ctx)
+					<-c.warmSlots
 				}
 			}
 		}()
 	}
+
+	<-ctx.Done()
+	close(c.stopping)
+	wg.Wait()
+	c.flush()
+	c.logger.Info("stopped cache controller")
 }
 
-// HandleResponse handles a response ans sends it to the channel
-func (c BasicController) HandleResponse(r *http.Response, params Params) error {
-	if !c.IsCacheableResponse(r, params) {
+// flush caches the queued responses until the shutdown timeout, the remaining ones are dropped
+func (c BasicController) flush() {
+	pending := len(c.pendingCache)
+	if pending == 0 {
+		return
+	}
+	c.logger.Infof("flushing %d pending responses", pending)
+	deadline := time.Now().Add(c.options.ShutdownTimeout)
+
+	var wg sync.WaitGroup
+	for i := 0; i < c.options.NumWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for time.Now().Before(deadline) {
+				select {
+				case response := <-c.pendingCache:
+					ctx, cancel := context.WithDeadline(response.ctx, deadline)
+					response.ctx = ctx
+					c.store(response)
+					cancel()
+				default:
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	for {
+		select {
+		case response := <-c.pendingCache:
+			c.drop(response, metrics.CacheDropShutdown)
+		default:
+			metrics.QueueDepth.WithLabelValues(cacheQueue).Set(0)
+			return
+		}
+	}
+}
+
+func (c BasicController) store(response response) {
+	c.logger.Debug("caching response")
+	if err := c.cacheResponse(response); err != nil {
+		c.logger.Error("error caching response", err)
+	}
+}
+
+// HandleResponse handles the response to a client request and sends it to the channel
+func (c BasicController) HandleResponse(r *http.Request, res *http.Response, params Params) error {
+	// the tags declared by the service are meant for the gateway, they are neither stored nor forwarded
+	tags := getTags(res, params)
+	res.Header.Del(TagsHeader)
+	if !c.IsCacheableResponse(r, res, params) {
 		return nil
 	}
 
-	bodyBytes, err := ioutil.ReadAll(r.Body)
+	bodyBytes, err := c.readBody(res, params)
+	if errors.Is(err, model.ErrCacheEntryTooLarge) {
+		c.logger.Debugf("response of service %s not cached: %v", params.Service, err)
+		metrics.CacheRejections.WithLabelValues(params.Service, metrics.CacheRejectEntrySize).Inc()
+		getStoreResult(r).complete(err)
+		return nil
+	}
 	if err != nil {
+		getStoreResult(r).complete(err)
 		return err
 	}
-	r.Body.Close()
-	r.Body = ioutil.NopCloser(bytes.NewBuffer(bodyBytes))
 
-	c.pendingCache <- response{
-		httpResponse: r,
+	c.enqueue(r, res, bodyBytes, params, tags)
+	return nil
+}
+
+// readBody reads the body of a response so it can be cached and sent to the client afterwards.
+// Bodies larger than the maximum entry size are not read beyond it
+func (c BasicController) readBody(res *http.Response, params Params) ([]byte, error) {
+	maxBytes := c.options.MaxEntryBytes
+	if params.MaxEntryBytes > 0 {
+		maxBytes = params.MaxEntryBytes
+	}
+	if maxBytes <= 0 {
+		bodyBytes, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			return nil, err
+		}
+		res.Body.Close()
+		res.Body = ioutil.NopCloser(bytes.NewBuffer(bodyBytes))
+		return bodyBytes, nil
+	}
+
+	if res.ContentLength > maxBytes {
+		return nil, model.ErrCacheEntryTooLarge
+	}
+	bodyBytes, err := ioutil.ReadAll(io.LimitReader(res.Body, maxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(bodyBytes)) > maxBytes {
+		res.Body = readCloser{
+			Reader: io.MultiReader(bytes.NewReader(bodyBytes), res.Body),
+			Closer: res.Body,
+		}
+		return nil, model.ErrCacheEntryTooLarge
+	}
+	res.Body.Close()
+	res.Body = ioutil.NopCloser(bytes.NewBuffer(bodyBytes))
+	return bodyBytes, nil
+}
+
+// Revalidate handles a 304 Not Modified response to a conditional request,
+// it returns the cached response updated with the new headers and stores it again
+func (c BasicController) Revalidate(
+	r *http.Request,
+	cache model.Cache,
+	res *http.Response,
+	params Params,
+) (*http.Response, error) {
+	res.Body.Close()
+
+	header := cache.Headers.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	header.Del(requestcontext.RequestIDHeader)
+	tags := cache.Tags
+	if declared, err := getCacheTagsHeader(res); err == nil {
+		tags = declared
+	}
+	for key, values := range res.Header {
+		if key == "Content-Length" || key == TagsHeader {
+			continue
+		}
+		header[key] = values
+	}
+
+	revalidated := &http.Response{
+		Status:        fmt.Sprintf("%d %s", cache.StatusCode, http.StatusText(cache.StatusCode)),
+		StatusCode:    cache.StatusCode,
+		Proto:         res.Proto,
+		ProtoMajor:    res.ProtoMajor,
+		ProtoMinor:    res.ProtoMinor,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(cache.Body)),
+		ContentLength: int64(len(cache.Body)),
+		Request:       res.Request,
+	}
+	metrics.CacheOperations.WithLabelValues(params.Service, metrics.CacheRevalidate).Inc()
+
+	if c.IsCacheableResponse(r, revalidated, params) {
+		c.enqueue(r, revalidated, cache.Body, params, tags)
+	}
+	return revalidated, nil
+}
+
+// enqueue queues a response to be cached without blocking the request, unless the queue policy
+// allows waiting for room in the queue
+func (c BasicController) enqueue(
+	r *http.Request,
+	res *http.Response,
+	bodyBytes []byte,
+	params Params,
+	tags []string,
+) {
+	pending := response{
+		ctx:          detachContext(r.Context()),
+		key:          GetKey(r, params.Key),
+		createdAt:    time.Now(),
+		httpResponse: res,
 		bodyBytes:    bodyBytes,
 		params:       params,
+		tags:         tags,
+		result:       getStoreResult(r),
+	}
+	pending.result.expect()
+	select {
+	case <-c.stopping:
+		c.drop(pending, metrics.CacheDropShutdown)
+		return
+	default:
 	}
 
-	return nil
+	select {
+	case c.pendingCache <- pending:
+		metrics.QueueDepth.WithLabelValues(cacheQueue).Set(float64(len(c.pendingCache)))
+		return
+	default:
+	}
+	if c.options.QueuePolicy != QueuePolicyWait || c.options.QueueTimeout <= 0 {
+		c.drop(pending, metrics.CacheDropQueueFull)
+		return
+	}
+
+	timer := time.NewTimer(c.options.QueueTimeout)
+	defer timer.Stop()
+	select {
+	case c.pendingCache <- pending:
+		metrics.QueueDepth.WithLabelValues(cacheQueue).Set(float64(len(c.pendingCache)))
+	case <-timer.C:
+		c.drop(pending, metrics.CacheDropQueueFull)
+	case <-c.stopping:
+		c.drop(pending, metrics.CacheDropShutdown)
+	case <-r.Context().Done():
+		c.drop(pending, metrics.CacheDropQueueFull)
+	}
+}
+
+func (c BasicController) drop(response response, reason string) {
+	c.logger.Debugf("response of service %s not cached: %s", response.params.Service, reason)
+	metrics.CacheDrops.WithLabelValues(response.params.Service, reason).Inc()
+	response.result.complete(fmt.Errorf("%w: %s", model.ErrCacheDropped, reason))
 }
 
-// IsCacheableRequest determines if a request's response can be retrieved from cache
+// IsCacheableRequest determines if a request's response can be retrieved from cache,
+// HEAD requests are served from the responses to GET requests
 func (c BasicController) IsCacheableRequest(r *http.Request) bool {
-	return r.Method == http.MethodGet
+	return r.Method == http.MethodGet || r.Method == http.MethodHead
 }
 
-// IsCacheableResponse determines if a response can be stored in cache
-func (c BasicController) IsCacheableResponse(r *http.Response, params Params) bool {
-	if !c.IsCacheableRequest(r.Request) || headersDisallowCaching(r) {
+// IsCacheableResponse determines if a response to a client request can be stored in cache
+func (c BasicController) IsCacheableResponse(r *http.Request, res *http.Response, params Params) bool {
+	if r.Method != http.MethodGet || headersDisallowCaching(r, res, params) || !varyAllowed(res, params.Key) {
 		return false
 	}
 	for _, s := range params.Statuses {
-		if s == r.StatusCode {
+		if s == res.StatusCode {
 			return true
 		}
 	}
@@ -116,58 +378,176 @@ func (c BasicController) IsCacheableResponse(r *http.Response, params Params) bo
 }
 
 // GetCache gets a cached response for a request and a service
-func (c BasicController) GetCache(r *http.Request, service string) (model.Cache, error) {
-	cache, err := c.cacheRepo.Get(r.URL.Path, service)
+func (c BasicController) GetCache(r *http.Request, params Params) (model.Cache, error) {
+	cache, err := c.PeekCache(r, params)
 	if err != nil {
+		if errors.Is(err, model.ErrCacheNotFound) {
+			metrics.CacheOperations.WithLabelValues(params.Service, metrics.CacheMiss).Inc()
+		}
 		return model.Cache{}, err
 	}
+	metrics.CacheOperations.WithLabelValues(params.Service, metrics.CacheHit).Inc()
 	return cache, nil
 }
 
+// PeekCache gets a cached response like GetCache without counting it as a hit or a miss,
+// so it can be polled while waiting for a response to be cached
+func (c BasicController) PeekCache(r *http.Request, params Params) (model.Cache, error) {
+	return c.cacheRepo.Get(r.Context(), GetKey(r, params.Key), params.Service)
+}
+
 // DeleteCacheByPath deletes cache defined by its path
-func (c BasicController) DeleteCacheByPath(paths []model.CachePath) error {
-	return c.cacheRepo.DeleteByPath(paths)
+func (c BasicController) DeleteCacheByPath(ctx context.Context, paths []model.CachePath) error {
+	return c.cacheRepo.DeleteByPath(ctx, normalizePaths(paths))
 }
 
-// DeleteCacheByTags deletes cache with tags
-func (c BasicController) DeleteCacheByTags(tags []string) error {
-	return c.cacheRepo.DeleteByTags(tags)
+// DeleteCacheByTags deletes cache with tags and returns how many caches were deleted
+func (c BasicController) DeleteCacheByTags(ctx context.Context, tags []string) (int64, error) {
+	return c.cacheRepo.DeleteByTags(ctx, tags)
+}
+
+// DeleteCacheByFilter deletes the caches matching a filter and returns how many were deleted
+func (c BasicController) DeleteCacheByFilter(ctx context.Context, filter model.CacheFilter) (int64, error) {
+	filter.Paths = normalizePaths(filter.Paths)
+	return c.cacheRepo.DeleteByFilter(ctx, filter)
+}
+
+// FindCache lists a page of the caches matching a filter
+func (c BasicController) FindCache(
+	ctx context.Context,
+	filter model.CacheFilter,
+	page model.CachePage,
+) (model.CacheList, error) {
+	filter.Paths = normalizePaths(filter.Paths)
+	return c.cacheRepo.Find(ctx, filter, page)
+}
+
+// CountCache counts the caches matching a filter in total and per service
+func (c BasicController) CountCache(ctx context.Context, filter model.CacheFilter) (model.CacheCount, error) {
+	filter.Paths = normalizePaths(filter.Paths)
+	return c.cacheRepo.Count(ctx, filter)
+}
+
+// Lock acquires a lock shared by all the gateway replicas on the cache key of a request,
+// the lock expires after a ttl unless it is released before
+func (c BasicController) Lock(r *http.Request, params Params, ttl time.Duration) (func(), bool, error) {
+	key := GetKey(r, params.Key)
+	token, err := newLockToken()
+	if err != nil {
+		return nil, false, err
+	}
+	acquired, err := c.cacheRepo.Lock(r.Context(), key, params.Service, token, ttl)
+	if err != nil || !acquired {
+		return nil, false, err
+	}
+
+	ctx := detachContext(r.Context())
+	release := func() {
+		if err := c.cacheRepo.Unlock(ctx, key, params.Service, token); err != nil {
+			c.logger.Error("error releasing cache lock ", err)
+		}
+	}
+	return release, true, nil
+}
+
+// Warm runs a task in the worker pool and waits for it. Warming tasks wait for a slot first, so they
+// leave a worker to store responses. Tasks do not wait for the responses they fetch to be stored,
+// which would block a single worker
+
+func (c BasicController) Warm(ctx context.Context, task WarmTask) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	select {
+	case c.warmSlots <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	done := make(chan error, 1)
+	// there are as many slots as room in the queue
+	c.pendingWarm <- warmTask{ctx: ctx, task: task, done: done}
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 func (c BasicController) cacheResponse(res response) error {
-	path := getPath(res.httpResponse.Request)
 	ttl := getTTL(res.httpResponse, res.params)
-	tags := getTags(res.httpResponse, res.params)
+	staleWhileRevalidate, staleIfError := getStale(res.httpResponse, res.params)
 
 	cache := model.Cache{
-		Path:       path,
-		StatusCode: res.httpResponse.StatusCode,
-		Headers:    res.httpResponse.Header,
-		Body:       res.bodyBytes,
-		TTL:        ttl,
-		Tags:       tags,
+		Path:                 res.key,
+		StatusCode:           res.httpResponse.StatusCode,
+		Headers:              res.httpResponse.Header,
+		Body:                 res.bodyBytes,
+		TTL:                  ttl,
+		StaleWhileRevalidate: staleWhileRevalidate,
+		StaleIfError:         staleIfError,
+		Tags:                 res.tags,
+		CreatedAt:            res.createdAt,
+	}
+	if cache.HasValidators() {
+		cache.Revalidate = model.CacheTTL(c.options.RevalidationWindow)
+	}
+
+	err := c.cacheRepo.Create(res.ctx, cache, res.params.Service, c.getQuota(res.params))
+	res.result.complete(err)
+	if reason, rejected := getRejectReason(err); rejected {
+		c.logger.Debugf("response of service %s not cached: %v", res.params.Service, err)
+		metrics.CacheRejections.WithLabelValues(res.params.Service, reason).Inc()
+		return nil
+	}
+	if err != nil {
+		return err
 	}
+	metrics.CacheOperations.WithLabelValues(res.params.Service, metrics.CacheStore).Inc()
+	return nil
+}
 
-	return c.cacheRepo.Create(cache, res.params.Service)
+// getQuota overrides the default quota with the limits of a service
+func (c BasicController) getQuota(params Params) model.CacheQuota {
+	quota := c.options.Quota
+	if params.Quota.MaxBytes > 0 {
+		quota.MaxBytes = params.Quota.MaxBytes
+	}
+	if params.Quota.MaxEntries > 0 {
+		quota.MaxEntries = params.Quota.MaxEntries
+	}
+	return quota
 }
 
-func getPath(r *http.Request) string {
-	path := r.URL.Path
-	if r.URL.RawQuery != "" {
-		return fmt.Sprintf("%s?%s", path, r.URL.RawQuery)
+func getRejectReason(err error) (string, bool) {
+	switch {
+	case errors.Is(err, model.ErrCacheQuotaExceeded):
+		return metrics.CacheRejectQuota, true
+	case errors.Is(err, model.ErrCacheBudgetExceeded):
+		return metrics.CacheRejectBudget, true
 	}
-	return path
+	return "", false
 }
 
-func getTTL(r *http.Response, params Params) model.CacheTTL {
-	ttl, err := getCacheTTLHeader(r)
-	var seconds int64
-	if err != nil {
-		seconds = params.TTL
-	} else {
-		seconds = ttl
+// readCloser reads the part of a body already read followed by the rest of it
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// detachContext keeps the span of a request context but not its cancellation,
+// responses are cached asynchronously once the request has already finished
+func detachContext(ctx context.Context) context.Context {
+	return trace.ContextWithSpanContext(context.Background(), trace.SpanContextFromContext(ctx))
+}
+
+func newLockToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
 	}
-	return model.NewCacheTTL(seconds)
+	return hex.EncodeToString(b), nil
 }
 
 func getTags(r *http.Response, params Params) []string {
@@ -178,44 +558,31 @@ func getTags(r *http.Response, params Params) []string {
 	return tags
 }
 
-func getCacheTTLHeader(r *http.Response) (int64, error) {
-	cacheControl := r.Header.Get("Cache-Control")
-	directives, err := cacheobject.ParseResponseCacheControl(cacheControl)
-	if err != nil {
-		return 0, err
-	}
-	ttl := directives.SMaxAge
-	if ttl < 0 {
-		return 0, errors.New("Cache-Control header not found")
-	}
-	return int64(ttl), nil
-}
-
 func getCacheTagsHeader(r *http.Response) ([]string, error) {
-	cacheTags := r.Header.Values("X-Cache-Tags")
+	cacheTags := r.Header.Values(TagsHeader)
 	if len(cacheTags) == 0 {
-		return cacheTags, errors.New("X-Cache-Tags header not found")
+		return cacheTags, fmt.Errorf("%s header not found", TagsHeader)
 	}
 	return cacheTags, nil
 }
 
-func headersDisallowCaching(r *http.Response) bool {
-	ttl, err := getCacheTTLHeader(r)
-	if err != nil {
-		return false
-	}
-	return ttl == 0
-}
-
 func NewController(
 	options Options,
 	cacheRepo repository.CacheRepo,
 	logger log.Logger,
 ) Controller {
+	// warming tasks leave a worker to store responses, unless there is only one
+	warmConcurrency := options.NumWorkers - 1
+	if warmConcurrency < 1 {
+		warmConcurrency = 1
+	}
 	return &BasicController{
 		options:      options,
 		cacheRepo:    cacheRepo,
 		pendingCache: make(chan response, options.BufferSize),
+		pendingWarm:  make(chan warmTask, warmConcurrency),
+		warmSlots:    make(chan struct{}, warmConcurrency),
+		stopping:     make(chan struct{}),
 		logger:       logger,
 	}
 }
@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"sync"
 	"testing"
 	"time"
 
@@ -15,6 +16,8 @@ import (
 	"github.com/gotway/gotway/internal/mocks"
 	"github.com/gotway/gotway/internal/model"
 	"github.com/gotway/gotway/pkg/log"
+	"github.com/gotway/gotway/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -27,7 +30,7 @@ type cacheResponse struct {
 
 func TestIsCacheable(t *testing.T) {
 	cacheRepo := new(mocks.CacheRepo)
-	controller := cache.NewController(cache.Options{10, 10}, cacheRepo, log.Log)
+	controller := cache.NewController(cache.Options{NumWorkers: 10, BufferSize: 10}, cacheRepo, log.Log)
 
 	getReq, _ := http.NewRequest(http.MethodGet, "http://api.gotway.com/service/foo", nil)
 	postReq, _ := http.NewRequest(http.MethodPost, "http://api.gotway.com/service/foo", nil)
@@ -60,11 +63,11 @@ func TestIsCacheable(t *testing.T) {
 
 func TestGetCache(t *testing.T) {
 	cacheRepo := new(mocks.CacheRepo)
-	controller := cache.NewController(cache.Options{10, 10}, cacheRepo, log.Log)
+	controller := cache.NewController(cache.Options{NumWorkers: 10, BufferSize: 10}, cacheRepo, log.Log)
 
 	reqCacheError, _ := http.NewRequest(http.MethodGet, "http://api.gotway.com/foo", nil)
 	cacheError := errors.New("Cache not found")
-	cacheRepo.On("Get", "/foo", "service").Return(model.Cache{}, cacheError)
+	cacheRepo.On("Get", mock.Anything, "/foo", "service").Return(model.Cache{}, cacheError)
 
 	reqSuccess, _ := http.NewRequest(http.MethodGet, "http://api.gotway.com/products", nil)
 	reqPrefix, _ := http.NewRequest(
@@ -72,13 +75,13 @@ func TestGetCache(t *testing.T) {
 		"http://api.gotway.com/products",
 		nil,
 	)
-	cache := model.Cache{
+	productsCache := model.Cache{
 		Path:       "/products",
 		StatusCode: 200,
 		TTL:        10,
 		Tags:       []string{"foo"},
 	}
-	cacheRepo.On("Get", "/products", "catalog").Return(cache, nil)
+	cacheRepo.On("Get", mock.Anything, "/products", "catalog").Return(productsCache, nil)
 
 	tests := []struct {
 		name      string
@@ -98,21 +101,21 @@ func TestGetCache(t *testing.T) {
 			name:      "Get cache successfully",
 			req:       reqSuccess,
 			service:   "catalog",
-			wantCache: cache,
+			wantCache: productsCache,
 			wantErr:   nil,
 		},
 		{
 			name:      "Get cache successfully",
 			req:       reqPrefix,
 			service:   "catalog",
-			wantCache: cache,
+			wantCache: productsCache,
 			wantErr:   nil,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			cacheDetail, err := controller.GetCache(tt.req, tt.service)
+			cacheDetail, err := controller.GetCache(tt.req, cache.Params{Service: tt.service})
 
 			assert.Equal(t, tt.wantCache, cacheDetail)
 			assert.Equal(t, tt.wantErr, err)
@@ -122,7 +125,7 @@ func TestGetCache(t *testing.T) {
 
 func TestDeleteCacheByPath(t *testing.T) {
 	cacheRepo := new(mocks.CacheRepo)
-	controller := cache.NewController(cache.Options{10, 10}, cacheRepo, log.Log)
+	controller := cache.NewController(cache.Options{NumWorkers: 10, BufferSize: 10}, cacheRepo, log.Log)
 
 	paths := []model.CachePath{
 		{
@@ -130,9 +133,9 @@ func TestDeleteCacheByPath(t *testing.T) {
 			Path:    "foo",
 		},
 	}
-	cacheRepo.On("DeleteByPath", paths).Return(nil)
+	cacheRepo.On("DeleteByPath", mock.Anything, paths).Return(nil)
 
-	err := controller.DeleteCacheByPath(paths)
+	err := controller.DeleteCacheByPath(context.Background(), paths)
 
 	assert.Nil(t, err)
 	cacheRepo.AssertExpectations(t)
@@ -140,20 +143,42 @@ func TestDeleteCacheByPath(t *testing.T) {
 
 func TestDeleteCacheByTags(t *testing.T) {
 	cacheRepo := new(mocks.CacheRepo)
-	controller := cache.NewController(cache.Options{10, 10}, cacheRepo, log.Log)
+	controller := cache.NewController(cache.Options{NumWorkers: 10, BufferSize: 10}, cacheRepo, log.Log)
 
 	tags := []string{"foo"}
-	cacheRepo.On("DeleteByTags", tags).Return(nil)
+	cacheRepo.On("DeleteByTags", mock.Anything, tags).Return(int64(2), nil)
 
-	err := controller.DeleteCacheByTags(tags)
+	deleted, err := controller.DeleteCacheByTags(context.Background(), tags)
 
 	assert.Nil(t, err)
+	assert.Equal(t, int64(2), deleted)
+	cacheRepo.AssertExpectations(t)
+}
+
+func TestDeleteCacheByFilter(t *testing.T) {
+	cacheRepo := new(mocks.CacheRepo)
+	controller := cache.NewController(cache.Options{NumWorkers: 10, BufferSize: 10}, cacheRepo, log.Log)
+
+	filter := model.CacheFilter{
+		Paths:  []model.CachePath{{Service: "catalog", Path: "/products?offset=0&limit=10"}},
+		Prefix: "/products",
+	}
+	normalized := model.CacheFilter{
+		Paths:  []model.CachePath{{Service: "catalog", Path: "/products?limit=10&offset=0"}},
+		Prefix: "/products",
+	}
+	cacheRepo.On("DeleteByFilter", mock.Anything, normalized).Return(int64(1), nil)
+
+	deleted, err := controller.DeleteCacheByFilter(context.Background(), filter)
+
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), deleted)
 	cacheRepo.AssertExpectations(t)
 }
 
 func TestListenResponses(t *testing.T) {
 	cacheRepo := new(mocks.CacheRepo)
-	controller := cache.NewController(cache.Options{10, 10}, cacheRepo, log.Log)
+	controller := cache.NewController(cache.Options{NumWorkers: 10, BufferSize: 10}, cacheRepo, log.Log)
 
 	bodyBytes := []byte("{}")
 	body := ioutil.NopCloser(bytes.NewBuffer(bodyBytes))
@@ -184,14 +209,14 @@ func TestListenResponses(t *testing.T) {
 		params:       stockParams,
 	}
 
-	cacheRepo.On("Create", mock.Anything, mock.Anything).Return(nil)
+	cacheRepo.On("Create", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 	go controller.Start(ctx)
 
 	for _, r := range []cacheResponse{cacheableRes, nonCacheableRes} {
-		if err := controller.HandleResponse(r.httpResponse, r.params); err != nil {
+		if err := controller.HandleResponse(r.httpResponse.Request, r.httpResponse, r.params); err != nil {
 			t.Errorf("got unexpected error: %v", err)
 		}
 	}
@@ -202,7 +227,7 @@ func TestListenResponses(t *testing.T) {
 
 func TestListenCacheControlResponses(t *testing.T) {
 	cacheRepo := new(mocks.CacheRepo)
-	controller := cache.NewController(cache.Options{10, 10}, cacheRepo, log.Log)
+	controller := cache.NewController(cache.Options{NumWorkers: 10, BufferSize: 10}, cacheRepo, log.Log)
 
 	params := cache.Params{
 		Service:  "foo",
@@ -254,14 +279,14 @@ func TestListenCacheControlResponses(t *testing.T) {
 		params:    params,
 	}
 
-	cacheRepo.On("Create", mock.Anything, mock.Anything).Return(nil)
+	cacheRepo.On("Create", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 	go controller.Start(ctx)
 
 	for _, r := range []cacheResponse{TTLRes, noTTLRes, zeroTTLRes} {
-		if err := controller.HandleResponse(r.httpResponse, r.params); err != nil {
+		if err := controller.HandleResponse(r.httpResponse.Request, r.httpResponse, r.params); err != nil {
 			t.Errorf("Got unexpected error: %v", err)
 		}
 	}
@@ -272,7 +297,7 @@ func TestListenCacheControlResponses(t *testing.T) {
 
 func TestListenCacheTagsResponses(t *testing.T) {
 	cacheRepo := new(mocks.CacheRepo)
-	controller := cache.NewController(cache.Options{10, 10}, cacheRepo, log.Log)
+	controller := cache.NewController(cache.Options{NumWorkers: 10, BufferSize: 10}, cacheRepo, log.Log)
 
 	params := cache.Params{
 		Service:  "foo",
@@ -309,20 +334,27 @@ func TestListenCacheTagsResponses(t *testing.T) {
 		params:    params,
 	}
 
-	cacheRepo.On("Create", mock.Anything, mock.Anything).Return(nil)
+	cacheRepo.On("Create", mock.Anything, mock.MatchedBy(func(c model.Cache) bool {
+		return len(c.Tags) == 1 && c.Tags[0] == "products" && c.Headers.Get(cache.TagsHeader) == ""
+	}), mock.Anything, mock.Anything).Return(nil).Once()
+	cacheRepo.On("Create", mock.Anything, mock.MatchedBy(func(c model.Cache) bool {
+		return len(c.Tags) == 0
+	}), mock.Anything, mock.Anything).Return(nil).Once()
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 	go controller.Start(ctx)
 
 	for _, r := range []cacheResponse{tagsRes, noTagsRes} {
-		if err := controller.HandleResponse(r.httpResponse, r.params); err != nil {
+		if err := controller.HandleResponse(r.httpResponse.Request, r.httpResponse, r.params); err != nil {
 			t.Errorf("got unexpected error: %v", err)
 		}
 	}
+	// the declared tags are not forwarded to the client
+	assert.Empty(t, tagsRes.httpResponse.Header.Get(cache.TagsHeader))
 
 	time.Sleep(1 * time.Second)
-	cacheRepo.AssertNumberOfCalls(t, "Create", 2)
+	cacheRepo.AssertExpectations(t)
 }
 
 type errReader int
@@ -333,7 +365,7 @@ func (errReader) Read(p []byte) (n int, err error) {
 
 func TestErrReadingBody(t *testing.T) {
 	cacheRepo := new(mocks.CacheRepo)
-	controller := cache.NewController(cache.Options{10, 10}, cacheRepo, log.Log)
+	controller := cache.NewController(cache.Options{NumWorkers: 10, BufferSize: 10}, cacheRepo, log.Log)
 
 	url, _ := url.Parse("http://api.gotway.com/catalog/products")
 	testRequest := httptest.NewRequest(http.MethodPost, "/foo", errReader(0))
@@ -352,20 +384,142 @@ func TestErrReadingBody(t *testing.T) {
 		Body:       testRequest.Body,
 	}
 
-	cacheRepo.On("Create", mock.Anything, mock.Anything).Return(nil)
+	cacheRepo.On("Create", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 	go controller.Start(ctx)
 
-	err := controller.HandleResponse(res, params)
+	err := controller.HandleResponse(res.Request, res, params)
 	assert.NotNil(t, err)
 }
 
+func TestCacheLimits(t *testing.T) {
+	cacheRepo := new(mocks.CacheRepo)
+	controller := cache.NewController(cache.Options{
+		NumWorkers:    1,
+		BufferSize:    10,
+		MaxEntryBytes: 8,
+		Quota:         model.CacheQuota{MaxBytes: 1024, MaxEntries: 100},
+	}, cacheRepo, log.Log)
+
+	stored := make(chan model.Cache, 10)
+	cacheRepo.On("Create", mock.Anything, mock.Anything, "catalog", model.CacheQuota{MaxBytes: 1024, MaxEntries: 10}).
+		Run(func(args mock.Arguments) { stored <- args.Get(1).(model.Cache) }).
+		Return(nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go controller.Start(ctx)
+
+	params := cache.Params{
+		Service:  "catalog",
+		Statuses: []int{http.StatusOK},
+		Quota:    model.CacheQuota{MaxEntries: 10},
+	}
+	largeParams := params
+	largeParams.MaxEntryBytes = 64
+
+	tests := []struct {
+		name          string
+		body          string
+		contentLength int64
+		params        cache.Params
+		wantCached    bool
+	}{
+		{
+			name:          "Small body",
+			body:          `{}`,
+			contentLength: -1,
+			params:        params,
+			wantCached:    true,
+		},
+		{
+			name:          "Large body",
+			body:          `{"name":"sneakers"}`,
+			contentLength: -1,
+			params:        params,
+			wantCached:    false,
+		},
+		{
+			name:          "Large Content-Length",
+			body:          `{"name":"sneakers"}`,
+			contentLength: 19,
+			params:        params,
+			wantCached:    false,
+		},
+		{
+			name:          "Service max entry size",
+			body:          `{"name":"sneakers"}`,
+			contentLength: 19,
+			params:        largeParams,
+			wantCached:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, "http://api.gotway.com/catalog/products", nil)
+			res := &http.Response{
+				Request:       req,
+				StatusCode:    http.StatusOK,
+				Header:        http.Header{},
+				Body:          ioutil.NopCloser(bytes.NewBufferString(tt.body)),
+				ContentLength: tt.contentLength,
+			}
+
+			assert.Nil(t, controller.HandleResponse(req, res, tt.params))
+			body, err := ioutil.ReadAll(res.Body)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.body, string(body), "the whole body is sent to the client")
+
+			select {
+			case cached := <-stored:
+				assert.True(t, tt.wantCached)
+				assert.Equal(t, tt.body, string(cached.Body))
+			case <-time.After(100 * time.Millisecond):
+				assert.False(t, tt.wantCached)
+			}
+		})
+	}
+}
+
+func TestCacheRejected(t *testing.T) {
+	cacheRepo := new(mocks.CacheRepo)
+	controller := cache.NewController(cache.Options{NumWorkers: 1, BufferSize: 10}, cacheRepo, log.Log)
+
+	cacheRepo.On("Create", mock.Anything, mock.Anything, "catalog", model.CacheQuota{}).
+		Return(model.ErrCacheQuotaExceeded)
+	rejections := metrics.CacheRejections.WithLabelValues("catalog", metrics.CacheRejectQuota)
+	before := testutil.ToFloat64(rejections)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go controller.Start(ctx)
+
+	req, _ := http.NewRequest(http.MethodGet, "http://api.gotway.com/catalog/products", nil)
+	res := &http.Response{
+		Request:    req,
+		StatusCode: http.StatusOK,
+		Header:     http.Header{},
+		Body:       ioutil.NopCloser(bytes.NewBufferString(`{}`)),
+	}
+	params := cache.Params{Service: "catalog", Statuses: []int{http.StatusOK}}
+	req, result := cache.WithStoreResult(req)
+	res.Request = req
+	assert.Nil(t, controller.HandleResponse(req, res, params))
+
+	assert.ErrorIs(t, result.Wait(context.Background()), model.ErrCacheQuotaExceeded)
+	assert.Eventually(t, func() bool {
+		return testutil.ToFloat64(rejections) == before+1
+	}, time.Second, 10*time.Millisecond)
+	cacheRepo.AssertExpectations(t)
+}
+
 func TestCachePolicy(t *testing.T) {
 	cacheRepo := new(mocks.CacheRepo)
 	controller := cache.NewController(
-		cache.Options{10, 10},
+		cache.Options{NumWorkers: 10, BufferSize: 10},
 		cacheRepo,
 		log.Log,
 	)
@@ -458,10 +612,210 @@ func TestCachePolicy(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			isCacheable := controller.IsCacheableResponse(tt.response, tt.params)
+			isCacheable := controller.IsCacheableResponse(tt.response.Request, tt.response, tt.params)
 
 			assert.Equal(t, tt.wantIsCacheable, isCacheable)
 		})
 	}
 
 }
+
+func TestRevalidate(t *testing.T) {
+	cacheRepo := new(mocks.CacheRepo)
+	controller := cache.NewController(
+		cache.Options{NumWorkers: 10, BufferSize: 10, RevalidationWindow: time.Minute},
+		cacheRepo,
+		log.Log,
+	)
+
+	req, _ := http.NewRequest(http.MethodGet, "http://api.gotway.com/products", nil)
+	stale := model.Cache{
+		Path:       "/products",
+		StatusCode: http.StatusOK,
+		Headers: http.Header{
+			"Content-Type":  []string{"application/json"},
+			"Etag":          []string{`"v1"`},
+			"X-Request-Id":  []string{"previous"},
+			"Cache-Control": []string{"s-maxage=10"},
+		},
+		Body:      []byte(`{"name":"sneakers"}`),
+		TTL:       model.NewCacheTTL(10),
+		Tags:      []string{"products"},
+		CreatedAt: time.Now().Add(-time.Minute),
+	}
+	notModified := &http.Response{
+		Request:    req,
+		StatusCode: http.StatusNotModified,
+		Header: http.Header{
+			"Cache-Control": []string{"s-maxage=30"},
+			"Etag":          []string{`"v1"`},
+		},
+		Body: http.NoBody,
+	}
+	params := cache.Params{
+		Service:  "catalog",
+		Statuses: []int{http.StatusOK},
+	}
+
+	stored := make(chan model.Cache, 1)
+	cacheRepo.On("Create", mock.Anything, mock.Anything, "catalog", model.CacheQuota{}).
+		Run(func(args mock.Arguments) { stored <- args.Get(1).(model.Cache) }).
+		Return(nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go controller.Start(ctx)
+
+	res, err := controller.Revalidate(req, stale, notModified, params)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "application/json", res.Header.Get("Content-Type"))
+	assert.Equal(t, "s-maxage=30", res.Header.Get("Cache-Control"))
+	assert.Empty(t, res.Header.Get("X-Request-ID"))
+	body, err := ioutil.ReadAll(res.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, stale.Body, body)
+
+	select {
+	case cached := <-stored:
+		assert.Equal(t, model.NewCacheTTL(30), cached.TTL)
+		assert.Equal(t, model.CacheTTL(time.Minute), cached.Revalidate)
+		assert.Equal(t, []string{"products"}, cached.Tags)
+		assert.True(t, cached.IsFresh(time.Now()))
+	case <-time.After(time.Second):
+		t.Error("revalidated response was not stored")
+	}
+}
+
+func TestWarm(t *testing.T) {
+	cacheRepo := new(mocks.CacheRepo)
+	controller := cache.NewController(
+		cache.Options{NumWorkers: 3, BufferSize: 10},
+		cacheRepo,
+		log.Log,
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go controller.Start(ctx)
+
+	var mu sync.Mutex
+	var running, maxRunning int
+	task := func(ctx context.Context) error {
+		mu.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.Nil(t, controller.Warm(ctx, task))
+		}()
+	}
+	wg.Wait()
+	assert.LessOrEqual(t, maxRunning, 2)
+
+	errWarm := errors.New("gateway responded 502")
+	err := controller.Warm(ctx, func(ctx context.Context) error { return errWarm })
+	assert.Equal(t, errWarm, err)
+
+	canceled, cancelWarm := context.WithCancel(ctx)
+	cancelWarm()
+	err = controller.Warm(canceled, func(ctx context.Context) error { return nil })
+	assert.Equal(t, context.Canceled, err)
+}
+
+func newCacheableResponse(path string) (*http.Request, *http.Response) {
+	req, _ := http.NewRequest(http.MethodGet, "http://api.gotway.com"+path, nil)
+	return req, &http.Response{
+		Request:    req,
+		StatusCode: http.StatusOK,
+		Header:     http.Header{},
+		Body:       ioutil.NopCloser(bytes.NewBufferString(`{}`)),
+	}
+}
+
+func TestQueueFull(t *testing.T) {
+	params := cache.Params{Service: "stock", Statuses: []int{http.StatusOK}}
+	drops := metrics.CacheDrops.WithLabelValues("stock", metrics.CacheDropQueueFull)
+
+	tests := []struct {
+		name     string
+		options  cache.Options
+		wantWait time.Duration
+	}{
+		{
+			name:    "Drop",
+			options: cache.Options{NumWorkers: 1, BufferSize: 1, QueuePolicy: cache.QueuePolicyDrop},
+		},
+		{
+			name: "Wait",
+			options: cache.Options{
+				NumWorkers:   1,
+				BufferSize:   1,
+				QueuePolicy:  cache.QueuePolicyWait,
+				QueueTimeout: 20 * time.Millisecond,
+			},
+			wantWait: 20 * time.Millisecond,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// not started, so the queue is never consumed
+			controller := cache.NewController(tt.options, new(mocks.CacheRepo), log.Log)
+			before := testutil.ToFloat64(drops)
+
+			req, res := newCacheableResponse("/stock/1")
+			assert.Nil(t, controller.HandleResponse(req, res, params))
+			assert.Equal(t, before, testutil.ToFloat64(drops))
+
+			start := time.Now()
+			req, res = newCacheableResponse("/stock/2")
+			req, result := cache.WithStoreResult(req)
+			assert.Nil(t, controller.HandleResponse(req, res, params))
+			assert.GreaterOrEqual(t, time.Since(start), tt.wantWait)
+			assert.Equal(t, before+1, testutil.ToFloat64(drops))
+			assert.ErrorIs(t, result.Wait(context.Background()), model.ErrCacheDropped)
+		})
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	cacheRepo := new(mocks.CacheRepo)
+	controller := cache.NewController(
+		cache.Options{NumWorkers: 2, BufferSize: 10, ShutdownTimeout: time.Second},
+		cacheRepo,
+		log.Log,
+	)
+	params := cache.Params{Service: "offers", Statuses: []int{http.StatusOK}}
+	cacheRepo.On("Create", mock.Anything, mock.Anything, "offers", model.CacheQuota{}).Return(nil)
+	drops := metrics.CacheDrops.WithLabelValues("offers", metrics.CacheDropShutdown)
+	before := testutil.ToFloat64(drops)
+
+	for _, path := range []string{"/offers/1", "/offers/2", "/offers/3"} {
+		req, res := newCacheableResponse(path)
+		assert.Nil(t, controller.HandleResponse(req, res, params))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	// pending responses are flushed before returning
+	controller.Start(ctx)
+	cacheRepo.AssertNumberOfCalls(t, "Create", 3)
+
+	req, res := newCacheableResponse("/offers/4")
+	assert.Nil(t, controller.HandleResponse(req, res, params))
+	assert.Equal(t, before+1, testutil.ToFloat64(drops))
+	cacheRepo.AssertNumberOfCalls(t, "Create", 3)
+}
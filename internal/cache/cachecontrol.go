@@ -0,0 +1,213 @@
+package cache
+
+import (
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gotway/gotway/internal/model"
+	"github.com/pquerna/cachecontrol/cacheobject"
+)
+
+// RequestDirectives are the Cache-Control directives of a request, as in RFC 9111 section 5.2.1
+type RequestDirectives struct {
+	NoCache      bool
+	NoStore      bool
+	OnlyIfCached bool
+	// MaxAge, MaxStale and MinFresh are negative when they are not present
+	MaxAge   time.Duration
+	MaxStale time.Duration
+	MinFresh time.Duration
+}
+
+// Accepts determines if a cached response is fresh enough for the max-age and min-fresh of the request
+func (d RequestDirectives) Accepts(cached model.Cache, now time.Time) bool {
+	if d.MaxAge >= 0 && cached.CurrentAge(now) > d.MaxAge {
+		return false
+	}
+	if d.MinFresh >= 0 && time.Duration(cached.TTL)-cached.Age(now) < d.MinFresh {
+		return false
+	}
+	return true
+}
+
+// AcceptsStale determines if the request accepts a cached response that already expired, with max-stale
+func (d RequestDirectives) AcceptsStale(cached model.Cache, now time.Time) bool {
+	return d.MaxStale >= 0 && cached.Age(now)-time.Duration(cached.TTL) <= d.MaxStale
+}
+
+// GetRequestDirectives parses the Cache-Control header of a request, Pragma: no-cache is
+// only taken into account when there is no Cache-Control header
+func GetRequestDirectives(r *http.Request) RequestDirectives {
+	d := RequestDirectives{MaxAge: -1, MaxStale: -1, MinFresh: -1}
+	cacheControl := getCacheControl(r.Header)
+	if cacheControl == "" {
+		d.NoCache = hasPragmaNoCache(r.Header)
+		return d
+	}
+	directives, err := cacheobject.ParseRequestCacheControl(cacheControl)
+	if err != nil {
+		return d
+	}
+	d.NoCache = directives.NoCache
+	d.NoStore = directives.NoStore
+	d.OnlyIfCached = directives.OnlyIfCached
+	d.MaxAge = toDuration(directives.MaxAge)
+	d.MinFresh = toDuration(directives.MinFresh)
+	d.MaxStale = toDuration(directives.MaxStale)
+	if directives.MaxStaleSet && d.MaxStale < 0 {
+		// max-stale without a value accepts stale responses of any age
+		d.MaxStale = math.MaxInt64
+	}
+	return d
+}
+
+// AllowsStale determines if a cached response may be served once expired without revalidating it
+func AllowsStale(cached model.Cache, params Params) bool {
+	if params.IgnoreOriginHeaders {
+		return true
+	}
+	directives, err := cacheobject.ParseResponseCacheControl(getCacheControl(cached.Headers))
+	if err != nil {
+		return true
+	}
+	return !mustRevalidate(directives)
+}
+
+// headersDisallowCaching applies the storage rules of RFC 9111 section 3 to a response and the client
+// request it answers, the request sent to the service does not carry the headers of the client
+func headersDisallowCaching(req *http.Request, r *http.Response, params Params) bool {
+	if GetRequestDirectives(req).NoStore {
+		return true
+	}
+	authorized := req.Header.Get("Authorization") != ""
+	if params.IgnoreOriginHeaders {
+		return authorized
+	}
+
+	validators := r.Header.Get("ETag") != "" || r.Header.Get("Last-Modified") != ""
+	directives, err := cacheobject.ParseResponseCacheControl(getCacheControl(r.Header))
+	if err != nil {
+		return authorized
+	}
+	if directives.NoStore || directives.PrivatePresent {
+		return true
+	}
+	// responses to authorized requests are only shared when the service explicitly allows it
+	if authorized && !directives.Public && !directives.MustRevalidate && directives.SMaxAge < 0 {
+		return true
+	}
+	if directives.NoCachePresent && !validators {
+		return true
+	}
+	// a response that is never fresh is only useful to revalidate it
+	lifetime, ok := getFreshnessLifetime(r)
+	return ok && lifetime == 0 && !validators
+}
+
+// GetResponseTTL is how long a response is cached, according to its headers and the params of the ingress
+func GetResponseTTL(r *http.Response, params Params) time.Duration {
+	return time.Duration(getTTL(r, params))
+}
+
+// getTTL is the freshness lifetime of a response minus the age it had when it was received,
+// falling back to the TTL of the ingress when the response does not define it.
+// Responses with no-cache are never fresh, they are only kept to revalidate them
+func getTTL(r *http.Response, params Params) model.CacheTTL {
+	if params.IgnoreOriginHeaders {
+		return model.NewCacheTTL(params.TTL)
+	}
+	directives, err := cacheobject.ParseResponseCacheControl(getCacheControl(r.Header))
+	if err == nil && directives.NoCachePresent {
+		return 0
+	}
+	lifetime, ok := getFreshnessLifetime(r)
+	if !ok {
+		return model.NewCacheTTL(params.TTL)
+	}
+	lifetime -= model.InitialAge(r.Header)
+	if lifetime < 0 {
+		lifetime = 0
+	}
+	return model.CacheTTL(lifetime.Truncate(time.Second))
+}
+
+// getFreshnessLifetime reads the freshness lifetime of a response from its s-maxage, max-age
+// or Expires headers, in that order, as in RFC 9111 section 4.2.1
+func getFreshnessLifetime(r *http.Response) (time.Duration, bool) {
+	directives, err := cacheobject.ParseResponseCacheControl(getCacheControl(r.Header))
+	if err == nil {
+		if directives.SMaxAge >= 0 {
+			return toDuration(directives.SMaxAge), true
+		}
+		if directives.MaxAge >= 0 {
+			return toDuration(directives.MaxAge), true
+		}
+	}
+	expires := r.Header.Get("Expires")
+	if expires == "" {
+		return 0, false
+	}
+	expiresAt, err := http.ParseTime(expires)
+	if err != nil {
+		// invalid dates, like 0, represent a time in the past
+		return 0, true
+	}
+	date, err := http.ParseTime(r.Header.Get("Date"))
+	if err != nil {
+		date = time.Now()
+	}
+	if lifetime := expiresAt.Sub(date); lifetime > 0 {
+		return lifetime, true
+	}
+	return 0, true
+}
+
+func getStale(r *http.Response, params Params) (staleWhileRevalidate, staleIfError model.CacheTTL) {
+	swr, sie := params.StaleWhileRevalidate, params.StaleIfError
+	if params.IgnoreOriginHeaders {
+		return model.NewCacheTTL(swr), model.NewCacheTTL(sie)
+	}
+	directives, err := cacheobject.ParseResponseCacheControl(getCacheControl(r.Header))
+	if err == nil {
+		if mustRevalidate(directives) {
+			swr, sie = 0, 0
+		}
+		if directives.StaleWhileRevalidate >= 0 {
+			swr = int64(directives.StaleWhileRevalidate)
+		}
+		if directives.StaleIfError >= 0 {
+			sie = int64(directives.StaleIfError)
+		}
+	}
+	return model.NewCacheTTL(swr), model.NewCacheTTL(sie)
+}
+
+// mustRevalidate determines if a response cannot be served stale by a shared cache
+func mustRevalidate(directives *cacheobject.ResponseCacheDirectives) bool {
+	return directives.MustRevalidate || directives.ProxyRevalidate || directives.NoCachePresent
+}
+
+// getCacheControl joins the Cache-Control headers, the directives may be split in several of them
+func getCacheControl(header http.Header) string {
+	return strings.Join(header.Values("Cache-Control"), ",")
+}
+
+func hasPragmaNoCache(header http.Header) bool {
+	for _, value := range header.Values("Pragma") {
+		for _, directive := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(directive), "no-cache") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func toDuration(seconds cacheobject.DeltaSeconds) time.Duration {
+	if seconds < 0 {
+		return -1
+	}
+	return time.Duration(seconds) * time.Second
+}
@@ -0,0 +1,322 @@
+package cache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gotway/gotway/internal/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHeadersDisallowCaching(t *testing.T) {
+	tests := []struct {
+		name          string
+		requestHeader http.Header
+		header        http.Header
+		ignoreOrigin  bool
+		want          bool
+	}{
+		{
+			name:   "No headers",
+			header: http.Header{},
+			want:   false,
+		},
+		{
+			name:   "No store",
+			header: http.Header{"Cache-Control": []string{"no-store"}},
+			want:   true,
+		},
+		{
+			name:   "Private",
+			header: http.Header{"Cache-Control": []string{"private, max-age=60"}},
+			want:   true,
+		},
+		{
+			name:   "No cache without validators",
+			header: http.Header{"Cache-Control": []string{"no-cache"}},
+			want:   true,
+		},
+		{
+			name:   "No cache with validators",
+			header: http.Header{"Cache-Control": []string{"no-cache"}, "Etag": []string{`"v1"`}},
+			want:   false,
+		},
+		{
+			name:   "Zero max age",
+			header: http.Header{"Cache-Control": []string{"max-age=0"}},
+			want:   true,
+		},
+		{
+			name:   "Expired",
+			header: http.Header{"Expires": []string{"0"}},
+			want:   true,
+		},
+		{
+			name:          "Authorization",
+			requestHeader: http.Header{"Authorization": []string{"Bearer token"}},
+			header:        http.Header{"Cache-Control": []string{"max-age=60"}},
+			want:          true,
+		},
+		{
+			name:          "Authorization with public",
+			requestHeader: http.Header{"Authorization": []string{"Bearer token"}},
+			header:        http.Header{"Cache-Control": []string{"public, max-age=60"}},
+			want:          false,
+		},
+		{
+			name:          "Authorization with s-maxage",
+			requestHeader: http.Header{"Authorization": []string{"Bearer token"}},
+			header:        http.Header{"Cache-Control": []string{"s-maxage=60"}},
+			want:          false,
+		},
+		{
+			name:          "Request no store",
+			requestHeader: http.Header{"Cache-Control": []string{"no-store"}},
+			header:        http.Header{},
+			want:          true,
+		},
+		{
+			name:         "Ignored origin headers",
+			header:       http.Header{"Cache-Control": []string{"no-store, private"}},
+			ignoreOrigin: true,
+			want:         false,
+		},
+		{
+			name:          "Ignored origin headers with authorization",
+			requestHeader: http.Header{"Authorization": []string{"Bearer token"}},
+			header:        http.Header{"Cache-Control": []string{"public"}},
+			ignoreOrigin:  true,
+			want:          true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/products", nil)
+			for key, values := range tt.requestHeader {
+				req.Header[key] = values
+			}
+			res := &http.Response{StatusCode: http.StatusOK, Header: tt.header, Request: req}
+
+			got := headersDisallowCaching(req, res, Params{IgnoreOriginHeaders: tt.ignoreOrigin})
+
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestGetTTL(t *testing.T) {
+	date := time.Date(2021, 10, 21, 7, 28, 0, 0, time.UTC)
+
+	tests := []struct {
+		name         string
+		header       http.Header
+		ignoreOrigin bool
+		want         model.CacheTTL
+	}{
+		{
+			name:   "Ingress TTL",
+			header: http.Header{},
+			want:   model.NewCacheTTL(30),
+		},
+		{
+			name:   "S-maxage",
+			header: http.Header{"Cache-Control": []string{"max-age=10, s-maxage=20"}},
+			want:   model.NewCacheTTL(20),
+		},
+		{
+			name:   "Max age",
+			header: http.Header{"Cache-Control": []string{"max-age=10"}},
+			want:   model.NewCacheTTL(10),
+		},
+		{
+			name: "Max age over expires",
+			header: http.Header{
+				"Cache-Control": []string{"max-age=10"},
+				"Date":          []string{date.Format(http.TimeFormat)},
+				"Expires":       []string{date.Add(time.Hour).Format(http.TimeFormat)},
+			},
+			want: model.NewCacheTTL(10),
+		},
+		{
+			name: "Expires",
+			header: http.Header{
+				"Date":    []string{date.Format(http.TimeFormat)},
+				"Expires": []string{date.Add(time.Minute).Format(http.TimeFormat)},
+			},
+			want: model.NewCacheTTL(60),
+		},
+		{
+			name:   "Invalid expires",
+			header: http.Header{"Expires": []string{"-1"}},
+			want:   model.NewCacheTTL(0),
+		},
+		{
+			name:   "Initial age",
+			header: http.Header{"Cache-Control": []string{"max-age=10"}, "Age": []string{"4"}},
+			want:   model.NewCacheTTL(6),
+		},
+		{
+			name:   "No cache with validators",
+			header: http.Header{"Cache-Control": []string{"no-cache"}, "Etag": []string{`"v1"`}},
+			want:   model.NewCacheTTL(0),
+		},
+		{
+			name:   "No cache with max age",
+			header: http.Header{"Cache-Control": []string{"no-cache, max-age=60"}, "Last-Modified": []string{date.Format(http.TimeFormat)}},
+			want:   model.NewCacheTTL(0),
+		},
+		{
+			name:         "Ignored origin headers",
+			header:       http.Header{"Cache-Control": []string{"max-age=10"}},
+			ignoreOrigin: true,
+			want:         model.NewCacheTTL(30),
+		},
+		{
+			name:         "Ignored origin headers with no cache",
+			header:       http.Header{"Cache-Control": []string{"no-cache"}, "Etag": []string{`"v1"`}},
+			ignoreOrigin: true,
+			want:         model.NewCacheTTL(30),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := &http.Response{StatusCode: http.StatusOK, Header: tt.header}
+
+			got := getTTL(res, Params{TTL: 30, IgnoreOriginHeaders: tt.ignoreOrigin})
+
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestGetStale(t *testing.T) {
+	params := Params{StaleWhileRevalidate: 10, StaleIfError: 60}
+
+	tests := []struct {
+		name    string
+		header  http.Header
+		wantSWR model.CacheTTL
+		wantSIE model.CacheTTL
+	}{
+		{
+			name:    "Defaults",
+			header:  http.Header{},
+			wantSWR: model.NewCacheTTL(10),
+			wantSIE: model.NewCacheTTL(60),
+		},
+		{
+			name:    "Directives",
+			header:  http.Header{"Cache-Control": []string{"stale-while-revalidate=5, stale-if-error=30"}},
+			wantSWR: model.NewCacheTTL(5),
+			wantSIE: model.NewCacheTTL(30),
+		},
+		{
+			name:    "Must revalidate",
+			header:  http.Header{"Cache-Control": []string{"max-age=10, must-revalidate"}},
+			wantSWR: model.NewCacheTTL(0),
+			wantSIE: model.NewCacheTTL(0),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			swr, sie := getStale(&http.Response{Header: tt.header}, params)
+
+			assert.Equal(t, tt.wantSWR, swr)
+			assert.Equal(t, tt.wantSIE, sie)
+		})
+	}
+}
+
+func TestRequestDirectives(t *testing.T) {
+	now := time.Now()
+	cached := model.Cache{
+		Headers:   http.Header{"Age": []string{"5"}},
+		TTL:       model.NewCacheTTL(30),
+		CreatedAt: now.Add(-20 * time.Second),
+	}
+	expired := model.Cache{
+		Headers:   http.Header{},
+		TTL:       model.NewCacheTTL(30),
+		CreatedAt: now.Add(-40 * time.Second),
+	}
+
+	tests := []struct {
+		name             string
+		header           http.Header
+		wantNoCache      bool
+		wantAccepts      bool
+		wantAcceptsStale bool
+	}{
+		{
+			name:        "No directives",
+			header:      http.Header{},
+			wantAccepts: true,
+		},
+		{
+			name:        "No cache",
+			header:      http.Header{"Cache-Control": []string{"no-cache"}},
+			wantNoCache: true,
+			wantAccepts: true,
+		},
+		{
+			name:        "Pragma",
+			header:      http.Header{"Pragma": []string{"no-cache"}},
+			wantNoCache: true,
+			wantAccepts: true,
+		},
+		{
+			name:        "Max age including initial age",
+			header:      http.Header{"Cache-Control": []string{"max-age=22"}},
+			wantAccepts: false,
+		},
+		{
+			name:        "Min fresh",
+			header:      http.Header{"Cache-Control": []string{"min-fresh=15"}},
+			wantAccepts: false,
+		},
+		{
+			name:             "Max stale",
+			header:           http.Header{"Cache-Control": []string{"max-stale=15"}},
+			wantAccepts:      true,
+			wantAcceptsStale: true,
+		},
+		{
+			name:             "Max stale exceeded",
+			header:           http.Header{"Cache-Control": []string{"max-stale=5"}},
+			wantAccepts:      true,
+			wantAcceptsStale: false,
+		},
+		{
+			name:             "Max stale of any age",
+			header:           http.Header{"Cache-Control": []string{"max-stale"}},
+			wantAccepts:      true,
+			wantAcceptsStale: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/products", nil)
+			req.Header = tt.header
+
+			directives := GetRequestDirectives(req)
+
+			assert.Equal(t, tt.wantNoCache, directives.NoCache)
+			assert.Equal(t, tt.wantAccepts, directives.Accepts(cached, now))
+			assert.Equal(t, tt.wantAcceptsStale, directives.AcceptsStale(expired, now))
+		})
+	}
+}
+
+func TestAllowsStale(t *testing.T) {
+	cached := model.Cache{Headers: http.Header{"Cache-Control": []string{"max-age=10, proxy-revalidate"}}}
+
+	assert.False(t, AllowsStale(cached, Params{}))
+	assert.True(t, AllowsStale(cached, Params{IgnoreOriginHeaders: true}))
+	assert.True(t, AllowsStale(model.Cache{Headers: http.Header{}}, Params{}))
+}
@@ -0,0 +1,68 @@
+package cache
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// notModifiedHeaders are the headers kept in a 304 Not Modified response
+var notModifiedHeaders = []string{
+	"Cache-Control",
+	"Content-Location",
+	"Date",
+	"ETag",
+	"Expires",
+	"Last-Modified",
+	"Vary",
+}
+
+// NotModified evaluates the If-None-Match and If-Modified-Since headers of a request
+// against the validators of a response, If-Modified-Since is ignored when If-None-Match is present
+func NotModified(r *http.Request, header http.Header) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		return etagMatches(ifNoneMatch, header.Get("ETag"))
+	}
+	ifModifiedSince := r.Header.Get("If-Modified-Since")
+	lastModified := header.Get("Last-Modified")
+	if ifModifiedSince == "" || lastModified == "" {
+		return false
+	}
+	since, err := http.ParseTime(ifModifiedSince)
+	if err != nil {
+		return false
+	}
+	modified, err := http.ParseTime(lastModified)
+	if err != nil {
+		return false
+	}
+	return !modified.Truncate(time.Second).After(since)
+}
+
+// NotModifiedHeader returns the headers of a response that have to be sent in a 304 Not Modified
+func NotModifiedHeader(header http.Header) http.Header {
+	notModified := http.Header{}
+	for _, key := range notModifiedHeaders {
+		if values := header.Values(key); len(values) > 0 {
+			notModified[http.CanonicalHeaderKey(key)] = values
+		}
+	}
+	return notModified
+}
+
+// etagMatches uses the weak comparison, as If-None-Match does
+func etagMatches(ifNoneMatch string, etag string) bool {
+	if etag == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,91 @@
+package cache
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNotModified(t *testing.T) {
+	header := http.Header{
+		"Etag":          []string{`W/"v1"`},
+		"Last-Modified": []string{"Sat, 01 Jan 2022 10:00:00 GMT"},
+		"Content-Type":  []string{"application/json"},
+	}
+
+	tests := []struct {
+		name    string
+		method  string
+		headers map[string]string
+		want    bool
+	}{
+		{
+			name: "No conditional headers",
+		},
+		{
+			name:    "Matching ETag",
+			headers: map[string]string{"If-None-Match": `"v0", "v1"`},
+			want:    true,
+		},
+		{
+			name:    "Any ETag",
+			headers: map[string]string{"If-None-Match": "*"},
+			want:    true,
+		},
+		{
+			name: "Different ETag takes precedence over date",
+			headers: map[string]string{
+				"If-None-Match":     `"v2"`,
+				"If-Modified-Since": "Sat, 01 Jan 2022 11:00:00 GMT",
+			},
+		},
+		{
+			name:    "Not modified since",
+			headers: map[string]string{"If-Modified-Since": "Sat, 01 Jan 2022 10:00:00 GMT"},
+			want:    true,
+		},
+		{
+			name:    "Modified since",
+			headers: map[string]string{"If-Modified-Since": "Sat, 01 Jan 2022 09:00:00 GMT"},
+		},
+		{
+			name:    "Invalid date",
+			headers: map[string]string{"If-Modified-Since": "yesterday"},
+		},
+		{
+			name:    "Unsafe method",
+			method:  http.MethodPost,
+			headers: map[string]string{"If-None-Match": "*"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			r, _ := http.NewRequest(method, "http://api.gotway.com/products", nil)
+			for key, value := range tt.headers {
+				r.Header.Set(key, value)
+			}
+
+			assert.Equal(t, tt.want, NotModified(r, header))
+		})
+	}
+}
+
+func TestNotModifiedHeader(t *testing.T) {
+	header := http.Header{
+		"Etag":           []string{`"v1"`},
+		"Cache-Control":  []string{"s-maxage=30"},
+		"Content-Type":   []string{"application/json"},
+		"Content-Length": []string{"42"},
+	}
+
+	assert.Equal(t, http.Header{
+		"Etag":          []string{`"v1"`},
+		"Cache-Control": []string{"s-maxage=30"},
+	}, NotModifiedHeader(header))
+}
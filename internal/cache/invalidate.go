@@ -0,0 +1,102 @@
+package cache
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gotway/gotway/internal/model"
+)
+
+const (
+	// TagsHeader lets services declare the tags of a cacheable response, instead of the ones of the ingress
+	TagsHeader = "X-Cache-Tags"
+	// PurgeTagsHeader lets services purge the caches of some tags when responding to an unsafe request
+	PurgeTagsHeader = "X-Cache-Purge-Tags"
+)
+
+// InvalidateOptions purge caches when a request with an unsafe method succeeds
+type InvalidateOptions struct {
+	Enabled bool
+	// Paths and Tags are purged along with the path of the request
+	Paths []string
+	Tags  []string
+}
+
+// IsInvalidatingResponse determines if a response invalidates caches: a non-error response to an
+// unsafe request, as in RFC 9111 section 4.4
+func (c BasicController) IsInvalidatingResponse(r *http.Response, params Params) bool {
+	return params.Invalidate.Enabled && r.Request != nil && isUnsafeMethod(r.Request.Method) &&
+		r.StatusCode < http.StatusBadRequest
+}
+
+// Invalidate deletes the caches of the target URI of a request along with the ones of the Location and
+// Content-Location headers of its response, if they have the same origin. The configured paths and tags
+// are purged too, as well as the tags in the PurgeTagsHeader of the response. Tags are only purged
+// from the caches of the service of the request, so services cannot purge each other's caches
+func (c BasicController) Invalidate(
+	ctx context.Context,
+	r *http.Request,
+	res *http.Response,
+	params Params,
+) (int64, error) {
+	paths := []model.CachePath{{Service: params.Service, Path: getPathKey(r.URL, params.Key)}}
+	for _, header := range []string{"Location", "Content-Location"} {
+		if u, ok := sameOrigin(r, res.Header.Get(header)); ok {
+			paths = append(paths, model.CachePath{Service: params.Service, Path: getPathKey(u, params.Key)})
+		}
+	}
+	for _, path := range params.Invalidate.Paths {
+		paths = append(paths, model.CachePath{Service: params.Service, Path: normalizePath(path)})
+	}
+
+	deleted, err := c.cacheRepo.DeleteByFilter(ctx, model.CacheFilter{Paths: paths})
+	if err != nil {
+		return deleted, err
+	}
+
+	tags := append(append([]string{}, params.Invalidate.Tags...), getPurgeTags(res)...)
+	if len(tags) == 0 {
+		return deleted, nil
+	}
+	tagged, err := c.cacheRepo.DeleteByFilter(ctx, model.CacheFilter{Service: params.Service, Tags: tags})
+	return deleted + tagged, err
+}
+
+func isUnsafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return false
+	default:
+		return true
+	}
+}
+
+// sameOrigin resolves a reference relative to a request, as long as it has its host
+func sameOrigin(r *http.Request, reference string) (*url.URL, bool) {
+	if reference == "" {
+		return nil, false
+	}
+	ref, err := url.Parse(reference)
+	if err != nil {
+		return nil, false
+	}
+	if ref.Host != "" && !strings.EqualFold(ref.Host, r.Host) {
+		return nil, false
+	}
+	return r.URL.ResolveReference(ref), true
+}
+
+// getPurgeTags reads the PurgeTagsHeader, which can be repeated or hold comma separated tags
+func getPurgeTags(r *http.Response) []string {
+	var tags []string
+	for _, value := range r.Header.Values(PurgeTagsHeader) {
+		for _, tag := range strings.Split(value, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return tags
+}
@@ -0,0 +1,173 @@
+package cache_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gotway/gotway/internal/cache"
+	"github.com/gotway/gotway/internal/mocks"
+	"github.com/gotway/gotway/internal/model"
+	"github.com/gotway/gotway/pkg/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestIsInvalidatingResponse(t *testing.T) {
+	cacheRepo := new(mocks.CacheRepo)
+	controller := cache.NewController(cache.Options{NumWorkers: 10, BufferSize: 10}, cacheRepo, log.Log)
+
+	tests := []struct {
+		name       string
+		method     string
+		statusCode int
+		enabled    bool
+		want       bool
+	}{
+		{
+			name:       "Successful POST",
+			method:     http.MethodPost,
+			statusCode: http.StatusCreated,
+			enabled:    true,
+			want:       true,
+		},
+		{
+			name:       "Redirected DELETE",
+			method:     http.MethodDelete,
+			statusCode: http.StatusSeeOther,
+			enabled:    true,
+			want:       true,
+		},
+		{
+			name:       "Failed PUT",
+			method:     http.MethodPut,
+			statusCode: http.StatusBadRequest,
+			enabled:    true,
+			want:       false,
+		},
+		{
+			name:       "Safe method",
+			method:     http.MethodGet,
+			statusCode: http.StatusOK,
+			enabled:    true,
+			want:       false,
+		},
+		{
+			name:       "Disabled",
+			method:     http.MethodPatch,
+			statusCode: http.StatusOK,
+			enabled:    false,
+			want:       false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := &http.Response{
+				StatusCode: tt.statusCode,
+				Request:    httptest.NewRequest(tt.method, "/products/1", nil),
+			}
+			params := cache.Params{Invalidate: cache.InvalidateOptions{Enabled: tt.enabled}}
+
+			assert.Equal(t, tt.want, controller.IsInvalidatingResponse(res, params))
+		})
+	}
+}
+
+func TestInvalidate(t *testing.T) {
+	tests := []struct {
+		name        string
+		header      http.Header
+		options     cache.InvalidateOptions
+		wantPaths   []string
+		wantTags    []string
+		wantDeleted int64
+	}{
+		{
+			name:        "Target URI",
+			header:      http.Header{},
+			wantPaths:   []string{"/products/1?a=1&b=2"},
+			wantDeleted: 1,
+		},
+		{
+			name: "Same origin locations",
+			header: http.Header{
+				"Location":         []string{"/products/2"},
+				"Content-Location": []string{"http://example.com/products/3"},
+			},
+			wantPaths:   []string{"/products/1?a=1&b=2", "/products/2", "/products/3"},
+			wantDeleted: 1,
+		},
+		{
+			name: "Cross origin location",
+			header: http.Header{
+				"Location": []string{"http://other.com/products/2"},
+			},
+			wantPaths:   []string{"/products/1?a=1&b=2"},
+			wantDeleted: 1,
+		},
+		{
+			name: "Configured paths and tags",
+			header: http.Header{
+				cache.PurgeTagsHeader: []string{"products, catalog", "stock"},
+			},
+			options: cache.InvalidateOptions{
+				Paths: []string{"/products?offset=0&limit=10"},
+				Tags:  []string{"listing"},
+			},
+			wantPaths:   []string{"/products/1?a=1&b=2", "/products?limit=10&offset=0"},
+			wantTags:    []string{"listing", "products", "catalog", "stock"},
+			wantDeleted: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cacheRepo := new(mocks.CacheRepo)
+			controller := cache.NewController(cache.Options{NumWorkers: 10, BufferSize: 10}, cacheRepo, log.Log)
+
+			paths := make([]model.CachePath, len(tt.wantPaths))
+			for i, path := range tt.wantPaths {
+				paths[i] = model.CachePath{Service: "catalog", Path: path}
+			}
+			cacheRepo.On("DeleteByFilter", mock.Anything, model.CacheFilter{Paths: paths}).Return(int64(1), nil)
+			if len(tt.wantTags) > 0 {
+				cacheRepo.On("DeleteByFilter", mock.Anything, model.CacheFilter{Service: "catalog", Tags: tt.wantTags}).
+					Return(int64(2), nil)
+			}
+
+			req := httptest.NewRequest(http.MethodPut, "http://example.com/products/1?b=2&a=1", nil)
+			res := &http.Response{StatusCode: http.StatusOK, Header: tt.header, Request: req}
+			params := cache.Params{Service: "catalog", Invalidate: tt.options}
+			params.Invalidate.Enabled = true
+
+			deleted, err := controller.Invalidate(context.Background(), req, res, params)
+
+			assert.Nil(t, err)
+			assert.Equal(t, tt.wantDeleted, deleted)
+			cacheRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestInvalidateError(t *testing.T) {
+	cacheRepo := new(mocks.CacheRepo)
+	controller := cache.NewController(cache.Options{NumWorkers: 10, BufferSize: 10}, cacheRepo, log.Log)
+
+	cacheRepo.On("DeleteByFilter", mock.Anything, mock.Anything).Return(int64(0), errors.New("unavailable")).Once()
+
+	req := httptest.NewRequest(http.MethodDelete, "/products/1", nil)
+	res := &http.Response{
+		StatusCode: http.StatusNoContent,
+		Header:     http.Header{cache.PurgeTagsHeader: []string{"products"}},
+		Request:    req,
+	}
+	params := cache.Params{Service: "catalog", Invalidate: cache.InvalidateOptions{Enabled: true}}
+
+	_, err := controller.Invalidate(context.Background(), req, res, params)
+
+	assert.NotNil(t, err)
+	cacheRepo.AssertNumberOfCalls(t, "DeleteByFilter", 1)
+}
@@ -0,0 +1,162 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/gotway/gotway/internal/model"
+)
+
+// KeyOptions customize which parts of a request identify a cached response
+type KeyOptions struct {
+	Headers            []string
+	Cookies            []string
+	QueryParams        []string
+	IgnoredQueryParams []string
+}
+
+// GetKey builds the cache key of a request: its path, its normalized query
+// and a hash of the headers and cookies the response varies on
+func GetKey(r *http.Request, options KeyOptions) string {
+	key := getPathKey(r.URL, options)
+	if variant := getVariant(r, options); variant != "" {
+		key += model.CacheVariantSeparator + variant
+	}
+	return key
+}
+
+// getPathKey builds the part of a cache key shared by all the variants of a URL
+func getPathKey(u *url.URL, options KeyOptions) string {
+	if query := normalizeQuery(u.Query(), options); query != "" {
+		return u.Path + "?" + query
+	}
+	return u.Path
+}
+
+// normalizePath sorts the query of a path, so it matches the keys built by GetKey
+func normalizePath(path string) string {
+	parts := strings.SplitN(path, "?", 2)
+	if len(parts) < 2 {
+		return path
+	}
+	query, err := url.ParseQuery(parts[1])
+	if err != nil {
+		return path
+	}
+	if normalized := normalizeQuery(query, KeyOptions{}); normalized != "" {
+		return parts[0] + "?" + normalized
+	}
+	return parts[0]
+}
+
+// normalizePaths normalizes the paths of some caches
+func normalizePaths(paths []model.CachePath) []model.CachePath {
+	if paths == nil {
+		return nil
+	}
+	normalized := make([]model.CachePath, len(paths))
+	for i, p := range paths {
+		normalized[i] = model.CachePath{Service: p.Service, Path: normalizePath(p.Path)}
+	}
+	return normalized
+}
+
+// normalizeQuery sorts the query parameters by name, filtering out the ignored ones.
+// Repeated parameters keep the order of their values, as services may depend on it
+func normalizeQuery(query url.Values, options KeyOptions) string {
+	normalized := url.Values{}
+	for name, values := range query {
+		if len(options.QueryParams) > 0 && !containsFold(options.QueryParams, name) {
+			continue
+		}
+		if matchesAny(options.IgnoredQueryParams, name) {
+			continue
+		}
+		normalized[name] = values
+	}
+	// Encode sorts by name
+	return normalized.Encode()
+}
+
+// getVariant hashes the selected headers and cookies, so their values are not exposed in the key
+func getVariant(r *http.Request, options KeyOptions) string {
+	if len(options.Headers) == 0 && len(options.Cookies) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	for _, name := range sorted(lower(options.Headers)) {
+		b.WriteString("h:" + name + "=" + strings.Join(r.Header.Values(name), ",") + "\n")
+	}
+	for _, name := range sorted(options.Cookies) {
+		value := ""
+		if cookie, err := r.Cookie(name); err == nil {
+			value = cookie.Value
+		}
+		b.WriteString("c:" + name + "=" + value + "\n")
+	}
+	sum := sha256.Sum256([]byte(b.String()))
+	return hex.EncodeToString(sum[:8])
+}
+
+// varyAllowed checks that every header the response varies on is part of the key
+func varyAllowed(res *http.Response, options KeyOptions) bool {
+	for _, v := range res.Header.Values("Vary") {
+		for _, field := range strings.Split(v, ",") {
+			field = strings.TrimSpace(field)
+			switch {
+			case field == "":
+				continue
+			case field == "*":
+				return false
+			// the gateway negotiates the encoding with clients by itself
+			case strings.EqualFold(field, "Accept-Encoding"):
+				continue
+			case !containsFold(options.Headers, field):
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func matchesAny(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if strings.HasSuffix(p, "*") {
+			if strings.HasPrefix(name, strings.TrimSuffix(p, "*")) {
+				return true
+			}
+			continue
+		}
+		if p == name {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func lower(values []string) []string {
+	lowered := make([]string, len(values))
+	for i, v := range values {
+		lowered[i] = strings.ToLower(v)
+	}
+	return lowered
+}
+
+func sorted(values []string) []string {
+	s := append([]string(nil), values...)
+	sort.Strings(s)
+	return s
+}
@@ -0,0 +1,125 @@
+package cache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gotway/gotway/internal/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		url     string
+		options KeyOptions
+		wantKey string
+	}{
+		{
+			name:    "Path",
+			url:     "/products",
+			wantKey: "/products",
+		},
+		{
+			name:    "Sorted query",
+			url:     "/products?offset=0&limit=10",
+			wantKey: "/products?limit=10&offset=0",
+		},
+		{
+			name:    "Repeated query param",
+			url:     "/products?sort=price&limit=10&sort=name",
+			wantKey: "/products?limit=10&sort=price&sort=name",
+		},
+		{
+			name:    "Ignored query params",
+			url:     "/products?utm_source=newsletter&utm_medium=email&offset=0&gclid=1",
+			options: KeyOptions{IgnoredQueryParams: []string{"utm_*", "gclid"}},
+			wantKey: "/products?offset=0",
+		},
+		{
+			name:    "Allowed query params",
+			url:     "/products?offset=0&limit=10&session=1234",
+			options: KeyOptions{QueryParams: []string{"offset", "limit"}},
+			wantKey: "/products?limit=10&offset=0",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.url, nil)
+
+			assert.Equal(t, tt.wantKey, GetKey(r, tt.options))
+		})
+	}
+}
+
+func TestGetKeyVariants(t *testing.T) {
+	options := KeyOptions{
+		Headers: []string{"Accept-Language", "X-Tenant-ID"},
+		Cookies: []string{"currency"},
+	}
+	newRequest := func(language, tenant, currency string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/products", nil)
+		r.Header.Set("Accept-Language", language)
+		r.Header.Set("X-Tenant-ID", tenant)
+		r.AddCookie(&http.Cookie{Name: "currency", Value: currency})
+		r.AddCookie(&http.Cookie{Name: "session", Value: "1234"})
+		return r
+	}
+
+	key := GetKey(newRequest("en", "acme", "EUR"), options)
+	assert.True(t, strings.HasPrefix(key, "/products"+model.CacheVariantSeparator))
+	assert.NotContains(t, key, "acme")
+
+	same := newRequest("en", "acme", "EUR")
+	same.AddCookie(&http.Cookie{Name: "tracking", Value: "5678"})
+	assert.Equal(t, key, GetKey(same, options))
+
+	assert.NotEqual(t, key, GetKey(newRequest("es", "acme", "EUR"), options))
+	assert.NotEqual(t, key, GetKey(newRequest("en", "globex", "EUR"), options))
+	assert.NotEqual(t, key, GetKey(newRequest("en", "acme", "USD"), options))
+}
+
+func TestNormalizePath(t *testing.T) {
+	assert.Equal(t, "/products", normalizePath("/products"))
+	assert.Equal(t, "/products?limit=10&offset=0", normalizePath("/products?offset=0&limit=10"))
+}
+
+func TestVaryAllowed(t *testing.T) {
+	options := KeyOptions{Headers: []string{"Accept-Language"}}
+	tests := []struct {
+		name        string
+		vary        []string
+		wantAllowed bool
+	}{
+		{
+			name:        "No vary",
+			wantAllowed: true,
+		},
+		{
+			name:        "Header in key",
+			vary:        []string{"accept-language, Accept-Encoding"},
+			wantAllowed: true,
+		},
+		{
+			name:        "Header not in key",
+			vary:        []string{"Accept-Language", "Authorization"},
+			wantAllowed: false,
+		},
+		{
+			name:        "Vary all",
+			vary:        []string{"*"},
+			wantAllowed: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := &http.Response{Header: http.Header{"Vary": tt.vary}}
+
+			assert.Equal(t, tt.wantAllowed, varyAllowed(res, options))
+		})
+	}
+}
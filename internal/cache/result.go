@@ -0,0 +1,67 @@
+package cache
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+type storeResultKey struct{}
+
+// StoreResult is the outcome of caching the response to a request, which is stored asynchronously.
+// It lets warming know whether a path was actually cached
+type StoreResult struct {
+	mu      sync.Mutex
+	pending bool
+	done    chan error
+}
+
+// WithStoreResult tracks whether the response to a request is cached
+func WithStoreResult(r *http.Request) (*http.Request, *StoreResult) {
+	result := &StoreResult{done: make(chan error, 1)}
+	return r.WithContext(context.WithValue(r.Context(), storeResultKey{}, result)), result
+}
+
+func getStoreResult(r *http.Request) *StoreResult {
+	result, _ := r.Context().Value(storeResultKey{}).(*StoreResult)
+	return result
+}
+
+// Wait waits until the response is cached and returns why it was not, if it was not.
+// Responses that were not meant to be cached return immediately
+func (s *StoreResult) Wait(ctx context.Context) error {
+	s.mu.Lock()
+	pending := s.pending
+	s.mu.Unlock()
+	if !pending {
+		return nil
+	}
+	select {
+	case err := <-s.done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// expect marks the response as meant to be cached
+func (s *StoreResult) expect() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.pending = true
+	s.mu.Unlock()
+}
+
+// complete records the outcome of caching the response, nil meaning it was stored
+func (s *StoreResult) complete(err error) {
+	if s == nil {
+		return
+	}
+	s.expect()
+	select {
+	case s.done <- err:
+	default:
+	}
+}
@@ -21,10 +21,122 @@ type HealthCheck struct {
 	Timeout    time.Duration
 }
 
+type RedisTLS struct {
+	Enabled            bool
+	CA                 string
+	Cert               string
+	Key                string
+	ServerName         string
+	InsecureSkipVerify bool
+}
+
+type Redis struct {
+	Mode             string
+	URL              string
+	Addrs            []string
+	MasterName       string
+	Username         string
+	Password         string
+	SentinelPassword string
+	DB               int
+	TLS              RedisTLS
+}
+
+const (
+	CacheBackendRedis  = "redis"
+	CacheBackendMemory = "memory"
+	CacheBackendDisk   = "disk"
+)
+
+type CacheDisk struct {
+	Path          string
+	SweepInterval time.Duration
+}
+
+type CacheCompression struct {
+	Enabled bool
+	MinSize int
+}
+
+type CacheMemory struct {
+	Enabled  bool
+	MaxBytes int64
+	Eviction string
+}
+
+type CacheDebug struct {
+	Enabled    bool
+	TrustedIPs []string
+}
+
+type CacheLimits struct {
+	MaxEntryBytes     int64
+	ServiceMaxBytes   int64
+	ServiceMaxEntries int64
+	MaxBytes          int64
+}
+
+type CacheWarming struct {
+	Enabled         bool
+	Interval        time.Duration
+	RefreshBefore   time.Duration
+	SitemapInterval time.Duration
+	Timeout         time.Duration
+	Concurrency     int
+}
+
+type CacheInvalidation struct {
+	ClaimTimeout time.Duration
+}
+
 type Cache struct {
+	Enabled               bool
+	Backend               string
+	NumWorkers            int
+	BufferSize            int
+	QueuePolicy           string
+	QueueTimeout          time.Duration
+	ShutdownTimeout       time.Duration
+	RevalidationWindow    time.Duration
+	Coalescing            bool
+	DistributedCoalescing bool
+	LockTimeout           time.Duration
+	InvalidateTimeout     time.Duration
+	Memory                CacheMemory
+	Disk                  CacheDisk
+	Compression           CacheCompression
+	Debug                 CacheDebug
+	Limits                CacheLimits
+	Warming               CacheWarming
+	Invalidation          CacheInvalidation
+}
+
+type Limits struct {
+	MaxRequestBodyBytes int64
+	MaxHeaderBytes      int64
+	MaxURLLength        int64
+}
+
+type Compression struct {
+	Enabled      bool
+	MinSize      int64
+	ContentTypes []string
+	Level        int
+}
+
+type Errors struct {
+	Format            string
+	TemplateConfigMap string
+	TemplateKey       string
+	InterceptUpstream bool
+}
+
+type AccessLog struct {
 	Enabled    bool
-	NumWorkers int
-	BufferSize int
+	Format     string
+	Template   string
+	Output     string
+	SampleRate float64
 }
 
 type TLS struct {
@@ -39,6 +151,15 @@ type Metrics struct {
 	Port    string
 }
 
+type Tracing struct {
+	Enabled      bool
+	Exporter     string
+	Endpoint     string
+	Insecure     bool
+	Sampler      string
+	SamplerRatio float64
+}
+
 type PProf struct {
 	Enabled bool
 	Port    string
@@ -48,14 +169,19 @@ type Config struct {
 	Port           string
 	Env            string
 	LogLevel       string
-	RedisUrl       string
 	GatewayTimeout time.Duration
 
+	Redis       Redis
 	Kubernetes  Kubernetes
+	Limits      Limits
+	Compression Compression
+	Errors      Errors
+	AccessLog   AccessLog
 	TLS         TLS
 	HealthCheck HealthCheck
 	Cache       Cache
 	Metrics     Metrics
+	Tracing     Tracing
 	PProf       PProf
 }
 
@@ -64,14 +190,62 @@ func GetConfig() (Config, error) {
 		Port:           env.Get("PORT", "9111"),
 		Env:            env.Get("ENV", "local"),
 		LogLevel:       env.Get("LOG_LEVEL", "debug"),
-		RedisUrl:       env.Get("REDIS_URL", "redis://localhost:6379/11"),
 		GatewayTimeout: env.GetDuration("GATEWAY_TIMEOUT_SECONDS", 5) * time.Second,
 
+		Redis: Redis{
+			Mode:             env.Get("REDIS_MODE", "standalone"),
+			URL:              env.Get("REDIS_URL", "redis://localhost:6379/11"),
+			Addrs:            env.GetStringSlice("REDIS_ADDRS", nil),
+			MasterName:       env.Get("REDIS_MASTER_NAME", ""),
+			Username:         env.Get("REDIS_USERNAME", ""),
+			Password:         env.Get("REDIS_PASSWORD", ""),
+			SentinelPassword: env.Get("REDIS_SENTINEL_PASSWORD", ""),
+			DB:               env.GetInt("REDIS_DB", 0),
+			TLS: RedisTLS{
+				Enabled:            env.GetBool("REDIS_TLS", false),
+				CA:                 env.Get("REDIS_TLS_CA", ""),
+				Cert:               env.Get("REDIS_TLS_CERT", ""),
+				Key:                env.Get("REDIS_TLS_KEY", ""),
+				ServerName:         env.Get("REDIS_TLS_SERVER_NAME", ""),
+				InsecureSkipVerify: env.GetBool("REDIS_TLS_INSECURE_SKIP_VERIFY", false),
+			},
+		},
+
 		Kubernetes: Kubernetes{
 			KubeConfig:   env.Get("KUBECONFIG", ""),
 			Namespace:    env.Get("KUBERNETES_NAMESPACE", "default"),
 			ResyncPeriod: env.GetDuration("KUBERNETES_RESYNC_PERIOD_SECONDS", 5) * time.Second,
 		},
+		Limits: Limits{
+			MaxRequestBodyBytes: int64(env.GetInt("MAX_REQUEST_BODY_BYTES", 0)),
+			MaxHeaderBytes:      int64(env.GetInt("MAX_HEADER_BYTES", 1<<20)),
+			MaxURLLength:        int64(env.GetInt("MAX_URL_LENGTH", 0)),
+		},
+		Compression: Compression{
+			Enabled: env.GetBool("COMPRESSION", false),
+			MinSize: int64(env.GetInt("COMPRESSION_MIN_SIZE", 1024)),
+			ContentTypes: env.GetStringSlice("COMPRESSION_CONTENT_TYPES", []string{
+				"application/json",
+				"application/javascript",
+				"application/xml",
+				"image/svg+xml",
+				"text/*",
+			}),
+			Level: env.GetInt("COMPRESSION_LEVEL", 0),
+		},
+		Errors: Errors{
+			Format:            env.Get("ERROR_FORMAT", "text"),
+			TemplateConfigMap: env.Get("ERROR_TEMPLATE_CONFIGMAP", ""),
+			TemplateKey:       env.Get("ERROR_TEMPLATE_KEY", "error.html"),
+			InterceptUpstream: env.GetBool("ERROR_INTERCEPT_UPSTREAM", false),
+		},
+		AccessLog: AccessLog{
+			Enabled:    env.GetBool("ACCESS_LOG", true),
+			Format:     env.Get("ACCESS_LOG_FORMAT", "json"),
+			Template:   env.Get("ACCESS_LOG_TEMPLATE", ""),
+			Output:     env.Get("ACCESS_LOG_OUTPUT", "stdout"),
+			SampleRate: env.GetFloat64("ACCESS_LOG_SAMPLE_RATE", 1),
+		},
 		TLS: TLS{
 			Enabled: env.GetBool("TLS_ENABLED", true),
 			Cert:    env.Get("TLS_CERT", tlstest.Cert()),
@@ -85,15 +259,66 @@ func GetConfig() (Config, error) {
 			Timeout:    env.GetDuration("HEALTH_CHECK_TIMEOUT_SECONDS", 5) * time.Second,
 		},
 		Cache: Cache{
-			Enabled:    env.GetBool("CACHE", true),
-			NumWorkers: env.GetInt("CACHE_NUM_WORKERS", 10),
-			BufferSize: env.GetInt("CACHE_BUFFER_SIZE", 10),
+			Enabled:               env.GetBool("CACHE", true),
+			Backend:               env.Get("CACHE_BACKEND", CacheBackendRedis),
+			NumWorkers:            env.GetInt("CACHE_NUM_WORKERS", 10),
+			BufferSize:            env.GetInt("CACHE_BUFFER_SIZE", 10),
+			QueuePolicy:           env.Get("CACHE_QUEUE_POLICY", "drop"),
+			QueueTimeout:          env.GetDuration("CACHE_QUEUE_TIMEOUT_MILLISECONDS", 100) * time.Millisecond,
+			ShutdownTimeout:       env.GetDuration("CACHE_SHUTDOWN_TIMEOUT_SECONDS", 10) * time.Second,
+			RevalidationWindow:    env.GetDuration("CACHE_REVALIDATION_WINDOW_SECONDS", 600) * time.Second,
+			Coalescing:            env.GetBool("CACHE_COALESCING", true),
+			DistributedCoalescing: env.GetBool("CACHE_COALESCING_DISTRIBUTED", false),
+			LockTimeout:           env.GetDuration("CACHE_COALESCING_LOCK_TIMEOUT_SECONDS", 5) * time.Second,
+			InvalidateTimeout:     env.GetDuration("CACHE_INVALIDATE_TIMEOUT_SECONDS", 5) * time.Second,
+			Memory: CacheMemory{
+				Enabled:  env.GetBool("CACHE_MEMORY", false),
+				MaxBytes: int64(env.GetInt("CACHE_MEMORY_MAX_BYTES", 64<<20)),
+				Eviction: env.Get("CACHE_MEMORY_EVICTION", "lru"),
+			},
+			Compression: CacheCompression{
+				Enabled: env.GetBool("CACHE_COMPRESSION", false),
+				MinSize: env.GetInt("CACHE_COMPRESSION_MIN_SIZE", 1024),
+			},
+			Disk: CacheDisk{
+				Path:          env.Get("CACHE_DISK_PATH", "/var/lib/gotway/cache.db"),
+				SweepInterval: env.GetDuration("CACHE_DISK_SWEEP_INTERVAL_SECONDS", 60) * time.Second,
+			},
+			Debug: CacheDebug{
+				Enabled:    env.GetBool("CACHE_DEBUG", false),
+				TrustedIPs: env.GetStringSlice("CACHE_DEBUG_TRUSTED_IPS", nil),
+			},
+			Limits: CacheLimits{
+				MaxEntryBytes:     int64(env.GetInt("CACHE_MAX_ENTRY_BYTES", 0)),
+				ServiceMaxBytes:   int64(env.GetInt("CACHE_SERVICE_MAX_BYTES", 0)),
+				ServiceMaxEntries: int64(env.GetInt("CACHE_SERVICE_MAX_ENTRIES", 0)),
+				MaxBytes:          int64(env.GetInt("CACHE_MAX_BYTES", 0)),
+			},
+			Warming: CacheWarming{
+				Enabled:         env.GetBool("CACHE_WARMING", true),
+				Interval:        env.GetDuration("CACHE_WARMING_INTERVAL_SECONDS", 30) * time.Second,
+				RefreshBefore:   env.GetDuration("CACHE_WARMING_REFRESH_BEFORE_SECONDS", 10) * time.Second,
+				SitemapInterval: env.GetDuration("CACHE_WARMING_SITEMAP_INTERVAL_SECONDS", 600) * time.Second,
+				Timeout:         env.GetDuration("CACHE_WARMING_TIMEOUT_SECONDS", 10) * time.Second,
+				Concurrency:     env.GetInt("CACHE_WARMING_CONCURRENCY", 2),
+			},
+			Invalidation: CacheInvalidation{
+				ClaimTimeout: env.GetDuration("CACHE_INVALIDATION_CLAIM_TIMEOUT_SECONDS", 300) * time.Second,
+			},
 		},
 		Metrics: Metrics{
 			Enabled: env.GetBool("METRICS", true),
 			Path:    env.Get("METRICS_PATH", "/metrics"),
 			Port:    env.Get("METRICS_PORT", "2112"),
 		},
+		Tracing: Tracing{
+			Enabled:      env.GetBool("TRACING", false),
+			Exporter:     env.Get("TRACING_EXPORTER", "otlp"),
+			Endpoint:     env.Get("TRACING_OTLP_ENDPOINT", "localhost:4317"),
+			Insecure:     env.GetBool("TRACING_OTLP_INSECURE", true),
+			Sampler:      env.Get("TRACING_SAMPLER", "traceidratio"),
+			SamplerRatio: env.GetFloat64("TRACING_SAMPLER_RATIO", 1),
+		},
 		PProf: PProf{
 			Enabled: env.GetBool("PPROF", false),
 			Port:    env.Get("PPROF_PORT", "6060"),
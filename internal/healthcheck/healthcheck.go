@@ -9,8 +9,11 @@ import (
 	kubernetesCtrl "github.com/gotway/gotway/pkg/kubernetes/controller"
 	crdv1alpha1 "github.com/gotway/gotway/pkg/kubernetes/crd/v1alpha1"
 	"github.com/gotway/gotway/pkg/log"
+	"github.com/gotway/gotway/pkg/metrics"
 )
 
+const healthQueue = "health"
+
 type Options struct {
 	CheckInterval time.Duration
 	Timeout       time.Duration
@@ -49,6 +52,7 @@ func (c *Controller) Start(ctx context.Context) {
 			}
 			for _, s := range services {
 				c.pendingHealth <- s
+				metrics.QueueDepth.WithLabelValues(healthQueue).Set(float64(len(c.pendingHealth)))
 			}
 		}
 	}
@@ -60,6 +64,7 @@ func (c *Controller) checkServices(ctx context.Context) {
 		case <-ctx.Done():
 			return
 		case service := <-c.pendingHealth:
+			metrics.QueueDepth.WithLabelValues(healthQueue).Set(float64(len(c.pendingHealth)))
 			c.updateService(ctx, service)
 		}
 	}
@@ -85,6 +90,7 @@ func (c *Controller) updateService(ctx context.Context, ingress crdv1alpha1.Ingr
 	}
 
 	healthy, err := c.client.healthCheck(healthURL)
+	observeHealth(ingress.Spec.Service.Name, healthy && err == nil)
 	if err != nil {
 		c.logger.Errorf("error performing health check in service '%s': %v", ingress.Spec.Service.Name, err)
 		updateIngressStatus(false)
@@ -97,6 +103,17 @@ func (c *Controller) updateService(ctx context.Context, ingress crdv1alpha1.Ingr
 	updateIngressStatus(healthy)
 }
 
+func observeHealth(service string, healthy bool) {
+	result := "unhealthy"
+	value := 0.0
+	if healthy {
+		result = "healthy"
+		value = 1
+	}
+	metrics.HealthChecks.WithLabelValues(service, result).Inc()
+	metrics.ServiceHealthy.WithLabelValues(service).Set(value)
+}
+
 func getHealthUrl(ingress crdv1alpha1.IngressHTTP) (*url.URL, error) {
 	healthPath := ingress.Spec.Service.HealthPath
 	if healthPath == "" {
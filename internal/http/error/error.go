@@ -9,26 +9,49 @@ import (
 	"github.com/gotway/gotway/pkg/log"
 )
 
-func Handle(err error, w http.ResponseWriter, logger log.Logger) {
+var statusErrors = []struct {
+	status int
+	errors []error
+}{
+	{
+		status: http.StatusBadRequest,
+		errors: []error{model.ErrInvalidDeleteCache, model.ErrInvalidCachePage, model.ErrInvalidCacheCursor},
+	},
+	{
+		status: http.StatusNotFound,
+		errors: []error{model.ErrCacheNotFound, kubeCtrl.ErrIngressNotFound},
+	},
+	{
+		status: http.StatusRequestEntityTooLarge,
+		errors: []error{model.ErrRequestBodyTooLarge},
+	},
+	{
+		status: http.StatusRequestURITooLong,
+		errors: []error{model.ErrURITooLong},
+	},
+	{
+		status: http.StatusUnsupportedMediaType,
+		errors: []error{model.ErrUnsupportedMediaType},
+	},
+	{
+		status: http.StatusRequestHeaderFieldsTooLarge,
+		errors: []error{model.ErrRequestHeaderFieldsTooLarge},
+	},
+	{
+		status: http.StatusGatewayTimeout,
+		errors: []error{model.ErrOnlyIfCached},
+	},
+}
+
+func Handle(err error, w http.ResponseWriter, r *http.Request, logger log.Logger) {
 	logger.Error(err)
-	badRequestErrors := []error{
-		model.ErrInvalidDeleteCache,
-	}
-	notFoundErrors := []error{
-		model.ErrCacheNotFound,
-		kubeCtrl.ErrIngressNotFound,
-	}
-	for _, e := range badRequestErrors {
-		if errors.Is(err, e) {
-			http.Error(w, e.Error(), http.StatusBadRequest)
-			return
-		}
-	}
-	for _, e := range notFoundErrors {
-		if errors.Is(err, e) {
-			http.Error(w, e.Error(), http.StatusNotFound)
-			return
+	for _, s := range statusErrors {
+		for _, e := range s.errors {
+			if errors.Is(err, e) {
+				Write(w, r, s.status, e.Error())
+				return
+			}
 		}
 	}
-	http.Error(w, "Internal server error", http.StatusInternalServerError)
+	Write(w, r, http.StatusInternalServerError, "Internal server error")
 }
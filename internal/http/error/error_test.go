@@ -0,0 +1,164 @@
+package error
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gotway/gotway/internal/model"
+	"github.com/gotway/gotway/internal/requestcontext"
+	"github.com/gotway/gotway/pkg/log"
+	"github.com/stretchr/testify/assert"
+
+	crdv1alpha1 "github.com/gotway/gotway/pkg/kubernetes/crd/v1alpha1"
+)
+
+func TestHandle(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "Not found",
+			err:        model.ErrCacheNotFound,
+			wantStatus: http.StatusNotFound,
+			wantBody:   "Cache not found\n",
+		},
+		{
+			name:       "Wrapped error",
+			err:        fmt.Errorf("reading body: %w", model.ErrRequestBodyTooLarge),
+			wantStatus: http.StatusRequestEntityTooLarge,
+			wantBody:   "Request body too large\n",
+		},
+		{
+			name:       "Only if cached",
+			err:        model.ErrOnlyIfCached,
+			wantStatus: http.StatusGatewayTimeout,
+			wantBody:   "No cached response available\n",
+		},
+		{
+			name:       "Unknown error",
+			err:        errors.New("redis is down"),
+			wantStatus: http.StatusInternalServerError,
+			wantBody:   "Internal server error\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/products", nil)
+
+			Handle(tt.err, rec, req, log.Log)
+
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			assert.Equal(t, tt.wantBody, rec.Body.String())
+		})
+	}
+}
+
+func TestRenderProblem(t *testing.T) {
+	renderer := NewRenderer(Options{Format: FormatJSON}, nil, log.Log)
+	req := httptest.NewRequest(http.MethodGet, "/products", nil)
+	req = requestcontext.WithRequestID(req, "1234")
+	req = WithRenderer(req, renderer)
+	rec := httptest.NewRecorder()
+
+	Write(rec, req, http.StatusServiceUnavailable, "service not available")
+
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, "application/problem+json", rec.Header().Get("Content-Type"))
+	var problem Problem
+	assert.Nil(t, json.NewDecoder(rec.Body).Decode(&problem))
+	assert.Equal(t, Problem{
+		Type:      "about:blank",
+		Title:     "Service Unavailable",
+		Status:    http.StatusServiceUnavailable,
+		Detail:    "service not available",
+		Instance:  "/products",
+		RequestID: "1234",
+	}, problem)
+}
+
+func TestRenderIngressOptions(t *testing.T) {
+	intercept := true
+	renderer := NewRenderer(Options{Format: FormatJSON}, nil, log.Log)
+	req := httptest.NewRequest(http.MethodGet, "/products", nil)
+	req = WithRenderer(req, renderer)
+	req = requestcontext.WithIngress(req, crdv1alpha1.IngressHTTP{
+		Spec: crdv1alpha1.IngressHTTPSpec{
+			Errors: &crdv1alpha1.Errors{
+				Format:            FormatText,
+				InterceptUpstream: &intercept,
+			},
+		},
+	})
+	rec := httptest.NewRecorder()
+
+	Write(rec, req, http.StatusBadGateway, "error requesting service")
+
+	assert.Equal(t, http.StatusBadGateway, rec.Code)
+	assert.Equal(t, "error requesting service\n", rec.Body.String())
+	assert.True(t, InterceptsUpstream(req))
+}
+
+func TestInterceptsUpstream(t *testing.T) {
+	enabled, disabled := true, false
+	tests := []struct {
+		name   string
+		global bool
+		errors *crdv1alpha1.Errors
+		want   bool
+	}{
+		{
+			name:   "Global",
+			global: true,
+			want:   true,
+		},
+		{
+			name:   "Ingress without the setting",
+			global: true,
+			errors: &crdv1alpha1.Errors{Format: FormatJSON},
+			want:   true,
+		},
+		{
+			name:   "Disabled by ingress",
+			global: true,
+			errors: &crdv1alpha1.Errors{InterceptUpstream: &disabled},
+			want:   false,
+		},
+		{
+			name:   "Enabled by ingress",
+			errors: &crdv1alpha1.Errors{InterceptUpstream: &enabled},
+			want:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			renderer := NewRenderer(Options{InterceptUpstream: tt.global}, nil, log.Log)
+			req := WithRenderer(httptest.NewRequest(http.MethodGet, "/products", nil), renderer)
+			req = requestcontext.WithIngress(req, crdv1alpha1.IngressHTTP{
+				Spec: crdv1alpha1.IngressHTTPSpec{Errors: tt.errors},
+			})
+
+			assert.Equal(t, tt.want, InterceptsUpstream(req))
+		})
+	}
+}
+
+func TestRenderHTMLFallback(t *testing.T) {
+	renderer := NewRenderer(Options{Format: FormatHTML}, nil, log.Log)
+	req := WithRenderer(httptest.NewRequest(http.MethodGet, "/products", nil), renderer)
+	rec := httptest.NewRecorder()
+
+	Write(rec, req, http.StatusNotFound, "ingress not found")
+
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Equal(t, "application/problem+json", rec.Header().Get("Content-Type"))
+}
@@ -0,0 +1,196 @@
+package error
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"net/http"
+	"sync"
+
+	"github.com/gotway/gotway/internal/requestcontext"
+	"github.com/gotway/gotway/pkg/kubernetes/configmap"
+	"github.com/gotway/gotway/pkg/log"
+)
+
+const (
+	// FormatText writes errors as plain text
+	FormatText = "text"
+	// FormatJSON writes errors as RFC 7807 application/problem+json documents
+	FormatJSON = "json"
+	// FormatHTML renders errors using an HTML template stored in a ConfigMap
+	FormatHTML = "html"
+)
+
+type TemplateRef struct {
+	Namespace string
+	Name      string
+	Key       string
+}
+
+// Options are the global error settings, they apply when an ingress does not define its own
+type Options struct {
+	Format            string
+	Template          TemplateRef
+	InterceptUpstream bool
+}
+
+// Problem is an RFC 7807 problem details document
+type Problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Instance  string `json:"instance,omitempty"`
+	RequestID string `json:"requestId,omitempty"`
+}
+
+// Renderer writes error responses in the format configured globally or by the matched ingress
+type Renderer struct {
+	options    Options
+	configMaps *configmap.Store
+	templates  sync.Map
+	logger     log.Logger
+}
+
+type rendererContextKey struct{}
+
+// WithRenderer attaches a renderer to the request, errors handled
+// without a renderer are written as plain text
+func WithRenderer(r *http.Request, renderer *Renderer) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), rendererContextKey{}, renderer))
+}
+
+func getRenderer(r *http.Request) (*Renderer, bool) {
+	if r == nil {
+		return nil, false
+	}
+	renderer, ok := r.Context().Value(rendererContextKey{}).(*Renderer)
+	return renderer, ok && renderer != nil
+}
+
+// Write writes an error response with a status and a detail message
+func Write(w http.ResponseWriter, r *http.Request, status int, detail string) {
+	renderer, ok := getRenderer(r)
+	if !ok {
+		http.Error(w, detail, status)
+		return
+	}
+	renderer.Render(w, r, status, detail)
+}
+
+// InterceptsUpstream determines if upstream server errors should be replaced
+func InterceptsUpstream(r *http.Request) bool {
+	renderer, ok := getRenderer(r)
+	if !ok {
+		return false
+	}
+	return renderer.getOptions(r).InterceptUpstream
+}
+
+// Render writes an error response in the configured format
+func (rd *Renderer) Render(w http.ResponseWriter, r *http.Request, status int, detail string) {
+	options := rd.getOptions(r)
+	problem := Problem{
+		Type:     "about:blank",
+		Title:    http.StatusText(status),
+		Status:   status,
+		Detail:   detail,
+		Instance: r.URL.Path,
+	}
+	if requestID, err := requestcontext.GetRequestID(r); err == nil {
+		problem.RequestID = requestID
+	}
+
+	switch options.Format {
+	case FormatJSON:
+		writeProblem(w, problem)
+	case FormatHTML:
+		if err := rd.writeHTML(w, problem, options.Template); err != nil {
+			requestcontext.Logger(r, rd.logger).Error("error rendering error template ", err)
+			writeProblem(w, problem)
+		}
+	default:
+		http.Error(w, detail, status)
+	}
+}
+
+func (rd *Renderer) getOptions(r *http.Request) Options {
+	options := rd.options
+	ingress, err := requestcontext.GetIngress(r)
+	if err != nil || ingress.Spec.Errors == nil {
+		return options
+	}
+	settings := ingress.Spec.Errors
+	if settings.Format != "" {
+		options.Format = settings.Format
+	}
+	if settings.TemplateRef != nil {
+		options.Template = TemplateRef{
+			Namespace: ingress.Namespace,
+			Name:      settings.TemplateRef.Name,
+			Key:       settings.TemplateRef.Key,
+		}
+	}
+	if settings.InterceptUpstream != nil {
+		options.InterceptUpstream = *settings.InterceptUpstream
+	}
+	return options
+}
+
+func (rd *Renderer) writeHTML(w http.ResponseWriter, problem Problem, ref TemplateRef) error {
+	if rd.configMaps == nil {
+		return errors.New("configmaps are not available")
+	}
+	source, err := rd.configMaps.Get(ref.Namespace, ref.Name, ref.Key)
+	if err != nil {
+		return err
+	}
+	tmpl, err := rd.getTemplate(source)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, problem); err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(problem.Status)
+	_, _ = buf.WriteTo(w)
+	return nil
+}
+
+// getTemplate returns a parsed template, templates are cached by their source
+func (rd *Renderer) getTemplate(source string) (*template.Template, error) {
+	if tmpl, ok := rd.templates.Load(source); ok {
+		return tmpl.(*template.Template), nil
+	}
+	tmpl, err := template.New("error").Parse(source)
+	if err != nil {
+		return nil, err
+	}
+	rd.templates.Store(source, tmpl)
+	return tmpl, nil
+}
+
+func writeProblem(w http.ResponseWriter, problem Problem) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(problem.Status)
+	_ = json.NewEncoder(w).Encode(problem)
+}
+
+func NewRenderer(
+	options Options,
+	configMaps *configmap.Store,
+	logger log.Logger,
+) *Renderer {
+	return &Renderer{
+		options:    options,
+		configMaps: configMaps,
+		logger:     logger,
+	}
+}
@@ -4,27 +4,36 @@ import (
 	"encoding/json"
 	"io/ioutil"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 
 	"github.com/gotway/gotway/internal/cache"
 	httpError "github.com/gotway/gotway/internal/http/error"
 	"github.com/gotway/gotway/internal/model"
 	"github.com/gotway/gotway/internal/requestcontext"
+	"github.com/gotway/gotway/internal/warming"
 	"github.com/gotway/gotway/pkg/log"
 
 	kubeCtrl "github.com/gotway/gotway/pkg/kubernetes/controller"
 )
 
+const (
+	defaultCachePageLimit = 100
+	maxCachePageLimit     = 1000
+)
+
 type handler struct {
-	kubeCtrl  *kubeCtrl.Controller
-	cacheCtrl cache.Controller
-	logger    log.Logger
+	kubeCtrl    *kubeCtrl.Controller
+	cacheCtrl   cache.Controller
+	warmingCtrl *warming.Controller
+	logger      log.Logger
 }
 
 func (h *handler) getIngresses(w http.ResponseWriter, r *http.Request) {
 	ingresses, err := h.kubeCtrl.ListIngresses()
 	if err != nil {
-		httpError.Handle(err, w, h.logger)
+		httpError.Handle(err, w, r, h.logger)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -37,53 +46,149 @@ func (h *handler) deleteCache(w http.ResponseWriter, r *http.Request) {
 	var payload model.DeleteCache
 	err := decoded.Decode(&payload)
 	if err != nil {
-		http.Error(w, model.ErrInvalidDeleteCache.Error(), http.StatusBadRequest)
+		httpError.Write(w, r, http.StatusBadRequest, model.ErrInvalidDeleteCache.Error())
 		return
 	}
 
 	err = payload.Validate()
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		httpError.Write(w, r, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	if len(payload.Paths) > 0 {
-		err := h.cacheCtrl.DeleteCacheByPath(payload.Paths)
+	// exact paths keep failing when any of them is not cached
+	if payload.OnlyPaths() {
+		err := h.cacheCtrl.DeleteCacheByPath(r.Context(), payload.Paths)
 		if err != nil {
 			if _, ok := err.(*model.ErrCachePathNotFound); ok {
-				http.Error(w, err.Error(), http.StatusNotFound)
+				httpError.Write(w, r, http.StatusNotFound, err.Error())
 				return
 			}
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			httpError.Handle(err, w, r, h.logger)
 			return
 		}
+		w.WriteHeader(http.StatusOK)
+		return
 	}
 
-	if len(payload.Tags) > 0 {
-		err := h.cacheCtrl.DeleteCacheByTags(payload.Tags)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+	var deleted int64
+	if payload.OnlyTags() {
+		deleted, err = h.cacheCtrl.DeleteCacheByTags(r.Context(), payload.Tags)
+	} else {
+		deleted, err = h.cacheCtrl.DeleteCacheByFilter(r.Context(), payload.Filter())
+	}
+	if err != nil {
+		httpError.Handle(err, w, r, h.logger)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(model.DeleteCacheResult{Deleted: deleted})
+}
+
+func (h *handler) getCacheWarming(w http.ResponseWriter, r *http.Request) {
+	status := []model.CacheWarming{}
+	if h.warmingCtrl != nil {
+		status = h.warmingCtrl.Status()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(status)
+}
+
+// refreshCacheWarming warms every path again in the background, for instance after flushing the cache
+func (h *handler) refreshCacheWarming(w http.ResponseWriter, r *http.Request) {
+	if h.warmingCtrl == nil {
+		httpError.Write(w, r, http.StatusNotFound, "cache warming is disabled")
+		return
+	}
+	h.warmingCtrl.Refresh()
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (h *handler) listCache(w http.ResponseWriter, r *http.Request) {
+	filter, page, err := parseCacheQuery(r.URL.Query())
+	if err != nil {
+		httpError.Write(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	list, err := h.cacheCtrl.FindCache(r.Context(), filter, page)
+	if err != nil {
+		httpError.Handle(err, w, r, h.logger)
+		return
+	}
+	// headers are only shown when inspecting the caches of a path
+	if len(filter.Paths) == 0 {
+		for i := range list.Items {
+			list.Items[i].Headers = nil
 		}
 	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(list)
+}
 
-	w.WriteHeader(http.StatusOK)
+func (h *handler) countCache(w http.ResponseWriter, r *http.Request) {
+	filter, _, err := parseCacheQuery(r.URL.Query())
+	if err != nil {
+		httpError.Write(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	count, err := h.cacheCtrl.CountCache(r.Context(), filter)
+	if err != nil {
+		httpError.Handle(err, w, r, h.logger)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(count)
+}
+
+// parseCacheQuery reads the filter and page of the cache API from a query
+func parseCacheQuery(query url.Values) (model.CacheFilter, model.CachePage, error) {
+	filter := model.CacheFilter{
+		Tags:    query["tag"],
+		Service: query.Get("service"),
+		Prefix:  query.Get("prefix"),
+		Pattern: query.Get("pattern"),
+	}
+	if path := query.Get("path"); path != "" {
+		if filter.Service == "" {
+			return model.CacheFilter{}, model.CachePage{}, model.ErrInvalidCacheQuery
+		}
+		filter.Paths = []model.CachePath{{Service: filter.Service, Path: path}}
+	}
+	if err := filter.Validate(); err != nil {
+		return model.CacheFilter{}, model.CachePage{}, err
+	}
+
+	page := model.CachePage{Cursor: query.Get("cursor"), Limit: defaultCachePageLimit}
+	var err error
+	if limit := query.Get("limit"); limit != "" {
+		if page.Limit, err = strconv.Atoi(limit); err != nil || page.Limit < 1 || page.Limit > maxCachePageLimit {
+			return model.CacheFilter{}, model.CachePage{}, model.ErrInvalidCachePage
+		}
+	}
+	return filter, page, nil
 }
 
 func (h *handler) writeResponse(w http.ResponseWriter, r *http.Request) {
+	logger := requestcontext.Logger(r, h.logger)
 	res, err := requestcontext.GetResponse(r)
 	if err != nil {
-		httpError.Handle(err, w, h.logger)
+		httpError.Handle(err, w, r, logger)
 		return
 	}
 
 	bytes, err := ioutil.ReadAll(res.Body)
 	if err != nil {
-		httpError.Handle(err, w, h.logger)
+		httpError.Handle(err, w, r, logger)
+		return
+	}
+
+	if res.StatusCode >= http.StatusInternalServerError && httpError.InterceptsUpstream(r) {
+		logger.Debug("intercepting upstream error")
+		httpError.Write(w, r, res.StatusCode, "error in upstream service")
 		return
 	}
 
-	h.logger.Debug("write response")
+	logger.Debug("write response")
 	for key, header := range res.Header {
 		w.Header().Set(key, strings.Join(header[:], ","))
 	}
@@ -94,12 +199,14 @@ func (h *handler) writeResponse(w http.ResponseWriter, r *http.Request) {
 func newHandler(
 	kubeCtrl *kubeCtrl.Controller,
 	cacheController cache.Controller,
+	warmingCtrl *warming.Controller,
 	logger log.Logger,
 ) *handler {
 
 	return &handler{
-		kubeCtrl:  kubeCtrl,
-		cacheCtrl: cacheController,
-		logger:    logger,
+		kubeCtrl:    kubeCtrl,
+		cacheCtrl:   cacheController,
+		warmingCtrl: warmingCtrl,
+		logger:      logger,
 	}
 }
@@ -6,13 +6,17 @@ import (
 
 	"github.com/gorilla/mux"
 	"github.com/gotway/gotway/internal/cache"
+	httpError "github.com/gotway/gotway/internal/http/error"
 	"github.com/gotway/gotway/internal/middleware"
+	"github.com/gotway/gotway/internal/middleware/errorpage"
+	"github.com/gotway/gotway/internal/warming"
 	kubeCtrl "github.com/gotway/gotway/pkg/kubernetes/controller"
 	"github.com/gotway/gotway/pkg/log"
 )
 
 type ServerOptions struct {
-	Port string
+	Port           string
+	MaxHeaderBytes int
 
 	TLSenabled bool
 	TLScert    string
@@ -20,11 +24,12 @@ type ServerOptions struct {
 }
 
 type Server struct {
-	options     ServerOptions
-	server      *http.Server
-	handler     *handler
-	middlewares []middleware.Middleware
-	logger      log.Logger
+	options       ServerOptions
+	server        *http.Server
+	handler       *handler
+	middlewares   []middleware.Middleware
+	errorRenderer *httpError.Renderer
+	logger        log.Logger
 }
 
 func (s *Server) Start() {
@@ -60,11 +65,17 @@ func (s *Server) createRouter() *mux.Router {
 
 func (s *Server) addApiRouter(root *mux.Router) {
 	api := root.PathPrefix("/api").Subrouter()
+	// errors are rendered in the format of the gateway
+	api.Use(errorpage.New(s.errorRenderer, s.logger.WithField("middleware", "error-page")).MiddlewareFunc)
 	api.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 	}).Methods(http.MethodGet)
 	api.HandleFunc("/ingresses", s.handler.getIngresses).Methods(http.MethodGet)
+	api.HandleFunc("/cache", s.handler.listCache).Methods(http.MethodGet)
 	api.HandleFunc("/cache", s.handler.deleteCache).Methods(http.MethodDelete)
+	api.HandleFunc("/cache/count", s.handler.countCache).Methods(http.MethodGet)
+	api.HandleFunc("/cache/warming", s.handler.getCacheWarming).Methods(http.MethodGet)
+	api.HandleFunc("/cache/warming", s.handler.refreshCacheWarming).Methods(http.MethodPost)
 }
 
 func (s *Server) addGatewayRouter(root *mux.Router) {
@@ -75,11 +86,20 @@ func (s *Server) addGatewayRouter(root *mux.Router) {
 	gateway.PathPrefix("/").HandlerFunc(s.handler.writeResponse)
 }
 
+// GatewayHandler handles requests like the gateway does, without the API routes
+func (s *Server) GatewayHandler() http.Handler {
+	root := mux.NewRouter()
+	s.addGatewayRouter(root)
+	return root
+}
+
 func NewServer(
 	options ServerOptions,
 	middlewares []middleware.Middleware,
+	errorRenderer *httpError.Renderer,
 	kubeCtrl *kubeCtrl.Controller,
 	cacheCtrl cache.Controller,
+	warmingCtrl *warming.Controller,
 	logger log.Logger,
 ) *Server {
 
@@ -87,13 +107,18 @@ func NewServer(
 
 	return &Server{
 		options: options,
-		server:  &http.Server{Addr: addr},
+		server: &http.Server{
+			Addr:           addr,
+			MaxHeaderBytes: options.MaxHeaderBytes,
+		},
 		handler: newHandler(
 			kubeCtrl,
 			cacheCtrl,
+			warmingCtrl,
 			logger.WithField("type", "handler"),
 		),
-		middlewares: middlewares,
-		logger:      logger,
+		middlewares:   middlewares,
+		errorRenderer: errorRenderer,
+		logger:        logger,
 	}
 }
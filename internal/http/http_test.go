@@ -0,0 +1,79 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	httpError "github.com/gotway/gotway/internal/http/error"
+	"github.com/gotway/gotway/internal/mocks"
+	"github.com/gotway/gotway/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApiErrors(t *testing.T) {
+	tests := []struct {
+		name            string
+		format          string
+		method          string
+		path            string
+		body            string
+		wantStatus      int
+		wantContentType string
+	}{
+		{
+			name:            "Bad request as problem",
+			format:          httpError.FormatJSON,
+			method:          http.MethodDelete,
+			path:            "/api/cache",
+			body:            `not json`,
+			wantStatus:      http.StatusBadRequest,
+			wantContentType: "application/problem+json",
+		},
+		{
+			name:            "Not found as problem",
+			format:          httpError.FormatJSON,
+			method:          http.MethodPost,
+			path:            "/api/cache/warming",
+			wantStatus:      http.StatusNotFound,
+			wantContentType: "application/problem+json",
+		},
+		{
+			name:            "Not found as text",
+			format:          httpError.FormatText,
+			method:          http.MethodPost,
+			path:            "/api/cache/warming",
+			wantStatus:      http.StatusNotFound,
+			wantContentType: "text/plain; charset=utf-8",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := NewServer(
+				ServerOptions{},
+				nil,
+				httpError.NewRenderer(httpError.Options{Format: tt.format}, nil, log.Log),
+				nil,
+				new(mocks.Controller),
+				nil,
+				log.Log,
+			)
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			rec := httptest.NewRecorder()
+
+			server.createRouter().ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			assert.Equal(t, tt.wantContentType, rec.Header().Get("Content-Type"))
+			if tt.format == httpError.FormatJSON {
+				var problem httpError.Problem
+				assert.Nil(t, json.NewDecoder(rec.Body).Decode(&problem))
+				assert.Equal(t, tt.wantStatus, problem.Status)
+				assert.Equal(t, tt.path, problem.Instance)
+			}
+		})
+	}
+}
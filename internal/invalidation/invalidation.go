@@ -0,0 +1,302 @@
+package invalidation
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/gotway/gotway/internal/cache"
+	"github.com/gotway/gotway/internal/model"
+	crdv1alpha1 "github.com/gotway/gotway/pkg/kubernetes/crd/v1alpha1"
+	clientsetv1alpha1 "github.com/gotway/gotway/pkg/kubernetes/crd/v1alpha1/apis/clientset/versioned"
+	informersv1alpha1 "github.com/gotway/gotway/pkg/kubernetes/crd/v1alpha1/apis/informers/externalversions"
+	listersv1alpha1 "github.com/gotway/gotway/pkg/kubernetes/crd/v1alpha1/apis/listers/crd/v1alpha1"
+	"github.com/gotway/gotway/pkg/log"
+	"github.com/gotway/gotway/pkg/metrics"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	kubeCache "k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/client-go/util/workqueue"
+)
+
+type Options struct {
+	Namespace    string
+	ResyncPeriod time.Duration
+	// ClaimTimeout is how long a replica may take to execute an invalidation before
+	// other replicas claim it again, in case it stopped while executing it
+	ClaimTimeout time.Duration
+}
+
+var ErrEmptyInvalidation = errors.New("service and paths, prefixes or tags should be specified")
+
+// Controller executes the CacheInvalidation resources against the cache and records the outcome in their status.
+// Every replica watches them, the one that first marks an invalidation as running executes it
+type Controller struct {
+	options   Options
+	clientSet clientsetv1alpha1.Interface
+	informer  kubeCache.SharedIndexInformer
+	lister    listersv1alpha1.CacheInvalidationLister
+	queue     workqueue.RateLimitingInterface
+	cacheCtrl cache.Controller
+	now       func() time.Time
+	logger    log.Logger
+
+	// pending holds the outcome of the invalidations whose status could not be written yet
+	pending    map[string]crdv1alpha1.CacheInvalidationStatus
+	pendingMux sync.Mutex
+}
+
+func (c *Controller) Run(ctx context.Context) error {
+	defer utilruntime.HandleCrash()
+	defer c.queue.ShutDown()
+
+	c.logger.Info("starting cache invalidation informer")
+	go c.informer.Run(ctx.Done())
+
+	if !kubeCache.WaitForCacheSync(ctx.Done(), c.informer.HasSynced) {
+		err := errors.New("failed to wait for cache invalidation informer cache to sync")
+		utilruntime.HandleError(err)
+		return err
+	}
+	c.logger.Info("cache invalidation controller ready")
+	metrics.InformerSynced.WithLabelValues("cacheinvalidation").Set(1)
+	defer metrics.InformerSynced.WithLabelValues("cacheinvalidation").Set(0)
+
+	go wait.UntilWithContext(ctx, c.runWorker, time.Second)
+
+	<-ctx.Done()
+	c.logger.Info("stopping cache invalidation controller")
+
+	return nil
+}
+
+func (c *Controller) runWorker(ctx context.Context) {
+	for c.processNextItem(ctx) {
+	}
+}
+
+func (c *Controller) processNextItem(ctx context.Context) bool {
+	key, quit := c.queue.Get()
+	if quit {
+		return false
+	}
+	defer c.queue.Done(key)
+
+	if err := c.sync(ctx, key.(string)); err != nil {
+		c.logger.Errorf("error syncing cache invalidation %s: %v", key, err)
+		c.queue.AddRateLimited(key)
+		return true
+	}
+	c.queue.Forget(key)
+	return true
+}
+
+// sync executes an invalidation unless its current spec was already claimed by a replica
+// whose claim has not expired
+func (c *Controller) sync(ctx context.Context, key string) error {
+	namespace, name, err := kubeCache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return err
+	}
+	if status, ok := c.getPending(key); ok {
+		if err := c.updateStatus(ctx, key, status); err != nil {
+			return err
+		}
+	}
+	inv, err := c.lister.CacheInvalidations(namespace).Get(name)
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if inv.Status.Phase != "" && inv.Status.ObservedGeneration == inv.Generation {
+		expiration, ok := c.claimExpiration(inv)
+		if !ok {
+			return nil
+		}
+		if wait := expiration.Sub(c.now()); wait > 0 {
+			c.queue.AddAfter(key, wait)
+			return nil
+		}
+		c.logger.Infof("claim of cache invalidation %s expired", key)
+	}
+
+	client := c.clientSet.GotwayV1alpha1().CacheInvalidations(namespace)
+	startTime := metav1.NewTime(c.now())
+	claimed := inv.DeepCopy()
+	claimed.Status = crdv1alpha1.CacheInvalidationStatus{
+		Phase:              crdv1alpha1.CacheInvalidationRunning,
+		ObservedGeneration: inv.Generation,
+		StartTime:          &startTime,
+	}
+	claimed, err = client.UpdateStatus(ctx, claimed, metav1.UpdateOptions{})
+	if apierrors.IsConflict(err) {
+		// either another replica claimed it or the spec changed, which enqueues it again
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	c.logger.Infof("executing cache invalidation %s", key)
+	deleted, errs := c.invalidate(ctx, claimed.Spec)
+
+	status := claimed.Status
+	status.Phase = crdv1alpha1.CacheInvalidationCompleted
+	status.Deleted = deleted
+	for _, err := range errs {
+		status.Phase = crdv1alpha1.CacheInvalidationFailed
+		status.Errors = append(status.Errors, err.Error())
+	}
+	completionTime := metav1.NewTime(c.now())
+	status.CompletionTime = &completionTime
+
+	return c.updateStatus(ctx, key, status)
+}
+
+// claimExpiration returns when the claim of a running invalidation expires
+func (c *Controller) claimExpiration(inv *crdv1alpha1.CacheInvalidation) (time.Time, bool) {
+	if inv.Status.Phase != crdv1alpha1.CacheInvalidationRunning || inv.Status.StartTime == nil ||
+		inv.Status.CompletionTime != nil || c.options.ClaimTimeout <= 0 {
+		return time.Time{}, false
+	}
+	return inv.Status.StartTime.Add(c.options.ClaimTimeout), true
+}
+
+// updateStatus writes the outcome of an invalidation. If it fails, the outcome is kept
+// so it is written when the invalidation is requeued instead of executing it again
+func (c *Controller) updateStatus(
+	ctx context.Context,
+	key string,
+	status crdv1alpha1.CacheInvalidationStatus,
+) error {
+	namespace, name, err := kubeCache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return err
+	}
+	client := c.clientSet.GotwayV1alpha1().CacheInvalidations(namespace)
+
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		latest, err := client.Get(ctx, name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if latest.Generation != status.ObservedGeneration {
+			// the spec changed while it was being executed, it will be executed again
+			return nil
+		}
+		latest.Status = status
+		_, err = client.UpdateStatus(ctx, latest, metav1.UpdateOptions{})
+		return err
+	})
+
+	c.pendingMux.Lock()
+	defer c.pendingMux.Unlock()
+	if err != nil {
+		c.pending[key] = status
+		return err
+	}
+	delete(c.pending, key)
+	return nil
+}
+
+func (c *Controller) getPending(key string) (crdv1alpha1.CacheInvalidationStatus, bool) {
+	c.pendingMux.Lock()
+	defer c.pendingMux.Unlock()
+	status, ok := c.pending[key]
+	return status, ok
+}
+
+// invalidate deletes the caches matching any of the criteria of the spec,
+// every criteria is attempted even if some of them fail
+func (c *Controller) invalidate(ctx context.Context, spec crdv1alpha1.CacheInvalidationSpec) (int64, []error) {
+	filters := getFilters(spec)
+	if len(filters) == 0 {
+		return 0, []error{ErrEmptyInvalidation}
+	}
+
+	var deleted int64
+	var errs []error
+	for _, filter := range filters {
+		count, err := c.cacheCtrl.DeleteCacheByFilter(ctx, filter)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		deleted += count
+	}
+	return deleted, errs
+}
+
+func getFilters(spec crdv1alpha1.CacheInvalidationSpec) []model.CacheFilter {
+	if spec.Service == "" {
+		return nil
+	}
+	var filters []model.CacheFilter
+	if len(spec.Paths) > 0 {
+		paths := make([]model.CachePath, len(spec.Paths))
+		for i, path := range spec.Paths {
+			paths[i] = model.CachePath{Service: spec.Service, Path: path}
+		}
+		filters = append(filters, model.CacheFilter{Paths: paths})
+	}
+	for _, prefix := range spec.Prefixes {
+		filters = append(filters, model.CacheFilter{Service: spec.Service, Prefix: prefix})
+	}
+	if len(spec.Tags) > 0 {
+		filters = append(filters, model.CacheFilter{Service: spec.Service, Tags: spec.Tags})
+	}
+	return filters
+}
+
+func (c *Controller) enqueue(obj interface{}) {
+	key, err := kubeCache.MetaNamespaceKeyFunc(obj)
+	if err != nil {
+		c.logger.Errorf("error getting key of %v: %v", obj, err)
+		return
+	}
+	c.queue.Add(key)
+}
+
+func NewController(
+	options Options,
+	clientSet clientsetv1alpha1.Interface,
+	cacheCtrl cache.Controller,
+	logger log.Logger,
+) *Controller {
+
+	informerFactory := informersv1alpha1.NewSharedInformerFactoryWithOptions(
+		clientSet,
+		options.ResyncPeriod,
+		informersv1alpha1.WithNamespace(options.Namespace),
+	)
+	informer := informerFactory.Gotway().V1alpha1().CacheInvalidations()
+
+	c := &Controller{
+		options:   options,
+		clientSet: clientSet,
+		informer:  informer.Informer(),
+		lister:    informer.Lister(),
+		queue:     workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
+		cacheCtrl: cacheCtrl,
+		now:       time.Now,
+		logger:    logger,
+		pending:   make(map[string]crdv1alpha1.CacheInvalidationStatus),
+	}
+	c.informer.AddEventHandler(kubeCache.ResourceEventHandlerFuncs{
+		AddFunc: c.enqueue,
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			c.enqueue(newObj)
+		},
+	})
+	return c
+}
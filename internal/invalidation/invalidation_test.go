@@ -0,0 +1,195 @@
+package invalidation
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gotway/gotway/internal/mocks"
+	"github.com/gotway/gotway/internal/model"
+	crdv1alpha1 "github.com/gotway/gotway/pkg/kubernetes/crd/v1alpha1"
+	"github.com/gotway/gotway/pkg/kubernetes/crd/v1alpha1/apis/clientset/versioned/fake"
+	"github.com/gotway/gotway/pkg/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func newInvalidation(spec crdv1alpha1.CacheInvalidationSpec, status crdv1alpha1.CacheInvalidationStatus) *crdv1alpha1.CacheInvalidation {
+	return &crdv1alpha1.CacheInvalidation{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "deploy",
+			Namespace:  "default",
+			Generation: 2,
+		},
+		Spec:   spec,
+		Status: status,
+	}
+}
+
+func newTestController(t *testing.T, inv *crdv1alpha1.CacheInvalidation, cacheCtrl *mocks.Controller) *Controller {
+	clientSet := fake.NewSimpleClientset(inv)
+	c := NewController(Options{}, clientSet, cacheCtrl, log.Log)
+	c.now = func() time.Time { return time.Date(2022, time.June, 1, 0, 0, 0, 0, time.UTC) }
+	assert.Nil(t, c.informer.GetIndexer().Add(inv))
+	return c
+}
+
+func getStatus(t *testing.T, c *Controller) crdv1alpha1.CacheInvalidationStatus {
+	inv, err := c.clientSet.GotwayV1alpha1().CacheInvalidations("default").Get(context.Background(), "deploy", metav1.GetOptions{})
+	assert.Nil(t, err)
+	return inv.Status
+}
+
+func TestSync(t *testing.T) {
+	inv := newInvalidation(crdv1alpha1.CacheInvalidationSpec{
+		Service:  "catalog",
+		Paths:    []string{"/products"},
+		Prefixes: []string{"/products/", "/offers/"},
+		Tags:     []string{"products"},
+	}, crdv1alpha1.CacheInvalidationStatus{
+		Phase:              crdv1alpha1.CacheInvalidationCompleted,
+		ObservedGeneration: 1,
+	})
+
+	cacheCtrl := new(mocks.Controller)
+	cacheCtrl.On("DeleteCacheByFilter", mock.Anything, model.CacheFilter{
+		Paths: []model.CachePath{{Service: "catalog", Path: "/products"}},
+	}).Return(int64(1), nil)
+	cacheCtrl.On("DeleteCacheByFilter", mock.Anything, model.CacheFilter{Service: "catalog", Prefix: "/products/"}).
+		Return(int64(3), nil)
+	cacheCtrl.On("DeleteCacheByFilter", mock.Anything, model.CacheFilter{Service: "catalog", Prefix: "/offers/"}).
+		Return(int64(0), errors.New("connection refused"))
+	cacheCtrl.On("DeleteCacheByFilter", mock.Anything, model.CacheFilter{Service: "catalog", Tags: []string{"products"}}).
+		Return(int64(2), nil)
+
+	c := newTestController(t, inv, cacheCtrl)
+	assert.Nil(t, c.sync(context.Background(), "default/deploy"))
+
+	status := getStatus(t, c)
+	assert.Equal(t, crdv1alpha1.CacheInvalidationFailed, status.Phase)
+	assert.Equal(t, int64(2), status.ObservedGeneration)
+	assert.Equal(t, int64(6), status.Deleted)
+	assert.Equal(t, []string{"connection refused"}, status.Errors)
+	assert.NotNil(t, status.StartTime)
+	assert.Equal(t, c.now(), status.CompletionTime.Time)
+	cacheCtrl.AssertExpectations(t)
+}
+
+func TestSyncEmpty(t *testing.T) {
+	inv := newInvalidation(crdv1alpha1.CacheInvalidationSpec{Service: "catalog"}, crdv1alpha1.CacheInvalidationStatus{})
+	cacheCtrl := new(mocks.Controller)
+
+	c := newTestController(t, inv, cacheCtrl)
+	assert.Nil(t, c.sync(context.Background(), "default/deploy"))
+
+	status := getStatus(t, c)
+	assert.Equal(t, crdv1alpha1.CacheInvalidationFailed, status.Phase)
+	assert.Equal(t, []string{ErrEmptyInvalidation.Error()}, status.Errors)
+	cacheCtrl.AssertNotCalled(t, "DeleteCacheByFilter", mock.Anything, mock.Anything)
+}
+
+func TestSyncObserved(t *testing.T) {
+	inv := newInvalidation(crdv1alpha1.CacheInvalidationSpec{
+		Service: "catalog",
+		Tags:    []string{"products"},
+	}, crdv1alpha1.CacheInvalidationStatus{
+		Phase:              crdv1alpha1.CacheInvalidationRunning,
+		ObservedGeneration: 2,
+	})
+	cacheCtrl := new(mocks.Controller)
+
+	c := newTestController(t, inv, cacheCtrl)
+	assert.Nil(t, c.sync(context.Background(), "default/deploy"))
+	assert.Nil(t, c.sync(context.Background(), "default/unknown"))
+
+	assert.Equal(t, crdv1alpha1.CacheInvalidationRunning, getStatus(t, c).Phase)
+	cacheCtrl.AssertNotCalled(t, "DeleteCacheByFilter", mock.Anything, mock.Anything)
+}
+
+func TestSyncClaimExpiration(t *testing.T) {
+	now := time.Date(2022, time.June, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		startTime time.Time
+		wantPhase crdv1alpha1.CacheInvalidationPhase
+		wantCalls int
+	}{
+		{
+			name:      "Claimed",
+			startTime: now.Add(-time.Minute),
+			wantPhase: crdv1alpha1.CacheInvalidationRunning,
+			wantCalls: 0,
+		},
+		{
+			name:      "Claim expired",
+			startTime: now.Add(-10 * time.Minute),
+			wantPhase: crdv1alpha1.CacheInvalidationCompleted,
+			wantCalls: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			startTime := metav1.NewTime(tt.startTime)
+			inv := newInvalidation(crdv1alpha1.CacheInvalidationSpec{
+				Service: "catalog",
+				Tags:    []string{"products"},
+			}, crdv1alpha1.CacheInvalidationStatus{
+				Phase:              crdv1alpha1.CacheInvalidationRunning,
+				ObservedGeneration: 2,
+				StartTime:          &startTime,
+			})
+			cacheCtrl := new(mocks.Controller)
+			cacheCtrl.On("DeleteCacheByFilter", mock.Anything, mock.Anything).Return(int64(1), nil)
+
+			c := newTestController(t, inv, cacheCtrl)
+			c.options.ClaimTimeout = 5 * time.Minute
+			assert.Nil(t, c.sync(context.Background(), "default/deploy"))
+
+			assert.Equal(t, tt.wantPhase, getStatus(t, c).Phase)
+			cacheCtrl.AssertNumberOfCalls(t, "DeleteCacheByFilter", tt.wantCalls)
+		})
+	}
+}
+
+func TestSyncStatusRetry(t *testing.T) {
+	inv := newInvalidation(crdv1alpha1.CacheInvalidationSpec{
+		Service: "catalog",
+		Tags:    []string{"products"},
+	}, crdv1alpha1.CacheInvalidationStatus{})
+	cacheCtrl := new(mocks.Controller)
+	cacheCtrl.On("DeleteCacheByFilter", mock.Anything, mock.Anything).Return(int64(3), nil)
+
+	c := newTestController(t, inv, cacheCtrl)
+	c.options.ClaimTimeout = 5 * time.Minute
+	updates := 0
+	c.clientSet.(*fake.Clientset).PrependReactor(
+		"update",
+		"cacheinvalidations",
+		func(action k8stesting.Action) (bool, runtime.Object, error) {
+			updates++
+			if updates == 2 {
+				return true, nil, errors.New("connection refused")
+			}
+			return false, nil, nil
+		},
+	)
+
+	assert.NotNil(t, c.sync(context.Background(), "default/deploy"))
+	assert.Equal(t, crdv1alpha1.CacheInvalidationRunning, getStatus(t, c).Phase)
+
+	// the informer eventually observes the claim
+	claimed, err := c.clientSet.GotwayV1alpha1().CacheInvalidations("default").Get(context.Background(), "deploy", metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Nil(t, c.informer.GetIndexer().Update(claimed))
+
+	assert.Nil(t, c.sync(context.Background(), "default/deploy"))
+	status := getStatus(t, c)
+	assert.Equal(t, crdv1alpha1.CacheInvalidationCompleted, status.Phase)
+	assert.Equal(t, int64(3), status.Deleted)
+	cacheCtrl.AssertNumberOfCalls(t, "DeleteCacheByFilter", 1)
+}
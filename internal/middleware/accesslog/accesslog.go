@@ -0,0 +1,111 @@
+package accesslog
+
+import (
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gotway/gotway/internal/middleware"
+	"github.com/gotway/gotway/internal/requestcontext"
+	"github.com/gotway/gotway/pkg/log"
+)
+
+type Options struct {
+	Format   string
+	Template string
+	// SampleRate is the ratio of requests to be logged, server errors are always logged
+	SampleRate float64
+}
+
+type accessLog struct {
+	options Options
+	format  formatter
+	writer  io.Writer
+	mux     sync.Mutex
+	logger  log.Logger
+}
+
+func (a *accessLog) MiddlewareFunc(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestcontext.Logger(r, a.logger).Debug("access log")
+
+		start := time.Now()
+		summary := &requestcontext.Summary{}
+		rw := middleware.NewResponseWriter(w)
+		next.ServeHTTP(rw, requestcontext.WithSummary(r, summary))
+
+		status := rw.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		if !a.sampled(status) {
+			return
+		}
+		requestID, _ := requestcontext.GetRequestID(r)
+		a.write(r, Entry{
+			Time:             start,
+			RequestID:        requestID,
+			ClientIP:         clientIP(r),
+			Method:           r.Method,
+			URI:              r.URL.RequestURI(),
+			Proto:            r.Proto,
+			Host:             r.Host,
+			Status:           status,
+			Bytes:            rw.Bytes,
+			Duration:         time.Since(start),
+			Ingress:          summary.Ingress,
+			Service:          summary.Service,
+			Upstream:         summary.Upstream,
+			UpstreamDuration: summary.UpstreamDuration,
+			CacheStatus:      summary.CacheStatus,
+			Referer:          r.Referer(),
+			UserAgent:        r.UserAgent(),
+		})
+	})
+}
+
+func (a *accessLog) sampled(status int) bool {
+	if status >= http.StatusInternalServerError || a.options.SampleRate >= 1 {
+		return true
+	}
+	return rand.Float64() < a.options.SampleRate
+}
+
+func (a *accessLog) write(r *http.Request, entry Entry) {
+	line, err := a.format(entry)
+	if err != nil {
+		requestcontext.Logger(r, a.logger).Error("error formatting access log ", err)
+		return
+	}
+	line = append(line, '\n')
+
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	if _, err := a.writer.Write(line); err != nil {
+		requestcontext.Logger(r, a.logger).Error("error writing access log ", err)
+	}
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func New(options Options, writer io.Writer, logger log.Logger) (middleware.Middleware, error) {
+	format, err := newFormatter(options.Format, options.Template)
+	if err != nil {
+		return nil, err
+	}
+	return &accessLog{
+		options: options,
+		format:  format,
+		writer:  writer,
+		logger:  logger,
+	}, nil
+}
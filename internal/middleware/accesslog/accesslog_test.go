@@ -0,0 +1,155 @@
+package accesslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gotway/gotway/internal/requestcontext"
+	"github.com/gotway/gotway/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+var entry = Entry{
+	Time:        time.Date(2021, time.July, 4, 10, 30, 0, 0, time.UTC),
+	RequestID:   "1234",
+	ClientIP:    "10.0.0.1",
+	Method:      http.MethodGet,
+	URI:         "/products?offset=0",
+	Proto:       "HTTP/1.1",
+	Status:      http.StatusOK,
+	Bytes:       512,
+	Duration:    1500 * time.Microsecond,
+	Ingress:     "catalog-get-products",
+	Service:     "catalog",
+	CacheStatus: requestcontext.CacheStatusHit,
+	Referer:     "https://gotway.duckdns.org",
+	UserAgent:   "curl/7.68.0",
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   string
+		template string
+		want     string
+	}{
+		{
+			name:   "Common",
+			format: FormatCommon,
+			want:   `10.0.0.1 - - [04/Jul/2021:10:30:00 +0000] "GET /products?offset=0 HTTP/1.1" 200 512`,
+		},
+		{
+			name:   "Combined",
+			format: FormatCombined,
+			want: `10.0.0.1 - - [04/Jul/2021:10:30:00 +0000] "GET /products?offset=0 HTTP/1.1" 200 512 ` +
+				`"https://gotway.duckdns.org" "curl/7.68.0"`,
+		},
+		{
+			name:     "Template",
+			format:   FormatTemplate,
+			template: `{{.RequestID}} {{.Service}} {{.Status}} cache={{.CacheStatus}}`,
+			want:     `1234 catalog 200 cache=hit`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			format, err := newFormatter(tt.format, tt.template)
+			assert.Nil(t, err)
+
+			line, err := format(entry)
+
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, string(line))
+		})
+	}
+}
+
+func TestFormatJSON(t *testing.T) {
+	line, err := formatJSON(entry)
+	assert.Nil(t, err)
+
+	var decoded map[string]interface{}
+	assert.Nil(t, json.Unmarshal(line, &decoded))
+	assert.Equal(t, "1234", decoded["requestId"])
+	assert.Equal(t, "catalog-get-products", decoded["ingress"])
+	assert.Equal(t, "hit", decoded["cacheStatus"])
+	assert.Equal(t, 1.5, decoded["durationMs"])
+	assert.NotContains(t, decoded, "upstream")
+}
+
+func TestInvalidFormat(t *testing.T) {
+	_, err := New(Options{Format: "xml"}, &bytes.Buffer{}, log.Log)
+	assert.NotNil(t, err)
+
+	_, err = New(Options{Format: FormatTemplate, Template: "{{.Status"}, &bytes.Buffer{}, log.Log)
+	assert.NotNil(t, err)
+}
+
+func TestMiddleware(t *testing.T) {
+	tests := []struct {
+		name       string
+		sampleRate float64
+		status     int
+		wantLogged bool
+	}{
+		{
+			name:       "Logged",
+			sampleRate: 1,
+			status:     http.StatusOK,
+			wantLogged: true,
+		},
+		{
+			name:       "Sampled out",
+			sampleRate: 0,
+			status:     http.StatusOK,
+			wantLogged: false,
+		},
+		{
+			name:       "Server errors are always logged",
+			sampleRate: 0,
+			status:     http.StatusBadGateway,
+			wantLogged: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			mw, err := New(Options{Format: FormatJSON, SampleRate: tt.sampleRate}, &buf, log.Log)
+			assert.Nil(t, err)
+			handler := mw.MiddlewareFunc(
+				http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					requestcontext.Summarize(r, func(s *requestcontext.Summary) {
+						s.Service = "catalog"
+						s.CacheStatus = requestcontext.CacheStatusMiss
+					})
+					w.WriteHeader(tt.status)
+					_, _ = w.Write([]byte("{}"))
+				}),
+			)
+			req := httptest.NewRequest(http.MethodGet, "/products", nil)
+			req.RemoteAddr = "10.0.0.1:54321"
+
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			if !tt.wantLogged {
+				assert.Empty(t, buf.String())
+				return
+			}
+			assert.True(t, strings.HasSuffix(buf.String(), "\n"))
+			var logged Entry
+			assert.Nil(t, json.Unmarshal(buf.Bytes(), &logged))
+			assert.Equal(t, "10.0.0.1", logged.ClientIP)
+			assert.Equal(t, tt.status, logged.Status)
+			assert.Equal(t, int64(2), logged.Bytes)
+			assert.Equal(t, "catalog", logged.Service)
+			assert.Equal(t, requestcontext.CacheStatusMiss, logged.CacheStatus)
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package accesslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"text/template"
+	"time"
+)
+
+const (
+	FormatJSON     = "json"
+	FormatCommon   = "common"
+	FormatCombined = "combined"
+	FormatTemplate = "template"
+)
+
+const clfTimeLayout = "02/Jan/2006:15:04:05 -0700"
+
+// Entry is an access log record, templates can refer to any of its fields
+type Entry struct {
+	Time             time.Time     `json:"time"`
+	RequestID        string        `json:"requestId,omitempty"`
+	ClientIP         string        `json:"clientIp"`
+	Method           string        `json:"method"`
+	URI              string        `json:"uri"`
+	Proto            string        `json:"proto"`
+	Host             string        `json:"host"`
+	Status           int           `json:"status"`
+	Bytes            int64         `json:"bytes"`
+	Duration         time.Duration `json:"-"`
+	Ingress          string        `json:"ingress,omitempty"`
+	Service          string        `json:"service,omitempty"`
+	Upstream         string        `json:"upstream,omitempty"`
+	UpstreamDuration time.Duration `json:"-"`
+	CacheStatus      string        `json:"cacheStatus,omitempty"`
+	Referer          string        `json:"referer,omitempty"`
+	UserAgent        string        `json:"userAgent,omitempty"`
+}
+
+type jsonEntry struct {
+	Entry
+	DurationMs         float64 `json:"durationMs"`
+	UpstreamDurationMs float64 `json:"upstreamDurationMs,omitempty"`
+}
+
+type formatter func(entry Entry) ([]byte, error)
+
+func newFormatter(format, tmpl string) (formatter, error) {
+	switch format {
+	case FormatJSON:
+		return formatJSON, nil
+	case FormatCommon:
+		return formatCommon, nil
+	case FormatCombined:
+		return formatCombined, nil
+	case FormatTemplate:
+		t, err := template.New("accesslog").Parse(tmpl)
+		if err != nil {
+			return nil, fmt.Errorf("invalid access log template: %v", err)
+		}
+		return func(entry Entry) ([]byte, error) {
+			var buf bytes.Buffer
+			if err := t.Execute(&buf, entry); err != nil {
+				return nil, err
+			}
+			return buf.Bytes(), nil
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown access log format '%s'", format)
+	}
+}
+
+func formatJSON(entry Entry) ([]byte, error) {
+	return json.Marshal(jsonEntry{
+		Entry:              entry,
+		DurationMs:         milliseconds(entry.Duration),
+		UpstreamDurationMs: milliseconds(entry.UpstreamDuration),
+	})
+}
+
+func formatCommon(entry Entry) ([]byte, error) {
+	return []byte(fmt.Sprintf("%s - - [%s] \"%s %s %s\" %d %s",
+		entry.ClientIP,
+		entry.Time.Format(clfTimeLayout),
+		entry.Method,
+		entry.URI,
+		entry.Proto,
+		entry.Status,
+		clfBytes(entry.Bytes),
+	)), nil
+}
+
+func formatCombined(entry Entry) ([]byte, error) {
+	common, _ := formatCommon(entry)
+	return []byte(fmt.Sprintf("%s %q %q", common, entry.Referer, entry.UserAgent)), nil
+}
+
+func clfBytes(bytes int64) string {
+	if bytes == 0 {
+		return "-"
+	}
+	return strconv.FormatInt(bytes, 10)
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -2,8 +2,11 @@ package cache
 
 import (
 	"errors"
+	"net"
 	"net/http"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/gotway/gotway/internal/cache"
 	httpError "github.com/gotway/gotway/internal/http/error"
@@ -11,49 +14,207 @@ import (
 	"github.com/gotway/gotway/internal/model"
 	"github.com/gotway/gotway/internal/requestcontext"
 	"github.com/gotway/gotway/pkg/log"
+	"github.com/gotway/gotway/pkg/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
 )
 
+var tracer = otel.Tracer("github.com/gotway/gotway/internal/middleware/cache")
+
+// CacheInOptions configures how concurrent cache misses are coalesced and who gets the debug headers
+type CacheInOptions struct {
+	Coalescing            bool
+	DistributedCoalescing bool
+	LockTimeout           time.Duration
+	Debug                 bool
+	DebugNetworks         []*net.IPNet
+}
+
 type cacheIn struct {
+	options   CacheInOptions
 	cacheCtrl cache.Controller
-	logger    log.Logger
+	// revalidating holds the keys being refreshed in the background
+	revalidating sync.Map
+	inFlight     *calls
+	logger       log.Logger
 }
 
 func (c *cacheIn) MiddlewareFunc(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		c.logger.Debug("cache in")
+		logger := requestcontext.Logger(r, c.logger)
+		logger.Debug("cache in")
 		ingress, err := requestcontext.GetIngress(r)
 		if err != nil {
-			httpError.Handle(err, w, c.logger)
+			httpError.Handle(err, w, r, logger)
 			return
 		}
+		if _, err := requestcontext.GetSummary(r); err != nil {
+			r = requestcontext.WithSummary(r, &requestcontext.Summary{})
+		}
+		hw := newHeaderWriter(w, r, c.options.Debug || isTrusted(r, c.options.DebugNetworks))
+		w = hw
 
 		if !c.cacheCtrl.IsCacheableRequest(r) {
+			setCacheStatus(r, requestcontext.CacheStatusBypass)
 			next.ServeHTTP(w, r)
 			return
 		}
 
-		c.logger.Debug("checking cache")
-		cache, err := c.cacheCtrl.GetCache(r, ingress.Spec.Service.Name)
+		logger.Debug("checking cache")
+		params := GetParams(ingress)
+		directives := cache.GetRequestDirectives(r)
+		if hw.debug {
+			hw.key = params.Service + "::" + cache.GetKey(r, params.Key)
+		}
+		ctx, span := tracer.Start(r.Context(), "cache-in")
+		cached, err := c.cacheCtrl.GetCache(r.WithContext(ctx), params)
+		span.SetAttributes(attribute.Bool("gotway.cache.hit", err == nil))
 		if err != nil {
 			if !errors.Is(err, model.ErrCacheNotFound) {
-				c.logger.Error(err)
+				logger.Error(err)
+				tracing.EndSpan(span, err)
+			} else {
+				span.End()
 			}
-			next.ServeHTTP(w, r)
+			c.miss(next, w, r, params, directives, logger)
 			return
 		}
+		span.End()
+
+		now := hw.now
+		if cached.CanRevalidateWithService(now) {
+			r = requestcontext.WithStaleCache(r, cached)
+		}
+		switch {
+		case directives.NoCache:
+			logger.Debug("client requested a validated response")
+			setCacheStatus(r, requestcontext.CacheStatusMiss)
+			c.load(next, w, r, params, logger)
+		case !directives.Accepts(cached, now):
+			c.miss(next, w, r, params, directives, logger)
+		case cached.IsFresh(now):
+			logger.Debug("cached response")
+			setCacheStatus(r, requestcontext.CacheStatusHit)
+			hw.cached = &cached
+			writeCache(w, r, cached, now)
+		case directives.AcceptsStale(cached, now) && cache.AllowsStale(cached, params):
+			logger.Debug("stale cached response accepted by the client")
+			setCacheStatus(r, requestcontext.CacheStatusStale)
+			hw.cached = &cached
+			writeCache(w, r, cached, now)
+		case cached.CanRevalidate(now):
+			logger.Debug("stale cached response, revalidating")
+			setCacheStatus(r, requestcontext.CacheStatusStale)
+			hw.cached = &cached
+			writeCache(w, r, cached, now)
+			c.revalidate(next, r, params)
+		case cached.CanServeOnError(now) && !directives.OnlyIfCached:
+			hw.cached = &cached
+			c.serveOnError(next, w, r, cached, logger)
+		default:
+			c.miss(next, w, r, params, directives, logger)
+		}
+	})
+}
+
+// miss requests the service when there is no cached response for the request, unless the client only accepts cached ones
+func (c *cacheIn) miss(
+	next http.Handler,
+	w http.ResponseWriter,
+	r *http.Request,
+	params cache.Params,
+	directives cache.RequestDirectives,
+	logger log.Logger,
+) {
+	setCacheStatus(r, requestcontext.CacheStatusMiss)
+	if directives.OnlyIfCached {
+		httpError.Handle(model.ErrOnlyIfCached, w, r, logger)
+		return
+	}
+	c.load(next, w, r, params, logger)
+}
+
+// revalidate refreshes a cached response in the background, only once at a time per key
+func (c *cacheIn) revalidate(next http.Handler, r *http.Request, params cache.Params) {
+	key := params.Service + "::" + cache.GetKey(r, params.Key)
+	if _, loaded := c.revalidating.LoadOrStore(key, struct{}{}); loaded {
+		return
+	}
+	req := requestcontext.WithSummary(requestcontext.Detach(r), &requestcontext.Summary{})
+	// only responses to GET requests are cached, HEAD ones are refreshed with them
+	req.Method = http.MethodGet
+
+	go func() {
+		defer c.revalidating.Delete(key)
+		next.ServeHTTP(newDiscardWriter(), req)
+	}()
+}
+
+// serveOnError requests the service and falls back to the stale response if it fails
+func (c *cacheIn) serveOnError(
+	next http.Handler,
+	w http.ResponseWriter,
+	r *http.Request,
+	cached model.Cache,
+	logger log.Logger,
+) {
+	bw := newBufferedWriter()
+	next.ServeHTTP(bw, r)
+
+	if bw.status >= http.StatusInternalServerError {
+		logger.Debugf("service responded %d, serving stale cached response", bw.status)
+		setCacheStatus(r, requestcontext.CacheStatusStale)
+		writeCache(w, r, cached, time.Now())
+		return
+	}
+	requestcontext.Summarize(r, func(s *requestcontext.Summary) {
+		if s.CacheStatus == "" {
+			s.CacheStatus = requestcontext.CacheStatusMiss
+		}
+	})
+	bw.flush(w)
+}
 
-		c.logger.Debug("cached response")
-		for key, header := range cache.Headers {
+// writeCache writes a cached response, or a 304 Not Modified if the client already has it
+func writeCache(w http.ResponseWriter, r *http.Request, cached model.Cache, now time.Time) {
+	if cached.StatusCode == http.StatusOK && cache.NotModified(r, cached.Headers) {
+		for key, header := range cache.NotModifiedHeader(cached.Headers) {
 			w.Header().Set(key, strings.Join(header[:], ","))
 		}
-		w.WriteHeader(cache.StatusCode)
-		_, _ = w.Write(cache.Body)
+		setAge(w.Header(), cached, now)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	writeCachedResponse(w, cached, now)
+}
+
+func writeCachedResponse(w http.ResponseWriter, cached model.Cache, now time.Time) {
+	for key, header := range cached.Headers {
+		if http.CanonicalHeaderKey(key) == http.CanonicalHeaderKey(requestcontext.RequestIDHeader) {
+			continue
+		}
+		w.Header().Set(key, strings.Join(header[:], ","))
+	}
+	setAge(w.Header(), cached, now)
+	w.WriteHeader(cached.StatusCode)
+	_, _ = w.Write(cached.Body)
+}
+
+func setCacheStatus(r *http.Request, status string) {
+	requestcontext.Summarize(r, func(s *requestcontext.Summary) {
+		s.CacheStatus = status
 	})
 }
 
 func NewCacheIn(
+	options CacheInOptions,
 	cacheController cache.Controller,
 	logger log.Logger,
 ) middleware.Middleware {
-	return &cacheIn{cacheController, logger}
+	return &cacheIn{
+		options:   options,
+		cacheCtrl: cacheController,
+		inFlight:  newCalls(),
+		logger:    logger,
+	}
 }
@@ -0,0 +1,151 @@
+package cache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gotway/gotway/internal/mocks"
+	"github.com/gotway/gotway/internal/model"
+	"github.com/gotway/gotway/internal/requestcontext"
+	"github.com/gotway/gotway/pkg/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	crdv1alpha1 "github.com/gotway/gotway/pkg/kubernetes/crd/v1alpha1"
+)
+
+func TestRequestCacheControl(t *testing.T) {
+	fresh := model.Cache{
+		StatusCode: http.StatusOK,
+		Headers:    http.Header{},
+		Body:       []byte(`{"name":"sneakers"}`),
+		TTL:        model.NewCacheTTL(30),
+		CreatedAt:  time.Now().Add(-10 * time.Second),
+	}
+	expired := model.Cache{
+		StatusCode: http.StatusOK,
+		Headers:    http.Header{},
+		Body:       []byte(`{"name":"sneakers"}`),
+		TTL:        model.NewCacheTTL(30),
+		CreatedAt:  time.Now().Add(-40 * time.Second),
+	}
+	mustRevalidate := expired
+	mustRevalidate.Headers = http.Header{"Cache-Control": []string{"max-age=30, must-revalidate"}}
+
+	tests := []struct {
+		name          string
+		method        string
+		cacheControl  string
+		cached        *model.Cache
+		wantStatus    int
+		wantCache     string
+		wantUpstreams int32
+	}{
+		{
+			name:          "Hit",
+			method:        http.MethodGet,
+			cached:        &fresh,
+			wantStatus:    http.StatusOK,
+			wantCache:     "HIT",
+			wantUpstreams: 0,
+		},
+		{
+			name:          "HEAD served from GET",
+			method:        http.MethodHead,
+			cached:        &fresh,
+			wantStatus:    http.StatusOK,
+			wantCache:     "HIT",
+			wantUpstreams: 0,
+		},
+		{
+			name:          "No cache",
+			method:        http.MethodGet,
+			cacheControl:  "no-cache",
+			cached:        &fresh,
+			wantStatus:    http.StatusOK,
+			wantCache:     "MISS",
+			wantUpstreams: 1,
+		},
+		{
+			name:          "Max age",
+			method:        http.MethodGet,
+			cacheControl:  "max-age=5",
+			cached:        &fresh,
+			wantStatus:    http.StatusOK,
+			wantCache:     "MISS",
+			wantUpstreams: 1,
+		},
+		{
+			name:          "Max stale",
+			method:        http.MethodGet,
+			cacheControl:  "max-stale=20",
+			cached:        &expired,
+			wantStatus:    http.StatusOK,
+			wantCache:     "STALE",
+			wantUpstreams: 0,
+		},
+		{
+			name:          "Max stale with must revalidate",
+			method:        http.MethodGet,
+			cacheControl:  "max-stale=20",
+			cached:        &mustRevalidate,
+			wantStatus:    http.StatusOK,
+			wantCache:     "MISS",
+			wantUpstreams: 1,
+		},
+		{
+			name:          "Only if cached",
+			method:        http.MethodGet,
+			cacheControl:  "only-if-cached",
+			cached:        &fresh,
+			wantStatus:    http.StatusOK,
+			wantCache:     "HIT",
+			wantUpstreams: 0,
+		},
+		{
+			name:          "Only if cached miss",
+			method:        http.MethodGet,
+			cacheControl:  "only-if-cached",
+			wantStatus:    http.StatusGatewayTimeout,
+			wantCache:     "MISS",
+			wantUpstreams: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cacheCtrl := new(mocks.Controller)
+			cacheCtrl.On("IsCacheableRequest", mock.Anything).Return(true)
+			if tt.cached != nil {
+				cacheCtrl.On("GetCache", mock.Anything, mock.Anything).Return(*tt.cached, nil)
+			} else {
+				cacheCtrl.On("GetCache", mock.Anything, mock.Anything).Return(model.Cache{}, model.ErrCacheNotFound)
+			}
+
+			var upstreams int32
+			handler := NewCacheIn(
+				CacheInOptions{},
+				cacheCtrl,
+				log.Log,
+			).MiddlewareFunc(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&upstreams, 1)
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			req := httptest.NewRequest(tt.method, "/products", nil)
+			if tt.cacheControl != "" {
+				req.Header.Set("Cache-Control", tt.cacheControl)
+			}
+			req = requestcontext.WithIngress(req, crdv1alpha1.IngressHTTP{})
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			assert.Equal(t, tt.wantCache, rec.Header().Get(StatusHeader))
+			assert.Equal(t, tt.wantUpstreams, atomic.LoadInt32(&upstreams))
+		})
+	}
+}
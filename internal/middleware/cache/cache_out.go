@@ -1,42 +1,69 @@
 package cache
 
 import (
+	"context"
 	"net/http"
+	"time"
 
 	"github.com/gotway/gotway/internal/cache"
 	httpError "github.com/gotway/gotway/internal/http/error"
 	"github.com/gotway/gotway/internal/middleware"
 	"github.com/gotway/gotway/internal/requestcontext"
 	"github.com/gotway/gotway/pkg/log"
+	"github.com/gotway/gotway/pkg/tracing"
 )
 
+type CacheOutOptions struct {
+	// InvalidateTimeout bounds how long invalidating caches may delay a response
+	InvalidateTimeout time.Duration
+}
+
 type cacheOut struct {
+	options   CacheOutOptions
 	cacheCtrl cache.Controller
 	logger    log.Logger
 }
 
 func (c *cacheOut) MiddlewareFunc(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		c.logger.Debug("cache out")
+		logger := requestcontext.Logger(r, c.logger)
+		logger.Debug("cache out")
 		res, err := requestcontext.GetResponse(r)
 		if err != nil {
-			httpError.Handle(err, w, c.logger)
+			httpError.Handle(err, w, r, logger)
 			return
 		}
 		ingress, err := requestcontext.GetIngress(r)
 		if err != nil {
-			httpError.Handle(err, w, c.logger)
+			httpError.Handle(err, w, r, logger)
 			return
 		}
 
-		params := cache.Params{
-			Service:  ingress.Spec.Service.Name,
-			TTL:      ingress.Spec.Cache.TTL,
-			Statuses: ingress.Spec.Cache.Statuses,
-			Tags:     ingress.Spec.Cache.Tags,
+		params := GetParams(ingress)
+		ctx, span := tracer.Start(r.Context(), "cache-out")
+		if stale, staleErr := requestcontext.GetStaleCache(r); staleErr == nil && res.StatusCode == http.StatusNotModified {
+			logger.Debug("cached response revalidated")
+			res, err = c.cacheCtrl.Revalidate(r.WithContext(ctx), stale, res, params)
+			tracing.EndSpan(span, err)
+			if err != nil {
+				httpError.Handle(err, w, r, logger)
+				return
+			}
+			setCacheStatus(r, requestcontext.CacheStatusRevalidated)
+			if res.StatusCode == http.StatusOK && cache.NotModified(r, res.Header) {
+				res = notModifiedResponse(res)
+			}
+			next.ServeHTTP(w, requestcontext.WithResponse(r, res))
+			return
 		}
-		if err := c.cacheCtrl.HandleResponse(res, params); err != nil {
-			httpError.Handle(err, w, c.logger)
+		if c.cacheCtrl.IsInvalidatingResponse(res, params) {
+			c.invalidate(r.WithContext(ctx), res, params, logger)
+			res.Header.Del(cache.PurgeTagsHeader)
+		}
+		err = c.cacheCtrl.HandleResponse(r.WithContext(ctx), res, params)
+		tracing.EndSpan(span, err)
+		if err != nil {
+			httpError.Handle(err, w, r, logger)
 			return
 		}
 
@@ -44,9 +71,37 @@ func (c *cacheOut) MiddlewareFunc(next http.Handler) http.Handler {
 	})
 }
 
+// invalidate purges the caches invalidated by a response before it is written, so the client does not
+// read a stale response right after it. The request already succeeded, a failed invalidation is only logged
+func (c *cacheOut) invalidate(r *http.Request, res *http.Response, params cache.Params, logger log.Logger) {
+	ctx, cancel := context.WithTimeout(r.Context(), c.options.InvalidateTimeout)
+	defer cancel()
+
+	deleted, err := c.cacheCtrl.Invalidate(ctx, r, res, params)
+	if err != nil {
+		logger.Error("error invalidating cache ", err)
+		return
+	}
+	logger.Debugf("invalidated %d cached responses", deleted)
+}
+
+func notModifiedResponse(res *http.Response) *http.Response {
+	return &http.Response{
+		Status:     "304 Not Modified",
+		StatusCode: http.StatusNotModified,
+		Proto:      res.Proto,
+		ProtoMajor: res.ProtoMajor,
+		ProtoMinor: res.ProtoMinor,
+		Header:     cache.NotModifiedHeader(res.Header),
+		Body:       http.NoBody,
+		Request:    res.Request,
+	}
+}
+
 func NewCacheOut(
+	options CacheOutOptions,
 	cacheController cache.Controller,
 	logger log.Logger,
 ) middleware.Middleware {
-	return &cacheOut{cacheController, logger}
+	return &cacheOut{options, cacheController, logger}
 }
@@ -0,0 +1,118 @@
+package cache
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gotway/gotway/internal/cache"
+	"github.com/gotway/gotway/internal/mocks"
+	"github.com/gotway/gotway/internal/requestcontext"
+	"github.com/gotway/gotway/pkg/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	gateway "github.com/gotway/gotway/internal/middleware/gateway"
+	crdv1alpha1 "github.com/gotway/gotway/pkg/kubernetes/crd/v1alpha1"
+)
+
+// TestCacheOutClientRequest sends the responses of a service through the gateway, whose request
+// to the service does not carry the headers of the client
+func TestCacheOutClientRequest(t *testing.T) {
+	service := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		_, _ = w.Write([]byte(`{"name":"sneakers"}`))
+	}))
+	defer service.Close()
+	ingress := crdv1alpha1.IngressHTTP{
+		Spec: crdv1alpha1.IngressHTTPSpec{
+			Service: crdv1alpha1.Service{Name: "catalog", URL: service.URL},
+			Cache:   crdv1alpha1.Cache{TTL: 60, Statuses: []int{http.StatusOK}},
+		},
+		Status: crdv1alpha1.IngressHTTPStatus{IsServiceHealthy: true},
+	}
+
+	tests := []struct {
+		name       string
+		header     http.Header
+		wantCached bool
+	}{
+		{
+			name:       "Cacheable",
+			wantCached: true,
+		},
+		{
+			name:       "Authorization",
+			header:     http.Header{"Authorization": []string{"Bearer token"}},
+			wantCached: false,
+		},
+		{
+			name:       "Request no-store",
+			header:     http.Header{"Cache-Control": []string{"no-store"}},
+			wantCached: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cacheRepo := new(mocks.CacheRepo)
+			cacheRepo.On("Create", mock.Anything, mock.Anything, "catalog", mock.Anything).Return(nil)
+			cacheCtrl := cache.NewController(cache.Options{NumWorkers: 1, BufferSize: 1}, cacheRepo, log.Log)
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			go cacheCtrl.Start(ctx)
+
+			cacheOut := NewCacheOut(CacheOutOptions{InvalidateTimeout: time.Second}, cacheCtrl, log.Log)
+			handler := gateway.New(gateway.GatewayOptions{Timeout: time.Second}, log.Log).MiddlewareFunc(
+				cacheOut.MiddlewareFunc(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.WriteHeader(http.StatusOK)
+				})),
+			)
+
+			req := httptest.NewRequest(http.MethodGet, "/products", nil)
+			for key, values := range tt.header {
+				req.Header[key] = values
+			}
+			req, result := cache.WithStoreResult(requestcontext.WithIngress(req, ingress))
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			assert.Nil(t, result.Wait(ctx))
+			if tt.wantCached {
+				cacheRepo.AssertNumberOfCalls(t, "Create", 1)
+			} else {
+				cacheRepo.AssertNotCalled(t, "Create", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
+
+func TestCacheOutInvalidatesBeforeResponding(t *testing.T) {
+	cacheCtrl := new(mocks.Controller)
+	cacheCtrl.On("IsInvalidatingResponse", mock.Anything, mock.Anything).Return(true)
+	cacheCtrl.On("HandleResponse", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	var invalidated, bounded bool
+	cacheCtrl.On("Invalidate", mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) {
+			_, bounded = args.Get(0).(context.Context).Deadline()
+			invalidated = true
+		}).
+		Return(int64(1), nil)
+
+	handler := NewCacheOut(CacheOutOptions{InvalidateTimeout: time.Second}, cacheCtrl, log.Log).MiddlewareFunc(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.True(t, invalidated, "invalidated before responding")
+			w.WriteHeader(http.StatusNoContent)
+		}),
+	)
+	req := httptest.NewRequest(http.MethodPost, "/products", nil)
+	req = requestcontext.WithIngress(req, crdv1alpha1.IngressHTTP{})
+	req = requestcontext.WithResponse(req, &http.Response{StatusCode: http.StatusNoContent, Header: http.Header{}})
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.True(t, invalidated)
+	assert.True(t, bounded, "invalidation has a timeout")
+}
@@ -0,0 +1,148 @@
+package cache
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gotway/gotway/internal/cache"
+	"github.com/gotway/gotway/internal/requestcontext"
+	"github.com/gotway/gotway/pkg/log"
+	"github.com/gotway/gotway/pkg/metrics"
+)
+
+// lockPollInterval is how often a replica waiting for another one checks the cache
+const lockPollInterval = 50 * time.Millisecond
+
+// call is a request in flight whose response is shared with the concurrent requests of the same key
+type call struct {
+	done      chan struct{}
+	once      sync.Once
+	res       *bufferedWriter
+	shareable bool
+}
+
+// calls holds the requests in flight by cache key
+type calls struct {
+	mu    sync.Mutex
+	calls map[string]*call
+}
+
+// join returns the call in flight for a key, starting a new one when there is none
+func (cs *calls) join(key string) (*call, bool) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if c, ok := cs.calls[key]; ok {
+		return c, false
+	}
+	c := &call{done: make(chan struct{})}
+	cs.calls[key] = c
+	return c, true
+}
+
+// leave finishes a call and wakes up the requests waiting for it, only the first result counts
+func (cs *calls) leave(key string, c *call, res *bufferedWriter, shareable bool) {
+	c.once.Do(func() {
+		cs.mu.Lock()
+		delete(cs.calls, key)
+		cs.mu.Unlock()
+
+		c.res = res
+		c.shareable = shareable
+		close(c.done)
+	})
+}
+
+func newCalls() *calls {
+	return &calls{calls: make(map[string]*call)}
+}
+
+// load requests the service on a cache miss, concurrent misses of the same key are coalesced
+// so only one request reaches the service and its response is shared if it can be cached
+func (c *cacheIn) load(
+	next http.Handler,
+	w http.ResponseWriter,
+	r *http.Request,
+	params cache.Params,
+	logger log.Logger,
+) {
+	if !c.options.Coalescing {
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	key := params.Service + "::" + cache.GetKey(r, params.Key)
+	inFlight, leader := c.inFlight.join(key)
+	if !leader {
+		select {
+		case <-inFlight.done:
+		case <-r.Context().Done():
+			return
+		}
+		if !inFlight.shareable {
+			next.ServeHTTP(w, r)
+			return
+		}
+		logger.Debug("coalesced response")
+		setCacheStatus(r, requestcontext.CacheStatusCoalesced)
+		metrics.CacheOperations.WithLabelValues(params.Service, metrics.CacheCoalesce).Inc()
+		inFlight.res.flush(w)
+		return
+	}
+
+	defer c.inFlight.leave(key, inFlight, nil, false)
+	bw := newBufferedWriter()
+	c.fetch(next, bw, r, params, logger)
+	shareable := c.cacheCtrl.IsCacheableResponse(r, bw.response(r), params)
+	c.inFlight.leave(key, inFlight, bw, shareable)
+	bw.flush(w)
+}
+
+// fetch requests the service. When coalescing is distributed, only the replica holding
+// the lock of the key does it while the others wait for its response to be cached
+func (c *cacheIn) fetch(
+	next http.Handler,
+	w http.ResponseWriter,
+	r *http.Request,
+	params cache.Params,
+	logger log.Logger,
+) {
+	if !c.options.DistributedCoalescing {
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	ticker := time.NewTicker(lockPollInterval)
+	defer ticker.Stop()
+	timeout := time.NewTimer(c.options.LockTimeout)
+	defer timeout.Stop()
+
+	for {
+		release, acquired, err := c.cacheCtrl.Lock(r, params, c.options.LockTimeout)
+		if err != nil {
+			logger.Error("error acquiring cache lock ", err)
+			next.ServeHTTP(w, r)
+			return
+		}
+		if acquired {
+			defer release()
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-timeout.C:
+			logger.Debug("timeout waiting for cache lock")
+			next.ServeHTTP(w, r)
+			return
+		case <-ticker.C:
+		}
+		if cached, err := c.cacheCtrl.PeekCache(r, params); err == nil && cached.IsFresh(time.Now()) {
+			logger.Debug("response cached by another replica")
+			writeCachedResponse(w, cached, time.Now())
+			return
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package cache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gotway/gotway/internal/mocks"
+	"github.com/gotway/gotway/internal/model"
+	"github.com/gotway/gotway/internal/requestcontext"
+	"github.com/gotway/gotway/pkg/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	crdv1alpha1 "github.com/gotway/gotway/pkg/kubernetes/crd/v1alpha1"
+)
+
+func TestCoalescing(t *testing.T) {
+	tests := []struct {
+		name          string
+		coalescing    bool
+		cacheable     bool
+		wantUpstreams int32
+	}{
+		{
+			name:          "Coalesced",
+			coalescing:    true,
+			cacheable:     true,
+			wantUpstreams: 1,
+		},
+		{
+			name:          "Not cacheable",
+			coalescing:    true,
+			cacheable:     false,
+			wantUpstreams: 5,
+		},
+		{
+			name:          "Disabled",
+			coalescing:    false,
+			cacheable:     true,
+			wantUpstreams: 5,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cacheCtrl := new(mocks.Controller)
+			cacheCtrl.On("IsCacheableRequest", mock.Anything).Return(true)
+			cacheCtrl.On("GetCache", mock.Anything, mock.Anything).Return(model.Cache{}, model.ErrCacheNotFound)
+			cacheCtrl.On("IsCacheableResponse", mock.Anything, mock.Anything, mock.Anything).Return(tt.cacheable)
+
+			var upstreams int32
+			release := make(chan struct{})
+			handler := NewCacheIn(
+				CacheInOptions{Coalescing: tt.coalescing},
+				cacheCtrl,
+				log.Log,
+			).MiddlewareFunc(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&upstreams, 1)
+				<-release
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusOK)
+				_, _ = w.Write([]byte(`{"name":"sneakers"}`))
+			}))
+
+			var wg sync.WaitGroup
+			recorders := make([]*httptest.ResponseRecorder, 5)
+			for i := range recorders {
+				recorders[i] = httptest.NewRecorder()
+				req := httptest.NewRequest(http.MethodGet, "/catalog/products", nil)
+				req = requestcontext.WithIngress(req, crdv1alpha1.IngressHTTP{})
+
+				wg.Add(1)
+				go func(rec *httptest.ResponseRecorder) {
+					defer wg.Done()
+					handler.ServeHTTP(rec, req)
+				}(recorders[i])
+			}
+			time.Sleep(100 * time.Millisecond)
+			close(release)
+			wg.Wait()
+
+			assert.Equal(t, tt.wantUpstreams, atomic.LoadInt32(&upstreams))
+			for _, rec := range recorders {
+				assert.Equal(t, http.StatusOK, rec.Code)
+				assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+				assert.Equal(t, `{"name":"sneakers"}`, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestDistributedCoalescing(t *testing.T) {
+	cached := model.Cache{
+		Path:       "/catalog/products",
+		StatusCode: http.StatusOK,
+		Headers:    http.Header{"Content-Type": []string{"application/json"}},
+		Body:       []byte(`{"name":"sneakers"}`),
+		TTL:        model.NewCacheTTL(30),
+		CreatedAt:  time.Now(),
+	}
+	cacheCtrl := new(mocks.Controller)
+	cacheCtrl.On("IsCacheableRequest", mock.Anything).Return(true)
+	cacheCtrl.On("GetCache", mock.Anything, mock.Anything).Return(model.Cache{}, model.ErrCacheNotFound)
+	cacheCtrl.On("PeekCache", mock.Anything, mock.Anything).Return(cached, nil)
+	cacheCtrl.On("Lock", mock.Anything, mock.Anything, time.Second).Return(nil, false, nil)
+	cacheCtrl.On("IsCacheableResponse", mock.Anything, mock.Anything, mock.Anything).Return(true)
+
+	var upstreams int32
+	handler := NewCacheIn(
+		CacheInOptions{Coalescing: true, DistributedCoalescing: true, LockTimeout: time.Second},
+		cacheCtrl,
+		log.Log,
+	).MiddlewareFunc(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&upstreams, 1)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/catalog/products", nil)
+	req = requestcontext.WithIngress(req, crdv1alpha1.IngressHTTP{})
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	assert.Equal(t, int32(0), atomic.LoadInt32(&upstreams))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, `{"name":"sneakers"}`, rec.Body.String())
+	// polling the cache while waiting for the lock is not counted as more misses
+	cacheCtrl.AssertNumberOfCalls(t, "GetCache", 1)
+}
@@ -0,0 +1,134 @@
+package cache
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gotway/gotway/internal/model"
+	"github.com/gotway/gotway/internal/requestcontext"
+)
+
+const (
+	// StatusHeader tells whether a response was served from the cache: HIT, MISS, STALE, BYPASS...
+	StatusHeader = "X-Cache"
+	// KeyHeader, TTLHeader and TagsHeader describe the cached response when debugging is enabled.
+	// Tags have their own header, as services declare them in cache.TagsHeader
+	KeyHeader  = "X-Cache-Key"
+	TTLHeader  = "X-Cache-TTL"
+	TagsHeader = "X-Cache-Debug-Tags"
+)
+
+// headerWriter adds the cache status to a response once it is known, just before its headers are written
+type headerWriter struct {
+	http.ResponseWriter
+	r           *http.Request
+	debug       bool
+	key         string
+	cached      *model.Cache
+	now         time.Time
+	wroteHeader bool
+}
+
+func (hw *headerWriter) WriteHeader(status int) {
+	if !hw.wroteHeader {
+		hw.wroteHeader = true
+		hw.setHeaders()
+	}
+	hw.ResponseWriter.WriteHeader(status)
+}
+
+func (hw *headerWriter) Write(p []byte) (int, error) {
+	if !hw.wroteHeader {
+		hw.WriteHeader(http.StatusOK)
+	}
+	return hw.ResponseWriter.Write(p)
+}
+
+func (hw *headerWriter) setHeaders() {
+	header := hw.Header()
+	var status string
+	if summary, err := requestcontext.GetSummary(hw.r); err == nil {
+		status = summary.CacheStatus
+	}
+	if status != "" {
+		header.Set(StatusHeader, strings.ToUpper(status))
+	}
+	if !hw.debug {
+		return
+	}
+	if hw.key != "" {
+		header.Set(KeyHeader, hw.key)
+	}
+	// a cached response that could not be served is not described
+	if hw.cached != nil && (status == requestcontext.CacheStatusHit || status == requestcontext.CacheStatusStale) {
+		remaining := time.Duration(hw.cached.TTL) - hw.cached.Age(hw.now)
+		if remaining < 0 {
+			remaining = 0
+		}
+		header.Set(TTLHeader, strconv.FormatInt(int64(remaining/time.Second), 10))
+		if len(hw.cached.Tags) > 0 {
+			header.Set(TagsHeader, strings.Join(hw.cached.Tags, ","))
+		}
+	}
+}
+
+func newHeaderWriter(w http.ResponseWriter, r *http.Request, debug bool) *headerWriter {
+	return &headerWriter{ResponseWriter: w, r: r, debug: debug, now: time.Now()}
+}
+
+// setAge sets the Age header of a cached response: the age it had when it was received,
+// plus the time it has been cached
+func setAge(header http.Header, cached model.Cache, now time.Time) {
+	header.Set("Age", strconv.FormatInt(int64(cached.CurrentAge(now)/time.Second), 10))
+}
+
+// ParseNetworks parses a list of IPs and CIDRs
+func ParseNetworks(values []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(values))
+	for _, value := range values {
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP '%s'", value)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 8 * net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR '%s': %v", value, err)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// isTrusted determines if a request comes directly from one of the networks
+func isTrusted(r *http.Request, networks []*net.IPNet) bool {
+	if len(networks) == 0 {
+		return false
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
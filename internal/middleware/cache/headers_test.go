@@ -0,0 +1,206 @@
+package cache
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gotway/gotway/internal/mocks"
+	"github.com/gotway/gotway/internal/model"
+	"github.com/gotway/gotway/internal/requestcontext"
+	"github.com/gotway/gotway/pkg/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	crdv1alpha1 "github.com/gotway/gotway/pkg/kubernetes/crd/v1alpha1"
+)
+
+func TestCacheHeaders(t *testing.T) {
+	ingress := crdv1alpha1.IngressHTTP{}
+	ingress.Spec.Service.Name = "catalog"
+
+	tests := []struct {
+		name        string
+		cacheable   bool
+		cached      *model.Cache
+		options     CacheInOptions
+		remoteAddr  string
+		wantHeaders map[string]string
+	}{
+		{
+			name:      "Bypass",
+			cacheable: false,
+			wantHeaders: map[string]string{
+				StatusHeader: "BYPASS",
+				"Age":        "",
+			},
+		},
+		{
+			name:      "Miss",
+			cacheable: true,
+			wantHeaders: map[string]string{
+				StatusHeader: "MISS",
+				"Age":        "",
+				KeyHeader:    "",
+			},
+		},
+		{
+			name:      "Hit",
+			cacheable: true,
+			cached: &model.Cache{
+				StatusCode: http.StatusOK,
+				Headers:    http.Header{"Age": []string{"5"}},
+				TTL:        model.NewCacheTTL(30),
+				Tags:       []string{"products"},
+				CreatedAt:  time.Now().Add(-10 * time.Second),
+			},
+			wantHeaders: map[string]string{
+				StatusHeader: "HIT",
+				"Age":        "15",
+				TTLHeader:    "",
+			},
+		},
+		{
+			name:      "Stale",
+			cacheable: true,
+			cached: &model.Cache{
+				StatusCode:           http.StatusOK,
+				Headers:              http.Header{},
+				TTL:                  model.NewCacheTTL(30),
+				StaleWhileRevalidate: model.NewCacheTTL(30),
+				CreatedAt:            time.Now().Add(-40 * time.Second),
+			},
+			options: CacheInOptions{Debug: true},
+			wantHeaders: map[string]string{
+				StatusHeader: "STALE",
+				"Age":        "40",
+				KeyHeader:    "catalog::/products",
+				TTLHeader:    "0",
+			},
+		},
+		{
+			name:      "Debug",
+			cacheable: true,
+			cached: &model.Cache{
+				StatusCode: http.StatusOK,
+				Headers:    http.Header{},
+				TTL:        model.NewCacheTTL(30),
+				Tags:       []string{"catalog", "products"},
+				CreatedAt:  time.Now().Add(-10 * time.Second),
+			},
+			options: CacheInOptions{Debug: true},
+			wantHeaders: map[string]string{
+				StatusHeader: "HIT",
+				KeyHeader:    "catalog::/products",
+				TTLHeader:    "19",
+				TagsHeader:   "catalog,products",
+			},
+		},
+		{
+			name:       "Trusted IP",
+			cacheable:  true,
+			options:    CacheInOptions{DebugNetworks: mustParseNetworks(t, "10.0.0.0/8")},
+			remoteAddr: "10.1.2.3:5432",
+			wantHeaders: map[string]string{
+				StatusHeader: "MISS",
+				KeyHeader:    "catalog::/products",
+			},
+		},
+		{
+			name:       "Untrusted IP",
+			cacheable:  true,
+			options:    CacheInOptions{DebugNetworks: mustParseNetworks(t, "10.0.0.0/8")},
+			remoteAddr: "192.168.1.1:5432",
+			wantHeaders: map[string]string{
+				StatusHeader: "MISS",
+				KeyHeader:    "",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cacheCtrl := new(mocks.Controller)
+			cacheCtrl.On("IsCacheableRequest", mock.Anything).Return(tt.cacheable)
+			if tt.cached != nil {
+				cacheCtrl.On("GetCache", mock.Anything, mock.Anything).Return(*tt.cached, nil)
+			} else {
+				cacheCtrl.On("GetCache", mock.Anything, mock.Anything).Return(model.Cache{}, model.ErrCacheNotFound)
+			}
+
+			handler := NewCacheIn(
+				tt.options,
+				cacheCtrl,
+				log.Log,
+			).MiddlewareFunc(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set(StatusHeader, "HIT from upstream")
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/products", nil)
+			if tt.remoteAddr != "" {
+				req.RemoteAddr = tt.remoteAddr
+			}
+			req = requestcontext.WithIngress(req, ingress)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			assert.Equal(t, http.StatusOK, rec.Code)
+			for key, value := range tt.wantHeaders {
+				assert.Equal(t, value, rec.Header().Get(key), key)
+			}
+		})
+	}
+}
+
+func TestParseNetworks(t *testing.T) {
+	tests := []struct {
+		name     string
+		values   []string
+		contains []string
+		wantErr  bool
+	}{
+		{
+			name:     "IPs and CIDRs",
+			values:   []string{"127.0.0.1", "::1", "10.0.0.0/8"},
+			contains: []string{"127.0.0.1", "::1", "10.20.30.40"},
+		},
+		{
+			name:    "Invalid IP",
+			values:  []string{"localhost"},
+			wantErr: true,
+		},
+		{
+			name:    "Invalid CIDR",
+			values:  []string{"10.0.0.0/64"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			networks, err := ParseNetworks(tt.values)
+
+			if tt.wantErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			for _, ip := range tt.contains {
+				req := httptest.NewRequest(http.MethodGet, "/", nil)
+				req.RemoteAddr = ip
+				assert.True(t, isTrusted(req, networks), ip)
+			}
+		})
+	}
+}
+
+func mustParseNetworks(t *testing.T, values ...string) []*net.IPNet {
+	networks, err := ParseNetworks(values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return networks
+}
@@ -0,0 +1,45 @@
+package cache
+
+import (
+	"github.com/gotway/gotway/internal/cache"
+	"github.com/gotway/gotway/internal/model"
+
+	crdv1alpha1 "github.com/gotway/gotway/pkg/kubernetes/crd/v1alpha1"
+)
+
+// GetParams maps the cache spec of an ingress to the parameters of the cache controller
+func GetParams(ingress crdv1alpha1.IngressHTTP) cache.Params {
+	params := cache.Params{
+		Service:  ingress.Spec.Service.Name,
+		TTL:      ingress.Spec.Cache.TTL,
+		Statuses: ingress.Spec.Cache.Statuses,
+		Tags:     ingress.Spec.Cache.Tags,
+
+		StaleWhileRevalidate: ingress.Spec.Cache.StaleWhileRevalidate,
+		StaleIfError:         ingress.Spec.Cache.StaleIfError,
+		IgnoreOriginHeaders:  ingress.Spec.Cache.IgnoreOriginHeaders,
+	}
+	if invalidate := ingress.Spec.Cache.Invalidate; invalidate != nil {
+		params.Invalidate = cache.InvalidateOptions{
+			Enabled: invalidate.Enabled,
+			Paths:   invalidate.Paths,
+			Tags:    invalidate.Tags,
+		}
+	}
+	if limits := ingress.Spec.Cache.Limits; limits != nil {
+		params.MaxEntryBytes = limits.MaxEntryBytes
+		params.Quota = model.CacheQuota{
+			MaxBytes:   limits.MaxBytes,
+			MaxEntries: limits.MaxEntries,
+		}
+	}
+	if key := ingress.Spec.Cache.Key; key != nil {
+		params.Key = cache.KeyOptions{
+			Headers:            key.Headers,
+			Cookies:            key.Cookies,
+			QueryParams:        key.QueryParams,
+			IgnoredQueryParams: key.IgnoredQueryParams,
+		}
+	}
+	return params
+}
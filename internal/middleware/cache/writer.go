@@ -0,0 +1,83 @@
+package cache
+
+import (
+	"bytes"
+	"net/http"
+
+	"github.com/gotway/gotway/internal/requestcontext"
+)
+
+// bufferedWriter holds a response until it is decided whether it reaches the client
+type bufferedWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (bw *bufferedWriter) Header() http.Header {
+	return bw.header
+}
+
+func (bw *bufferedWriter) WriteHeader(status int) {
+	if bw.status == 0 {
+		bw.status = status
+	}
+}
+
+func (bw *bufferedWriter) Write(p []byte) (int, error) {
+	if bw.status == 0 {
+		bw.status = http.StatusOK
+	}
+	return bw.body.Write(p)
+}
+
+// flush writes the response, it may be flushed to several clients so the buffer is not consumed
+func (bw *bufferedWriter) flush(w http.ResponseWriter) {
+	for key, values := range bw.header {
+		if key == http.CanonicalHeaderKey(requestcontext.RequestIDHeader) {
+			continue
+		}
+		w.Header()[key] = values
+	}
+	w.WriteHeader(bw.statusCode())
+	_, _ = w.Write(bw.body.Bytes())
+}
+
+// response describes the buffered response, without its body
+func (bw *bufferedWriter) response(r *http.Request) *http.Response {
+	return &http.Response{
+		StatusCode: bw.statusCode(),
+		Header:     bw.header,
+		Request:    r,
+	}
+}
+
+func (bw *bufferedWriter) statusCode() int {
+	if bw.status == 0 {
+		return http.StatusOK
+	}
+	return bw.status
+}
+
+func newBufferedWriter() *bufferedWriter {
+	return &bufferedWriter{header: http.Header{}}
+}
+
+// discardWriter handles responses that nobody is waiting for
+type discardWriter struct {
+	header http.Header
+}
+
+func (dw *discardWriter) Header() http.Header {
+	return dw.header
+}
+
+func (dw *discardWriter) WriteHeader(int) {}
+
+func (dw *discardWriter) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+func newDiscardWriter() *discardWriter {
+	return &discardWriter{header: http.Header{}}
+}
@@ -0,0 +1,160 @@
+package compression
+
+import (
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	httpError "github.com/gotway/gotway/internal/http/error"
+	"github.com/gotway/gotway/internal/middleware"
+	"github.com/gotway/gotway/internal/requestcontext"
+	"github.com/gotway/gotway/pkg/log"
+
+	crdv1alpha1 "github.com/gotway/gotway/pkg/kubernetes/crd/v1alpha1"
+)
+
+const (
+	encodingBrotli   = "br"
+	encodingGzip     = "gzip"
+	encodingIdentity = "identity"
+)
+
+// supportedEncodings are sorted by preference
+var supportedEncodings = []string{encodingBrotli, encodingGzip}
+
+// Options are the global compression settings, they apply when an ingress does not define its own
+type Options struct {
+	Enabled      bool
+	MinSize      int64
+	ContentTypes []string
+	Level        int
+}
+
+type compression struct {
+	options Options
+	logger  log.Logger
+}
+
+func (c *compression) MiddlewareFunc(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger := requestcontext.Logger(r, c.logger)
+		logger.Debug("compression")
+		ingress, err := requestcontext.GetIngress(r)
+		if err != nil {
+			httpError.Handle(err, w, r, logger)
+			return
+		}
+
+		options := c.getOptions(ingress)
+		if !options.Enabled || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := newCompressWriter(w, options, negotiateEncoding(r.Header.Get("Accept-Encoding")))
+		defer func() {
+			if err := cw.Close(); err != nil {
+				logger.Error("error compressing response ", err)
+			}
+		}()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+func (c *compression) getOptions(ingress crdv1alpha1.IngressHTTP) Options {
+	options := c.options
+	settings := ingress.Spec.Compression
+	if settings == nil {
+		return options
+	}
+	if settings.Enabled != nil {
+		options.Enabled = *settings.Enabled
+	}
+	if settings.MinSize > 0 {
+		options.MinSize = settings.MinSize
+	}
+	if len(settings.ContentTypes) > 0 {
+		options.ContentTypes = settings.ContentTypes
+	}
+	if settings.Level > 0 {
+		options.Level = settings.Level
+	}
+	return options
+}
+
+// negotiateEncoding picks the preferred supported encoding accepted by the client,
+// returning identity when none is acceptable
+func negotiateEncoding(acceptEncoding string) string {
+	qualities := make(map[string]float64)
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		fields := strings.Split(part, ";")
+		coding := strings.ToLower(strings.TrimSpace(fields[0]))
+		if coding == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if !strings.HasPrefix(param, "q=") {
+				continue
+			}
+			if v, err := strconv.ParseFloat(strings.TrimPrefix(param, "q="), 64); err == nil {
+				q = v
+			}
+		}
+		qualities[coding] = q
+	}
+
+	candidates := make([]string, 0, len(supportedEncodings))
+	for _, encoding := range supportedEncodings {
+		q, ok := qualities[encoding]
+		if !ok {
+			q, ok = qualities["*"]
+		}
+		if ok && q > 0 {
+			candidates = append(candidates, encoding)
+		}
+	}
+	if len(candidates) == 0 {
+		return encodingIdentity
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return quality(qualities, candidates[i]) > quality(qualities, candidates[j])
+	})
+	return candidates[0]
+}
+
+func quality(qualities map[string]float64, encoding string) float64 {
+	if q, ok := qualities[encoding]; ok {
+		return q
+	}
+	return qualities["*"]
+}
+
+// isCompressibleType checks a Content-Type against a list of media types,
+// which may use wildcard subtypes such as text/*
+func isCompressibleType(contentType string, contentTypes []string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, t := range contentTypes {
+		t = strings.ToLower(t)
+		if t == mediaType {
+			return true
+		}
+		if strings.HasSuffix(t, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(t, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+func New(options Options, logger log.Logger) middleware.Middleware {
+	return &compression{
+		options: options,
+		logger:  logger,
+	}
+}
@@ -0,0 +1,204 @@
+package compression
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gotway/gotway/internal/requestcontext"
+	"github.com/gotway/gotway/pkg/log"
+	"github.com/stretchr/testify/assert"
+
+	crdv1alpha1 "github.com/gotway/gotway/pkg/kubernetes/crd/v1alpha1"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := []struct {
+		acceptEncoding string
+		wantEncoding   string
+	}{
+		{"", encodingIdentity},
+		{"gzip", encodingGzip},
+		{"gzip, deflate, br", encodingBrotli},
+		{"br;q=0.5, gzip;q=0.8", encodingGzip},
+		{"br;q=0, gzip;q=0", encodingIdentity},
+		{"*", encodingBrotli},
+		{"*;q=0.1, gzip", encodingGzip},
+		{"deflate", encodingIdentity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.acceptEncoding, func(t *testing.T) {
+			assert.Equal(t, tt.wantEncoding, negotiateEncoding(tt.acceptEncoding))
+		})
+	}
+}
+
+func TestIsCompressibleType(t *testing.T) {
+	contentTypes := []string{"application/json", "text/*"}
+
+	assert.True(t, isCompressibleType("application/json; charset=utf-8", contentTypes))
+	assert.True(t, isCompressibleType("text/html", contentTypes))
+	assert.False(t, isCompressibleType("image/png", contentTypes))
+	assert.False(t, isCompressibleType("", contentTypes))
+}
+
+func TestMiddleware(t *testing.T) {
+	body := strings.Repeat(`{"name":"sneakers"}`, 100)
+	options := Options{
+		Enabled:      true,
+		MinSize:      1024,
+		ContentTypes: []string{"application/json"},
+	}
+
+	enabled, disabled := true, false
+
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		contentType    string
+		body           string
+		ingress        crdv1alpha1.IngressHTTP
+		disabled       bool
+		wantEncoding   string
+		wantVary       bool
+	}{
+		{
+			name:           "Gzip",
+			acceptEncoding: "gzip",
+			contentType:    "application/json",
+			body:           body,
+			wantEncoding:   encodingGzip,
+			wantVary:       true,
+		},
+		{
+			name:           "Brotli",
+			acceptEncoding: "gzip, br",
+			contentType:    "application/json",
+			body:           body,
+			wantEncoding:   encodingBrotli,
+			wantVary:       true,
+		},
+		{
+			name:           "Not accepted",
+			acceptEncoding: "",
+			contentType:    "application/json",
+			body:           body,
+			wantVary:       true,
+		},
+		{
+			name:           "Smaller than min size",
+			acceptEncoding: "gzip",
+			contentType:    "application/json",
+			body:           `{}`,
+			wantVary:       true,
+		},
+		{
+			name:           "Not compressible content type",
+			acceptEncoding: "gzip",
+			contentType:    "image/png",
+			body:           body,
+		},
+		{
+			name:           "Disabled by ingress",
+			acceptEncoding: "gzip",
+			contentType:    "application/json",
+			body:           body,
+			ingress: crdv1alpha1.IngressHTTP{
+				Spec: crdv1alpha1.IngressHTTPSpec{
+					Compression: &crdv1alpha1.Compression{Enabled: &disabled},
+				},
+			},
+		},
+		{
+			name:           "Enabled by ingress",
+			acceptEncoding: "gzip",
+			contentType:    "application/json",
+			body:           body,
+			ingress: crdv1alpha1.IngressHTTP{
+				Spec: crdv1alpha1.IngressHTTPSpec{
+					Compression: &crdv1alpha1.Compression{Enabled: &enabled},
+				},
+			},
+			disabled:     true,
+			wantEncoding: encodingGzip,
+			wantVary:     true,
+		},
+		{
+			name:           "Ingress settings without enabled",
+			acceptEncoding: "gzip",
+			contentType:    "application/json",
+			body:           `{"name":"sneakers"}`,
+			ingress: crdv1alpha1.IngressHTTP{
+				Spec: crdv1alpha1.IngressHTTPSpec{
+					Compression: &crdv1alpha1.Compression{MinSize: 10},
+				},
+			},
+			wantEncoding: encodingGzip,
+			wantVary:     true,
+		},
+		{
+			name:           "Disabled globally",
+			acceptEncoding: "gzip",
+			contentType:    "application/json",
+			body:           body,
+			disabled:       true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := options
+			options.Enabled = !tt.disabled
+			handler := New(options, log.Log).MiddlewareFunc(
+				http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.Header().Set("Content-Type", tt.contentType)
+					w.Header().Set("Content-Length", "1")
+					w.Header().Set("ETag", `"v1"`)
+					w.WriteHeader(http.StatusOK)
+					_, _ = w.Write([]byte(tt.body))
+				}),
+			)
+			req := httptest.NewRequest(http.MethodGet, "/products", nil)
+			req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			req = requestcontext.WithIngress(req, tt.ingress)
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			res := rec.Result()
+			assert.Equal(t, http.StatusOK, res.StatusCode)
+			assert.Equal(t, tt.wantEncoding, res.Header.Get("Content-Encoding"))
+			assert.Equal(t, tt.wantVary, res.Header.Get("Vary") == "Accept-Encoding")
+			assert.Equal(t, tt.body, decode(t, tt.wantEncoding, rec.Body.Bytes()))
+			if tt.wantEncoding != "" {
+				assert.Equal(t, `W/"v1"`, res.Header.Get("ETag"))
+				assert.Empty(t, res.Header.Get("Content-Length"))
+			} else {
+				assert.Equal(t, `"v1"`, res.Header.Get("ETag"))
+			}
+		})
+	}
+}
+
+func decode(t *testing.T, encoding string, body []byte) string {
+	var decoded []byte
+	var err error
+	switch encoding {
+	case encodingGzip:
+		reader, gzErr := gzip.NewReader(bytes.NewReader(body))
+		assert.Nil(t, gzErr)
+		decoded, err = ioutil.ReadAll(reader)
+	case encodingBrotli:
+		decoded, err = ioutil.ReadAll(brotli.NewReader(bytes.NewReader(body)))
+	default:
+		decoded = body
+	}
+	assert.Nil(t, err)
+	return string(decoded)
+}
@@ -0,0 +1,165 @@
+package compression
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+// compressWriter buffers the beginning of a response until it knows whether
+// it is big enough to be compressed, then it either streams it compressed
+// or writes it verbatim
+type compressWriter struct {
+	http.ResponseWriter
+	options  Options
+	encoding string
+
+	status      int
+	wroteHeader bool
+	decided     bool
+	buf         []byte
+	encoder     io.WriteCloser
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.wroteHeader {
+		return
+	}
+	cw.wroteHeader = true
+	cw.status = status
+}
+
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.decided {
+		return cw.write(p)
+	}
+
+	if !cw.isCompressible() {
+		if err := cw.decide(false); err != nil {
+			return 0, err
+		}
+		return cw.write(p)
+	}
+	cw.buf = append(cw.buf, p...)
+	if int64(len(cw.buf)) >= cw.options.MinSize {
+		if err := cw.decide(cw.encoding != encodingIdentity); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Close flushes the buffered response and finishes the compressed stream
+func (cw *compressWriter) Close() error {
+	if !cw.wroteHeader {
+		return nil
+	}
+	if !cw.decided {
+		if err := cw.decide(false); err != nil {
+			return err
+		}
+	}
+	if cw.encoder != nil {
+		return cw.encoder.Close()
+	}
+	return nil
+}
+
+func (cw *compressWriter) write(p []byte) (int, error) {
+	if cw.encoder != nil {
+		return cw.encoder.Write(p)
+	}
+	return cw.ResponseWriter.Write(p)
+}
+
+// decide writes the headers and the buffered body, compressing them if needed
+func (cw *compressWriter) decide(compress bool) error {
+	cw.decided = true
+	header := cw.Header()
+	if cw.isCompressible() {
+		addVary(header, "Accept-Encoding")
+	}
+	if compress {
+		header.Set("Content-Encoding", cw.encoding)
+		header.Del("Content-Length")
+		// the compressed body differs from the one of the service, so a strong validator no longer holds
+		if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			header.Set("ETag", "W/"+etag)
+		}
+		cw.encoder = newEncoder(cw.ResponseWriter, cw.encoding, cw.options.Level)
+	}
+	cw.ResponseWriter.WriteHeader(cw.status)
+
+	if len(cw.buf) == 0 {
+		return nil
+	}
+	buf := cw.buf
+	cw.buf = nil
+	_, err := cw.write(buf)
+	return err
+}
+
+// isCompressible checks whether the response could be compressed for some client
+func (cw *compressWriter) isCompressible() bool {
+	switch {
+	case cw.status < http.StatusOK,
+		cw.status == http.StatusNoContent,
+		cw.status == http.StatusPartialContent,
+		cw.status == http.StatusNotModified:
+		return false
+	}
+	header := cw.Header()
+	if header.Get("Content-Encoding") != "" {
+		return false
+	}
+	if strings.Contains(strings.ToLower(header.Get("Cache-Control")), "no-transform") {
+		return false
+	}
+	return isCompressibleType(header.Get("Content-Type"), cw.options.ContentTypes)
+}
+
+func addVary(header http.Header, value string) {
+	for _, v := range header.Values("Vary") {
+		for _, field := range strings.Split(v, ",") {
+			field = strings.TrimSpace(field)
+			if field == "*" || strings.EqualFold(field, value) {
+				return
+			}
+		}
+	}
+	header.Add("Vary", value)
+}
+
+func newEncoder(w io.Writer, encoding string, level int) io.WriteCloser {
+	if encoding == encodingBrotli {
+		if level <= 0 {
+			level = brotli.DefaultCompression
+		}
+		if level > brotli.BestCompression {
+			level = brotli.BestCompression
+		}
+		return brotli.NewWriterLevel(w, level)
+	}
+	if level <= 0 {
+		level = gzip.DefaultCompression
+	}
+	if level > gzip.BestCompression {
+		level = gzip.BestCompression
+	}
+	gw, _ := gzip.NewWriterLevel(w, level)
+	return gw
+}
+
+func newCompressWriter(w http.ResponseWriter, options Options, encoding string) *compressWriter {
+	return &compressWriter{
+		ResponseWriter: w,
+		options:        options,
+		encoding:       encoding,
+	}
+}
@@ -0,0 +1,30 @@
+package errorpage
+
+import (
+	"net/http"
+
+	httpError "github.com/gotway/gotway/internal/http/error"
+	"github.com/gotway/gotway/internal/middleware"
+	"github.com/gotway/gotway/internal/requestcontext"
+	"github.com/gotway/gotway/pkg/log"
+)
+
+type errorPage struct {
+	renderer *httpError.Renderer
+	logger   log.Logger
+}
+
+func (e *errorPage) MiddlewareFunc(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger := requestcontext.Logger(r, e.logger)
+		logger.Debug("error page")
+		next.ServeHTTP(w, httpError.WithRenderer(r, e.renderer))
+	})
+}
+
+func New(renderer *httpError.Renderer, logger log.Logger) middleware.Middleware {
+	return &errorPage{
+		renderer: renderer,
+		logger:   logger,
+	}
+}
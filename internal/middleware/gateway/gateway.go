@@ -3,17 +3,25 @@ package cache
 import (
 	"fmt"
 	"net/http"
-	"net/url"
+	"strconv"
 	"time"
 
 	httpError "github.com/gotway/gotway/internal/http/error"
 	"github.com/gotway/gotway/internal/middleware"
 	"github.com/gotway/gotway/internal/requestcontext"
 	"github.com/gotway/gotway/pkg/log"
+	"github.com/gotway/gotway/pkg/metrics"
+	"github.com/gotway/gotway/pkg/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 
 	crdv1alpha1 "github.com/gotway/gotway/pkg/kubernetes/crd/v1alpha1"
 )
 
+var tracer = otel.Tracer("github.com/gotway/gotway/internal/middleware/gateway")
+
 type GatewayOptions struct {
 	Timeout time.Duration
 }
@@ -25,40 +33,59 @@ type gateway struct {
 
 func (g *gateway) MiddlewareFunc(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		g.logger.Debug("gateway")
+		logger := requestcontext.Logger(r, g.logger)
+		logger.Debug("gateway")
 		ingress, err := requestcontext.GetIngress(r)
 		if err != nil {
-			httpError.Handle(err, w, g.logger)
+			httpError.Handle(err, w, r, logger)
 			return
 		}
 
 		if !ingress.Status.IsServiceHealthy {
-			http.Error(w, "service not available", http.StatusServiceUnavailable)
+			httpError.Write(w, r, http.StatusServiceUnavailable, "service not available")
 			return
 		}
 
 		serviceReq, err := getServiceRequest(r, ingress)
 		if err != nil {
-			httpError.Handle(err, w, g.logger)
+			httpError.Handle(err, w, r, logger)
 			return
 		}
 
+		ctx, span := tracer.Start(r.Context(), "gateway",
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(
+				attribute.String("gotway.service", ingress.Spec.Service.Name),
+				attribute.String("http.method", serviceReq.Method),
+				attribute.String("http.url", serviceReq.URL.String()),
+			),
+		)
+		otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(serviceReq.Header))
+		start := time.Now()
 		res, err := g.client.Do(serviceReq)
+		duration := time.Since(start)
+		requestcontext.Summarize(r, func(s *requestcontext.Summary) {
+			s.Upstream = serviceReq.URL.String()
+			s.UpstreamDuration = duration
+		})
+		status := "error"
+		if err == nil {
+			status = strconv.Itoa(res.StatusCode)
+			span.SetAttributes(attribute.Int("http.status_code", res.StatusCode))
+		}
+		metrics.UpstreamDuration.
+			WithLabelValues(ingress.Spec.Service.Name, serviceReq.Method, status).
+			Observe(duration.Seconds())
+		tracing.EndSpan(span, err)
 		if err != nil {
-			g.logger.Error("error requesting service ", err)
-			w.WriteHeader(http.StatusBadGateway)
+			logger.Error("error requesting service ", err)
+			httpError.Write(w, r, http.StatusBadGateway, "error requesting service")
 			return
 		}
-		g.log(r, res, serviceReq.URL)
-
 		next.ServeHTTP(w, requestcontext.WithResponse(r, res))
 	})
 }
 
-func (g *gateway) log(req *http.Request, res *http.Response, target *url.URL) {
-	g.logger.Infof("%s %s => %s %d", req.Method, req.URL, target, res.StatusCode)
-}
-
 func getServiceRequest(r *http.Request, ingress crdv1alpha1.IngressHTTP) (*http.Request, error) {
 	url := ingress.Spec.Service.URL + r.URL.Path
 	if r.URL.RawQuery != "" {
@@ -70,6 +97,14 @@ func getServiceRequest(r *http.Request, ingress crdv1alpha1.IngressHTTP) (*http.
 	}
 	serviceReq.Header.Add("X-Forwarded-Host", r.Host)
 	serviceReq.Header.Add("X-Origin-Host", serviceReq.Host)
+	if requestID, err := requestcontext.GetRequestID(r); err == nil {
+		serviceReq.Header.Set(requestcontext.RequestIDHeader, requestID)
+	}
+	if stale, err := requestcontext.GetStaleCache(r); err == nil {
+		for key, values := range stale.ConditionalHeaders() {
+			serviceReq.Header[key] = values
+		}
+	}
 	return serviceReq, nil
 }
 
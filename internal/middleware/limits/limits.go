@@ -0,0 +1,114 @@
+package limits
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	httpError "github.com/gotway/gotway/internal/http/error"
+	"github.com/gotway/gotway/internal/middleware"
+	"github.com/gotway/gotway/internal/model"
+	"github.com/gotway/gotway/internal/requestcontext"
+	"github.com/gotway/gotway/pkg/log"
+
+	crdv1alpha1 "github.com/gotway/gotway/pkg/kubernetes/crd/v1alpha1"
+)
+
+// Options are the global limits, they apply when an ingress does not define its own
+type Options struct {
+	MaxRequestBodyBytes int64
+	MaxHeaderBytes      int64
+	MaxURLLength        int64
+}
+
+type limits struct {
+	options Options
+	logger  log.Logger
+}
+
+func (l *limits) MiddlewareFunc(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger := requestcontext.Logger(r, l.logger)
+		logger.Debug("limits")
+		ingress, err := requestcontext.GetIngress(r)
+		if err != nil {
+			httpError.Handle(err, w, r, logger)
+			return
+		}
+		options := l.getOptions(ingress)
+
+		if options.MaxURLLength > 0 && int64(len(r.URL.RequestURI())) > options.MaxURLLength {
+			httpError.Handle(model.ErrURITooLong, w, r, logger)
+			return
+		}
+		if options.MaxHeaderBytes > 0 && headerSize(r.Header) > options.MaxHeaderBytes {
+			httpError.Handle(model.ErrRequestHeaderFieldsTooLarge, w, r, logger)
+			return
+		}
+		if options.MaxRequestBodyBytes > 0 && r.Body != nil {
+			if r.ContentLength > options.MaxRequestBodyBytes {
+				httpError.Handle(model.ErrRequestBodyTooLarge, w, r, logger)
+				return
+			}
+			if err := limitBody(r, options.MaxRequestBodyBytes); err != nil {
+				httpError.Handle(err, w, r, logger)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (l *limits) getOptions(ingress crdv1alpha1.IngressHTTP) Options {
+	options := l.options
+	limits := ingress.Spec.Limits
+	if limits == nil {
+		return options
+	}
+	if limits.MaxRequestBodyBytes > 0 {
+		options.MaxRequestBodyBytes = limits.MaxRequestBodyBytes
+	}
+	if limits.MaxHeaderBytes > 0 {
+		options.MaxHeaderBytes = limits.MaxHeaderBytes
+	}
+	if limits.MaxURLLength > 0 {
+		options.MaxURLLength = limits.MaxURLLength
+	}
+	return options
+}
+
+// limitBody buffers the request body, failing if it is bigger than maxBytes.
+// Buffering is needed because chunked requests do not announce their length.
+func limitBody(r *http.Request, maxBytes int64) error {
+	bodyBytes, err := ioutil.ReadAll(io.LimitReader(r.Body, maxBytes+1))
+	r.Body.Close()
+	if err != nil {
+		return err
+	}
+	if int64(len(bodyBytes)) > maxBytes {
+		return model.ErrRequestBodyTooLarge
+	}
+	r.Body = ioutil.NopCloser(bytes.NewBuffer(bodyBytes))
+	r.ContentLength = int64(len(bodyBytes))
+	return nil
+}
+
+// headerSize approximates the size of the headers on the wire
+func headerSize(header http.Header) int64 {
+	var size int64
+	for name, values := range header {
+		for _, value := range values {
+			size += int64(len(name) + len(value) + len(": \r\n"))
+		}
+	}
+	return size
+}
+
+func New(options Options, logger log.Logger) middleware.Middleware {
+	return &limits{
+		options: options,
+		logger:  logger,
+	}
+}
@@ -0,0 +1,103 @@
+package limits
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gotway/gotway/internal/requestcontext"
+	"github.com/gotway/gotway/pkg/log"
+	"github.com/stretchr/testify/assert"
+
+	crdv1alpha1 "github.com/gotway/gotway/pkg/kubernetes/crd/v1alpha1"
+)
+
+func TestMiddleware(t *testing.T) {
+	options := Options{
+		MaxRequestBodyBytes: 16,
+		MaxHeaderBytes:      128,
+		MaxURLLength:        32,
+	}
+
+	tests := []struct {
+		name          string
+		url           string
+		header        http.Header
+		body          string
+		contentLength int64
+		limits        *crdv1alpha1.Limits
+		wantStatus    int
+	}{
+		{
+			name:       "Within limits",
+			url:        "/products",
+			body:       `{"name":"shoe"}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Body too large",
+			url:        "/products",
+			body:       `{"name":"sneakers"}`,
+			wantStatus: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:          "Chunked body too large",
+			url:           "/products",
+			body:          `{"name":"sneakers"}`,
+			contentLength: -1,
+			wantStatus:    http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:       "URL too long",
+			url:        "/products?name=" + strings.Repeat("a", 32),
+			wantStatus: http.StatusRequestURITooLong,
+		},
+		{
+			name:       "Headers too large",
+			url:        "/products",
+			header:     http.Header{"Cookie": []string{strings.Repeat("a", 128)}},
+			wantStatus: http.StatusRequestHeaderFieldsTooLarge,
+		},
+		{
+			name:       "Overridden by ingress",
+			url:        "/products",
+			body:       `{"name":"sneakers"}`,
+			limits:     &crdv1alpha1.Limits{MaxRequestBodyBytes: 1024},
+			wantStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotBody string
+			handler := New(options, log.Log).MiddlewareFunc(
+				http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					body, err := ioutil.ReadAll(r.Body)
+					assert.Nil(t, err)
+					gotBody = string(body)
+					w.WriteHeader(http.StatusOK)
+				}),
+			)
+			req := httptest.NewRequest(http.MethodPost, tt.url, strings.NewReader(tt.body))
+			if tt.contentLength != 0 {
+				req.ContentLength = tt.contentLength
+			}
+			for key, values := range tt.header {
+				req.Header[key] = values
+			}
+			req = requestcontext.WithIngress(req, crdv1alpha1.IngressHTTP{
+				Spec: crdv1alpha1.IngressHTTPSpec{Limits: tt.limits},
+			})
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			if tt.wantStatus == http.StatusOK {
+				assert.Equal(t, tt.body, gotBody)
+			}
+		})
+	}
+}
@@ -1,18 +1,28 @@
 package matchingress
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	httpError "github.com/gotway/gotway/internal/http/error"
 	"github.com/gotway/gotway/internal/middleware"
+	"github.com/gotway/gotway/internal/openapi"
 	"github.com/gotway/gotway/internal/requestcontext"
 	kubeCtrl "github.com/gotway/gotway/pkg/kubernetes/controller"
 	"github.com/gotway/gotway/pkg/log"
+	"github.com/gotway/gotway/pkg/metrics"
+	"github.com/gotway/gotway/pkg/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
 
 	crdv1alpha1 "github.com/gotway/gotway/pkg/kubernetes/crd/v1alpha1"
 )
 
+var tracer = otel.Tracer("github.com/gotway/gotway/internal/middleware/matchingress")
+
 type matchIngress struct {
 	kubeCtrl *kubeCtrl.Controller
 	logger   log.Logger
@@ -20,13 +30,29 @@ type matchIngress struct {
 
 func (m *matchIngress) MiddlewareFunc(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		m.logger.Debug("match ingress")
+		logger := requestcontext.Logger(r, m.logger)
+		logger.Debug("match ingress")
 
+		start := time.Now()
+		_, span := tracer.Start(r.Context(), "match-ingress")
 		ingress, err := m.kubeCtrl.FindIngress(getIngressMatcher(r))
 		if err != nil {
-			httpError.Handle(err, w, m.logger)
+			tracing.EndSpan(span, err)
+			httpError.Handle(err, w, r, logger)
+			if errors.Is(err, kubeCtrl.ErrIngressNotFound) {
+				// they never reach the metrics middleware, so they are labelled without ingress nor service
+				labels := []string{"", "", r.Method, strconv.Itoa(http.StatusNotFound)}
+				metrics.Requests.WithLabelValues(labels...).Inc()
+				metrics.RequestDuration.WithLabelValues(labels...).Observe(time.Since(start).Seconds())
+			}
 			return
 		}
+		span.SetAttributes(attribute.String("gotway.ingress", ingress.Name))
+		span.End()
+		requestcontext.Summarize(r, func(s *requestcontext.Summary) {
+			s.Ingress = ingress.Name
+			s.Service = ingress.Spec.Service.Name
+		})
 
 		next.ServeHTTP(w, requestcontext.WithIngress(r, ingress))
 	})
@@ -51,6 +77,9 @@ func getIngressMatcher(r *http.Request) kubeCtrl.IngressMatcher {
 		if match.PathPrefix != "" && !strings.HasPrefix(r.URL.RawPath, match.PathPrefix) {
 			return false
 		}
+		if match.PathTemplate != "" && !openapi.MatchPathTemplate(match.PathTemplate, r.URL.Path) {
+			return false
+		}
 		return true
 	}
 }
@@ -0,0 +1,31 @@
+package matchingress
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	kubeCtrl "github.com/gotway/gotway/pkg/kubernetes/controller"
+	"github.com/gotway/gotway/pkg/kubernetes/crd/v1alpha1/apis/clientset/versioned/fake"
+	"github.com/gotway/gotway/pkg/log"
+	"github.com/gotway/gotway/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddlewareNotFound(t *testing.T) {
+	ctrl := kubeCtrl.New(kubeCtrl.Options{}, fake.NewSimpleClientset(), log.Log)
+	handler := New(ctrl, log.Log).MiddlewareFunc(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t.Error("unmatched requests should not be handled")
+		}),
+	)
+	counter := metrics.Requests.WithLabelValues("", "", http.MethodGet, "404")
+	before := testutil.ToFloat64(counter)
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/unknown", nil))
+
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Equal(t, before+1, testutil.ToFloat64(counter))
+}
@@ -0,0 +1,52 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	httpError "github.com/gotway/gotway/internal/http/error"
+	"github.com/gotway/gotway/internal/middleware"
+	"github.com/gotway/gotway/internal/requestcontext"
+	"github.com/gotway/gotway/pkg/log"
+	"github.com/gotway/gotway/pkg/metrics"
+)
+
+type requestMetrics struct {
+	logger log.Logger
+}
+
+// MiddlewareFunc observes the requests that matched an ingress, so it has to be placed right after the ingress matching
+// to observe the requests rejected by the rest of middlewares. Requests not matching any ingress are observed by it
+func (m *requestMetrics) MiddlewareFunc(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger := requestcontext.Logger(r, m.logger)
+		logger.Debug("metrics")
+		ingress, err := requestcontext.GetIngress(r)
+		if err != nil {
+			httpError.Handle(err, w, r, logger)
+			return
+		}
+
+		start := time.Now()
+		rw := middleware.NewResponseWriter(w)
+		next.ServeHTTP(rw, r)
+
+		status := rw.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		labels := []string{
+			ingress.Name,
+			ingress.Spec.Service.Name,
+			r.Method,
+			strconv.Itoa(status),
+		}
+		metrics.Requests.WithLabelValues(labels...).Inc()
+		metrics.RequestDuration.WithLabelValues(labels...).Observe(time.Since(start).Seconds())
+	})
+}
+
+func New(logger log.Logger) middleware.Middleware {
+	return &requestMetrics{logger: logger}
+}
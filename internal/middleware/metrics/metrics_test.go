@@ -0,0 +1,63 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gotway/gotway/internal/requestcontext"
+	"github.com/gotway/gotway/pkg/log"
+	"github.com/gotway/gotway/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	crdv1alpha1 "github.com/gotway/gotway/pkg/kubernetes/crd/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestMiddleware(t *testing.T) {
+	ingress := crdv1alpha1.IngressHTTP{
+		ObjectMeta: metav1.ObjectMeta{Name: "catalog-get-products"},
+		Spec: crdv1alpha1.IngressHTTPSpec{
+			Service: crdv1alpha1.Service{Name: "catalog"},
+		},
+	}
+	tests := []struct {
+		name       string
+		status     int
+		wantStatus string
+	}{
+		{
+			name:       "Implicit status",
+			wantStatus: "200",
+		},
+		{
+			name:       "Explicit status",
+			status:     http.StatusNotFound,
+			wantStatus: "404",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := New(log.Log).MiddlewareFunc(
+				http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					if tt.status != 0 {
+						w.WriteHeader(tt.status)
+					}
+					_, _ = w.Write([]byte("{}"))
+				}),
+			)
+			counter := metrics.Requests.WithLabelValues(
+				"catalog-get-products", "catalog", http.MethodGet, tt.wantStatus,
+			)
+			before := testutil.ToFloat64(counter)
+
+			req := httptest.NewRequest(http.MethodGet, "/products", nil)
+			req = requestcontext.WithIngress(req, ingress)
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			assert.Equal(t, before+1, testutil.ToFloat64(counter))
+		})
+	}
+}
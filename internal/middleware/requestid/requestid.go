@@ -0,0 +1,59 @@
+package requestid
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/gotway/gotway/internal/middleware"
+	"github.com/gotway/gotway/internal/requestcontext"
+	"github.com/gotway/gotway/pkg/log"
+)
+
+const maxRequestIDLength = 128
+
+type requestID struct {
+	logger log.Logger
+}
+
+func (rid *requestID) MiddlewareFunc(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestcontext.RequestIDHeader)
+		if !isValid(id) {
+			id = generate()
+		}
+		r = requestcontext.WithRequestID(r, id)
+		requestcontext.Logger(r, rid.logger).Debug("request id")
+
+		w.Header().Set(requestcontext.RequestIDHeader, id)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isValid checks that a client provided id is safe to be logged and forwarded
+func isValid(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func generate() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+func New(logger log.Logger) middleware.Middleware {
+	return &requestID{logger: logger}
+}
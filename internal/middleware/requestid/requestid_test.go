@@ -0,0 +1,67 @@
+package requestid
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gotway/gotway/internal/requestcontext"
+	"github.com/gotway/gotway/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddleware(t *testing.T) {
+	tests := []struct {
+		name          string
+		requestID     string
+		wantRequestID string
+	}{
+		{
+			name:          "Accept client id",
+			requestID:     "7f3c2a9e-catalog",
+			wantRequestID: "7f3c2a9e-catalog",
+		},
+		{
+			name:      "Generate when missing",
+			requestID: "",
+		},
+		{
+			name:      "Generate when invalid",
+			requestID: "1234\nfake log line",
+		},
+		{
+			name:      "Generate when too long",
+			requestID: strings.Repeat("a", maxRequestIDLength+1),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var contextID string
+			handler := New(log.Log).MiddlewareFunc(
+				http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					id, err := requestcontext.GetRequestID(r)
+					assert.Nil(t, err)
+					contextID = id
+				}),
+			)
+			req := httptest.NewRequest(http.MethodGet, "/products", nil)
+			if tt.requestID != "" {
+				req.Header.Set(requestcontext.RequestIDHeader, tt.requestID)
+			}
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			responseID := rec.Header().Get(requestcontext.RequestIDHeader)
+			assert.Equal(t, contextID, responseID)
+			if tt.wantRequestID != "" {
+				assert.Equal(t, tt.wantRequestID, responseID)
+			} else {
+				assert.Len(t, responseID, 32)
+				assert.NotEqual(t, tt.requestID, responseID)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package tracing
+
+import (
+	"net/http"
+
+	"github.com/gotway/gotway/internal/middleware"
+	"github.com/gotway/gotway/internal/requestcontext"
+	"github.com/gotway/gotway/pkg/log"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/gotway/gotway/internal/middleware/tracing")
+
+type tracing struct {
+	logger log.Logger
+}
+
+func (t *tracing) MiddlewareFunc(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestcontext.Logger(r, t.logger).Debug("tracing")
+
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracer.Start(ctx, "HTTP "+r.Method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.method", r.Method),
+				attribute.String("http.host", r.Host),
+				attribute.String("http.target", r.URL.RequestURI()),
+			),
+		)
+		defer span.End()
+		if requestID, err := requestcontext.GetRequestID(r); err == nil {
+			span.SetAttributes(attribute.String("gotway.request_id", requestID))
+		}
+
+		rw := middleware.NewResponseWriter(w)
+		next.ServeHTTP(rw, r.WithContext(ctx))
+
+		span.SetAttributes(attribute.Int("http.status_code", rw.Status))
+		if rw.Status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(rw.Status))
+		}
+	})
+}
+
+func New(logger log.Logger) middleware.Middleware {
+	return &tracing{logger: logger}
+}
@@ -0,0 +1,49 @@
+package tracing
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gotway/gotway/internal/requestcontext"
+	"github.com/gotway/gotway/pkg/log"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestMiddleware(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	var upstreamHeader http.Header
+	handler := New(log.Log).MiddlewareFunc(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			upstreamHeader = http.Header{}
+			otel.GetTextMapPropagator().Inject(r.Context(), propagation.HeaderCarrier(upstreamHeader))
+			w.WriteHeader(http.StatusBadGateway)
+		}),
+	)
+	req := httptest.NewRequest(http.MethodGet, "/products?offset=0", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	req = requestcontext.WithRequestID(req, "1234")
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	spans := recorder.Ended()
+	assert.Len(t, spans, 1)
+	span := spans[0]
+	assert.Equal(t, "HTTP GET", span.Name())
+	assert.Equal(t, trace.SpanKindServer, span.SpanKind())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext().TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", span.Parent().SpanID().String())
+	assert.Contains(t, span.Attributes(), attribute.Int("http.status_code", http.StatusBadGateway))
+	assert.Contains(t, span.Attributes(), attribute.String("gotway.request_id", "1234"))
+	assert.Contains(t, upstreamHeader.Get("traceparent"), "4bf92f3577b34da6a3ce929d0e0e4736")
+}
@@ -0,0 +1,171 @@
+package validation
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"sync"
+
+	httpError "github.com/gotway/gotway/internal/http/error"
+	"github.com/gotway/gotway/internal/middleware"
+	"github.com/gotway/gotway/internal/model"
+	"github.com/gotway/gotway/internal/openapi"
+	"github.com/gotway/gotway/internal/requestcontext"
+	"github.com/gotway/gotway/pkg/jsonschema"
+	"github.com/gotway/gotway/pkg/kubernetes/configmap"
+	"github.com/gotway/gotway/pkg/log"
+
+	crdv1alpha1 "github.com/gotway/gotway/pkg/kubernetes/crd/v1alpha1"
+)
+
+type validation struct {
+	configMaps *configmap.Store
+	validators sync.Map
+	logger     log.Logger
+}
+
+// validator validates the body of a request
+type validator func(r *http.Request, body []byte) error
+
+// compiledValidator is the validator of an ingress along with the source it was compiled from
+type compiledValidator struct {
+	mode     string
+	source   string
+	validate validator
+}
+
+func (v *validation) MiddlewareFunc(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger := requestcontext.Logger(r, v.logger)
+		logger.Debug("validation")
+		ingress, err := requestcontext.GetIngress(r)
+		if err != nil {
+			httpError.Handle(err, w, r, logger)
+			return
+		}
+
+		if !hasValidation(ingress) || !hasPayload(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		// requests without a body are validated too, as it may be required
+		if r.ContentLength != 0 && !openapi.IsJSONMediaType(r.Header.Get("Content-Type")) {
+			httpError.Handle(model.ErrUnsupportedMediaType, w, r, logger)
+			return
+		}
+
+		validate, err := v.getValidator(ingress)
+		if err != nil {
+			httpError.Handle(err, w, r, logger)
+			return
+		}
+
+		var bodyBytes []byte
+		if r.Body != nil {
+			bodyBytes, err = ioutil.ReadAll(r.Body)
+			if err != nil {
+				httpError.Handle(err, w, r, logger)
+				return
+			}
+			r.Body.Close()
+			r.Body = ioutil.NopCloser(bytes.NewBuffer(bodyBytes))
+		}
+
+		if err := validate(r, bodyBytes); err != nil {
+			var validationErr *jsonschema.ValidationError
+			if errors.As(err, &validationErr) || errors.Is(err, jsonschema.ErrInvalidJSON) {
+				logger.Debug("invalid request body ", err)
+				httpError.Write(w, r, http.StatusBadRequest, err.Error())
+				return
+			}
+			httpError.Handle(err, w, r, logger)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// getValidator returns the validator of an ingress. Schemas and documents are compiled once and
+// cached by ingress, updating the source recompiles them and replaces the validator of the ingress.
+func (v *validation) getValidator(ingress crdv1alpha1.IngressHTTP) (validator, error) {
+	validation := ingress.Spec.Validation
+	mode := getMode(validation)
+	source := validation.JSONSchema
+	if mode == crdv1alpha1.ValidationModeOpenAPI {
+		source = validation.OpenAPI
+	}
+	if ref := validation.ConfigMapRef; source == "" && ref != nil {
+		var err error
+		source, err = v.configMaps.Get(ingress.Namespace, ref.Name, ref.Key)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	key := ingress.Namespace + "/" + ingress.Name
+	if cached, ok := v.validators.Load(key); ok {
+		if cached := cached.(compiledValidator); cached.mode == mode && cached.source == source {
+			return cached.validate, nil
+		}
+	}
+	validate, err := compile(mode, source)
+	if err != nil {
+		return nil, err
+	}
+	v.validators.Store(key, compiledValidator{mode: mode, source: source, validate: validate})
+	return validate, nil
+}
+
+func compile(mode string, source string) (validator, error) {
+	if mode == crdv1alpha1.ValidationModeOpenAPI {
+		document, err := openapi.NewValidator([]byte(source))
+		if err != nil {
+			return nil, err
+		}
+		return func(r *http.Request, body []byte) error {
+			return document.Validate(r.Method, r.URL.Path, body)
+		}, nil
+	}
+	schema, err := jsonschema.Compile([]byte(source))
+	if err != nil {
+		return nil, err
+	}
+	return func(r *http.Request, body []byte) error {
+		return schema.Validate(body)
+	}, nil
+}
+
+// getMode infers the mode from the inline source when it is not set
+func getMode(validation *crdv1alpha1.Validation) string {
+	if validation.Mode != "" {
+		return validation.Mode
+	}
+	if validation.OpenAPI != "" {
+		return crdv1alpha1.ValidationModeOpenAPI
+	}
+	return crdv1alpha1.ValidationModeJSONSchema
+}
+
+func hasValidation(ingress crdv1alpha1.IngressHTTP) bool {
+	validation := ingress.Spec.Validation
+	return validation != nil &&
+		(validation.JSONSchema != "" || validation.OpenAPI != "" || validation.ConfigMapRef != nil)
+}
+
+func hasPayload(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch:
+		return true
+	default:
+		return false
+	}
+}
+
+func New(configMaps *configmap.Store, logger log.Logger) middleware.Middleware {
+	return &validation{
+		configMaps: configMaps,
+		logger:     logger,
+	}
+}
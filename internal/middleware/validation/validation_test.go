@@ -0,0 +1,275 @@
+package validation
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gotway/gotway/internal/requestcontext"
+	"github.com/gotway/gotway/pkg/kubernetes/configmap"
+	"github.com/gotway/gotway/pkg/log"
+	"github.com/stretchr/testify/assert"
+
+	crdv1alpha1 "github.com/gotway/gotway/pkg/kubernetes/crd/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const productSchema = `{
+	"type": "object",
+	"required": ["name"],
+	"properties": {"name": {"type": "string"}}
+}`
+
+const catalogDocument = `
+openapi: 3.0.3
+info:
+  title: catalog
+  version: 1.0.0
+servers:
+  - url: https://catalog.gotway.com/api
+paths:
+  /products:
+    post:
+      requestBody:
+        required: true
+        content:
+          application/json:
+            schema:
+              $ref: '#/components/schemas/Product'
+  /products/{id}:
+    put:
+      requestBody:
+        $ref: '#/components/requestBodies/Product'
+  /products/{id}/publish:
+    post:
+      responses:
+        '204':
+          description: published
+components:
+  requestBodies:
+    Product:
+      content:
+        application/json:
+          schema:
+            $ref: '#/components/schemas/Product'
+  schemas:
+    Product:
+      type: object
+      required: [name]
+      properties:
+        name:
+          type: string
+`
+
+func TestMiddleware(t *testing.T) {
+	clientSet := fake.NewSimpleClientset(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "schemas", Namespace: "default"},
+		Data:       map[string]string{"product.json": productSchema, "catalog.yaml": catalogDocument},
+	})
+	configMaps := configmap.New(configmap.Options{}, clientSet, log.Log)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go configMaps.Run(ctx)
+	assert.Eventually(t, func() bool {
+		_, err := configMaps.Get("default", "schemas", "product.json")
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+
+	tests := []struct {
+		name        string
+		validation  *crdv1alpha1.Validation
+		method      string
+		path        string
+		contentType string
+		body        string
+		wantStatus  int
+	}{
+		{
+			name:       "No validation",
+			method:     http.MethodPost,
+			path:       "/products",
+			body:       `not json`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:        "Valid body",
+			validation:  &crdv1alpha1.Validation{JSONSchema: productSchema},
+			method:      http.MethodPost,
+			path:        "/products",
+			contentType: "application/json",
+			body:        `{"name": "sneakers"}`,
+			wantStatus:  http.StatusOK,
+		},
+		{
+			name:        "Invalid body",
+			validation:  &crdv1alpha1.Validation{JSONSchema: productSchema},
+			method:      http.MethodPost,
+			path:        "/products",
+			contentType: "application/json",
+			body:        `{"price": 1}`,
+			wantStatus:  http.StatusBadRequest,
+		},
+		{
+			name:        "Invalid JSON",
+			validation:  &crdv1alpha1.Validation{JSONSchema: productSchema},
+			method:      http.MethodPost,
+			path:        "/products",
+			contentType: "application/json",
+			body:        `{"name": `,
+			wantStatus:  http.StatusBadRequest,
+		},
+		{
+			name:        "Unsupported media type",
+			validation:  &crdv1alpha1.Validation{JSONSchema: productSchema},
+			method:      http.MethodPost,
+			path:        "/products",
+			contentType: "text/plain",
+			body:        `sneakers`,
+			wantStatus:  http.StatusUnsupportedMediaType,
+		},
+		{
+			name:       "Safe method",
+			validation: &crdv1alpha1.Validation{JSONSchema: productSchema},
+			method:     http.MethodGet,
+			path:       "/products",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "Schema in configmap",
+			validation: &crdv1alpha1.Validation{
+				ConfigMapRef: &crdv1alpha1.ConfigMapKeyRef{Name: "schemas", Key: "product.json"},
+			},
+			method:      http.MethodPost,
+			path:        "/products",
+			contentType: "application/json",
+			body:        `{"name": 1}`,
+			wantStatus:  http.StatusBadRequest,
+		},
+		{
+			name: "Missing configmap",
+			validation: &crdv1alpha1.Validation{
+				ConfigMapRef: &crdv1alpha1.ConfigMapKeyRef{Name: "missing", Key: "product.json"},
+			},
+			method:      http.MethodPost,
+			path:        "/products",
+			contentType: "application/json",
+			body:        `{"name": "sneakers"}`,
+			wantStatus:  http.StatusInternalServerError,
+		},
+		{
+			name:        "Unsupported schema",
+			validation:  &crdv1alpha1.Validation{JSONSchema: `{"if": {"type": "object"}}`},
+			method:      http.MethodPost,
+			path:        "/products",
+			contentType: "application/json",
+			body:        `{"name": "sneakers"}`,
+			wantStatus:  http.StatusInternalServerError,
+		},
+		{
+			name:        "OpenAPI valid body",
+			validation:  &crdv1alpha1.Validation{OpenAPI: catalogDocument},
+			method:      http.MethodPost,
+			path:        "/api/products",
+			contentType: "application/json",
+			body:        `{"name": "sneakers"}`,
+			wantStatus:  http.StatusOK,
+		},
+		{
+			name:        "OpenAPI invalid body",
+			validation:  &crdv1alpha1.Validation{OpenAPI: catalogDocument},
+			method:      http.MethodPost,
+			path:        "/api/products",
+			contentType: "application/json",
+			body:        `{}`,
+			wantStatus:  http.StatusBadRequest,
+		},
+		{
+			name:       "OpenAPI required body",
+			validation: &crdv1alpha1.Validation{OpenAPI: catalogDocument},
+			method:     http.MethodPost,
+			path:       "/api/products",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "OpenAPI operation without body",
+			validation: &crdv1alpha1.Validation{OpenAPI: catalogDocument},
+			method:     http.MethodPost,
+			path:       "/api/products/1/publish",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "OpenAPI document in configmap",
+			validation: &crdv1alpha1.Validation{
+				Mode:         crdv1alpha1.ValidationModeOpenAPI,
+				ConfigMapRef: &crdv1alpha1.ConfigMapKeyRef{Name: "schemas", Key: "catalog.yaml"},
+			},
+			method:      http.MethodPut,
+			path:        "/api/products/1",
+			contentType: "application/json",
+			body:        `{"name": true}`,
+			wantStatus:  http.StatusBadRequest,
+		},
+	}
+
+	handler := New(configMaps, log.Log).MiddlewareFunc(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}),
+	)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ingress := crdv1alpha1.IngressHTTP{
+				ObjectMeta: metav1.ObjectMeta{Name: "catalog", Namespace: "default"},
+				Spec:       crdv1alpha1.IngressHTTPSpec{Validation: tt.validation},
+			}
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			req = requestcontext.WithIngress(req, ingress)
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.wantStatus, rec.Code, rec.Body.String())
+		})
+	}
+}
+
+func TestGetValidatorCache(t *testing.T) {
+	v := &validation{logger: log.Log}
+	newIngress := func(name string, schema string) crdv1alpha1.IngressHTTP {
+		return crdv1alpha1.IngressHTTP{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+			Spec: crdv1alpha1.IngressHTTPSpec{
+				Validation: &crdv1alpha1.Validation{JSONSchema: schema},
+			},
+		}
+	}
+	countValidators := func() int {
+		count := 0
+		v.validators.Range(func(key, value interface{}) bool {
+			count++
+			return true
+		})
+		return count
+	}
+	req := httptest.NewRequest(http.MethodPost, "/products", nil)
+
+	validate, err := v.getValidator(newIngress("catalog", `{"type": "object"}`))
+	assert.Nil(t, err)
+	assert.Nil(t, validate(req, []byte(`{}`)))
+
+	// an updated source replaces the validator of the ingress
+	validate, err = v.getValidator(newIngress("catalog", `{"type": "array"}`))
+	assert.Nil(t, err)
+	assert.NotNil(t, validate(req, []byte(`{}`)))
+	assert.Equal(t, 1, countValidators())
+
+	_, err = v.getValidator(newIngress("stock", `{"type": "array"}`))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, countValidators())
+}
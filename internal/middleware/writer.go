@@ -0,0 +1,30 @@
+package middleware
+
+import "net/http"
+
+// ResponseWriter records the status code and the size of a response
+type ResponseWriter struct {
+	http.ResponseWriter
+	Status int
+	Bytes  int64
+}
+
+func (rw *ResponseWriter) WriteHeader(status int) {
+	if rw.Status == 0 {
+		rw.Status = status
+	}
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *ResponseWriter) Write(p []byte) (int, error) {
+	if rw.Status == 0 {
+		rw.Status = http.StatusOK
+	}
+	n, err := rw.ResponseWriter.Write(p)
+	rw.Bytes += int64(n)
+	return n, err
+}
+
+func NewResponseWriter(w http.ResponseWriter) *ResponseWriter {
+	return &ResponseWriter{ResponseWriter: w}
+}
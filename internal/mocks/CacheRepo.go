@@ -3,6 +3,10 @@
 package mocks
 
 import (
+	context "context"
+
+	time "time"
+
 	model "github.com/gotway/gotway/internal/model"
 	mock "github.com/stretchr/testify/mock"
 )
@@ -12,27 +16,34 @@ type CacheRepo struct {
 	mock.Mock
 }
 
-// Create provides a mock function with given fields: cache, serviceKey
-func (_m *CacheRepo) Create(cache model.Cache, serviceKey string) error {
-	ret := _m.Called(cache, serviceKey)
+// Count provides a mock function with given fields: ctx, filter
+func (_m *CacheRepo) Count(ctx context.Context, filter model.CacheFilter) (model.CacheCount, error) {
+	ret := _m.Called(ctx, filter)
 
-	var r0 error
-	if rf, ok := ret.Get(0).(func(model.Cache, string) error); ok {
-		r0 = rf(cache, serviceKey)
+	var r0 model.CacheCount
+	if rf, ok := ret.Get(0).(func(context.Context, model.CacheFilter) model.CacheCount); ok {
+		r0 = rf(ctx, filter)
 	} else {
-		r0 = ret.Error(0)
+		r0 = ret.Get(0).(model.CacheCount)
 	}
 
-	return r0
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, model.CacheFilter) error); ok {
+		r1 = rf(ctx, filter)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
 }
 
-// DeleteByPath provides a mock function with given fields: paths
-func (_m *CacheRepo) DeleteByPath(paths []model.CachePath) error {
-	ret := _m.Called(paths)
+// Create provides a mock function with given fields: ctx, cache, serviceKey, quota
+func (_m *CacheRepo) Create(ctx context.Context, cache model.Cache, serviceKey string, quota model.CacheQuota) error {
+	ret := _m.Called(ctx, cache, serviceKey, quota)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func([]model.CachePath) error); ok {
-		r0 = rf(paths)
+	if rf, ok := ret.Get(0).(func(context.Context, model.Cache, string, model.CacheQuota) error); ok {
+		r0 = rf(ctx, cache, serviceKey, quota)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -40,13 +51,34 @@ func (_m *CacheRepo) DeleteByPath(paths []model.CachePath) error {
 	return r0
 }
 
-// DeleteByTags provides a mock function with given fields: tags
-func (_m *CacheRepo) DeleteByTags(tags []string) error {
-	ret := _m.Called(tags)
+// DeleteByFilter provides a mock function with given fields: ctx, filter
+func (_m *CacheRepo) DeleteByFilter(ctx context.Context, filter model.CacheFilter) (int64, error) {
+	ret := _m.Called(ctx, filter)
+
+	var r0 int64
+	if rf, ok := ret.Get(0).(func(context.Context, model.CacheFilter) int64); ok {
+		r0 = rf(ctx, filter)
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, model.CacheFilter) error); ok {
+		r1 = rf(ctx, filter)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// DeleteByPath provides a mock function with given fields: ctx, paths
+func (_m *CacheRepo) DeleteByPath(ctx context.Context, paths []model.CachePath) error {
+	ret := _m.Called(ctx, paths)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func([]string) error); ok {
-		r0 = rf(tags)
+	if rf, ok := ret.Get(0).(func(context.Context, []model.CachePath) error); ok {
+		r0 = rf(ctx, paths)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -54,20 +86,83 @@ func (_m *CacheRepo) DeleteByTags(tags []string) error {
 	return r0
 }
 
-// Get provides a mock function with given fields: path, serviceKey
-func (_m *CacheRepo) Get(path string, serviceKey string) (model.Cache, error) {
-	ret := _m.Called(path, serviceKey)
+// DeleteByTags provides a mock function with given fields: ctx, tags
+func (_m *CacheRepo) DeleteByTags(ctx context.Context, tags []string) (int64, error) {
+	ret := _m.Called(ctx, tags)
+
+	var r0 int64
+	if rf, ok := ret.Get(0).(func(context.Context, []string) int64); ok {
+		r0 = rf(ctx, tags)
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, []string) error); ok {
+		r1 = rf(ctx, tags)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Find provides a mock function with given fields: ctx, filter, page
+func (_m *CacheRepo) Find(ctx context.Context, filter model.CacheFilter, page model.CachePage) (model.CacheList, error) {
+	ret := _m.Called(ctx, filter, page)
+
+	var r0 model.CacheList
+	if rf, ok := ret.Get(0).(func(context.Context, model.CacheFilter, model.CachePage) model.CacheList); ok {
+		r0 = rf(ctx, filter, page)
+	} else {
+		r0 = ret.Get(0).(model.CacheList)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, model.CacheFilter, model.CachePage) error); ok {
+		r1 = rf(ctx, filter, page)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Get provides a mock function with given fields: ctx, path, serviceKey
+func (_m *CacheRepo) Get(ctx context.Context, path string, serviceKey string) (model.Cache, error) {
+	ret := _m.Called(ctx, path, serviceKey)
 
 	var r0 model.Cache
-	if rf, ok := ret.Get(0).(func(string, string) model.Cache); ok {
-		r0 = rf(path, serviceKey)
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) model.Cache); ok {
+		r0 = rf(ctx, path, serviceKey)
 	} else {
 		r0 = ret.Get(0).(model.Cache)
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(string, string) error); ok {
-		r1 = rf(path, serviceKey)
+	if rf, ok := ret.Get(1).(func(context.Context, string, string) error); ok {
+		r1 = rf(ctx, path, serviceKey)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Lock provides a mock function with given fields: ctx, path, serviceKey, token, ttl
+func (_m *CacheRepo) Lock(ctx context.Context, path string, serviceKey string, token string, ttl time.Duration) (bool, error) {
+	ret := _m.Called(ctx, path, serviceKey, token, ttl)
+
+	var r0 bool
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, string, time.Duration) bool); ok {
+		r0 = rf(ctx, path, serviceKey, token, ttl)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, string, time.Duration) error); ok {
+		r1 = rf(ctx, path, serviceKey, token, ttl)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -75,6 +170,20 @@ func (_m *CacheRepo) Get(path string, serviceKey string) (model.Cache, error) {
 	return r0, r1
 }
 
+// Unlock provides a mock function with given fields: ctx, path, serviceKey, token
+func (_m *CacheRepo) Unlock(ctx context.Context, path string, serviceKey string, token string) error {
+	ret := _m.Called(ctx, path, serviceKey, token)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, string) error); ok {
+		r0 = rf(ctx, path, serviceKey, token)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 type NewCacheRepoT interface {
 	mock.TestingT
 	Cleanup(func())
@@ -12,6 +12,8 @@ import (
 	mock "github.com/stretchr/testify/mock"
 
 	model "github.com/gotway/gotway/internal/model"
+
+	time "time"
 )
 
 // Controller is an autogenerated mock type for the Controller type
@@ -19,27 +21,55 @@ type Controller struct {
 	mock.Mock
 }
 
-// DeleteCacheByPath provides a mock function with given fields: paths
-func (_m *Controller) DeleteCacheByPath(paths []model.CachePath) error {
-	ret := _m.Called(paths)
+// CountCache provides a mock function with given fields: ctx, filter
+func (_m *Controller) CountCache(ctx context.Context, filter model.CacheFilter) (model.CacheCount, error) {
+	ret := _m.Called(ctx, filter)
 
-	var r0 error
-	if rf, ok := ret.Get(0).(func([]model.CachePath) error); ok {
-		r0 = rf(paths)
+	var r0 model.CacheCount
+	if rf, ok := ret.Get(0).(func(context.Context, model.CacheFilter) model.CacheCount); ok {
+		r0 = rf(ctx, filter)
 	} else {
-		r0 = ret.Error(0)
+		r0 = ret.Get(0).(model.CacheCount)
 	}
 
-	return r0
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, model.CacheFilter) error); ok {
+		r1 = rf(ctx, filter)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// DeleteCacheByFilter provides a mock function with given fields: ctx, filter
+func (_m *Controller) DeleteCacheByFilter(ctx context.Context, filter model.CacheFilter) (int64, error) {
+	ret := _m.Called(ctx, filter)
+
+	var r0 int64
+	if rf, ok := ret.Get(0).(func(context.Context, model.CacheFilter) int64); ok {
+		r0 = rf(ctx, filter)
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, model.CacheFilter) error); ok {
+		r1 = rf(ctx, filter)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
 }
 
-// DeleteCacheByTags provides a mock function with given fields: tags
-func (_m *Controller) DeleteCacheByTags(tags []string) error {
-	ret := _m.Called(tags)
+// DeleteCacheByPath provides a mock function with given fields: ctx, paths
+func (_m *Controller) DeleteCacheByPath(ctx context.Context, paths []model.CachePath) error {
+	ret := _m.Called(ctx, paths)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func([]string) error); ok {
-		r0 = rf(tags)
+	if rf, ok := ret.Get(0).(func(context.Context, []model.CachePath) error); ok {
+		r0 = rf(ctx, paths)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -47,20 +77,62 @@ func (_m *Controller) DeleteCacheByTags(tags []string) error {
 	return r0
 }
 
-// GetCache provides a mock function with given fields: r, service
-func (_m *Controller) GetCache(r *http.Request, service string) (model.Cache, error) {
-	ret := _m.Called(r, service)
+// DeleteCacheByTags provides a mock function with given fields: ctx, tags
+func (_m *Controller) DeleteCacheByTags(ctx context.Context, tags []string) (int64, error) {
+	ret := _m.Called(ctx, tags)
+
+	var r0 int64
+	if rf, ok := ret.Get(0).(func(context.Context, []string) int64); ok {
+		r0 = rf(ctx, tags)
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, []string) error); ok {
+		r1 = rf(ctx, tags)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// FindCache provides a mock function with given fields: ctx, filter, page
+func (_m *Controller) FindCache(ctx context.Context, filter model.CacheFilter, page model.CachePage) (model.CacheList, error) {
+	ret := _m.Called(ctx, filter, page)
+
+	var r0 model.CacheList
+	if rf, ok := ret.Get(0).(func(context.Context, model.CacheFilter, model.CachePage) model.CacheList); ok {
+		r0 = rf(ctx, filter, page)
+	} else {
+		r0 = ret.Get(0).(model.CacheList)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, model.CacheFilter, model.CachePage) error); ok {
+		r1 = rf(ctx, filter, page)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetCache provides a mock function with given fields: r, params
+func (_m *Controller) GetCache(r *http.Request, params cache.Params) (model.Cache, error) {
+	ret := _m.Called(r, params)
 
 	var r0 model.Cache
-	if rf, ok := ret.Get(0).(func(*http.Request, string) model.Cache); ok {
-		r0 = rf(r, service)
+	if rf, ok := ret.Get(0).(func(*http.Request, cache.Params) model.Cache); ok {
+		r0 = rf(r, params)
 	} else {
 		r0 = ret.Get(0).(model.Cache)
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(*http.Request, string) error); ok {
-		r1 = rf(r, service)
+	if rf, ok := ret.Get(1).(func(*http.Request, cache.Params) error); ok {
+		r1 = rf(r, params)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -68,13 +140,13 @@ func (_m *Controller) GetCache(r *http.Request, service string) (model.Cache, er
 	return r0, r1
 }
 
-// HandleResponse provides a mock function with given fields: r, params
-func (_m *Controller) HandleResponse(r *http.Response, params cache.Params) error {
-	ret := _m.Called(r, params)
+// HandleResponse provides a mock function with given fields: r, res, params
+func (_m *Controller) HandleResponse(r *http.Request, res *http.Response, params cache.Params) error {
+	ret := _m.Called(r, res, params)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(*http.Response, cache.Params) error); ok {
-		r0 = rf(r, params)
+	if rf, ok := ret.Get(0).(func(*http.Request, *http.Response, cache.Params) error); ok {
+		r0 = rf(r, res, params)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -82,6 +154,27 @@ func (_m *Controller) HandleResponse(r *http.Response, params cache.Params) erro
 	return r0
 }
 
+// Invalidate provides a mock function with given fields: ctx, r, res, params
+func (_m *Controller) Invalidate(ctx context.Context, r *http.Request, res *http.Response, params cache.Params) (int64, error) {
+	ret := _m.Called(ctx, r, res, params)
+
+	var r0 int64
+	if rf, ok := ret.Get(0).(func(context.Context, *http.Request, *http.Response, cache.Params) int64); ok {
+		r0 = rf(ctx, r, res, params)
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *http.Request, *http.Response, cache.Params) error); ok {
+		r1 = rf(ctx, r, res, params)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // IsCacheableRequest provides a mock function with given fields: r
 func (_m *Controller) IsCacheableRequest(r *http.Request) bool {
 	ret := _m.Called(r)
@@ -96,8 +189,22 @@ func (_m *Controller) IsCacheableRequest(r *http.Request) bool {
 	return r0
 }
 
-// IsCacheableResponse provides a mock function with given fields: r, params
-func (_m *Controller) IsCacheableResponse(r *http.Response, params cache.Params) bool {
+// IsCacheableResponse provides a mock function with given fields: r, res, params
+func (_m *Controller) IsCacheableResponse(r *http.Request, res *http.Response, params cache.Params) bool {
+	ret := _m.Called(r, res, params)
+
+	var r0 bool
+	if rf, ok := ret.Get(0).(func(*http.Request, *http.Response, cache.Params) bool); ok {
+		r0 = rf(r, res, params)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	return r0
+}
+
+// IsInvalidatingResponse provides a mock function with given fields: r, params
+func (_m *Controller) IsInvalidatingResponse(r *http.Response, params cache.Params) bool {
 	ret := _m.Called(r, params)
 
 	var r0 bool
@@ -110,11 +217,99 @@ func (_m *Controller) IsCacheableResponse(r *http.Response, params cache.Params)
 	return r0
 }
 
+// Lock provides a mock function with given fields: r, params, ttl
+func (_m *Controller) Lock(r *http.Request, params cache.Params, ttl time.Duration) (func(), bool, error) {
+	ret := _m.Called(r, params, ttl)
+
+	var r0 func()
+	if rf, ok := ret.Get(0).(func(*http.Request, cache.Params, time.Duration) func()); ok {
+		r0 = rf(r, params, ttl)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(func())
+		}
+	}
+
+	var r1 bool
+	if rf, ok := ret.Get(1).(func(*http.Request, cache.Params, time.Duration) bool); ok {
+		r1 = rf(r, params, ttl)
+	} else {
+		r1 = ret.Get(1).(bool)
+	}
+
+	var r2 error
+	if rf, ok := ret.Get(2).(func(*http.Request, cache.Params, time.Duration) error); ok {
+		r2 = rf(r, params, ttl)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+
+// PeekCache provides a mock function with given fields: r, params
+func (_m *Controller) PeekCache(r *http.Request, params cache.Params) (model.Cache, error) {
+	ret := _m.Called(r, params)
+
+	var r0 model.Cache
+	if rf, ok := ret.Get(0).(func(*http.Request, cache.Params) model.Cache); ok {
+		r0 = rf(r, params)
+	} else {
+		r0 = ret.Get(0).(model.Cache)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(*http.Request, cache.Params) error); ok {
+		r1 = rf(r, params)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Revalidate provides a mock function with given fields: r, _a1, res, params
+func (_m *Controller) Revalidate(r *http.Request, _a1 model.Cache, res *http.Response, params cache.Params) (*http.Response, error) {
+	ret := _m.Called(r, _a1, res, params)
+
+	var r0 *http.Response
+	if rf, ok := ret.Get(0).(func(*http.Request, model.Cache, *http.Response, cache.Params) *http.Response); ok {
+		r0 = rf(r, _a1, res, params)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*http.Response)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(*http.Request, model.Cache, *http.Response, cache.Params) error); ok {
+		r1 = rf(r, _a1, res, params)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // Start provides a mock function with given fields: ctx
 func (_m *Controller) Start(ctx context.Context) {
 	_m.Called(ctx)
 }
 
+// Warm provides a mock function with given fields: ctx, task
+func (_m *Controller) Warm(ctx context.Context, task cache.WarmTask) error {
+	ret := _m.Called(ctx, task)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, cache.WarmTask) error); ok {
+		r0 = rf(ctx, task)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 type NewControllerT interface {
 	mock.TestingT
 	Cleanup(func())
@@ -5,19 +5,99 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 )
 
 // Cache is a cached service response
 type Cache struct {
-	Path       string      `json:"path"`
-	StatusCode int         `json:"statusCode"`
-	Headers    http.Header `json:"headers"`
-	Body       []byte      `json:"body"`
-	TTL        CacheTTL    `json:"ttl"`
-	Tags       []string    `json:"tags"`
+	Path                 string      `json:"path"`
+	StatusCode           int         `json:"statusCode"`
+	Headers              http.Header `json:"headers"`
+	Body                 []byte      `json:"body"`
+	TTL                  CacheTTL    `json:"ttl"`
+	StaleWhileRevalidate CacheTTL    `json:"staleWhileRevalidate,omitempty"`
+	StaleIfError         CacheTTL    `json:"staleIfError,omitempty"`
+	Revalidate           CacheTTL    `json:"revalidate,omitempty"`
+	Tags                 []string    `json:"tags"`
+	CreatedAt            time.Time   `json:"createdAt"`
 }
 
+// Age is the time elapsed since the response was cached
+func (c Cache) Age(now time.Time) time.Duration {
+	if c.CreatedAt.IsZero() {
+		return 0
+	}
+	return now.Sub(c.CreatedAt)
+}
+
+// CurrentAge is the age of the response including the one it had when it was cached, as in RFC 9111 section 4.2.3
+func (c Cache) CurrentAge(now time.Time) time.Duration {
+	return InitialAge(c.Headers) + c.Age(now)
+}
+
+// InitialAge is the age of a response when it was received, taken from its Age header
+func InitialAge(header http.Header) time.Duration {
+	seconds, err := strconv.ParseInt(header.Get("Age"), 10, 64)
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// IsFresh determines if the response can be served without contacting the service
+func (c Cache) IsFresh(now time.Time) bool {
+	return c.Age(now) < time.Duration(c.TTL)
+}
+
+// CanRevalidate determines if the stale response can be served while it is refreshed in the background
+func (c Cache) CanRevalidate(now time.Time) bool {
+	return c.Age(now) < time.Duration(c.TTL)+time.Duration(c.StaleWhileRevalidate)
+}
+
+// CanServeOnError determines if the stale response can be served when the service fails
+func (c Cache) CanServeOnError(now time.Time) bool {
+	return c.Age(now) < time.Duration(c.TTL)+time.Duration(c.StaleIfError)
+}
+
+// CanRevalidateWithService determines if the expired response can be revalidated with a conditional request
+func (c Cache) CanRevalidateWithService(now time.Time) bool {
+	return c.HasValidators() && c.Age(now) < time.Duration(c.TTL)+time.Duration(c.Revalidate)
+}
+
+// HasValidators determines if the response has an ETag or a Last-Modified header
+func (c Cache) HasValidators() bool {
+	return c.Headers.Get("ETag") != "" || c.Headers.Get("Last-Modified") != ""
+}
+
+// ConditionalHeaders are the request headers that ask the service whether the response is still valid
+func (c Cache) ConditionalHeaders() http.Header {
+	header := http.Header{}
+	if etag := c.Headers.Get("ETag"); etag != "" {
+		header.Set("If-None-Match", etag)
+	}
+	if lastModified := c.Headers.Get("Last-Modified"); lastModified != "" {
+		header.Set("If-Modified-Since", lastModified)
+	}
+	return header
+}
+
+// Expiration is how long the response has to be kept, including the time it may be served stale or revalidated
+func (c Cache) Expiration() time.Duration {
+	stale := c.StaleWhileRevalidate
+	if c.StaleIfError > stale {
+		stale = c.StaleIfError
+	}
+	if c.Revalidate > stale {
+		stale = c.Revalidate
+	}
+	return time.Duration(c.TTL + stale)
+}
+
+// CacheVariantSeparator separates the path of a cache key from the hash of the
+// headers and cookies that identify one of its variants
+const CacheVariantSeparator = "::v="
+
 // CacheTTL is the cache time to live in seconds
 type CacheTTL time.Duration
 
@@ -27,26 +107,63 @@ func (c CacheTTL) MarshalJSON() ([]byte, error) {
 	return json.Marshal(seconds)
 }
 
+// UnmarshalJSON deserializes a TTL in seconds
+func (c *CacheTTL) UnmarshalJSON(data []byte) error {
+	var seconds int64
+	if err := json.Unmarshal(data, &seconds); err != nil {
+		return err
+	}
+	*c = NewCacheTTL(seconds)
+	return nil
+}
+
 // NewCacheTTL creates a new cache TTL in seconds
 func NewCacheTTL(seconds int64) CacheTTL {
 	return CacheTTL(time.Duration(seconds) * time.Second)
 }
 
-// DeleteCache defines the params used to delete cache
+// DeleteCache defines the params used to delete cache, caches matching all of them are deleted
 type DeleteCache struct {
-	Paths []CachePath `json:"paths"`
-	Tags  []string    `json:"tags"`
+	Paths   []CachePath `json:"paths"`
+	Tags    []string    `json:"tags"`
+	Service string      `json:"service"`
+	Prefix  string      `json:"prefix"`
+	Pattern string      `json:"pattern"`
+}
+
+// DeleteCacheResult reports how many caches were deleted
+type DeleteCacheResult struct {
+	Deleted int64 `json:"deleted"`
 }
 
 // Validate checks if the payload is valid
 func (p DeleteCache) Validate() error {
-	if len(p.Paths) == 0 && len(p.Tags) == 0 {
+	filter := p.Filter()
+	if filter.IsEmpty() {
 		return ErrInvalidDeleteCache
 	}
-	if len(p.Paths) > 0 && len(p.Tags) > 0 {
-		return ErrInvalidDeleteCache
+	return filter.Validate()
+}
+
+// OnlyPaths determines if caches are deleted just by their exact paths
+func (p DeleteCache) OnlyPaths() bool {
+	return len(p.Paths) > 0 && len(p.Tags) == 0 && p.Service == "" && p.Prefix == "" && p.Pattern == ""
+}
+
+// OnlyTags determines if caches are deleted just by their tags
+func (p DeleteCache) OnlyTags() bool {
+	return len(p.Tags) > 0 && len(p.Paths) == 0 && p.Service == "" && p.Prefix == "" && p.Pattern == ""
+}
+
+// Filter returns the criteria of the caches to delete
+func (p DeleteCache) Filter() CacheFilter {
+	return CacheFilter{
+		Paths:   p.Paths,
+		Tags:    p.Tags,
+		Service: p.Service,
+		Prefix:  p.Prefix,
+		Pattern: p.Pattern,
 	}
-	return nil
 }
 
 // CachePath defines the paths that conform a cache
@@ -67,5 +184,11 @@ func (e *ErrCachePathNotFound) Error() string {
 // ErrCacheNotFound error for not found cache
 var ErrCacheNotFound = errors.New("Cache not found")
 
+// ErrCacheDropped error for responses that could not be queued to be cached
+var ErrCacheDropped = errors.New("Cache dropped from the queue")
+
+// ErrOnlyIfCached error for requests with the only-if-cached directive that have no cached response
+var ErrOnlyIfCached = errors.New("No cached response available")
+
 // ErrInvalidDeleteCache error for invalid delete cache objects
-var ErrInvalidDeleteCache = errors.New("Paths or tags should be specified")
+var ErrInvalidDeleteCache = errors.New("Paths, tags, service, prefix or pattern should be specified")
@@ -0,0 +1,138 @@
+package model
+
+import (
+	"errors"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// CacheFilter selects caches, every criteria specified must match
+type CacheFilter struct {
+	// Paths matches the caches of some paths along with their variants
+	Paths []CachePath `json:"paths,omitempty"`
+	// Tags matches the caches having any of the tags
+	Tags []string `json:"tags,omitempty"`
+	// Service matches the caches of a service
+	Service string `json:"service,omitempty"`
+	// Prefix matches the caches whose path starts with it
+	Prefix string `json:"prefix,omitempty"`
+	// Pattern matches the caches whose path matches a glob, as in path.Match
+	Pattern string `json:"pattern,omitempty"`
+}
+
+// IsEmpty determines if the filter has no criteria, matching every cache
+func (f CacheFilter) IsEmpty() bool {
+	return len(f.Paths) == 0 && len(f.Tags) == 0 && f.Service == "" && f.Prefix == "" && f.Pattern == ""
+}
+
+// Validate checks if the pattern is a valid glob
+func (f CacheFilter) Validate() error {
+	if _, err := path.Match(f.Pattern, ""); err != nil {
+		return ErrInvalidCachePattern
+	}
+	return nil
+}
+
+// MatchPath checks the service and path criteria, variants are matched by the path they belong to
+func (f CacheFilter) MatchPath(service string, cachePath string) bool {
+	basePath := strings.SplitN(cachePath, CacheVariantSeparator, 2)[0]
+	if f.Service != "" && f.Service != service {
+		return false
+	}
+	if !strings.HasPrefix(basePath, f.Prefix) {
+		return false
+	}
+	if f.Pattern != "" {
+		if matched, _ := path.Match(f.Pattern, basePath); !matched {
+			return false
+		}
+	}
+	if len(f.Paths) == 0 {
+		return true
+	}
+	for _, p := range f.Paths {
+		if p.Service == service && p.Path == basePath {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchTags checks the tags criteria
+func (f CacheFilter) MatchTags(tags []string) bool {
+	if len(f.Tags) == 0 {
+		return true
+	}
+	for _, tag := range tags {
+		for _, t := range f.Tags {
+			if tag == t {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// CachePage selects a page of caches starting after the cursor returned by the previous page
+type CachePage struct {
+	Cursor string
+	Limit  int
+}
+
+// CacheEntry describes a cache without its body
+type CacheEntry struct {
+	Service      string      `json:"service"`
+	Path         string      `json:"path"`
+	StatusCode   int         `json:"statusCode"`
+	Headers      http.Header `json:"headers,omitempty"`
+	Tags         []string    `json:"tags"`
+	Size         int         `json:"size"`
+	TTL          CacheTTL    `json:"ttl"`
+	TTLRemaining CacheTTL    `json:"ttlRemaining"`
+	CreatedAt    time.Time   `json:"createdAt"`
+}
+
+// NewCacheEntry describes a cache whose stored body takes size bytes
+func NewCacheEntry(service string, cache Cache, size int, now time.Time) CacheEntry {
+	remaining := time.Duration(cache.TTL) - cache.Age(now)
+	if remaining < 0 {
+		remaining = 0
+	}
+	return CacheEntry{
+		Service:      service,
+		Path:         cache.Path,
+		StatusCode:   cache.StatusCode,
+		Headers:      cache.Headers,
+		Tags:         cache.Tags,
+		Size:         size,
+		TTL:          cache.TTL,
+		TTLRemaining: CacheTTL(remaining),
+		CreatedAt:    cache.CreatedAt,
+	}
+}
+
+// CacheList is a page of the caches matching a filter along with the cursor of the next page, if there may be more
+type CacheList struct {
+	Items  []CacheEntry `json:"items"`
+	Cursor string       `json:"cursor,omitempty"`
+}
+
+// CacheCount is how many caches match a filter in total and per service
+type CacheCount struct {
+	TotalCount int            `json:"totalCount"`
+	Services   map[string]int `json:"services"`
+}
+
+// ErrInvalidCachePattern error for malformed cache path globs
+var ErrInvalidCachePattern = errors.New("Invalid cache pattern")
+
+// ErrInvalidCacheQuery error for cache paths queried without their service
+var ErrInvalidCacheQuery = errors.New("Service should be specified along with path")
+
+// ErrInvalidCachePage error for invalid cache pages
+var ErrInvalidCachePage = errors.New("Limit should be between 1 and 1000")
+
+// ErrInvalidCacheCursor error for cache cursors not returned by a previous page
+var ErrInvalidCacheCursor = errors.New("Invalid cache cursor")
@@ -0,0 +1,92 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacheFilterMatchPath(t *testing.T) {
+	tests := []struct {
+		name    string
+		filter  CacheFilter
+		service string
+		path    string
+		want    bool
+	}{
+		{
+			name:    "Empty filter",
+			service: "catalog",
+			path:    "/products",
+			want:    true,
+		},
+		{
+			name:    "Other service",
+			filter:  CacheFilter{Service: "stock"},
+			service: "catalog",
+			path:    "/products",
+			want:    false,
+		},
+		{
+			name:    "Prefix",
+			filter:  CacheFilter{Service: "catalog", Prefix: "/products"},
+			service: "catalog",
+			path:    "/products/1?color=red",
+			want:    true,
+		},
+		{
+			name:    "Pattern",
+			filter:  CacheFilter{Pattern: "/products/*"},
+			service: "catalog",
+			path:    "/products/1",
+			want:    true,
+		},
+		{
+			name:    "Pattern does not match nested paths",
+			filter:  CacheFilter{Pattern: "/products/*"},
+			service: "catalog",
+			path:    "/products/1/reviews",
+			want:    false,
+		},
+		{
+			name:    "Pattern matches variants by their path",
+			filter:  CacheFilter{Pattern: "/products/*"},
+			service: "catalog",
+			path:    "/products/1" + CacheVariantSeparator + "abc",
+			want:    true,
+		},
+		{
+			name:    "Paths",
+			filter:  CacheFilter{Paths: []CachePath{{Service: "catalog", Path: "/products"}}},
+			service: "catalog",
+			path:    "/products" + CacheVariantSeparator + "abc",
+			want:    true,
+		},
+		{
+			name:    "Paths of other service",
+			filter:  CacheFilter{Paths: []CachePath{{Service: "stock", Path: "/products"}}},
+			service: "catalog",
+			path:    "/products",
+			want:    false,
+		},
+		{
+			name:    "Combined criteria",
+			filter:  CacheFilter{Service: "catalog", Prefix: "/products", Pattern: "*/1"},
+			service: "catalog",
+			path:    "/products/2",
+			want:    false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.filter.MatchPath(tt.service, tt.path))
+		})
+	}
+}
+
+func TestCacheFilterMatchTags(t *testing.T) {
+	assert.True(t, CacheFilter{}.MatchTags(nil))
+	assert.True(t, CacheFilter{Tags: []string{"a", "b"}}.MatchTags([]string{"b"}))
+	assert.False(t, CacheFilter{Tags: []string{"a"}}.MatchTags([]string{"b"}))
+}
@@ -0,0 +1,23 @@
+package model
+
+import "errors"
+
+// CacheQuota bounds the caches of a service, zero values mean unlimited
+type CacheQuota struct {
+	MaxBytes   int64
+	MaxEntries int64
+}
+
+// IsEmpty determines if the quota does not bound anything
+func (q CacheQuota) IsEmpty() bool {
+	return q.MaxBytes <= 0 && q.MaxEntries <= 0
+}
+
+// ErrCacheEntryTooLarge error for responses larger than the maximum entry size
+var ErrCacheEntryTooLarge = errors.New("Cache entry too large")
+
+// ErrCacheQuotaExceeded error for caches that do not fit in the quota of their service
+var ErrCacheQuotaExceeded = errors.New("Cache quota exceeded")
+
+// ErrCacheBudgetExceeded error for caches that do not fit in the size of the whole cache
+var ErrCacheBudgetExceeded = errors.New("Cache budget exceeded")
@@ -1,7 +1,9 @@
 package model
 
 import (
+	"encoding/json"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -31,7 +33,22 @@ func TestDeleteValidate(t *testing.T) {
 				},
 				Tags: []string{"catalog"},
 			},
-			wantErr: ErrInvalidDeleteCache,
+			wantErr: nil,
+		},
+		{
+			name: "Validate delete with invalid pattern",
+			delete: DeleteCache{
+				Service: "catalog",
+				Pattern: "/products/[",
+			},
+			wantErr: ErrInvalidCachePattern,
+		},
+		{
+			name: "Validate delete by prefix",
+			delete: DeleteCache{
+				Prefix: "/products",
+			},
+			wantErr: nil,
 		},
 		{
 			name: "Validate valid delete",
@@ -61,3 +78,69 @@ func TestErrCachePathFormat(t *testing.T) {
 
 	assert.EqualError(t, err, "Cache path not found: catalog/products")
 }
+
+func TestCacheFreshness(t *testing.T) {
+	createdAt := time.Date(2022, time.January, 1, 0, 0, 0, 0, time.UTC)
+	cache := Cache{
+		TTL:                  NewCacheTTL(30),
+		StaleWhileRevalidate: NewCacheTTL(10),
+		StaleIfError:         NewCacheTTL(60),
+		CreatedAt:            createdAt,
+	}
+
+	tests := []struct {
+		name             string
+		age              time.Duration
+		wantFresh        bool
+		wantRevalidate   bool
+		wantServeOnError bool
+	}{
+		{
+			name:             "Fresh",
+			age:              10 * time.Second,
+			wantFresh:        true,
+			wantRevalidate:   true,
+			wantServeOnError: true,
+		},
+		{
+			name:             "Stale while revalidate",
+			age:              35 * time.Second,
+			wantRevalidate:   true,
+			wantServeOnError: true,
+		},
+		{
+			name:             "Stale if error",
+			age:              80 * time.Second,
+			wantServeOnError: true,
+		},
+		{
+			name: "Expired",
+			age:  90 * time.Second,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := createdAt.Add(tt.age)
+
+			assert.Equal(t, tt.age, cache.Age(now))
+			assert.Equal(t, tt.wantFresh, cache.IsFresh(now))
+			assert.Equal(t, tt.wantRevalidate, cache.CanRevalidate(now))
+			assert.Equal(t, tt.wantServeOnError, cache.CanServeOnError(now))
+		})
+	}
+
+	assert.Equal(t, 90*time.Second, cache.Expiration())
+}
+
+func TestCacheTTLJSON(t *testing.T) {
+	ttl := NewCacheTTL(30)
+
+	data, err := json.Marshal(ttl)
+	assert.Nil(t, err)
+	assert.Equal(t, "30", string(data))
+
+	var decoded CacheTTL
+	assert.Nil(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, ttl, decoded)
+}
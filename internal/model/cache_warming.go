@@ -0,0 +1,33 @@
+package model
+
+import "time"
+
+const (
+	CacheWarmingPending = "pending"
+	CacheWarmingWarmed  = "warmed"
+	CacheWarmingFailed  = "failed"
+)
+
+// CacheWarming is the state of the paths warmed for an ingress
+type CacheWarming struct {
+	Ingress    string `json:"ingress"`
+	Service    string `json:"service"`
+	SitemapURL string `json:"sitemapURL,omitempty"`
+	// SitemapError is why the sitemap could not be read the last time, its previous paths are kept
+	SitemapError string             `json:"sitemapError,omitempty"`
+	Paths        []CacheWarmingPath `json:"paths"`
+}
+
+// CacheWarmingPath is the outcome of the last time a path was warmed
+type CacheWarmingPath struct {
+	Path string `json:"path"`
+	// Status is pending, warmed or failed
+	Status string `json:"status"`
+	// StatusCode and CacheStatus are the ones of the response, as in the X-Cache header
+	StatusCode   int        `json:"statusCode,omitempty"`
+	CacheStatus  string     `json:"cacheStatus,omitempty"`
+	Error        string     `json:"error,omitempty"`
+	Failures     int        `json:"failures"`
+	LastWarmedAt *time.Time `json:"lastWarmedAt,omitempty"`
+	NextWarmAt   time.Time  `json:"nextWarmAt"`
+}
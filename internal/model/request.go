@@ -0,0 +1,15 @@
+package model
+
+import "errors"
+
+// ErrRequestBodyTooLarge error for requests exceeding the body size limit
+var ErrRequestBodyTooLarge = errors.New("Request body too large")
+
+// ErrURITooLong error for requests exceeding the URL length limit
+var ErrURITooLong = errors.New("Request URI too long")
+
+// ErrRequestHeaderFieldsTooLarge error for requests exceeding the header size limit
+var ErrRequestHeaderFieldsTooLarge = errors.New("Request header fields too large")
+
+// ErrUnsupportedMediaType error for request bodies that cannot be validated
+var ErrUnsupportedMediaType = errors.New("Unsupported media type")
@@ -0,0 +1,278 @@
+package openapi
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	crdv1alpha1 "github.com/gotway/gotway/pkg/kubernetes/crd/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// SourceLabel identifies the ingresses generated from a service's OpenAPI document
+	SourceLabel = "gotway.io/openapi-service"
+	// OperationAnnotation keeps the OpenAPI operation an ingress was generated from
+	OperationAnnotation = "gotway.io/openapi-operation"
+	// SecurityAnnotation lists the security schemes required by an operation
+	SecurityAnnotation = "gotway.io/security"
+)
+
+// Document is the subset of an OpenAPI 3 document used to generate ingresses
+type Document struct {
+	OpenAPI  string                `json:"openapi"`
+	Servers  []Server              `json:"servers"`
+	Paths    map[string]PathItem   `json:"paths"`
+	Security []SecurityRequirement `json:"security"`
+	Cache    *CacheExtension       `json:"x-gotway-cache"`
+}
+
+type Server struct {
+	URL string `json:"url"`
+}
+
+type PathItem struct {
+	Get     *Operation      `json:"get"`
+	Put     *Operation      `json:"put"`
+	Post    *Operation      `json:"post"`
+	Delete  *Operation      `json:"delete"`
+	Options *Operation      `json:"options"`
+	Head    *Operation      `json:"head"`
+	Patch   *Operation      `json:"patch"`
+	Trace   *Operation      `json:"trace"`
+	Cache   *CacheExtension `json:"x-gotway-cache"`
+}
+
+type Operation struct {
+	OperationID string                 `json:"operationId"`
+	Tags        []string               `json:"tags"`
+	Security    *[]SecurityRequirement `json:"security"`
+	Cache       *CacheExtension        `json:"x-gotway-cache"`
+}
+
+// SecurityRequirement maps security scheme names to their scopes
+type SecurityRequirement map[string][]string
+
+// CacheExtension is the x-gotway-cache vendor extension, it may be defined
+// at document, path or operation level
+type CacheExtension struct {
+	TTL      int64    `json:"ttl"`
+	Statuses []int    `json:"statuses"`
+	Tags     []string `json:"tags"`
+}
+
+// Options configure how ingresses are generated
+type Options struct {
+	Namespace string
+	Host      string
+	Service   crdv1alpha1.Service
+}
+
+var (
+	ErrInvalidDocument = errors.New("invalid OpenAPI 3 document")
+
+	invalidNameChars = regexp.MustCompile(`[^a-z0-9]+`)
+	camelCaseWord    = regexp.MustCompile(`([a-z0-9])([A-Z])`)
+)
+
+const maxNameLength = 63
+
+// Parse parses an OpenAPI 3 document in JSON or YAML format
+func Parse(data []byte) (*Document, error) {
+	var doc Document
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidDocument, err)
+	}
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		return nil, fmt.Errorf("%w: unsupported version '%s'", ErrInvalidDocument, doc.OpenAPI)
+	}
+	return &doc, nil
+}
+
+// Ingresses generates an IngressHTTP per operation in the document.
+// Cache settings are taken from the most specific x-gotway-cache extension,
+// but extensions inherited from the path or the document are ignored for
+// operations that require authentication, as their responses are private.
+func (d *Document) Ingresses(options Options) ([]crdv1alpha1.IngressHTTP, error) {
+	if options.Service.Name == "" || options.Service.URL == "" {
+		return nil, errors.New("service name and url are required")
+	}
+	basePath, err := d.basePath()
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make([]string, 0, len(d.Paths))
+	for path := range d.Paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var ingresses []crdv1alpha1.IngressHTTP
+	names := make(map[string]bool)
+	for _, path := range paths {
+		item := d.Paths[path]
+		for _, op := range item.operations() {
+			name := uniqueName(ingressName(options.Service.Name, op.method, path, op.OperationID), names)
+			ingresses = append(ingresses, d.ingress(options, name, basePath+path, item, op))
+		}
+	}
+	return ingresses, nil
+}
+
+func (d *Document) ingress(
+	options Options,
+	name string,
+	pathTemplate string,
+	item PathItem,
+	op methodOperation,
+) crdv1alpha1.IngressHTTP {
+	security := d.Security
+	if op.Security != nil {
+		security = *op.Security
+	}
+	schemes := securitySchemes(security)
+
+	cache := op.Cache
+	if cache == nil && len(schemes) == 0 {
+		cache = item.Cache
+		if cache == nil {
+			cache = d.Cache
+		}
+	}
+
+	ingress := crdv1alpha1.IngressHTTP{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: crdv1alpha1.SchemeGroupVersion.String(),
+			Kind:       "IngressHTTP",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: options.Namespace,
+			Labels: map[string]string{
+				SourceLabel: options.Service.Name,
+			},
+			Annotations: map[string]string{
+				OperationAnnotation: fmt.Sprintf("%s %s", op.method, pathTemplate),
+			},
+		},
+		Spec: crdv1alpha1.IngressHTTPSpec{
+			Match: crdv1alpha1.Match{
+				Method:       op.method,
+				Host:         options.Host,
+				PathTemplate: pathTemplate,
+			},
+			Service: options.Service,
+			Cache: crdv1alpha1.Cache{
+				Statuses: []int{},
+				Tags:     []string{},
+			},
+		},
+	}
+	if len(schemes) > 0 {
+		ingress.Annotations[SecurityAnnotation] = strings.Join(schemes, ",")
+	}
+	if cache != nil && cache.TTL > 0 {
+		ingress.Spec.Cache = crdv1alpha1.Cache{
+			TTL:      cache.TTL,
+			Statuses: cache.Statuses,
+			Tags:     cache.Tags,
+		}
+		if len(ingress.Spec.Cache.Statuses) == 0 {
+			ingress.Spec.Cache.Statuses = []int{http.StatusOK}
+		}
+		if len(ingress.Spec.Cache.Tags) == 0 {
+			ingress.Spec.Cache.Tags = append([]string{}, op.Tags...)
+		}
+	}
+	return ingress
+}
+
+// basePath returns the path of the first server, which prefixes every path
+func (d *Document) basePath() (string, error) {
+	if len(d.Servers) == 0 {
+		return "", nil
+	}
+	u, err := url.Parse(d.Servers[0].URL)
+	if err != nil {
+		return "", fmt.Errorf("%w: invalid server url: %v", ErrInvalidDocument, err)
+	}
+	return strings.TrimSuffix(u.Path, "/"), nil
+}
+
+type methodOperation struct {
+	method string
+	*Operation
+}
+
+func (p PathItem) operations() []methodOperation {
+	var ops []methodOperation
+	for _, op := range []methodOperation{
+		{http.MethodGet, p.Get},
+		{http.MethodPut, p.Put},
+		{http.MethodPost, p.Post},
+		{http.MethodDelete, p.Delete},
+		{http.MethodOptions, p.Options},
+		{http.MethodHead, p.Head},
+		{http.MethodPatch, p.Patch},
+		{http.MethodTrace, p.Trace},
+	} {
+		if op.Operation != nil {
+			ops = append(ops, op)
+		}
+	}
+	return ops
+}
+
+// securitySchemes returns the schemes of a list of alternative requirements.
+// An empty requirement means that the operation can be called anonymously.
+func securitySchemes(requirements []SecurityRequirement) []string {
+	unique := make(map[string]bool)
+	for _, requirement := range requirements {
+		if len(requirement) == 0 {
+			return nil
+		}
+		for scheme := range requirement {
+			unique[scheme] = true
+		}
+	}
+	schemes := make([]string, 0, len(unique))
+	for scheme := range unique {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+func ingressName(service, method, path, operationID string) string {
+	suffix := operationID
+	if suffix == "" {
+		suffix = method + "-" + path
+	}
+	suffix = camelCaseWord.ReplaceAllString(suffix, "$1-$2")
+	name := invalidNameChars.ReplaceAllString(strings.ToLower(service+"-"+suffix), "-")
+	name = strings.Trim(name, "-")
+	if len(name) > maxNameLength {
+		name = strings.TrimRight(name[:maxNameLength], "-")
+	}
+	return name
+}
+
+func uniqueName(name string, names map[string]bool) string {
+	unique := name
+	for i := 2; names[unique]; i++ {
+		suffix := fmt.Sprintf("-%d", i)
+		base := name
+		if len(base)+len(suffix) > maxNameLength {
+			base = base[:maxNameLength-len(suffix)]
+		}
+		unique = base + suffix
+	}
+	names[unique] = true
+	return unique
+}
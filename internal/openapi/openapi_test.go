@@ -0,0 +1,183 @@
+package openapi
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	crdv1alpha1 "github.com/gotway/gotway/pkg/kubernetes/crd/v1alpha1"
+	"github.com/gotway/gotway/pkg/kubernetes/crd/v1alpha1/apis/clientset/versioned/fake"
+	"github.com/stretchr/testify/assert"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const catalogDocument = `
+openapi: 3.0.3
+info:
+  title: catalog
+  version: 1.0.0
+servers:
+  - url: https://catalog.gotway.duckdns.org/v1/
+x-gotway-cache:
+  ttl: 30
+paths:
+  /products:
+    get:
+      operationId: listProducts
+      tags: [products]
+    post:
+      operationId: createProduct
+      security:
+        - bearerAuth: []
+  /products/{id}:
+    x-gotway-cache:
+      ttl: 60
+      statuses: [200, 404]
+      tags: [product]
+    get:
+      operationId: getProduct
+    delete:
+      security:
+        - bearerAuth: []
+        - apiKey: []
+      x-gotway-cache:
+        ttl: 10
+`
+
+var catalogService = crdv1alpha1.Service{
+	Name:       "catalog",
+	URL:        "http://gotway-catalog",
+	HealthPath: "/health",
+}
+
+func TestIngresses(t *testing.T) {
+	doc, err := Parse([]byte(catalogDocument))
+	assert.Nil(t, err)
+
+	ingresses, err := doc.Ingresses(Options{
+		Namespace: "default",
+		Host:      "catalog.gotway.duckdns.org",
+		Service:   catalogService,
+	})
+	assert.Nil(t, err)
+
+	type want struct {
+		name     string
+		method   string
+		template string
+		cache    crdv1alpha1.Cache
+		security string
+	}
+	wants := []want{
+		{
+			name:     "catalog-list-products",
+			method:   "GET",
+			template: "/v1/products",
+			cache:    crdv1alpha1.Cache{TTL: 30, Statuses: []int{200}, Tags: []string{"products"}},
+		},
+		{
+			name:     "catalog-create-product",
+			method:   "POST",
+			template: "/v1/products",
+			cache:    crdv1alpha1.Cache{Statuses: []int{}, Tags: []string{}},
+			security: "bearerAuth",
+		},
+		{
+			name:     "catalog-get-product",
+			method:   "GET",
+			template: "/v1/products/{id}",
+			cache:    crdv1alpha1.Cache{TTL: 60, Statuses: []int{200, 404}, Tags: []string{"product"}},
+		},
+		{
+			name:     "catalog-delete-products-id",
+			method:   "DELETE",
+			template: "/v1/products/{id}",
+			cache:    crdv1alpha1.Cache{TTL: 10, Statuses: []int{200}, Tags: []string{}},
+			security: "apiKey,bearerAuth",
+		},
+	}
+
+	assert.Len(t, ingresses, len(wants))
+	for i, w := range wants {
+		ingress := ingresses[i]
+		assert.Equal(t, w.name, ingress.Name)
+		assert.Equal(t, "default", ingress.Namespace)
+		assert.Equal(t, "catalog", ingress.Labels[SourceLabel])
+		assert.Equal(t, w.security, ingress.Annotations[SecurityAnnotation])
+		assert.Equal(t, crdv1alpha1.Match{
+			Method:       w.method,
+			Host:         "catalog.gotway.duckdns.org",
+			PathTemplate: w.template,
+		}, ingress.Spec.Match)
+		assert.Equal(t, catalogService, ingress.Spec.Service)
+		assert.Equal(t, w.cache, ingress.Spec.Cache)
+	}
+}
+
+func TestParseInvalidDocument(t *testing.T) {
+	_, err := Parse([]byte(`swagger: "2.0"`))
+	assert.True(t, errors.Is(err, ErrInvalidDocument))
+
+	_, err = Parse([]byte(`openapi: [`))
+	assert.True(t, errors.Is(err, ErrInvalidDocument))
+}
+
+func TestIngressNames(t *testing.T) {
+	names := make(map[string]bool)
+
+	assert.Equal(t, "catalog-get-products", uniqueName(ingressName("catalog", "GET", "/products", ""), names))
+	assert.Equal(t, "catalog-get-products-2", uniqueName(ingressName("catalog", "GET", "/products/", ""), names))
+
+	long := ingressName("catalog", "GET", "", "getProductStockByWarehouseAndSizeAndColorForTheCurrentSeason")
+	assert.LessOrEqual(t, len(long), maxNameLength)
+}
+
+func TestSync(t *testing.T) {
+	ctx := context.Background()
+	doc, err := Parse([]byte(catalogDocument))
+	assert.Nil(t, err)
+	ingresses, err := doc.Ingresses(Options{Service: catalogService})
+	assert.Nil(t, err)
+
+	stale := crdv1alpha1.IngressHTTP{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "catalog-old-operation",
+			Namespace: "default",
+			Labels:    map[string]string{SourceLabel: "catalog"},
+		},
+	}
+	existing := ingresses[0].DeepCopy()
+	existing.Namespace = "default"
+	existing.Spec.Cache = crdv1alpha1.Cache{}
+	clientSet := fake.NewSimpleClientset(&stale, existing)
+
+	result, err := Sync(ctx, clientSet, "default", "catalog", ingresses, true)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{ingresses[0].Name}, result.Updated)
+	assert.Len(t, result.Created, len(ingresses)-1)
+	assert.Equal(t, []string{"catalog-old-operation"}, result.Deleted)
+
+	updated, err := clientSet.GotwayV1alpha1().IngressHTTPs("default").Get(ctx, ingresses[0].Name, metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, ingresses[0].Spec, updated.Spec)
+}
+
+func TestSyncForeignIngress(t *testing.T) {
+	ctx := context.Background()
+	doc, err := Parse([]byte(catalogDocument))
+	assert.Nil(t, err)
+	ingresses, err := doc.Ingresses(Options{Service: catalogService})
+	assert.Nil(t, err)
+
+	foreign := crdv1alpha1.IngressHTTP{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      ingresses[0].Name,
+			Namespace: "default",
+		},
+	}
+	clientSet := fake.NewSimpleClientset(&foreign)
+
+	_, err = Sync(ctx, clientSet, "default", "catalog", ingresses, false)
+	assert.NotNil(t, err)
+}
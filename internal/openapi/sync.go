@@ -0,0 +1,85 @@
+package openapi
+
+import (
+	"context"
+	"fmt"
+
+	crdv1alpha1 "github.com/gotway/gotway/pkg/kubernetes/crd/v1alpha1"
+	clientsetv1alpha1 "github.com/gotway/gotway/pkg/kubernetes/crd/v1alpha1/apis/clientset/versioned"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// SyncResult summarizes the changes applied by Sync
+type SyncResult struct {
+	Created []string
+	Updated []string
+	Deleted []string
+}
+
+// Sync creates or updates the generated ingresses. When prune is enabled,
+// ingresses previously generated for the same service that are no longer
+// part of the document are deleted.
+func Sync(
+	ctx context.Context,
+	clientSet clientsetv1alpha1.Interface,
+	namespace string,
+	service string,
+	ingresses []crdv1alpha1.IngressHTTP,
+	prune bool,
+) (SyncResult, error) {
+	var result SyncResult
+	client := clientSet.GotwayV1alpha1().IngressHTTPs(namespace)
+	generated := make(map[string]bool, len(ingresses))
+
+	for _, ingress := range ingresses {
+		ingress := ingress
+		ingress.Namespace = namespace
+		generated[ingress.Name] = true
+
+		current, err := client.Get(ctx, ingress.Name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			if _, err := client.Create(ctx, &ingress, metav1.CreateOptions{}); err != nil {
+				return result, fmt.Errorf("error creating ingress '%s': %v", ingress.Name, err)
+			}
+			result.Created = append(result.Created, ingress.Name)
+			continue
+		}
+		if err != nil {
+			return result, fmt.Errorf("error getting ingress '%s': %v", ingress.Name, err)
+		}
+		if current.Labels[SourceLabel] != service {
+			return result, fmt.Errorf("ingress '%s' already exists and was not generated for service '%s'", ingress.Name, service)
+		}
+
+		updated := current.DeepCopy()
+		updated.Labels = ingress.Labels
+		updated.Annotations = ingress.Annotations
+		updated.Spec = ingress.Spec
+		if _, err := client.Update(ctx, updated, metav1.UpdateOptions{}); err != nil {
+			return result, fmt.Errorf("error updating ingress '%s': %v", ingress.Name, err)
+		}
+		result.Updated = append(result.Updated, ingress.Name)
+	}
+
+	if !prune {
+		return result, nil
+	}
+	list, err := client.List(ctx, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=%s", SourceLabel, service),
+	})
+	if err != nil {
+		return result, fmt.Errorf("error listing ingresses: %v", err)
+	}
+	for _, ingress := range list.Items {
+		if generated[ingress.Name] {
+			continue
+		}
+		if err := client.Delete(ctx, ingress.Name, metav1.DeleteOptions{}); err != nil {
+			return result, fmt.Errorf("error deleting ingress '%s': %v", ingress.Name, err)
+		}
+		result.Deleted = append(result.Deleted, ingress.Name)
+	}
+	return result, nil
+}
@@ -0,0 +1,35 @@
+package openapi
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+)
+
+var (
+	templateParam   = regexp.MustCompile(`\{[^/{}]+\}`)
+	templateRegexps sync.Map
+)
+
+// MatchPathTemplate matches a path against an OpenAPI style template, where
+// each {param} matches a single non empty path segment or part of it
+func MatchPathTemplate(template, path string) bool {
+	if re, ok := templateRegexps.Load(template); ok {
+		return re.(*regexp.Regexp).MatchString(path)
+	}
+
+	var pattern strings.Builder
+	pattern.WriteString("^")
+	last := 0
+	for _, loc := range templateParam.FindAllStringIndex(template, -1) {
+		pattern.WriteString(regexp.QuoteMeta(template[last:loc[0]]))
+		pattern.WriteString("[^/]+")
+		last = loc[1]
+	}
+	pattern.WriteString(regexp.QuoteMeta(template[last:]))
+	pattern.WriteString("$")
+
+	re := regexp.MustCompile(pattern.String())
+	templateRegexps.Store(template, re)
+	return re.MatchString(path)
+}
@@ -0,0 +1,71 @@
+package openapi
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchPathTemplate(t *testing.T) {
+	tests := []struct {
+		name      string
+		template  string
+		path      string
+		wantMatch bool
+	}{
+		{
+			name:      "Literal path",
+			template:  "/products",
+			path:      "/products",
+			wantMatch: true,
+		},
+		{
+			name:      "Literal path mismatch",
+			template:  "/products",
+			path:      "/products/1",
+			wantMatch: false,
+		},
+		{
+			name:      "Single param",
+			template:  "/products/{id}",
+			path:      "/products/911902081",
+			wantMatch: true,
+		},
+		{
+			name:      "Param does not span segments",
+			template:  "/products/{id}",
+			path:      "/products/1/stock",
+			wantMatch: false,
+		},
+		{
+			name:      "Param must not be empty",
+			template:  "/products/{id}",
+			path:      "/products/",
+			wantMatch: false,
+		},
+		{
+			name:      "Multiple params",
+			template:  "/products/{id}/stock/{warehouse}",
+			path:      "/products/1/stock/madrid",
+			wantMatch: true,
+		},
+		{
+			name:      "Partial segment param",
+			template:  "/reports/{id}.json",
+			path:      "/reports/2021.json",
+			wantMatch: true,
+		},
+		{
+			name:      "Regexp characters are escaped",
+			template:  "/reports/{id}.json",
+			path:      "/reports/2021xjson",
+			wantMatch: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.wantMatch, MatchPathTemplate(tt.template, tt.path))
+		})
+	}
+}
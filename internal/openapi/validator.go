@@ -0,0 +1,183 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"sort"
+	"strings"
+
+	"github.com/gotway/gotway/pkg/jsonschema"
+	"sigs.k8s.io/yaml"
+)
+
+// Validator validates request bodies against the operations of an OpenAPI 3 document
+type Validator struct {
+	operations []validatedOperation
+}
+
+type validatedOperation struct {
+	method   string
+	template string
+	required bool
+	// schema is nil when the operation does not describe a JSON body
+	schema *jsonschema.Schema
+}
+
+// NewValidator compiles the JSON request body schemas of every operation of a document,
+// references to its components are resolved
+func NewValidator(data []byte) (*Validator, error) {
+	doc, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	basePath, err := doc.basePath()
+	if err != nil {
+		return nil, err
+	}
+	source, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidDocument, err)
+	}
+	var raw struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(source, &raw); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidDocument, err)
+	}
+
+	paths := make([]string, 0, len(doc.Paths))
+	for path := range doc.Paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	v := &Validator{}
+	for _, path := range paths {
+		for _, op := range doc.Paths[path].operations() {
+			method := strings.ToLower(op.method)
+			var operation struct {
+				RequestBody *requestBody `json:"requestBody"`
+			}
+			if err := json.Unmarshal(raw.Paths[path][method], &operation); err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrInvalidDocument, err)
+			}
+
+			validated := validatedOperation{method: op.method, template: basePath + path}
+			pointer := fmt.Sprintf("#/paths/%s/%s/requestBody", escapePointer(path), method)
+			body := operation.RequestBody
+			if body != nil && body.Ref != "" {
+				if body, err = getRequestBody(source, body.Ref); err != nil {
+					return nil, fmt.Errorf("%s %s: %v", op.method, path, err)
+				}
+				pointer = body.Ref
+			}
+			if body != nil {
+				validated.required = body.Required
+				if mediaType, ok := body.jsonMediaType(); ok {
+					ref := fmt.Sprintf("%s/content/%s/schema", pointer, escapePointer(mediaType))
+					if validated.schema, err = jsonschema.CompileRef(source, ref); err != nil {
+						return nil, fmt.Errorf("%s %s: %v", op.method, path, err)
+					}
+				}
+			}
+			v.operations = append(v.operations, validated)
+		}
+	}
+	// literal paths take precedence over templated ones, as in the OpenAPI specification
+	sort.SliceStable(v.operations, func(i, j int) bool {
+		return lessSpecific(v.operations[j].template, v.operations[i].template)
+	})
+	return v, nil
+}
+
+// Validate checks the body of a request against the operation matching its method and path.
+// Requests to operations that are not described by the document are not validated
+func (v *Validator) Validate(method string, path string, body []byte) error {
+	for _, op := range v.operations {
+		if op.method != method || !MatchPathTemplate(op.template, path) {
+			continue
+		}
+		if len(bytes.TrimSpace(body)) == 0 {
+			if op.required {
+				return &jsonschema.ValidationError{Message: "request body is required"}
+			}
+			return nil
+		}
+		if op.schema == nil {
+			return nil
+		}
+		return op.schema.Validate(body)
+	}
+	return nil
+}
+
+type requestBody struct {
+	Ref      string                     `json:"$ref"`
+	Required bool                       `json:"required"`
+	Content  map[string]json.RawMessage `json:"content"`
+}
+
+// jsonMediaType returns the JSON media type of the body, if any
+func (b *requestBody) jsonMediaType() (string, bool) {
+	mediaTypes := make([]string, 0, len(b.Content))
+	for mediaType := range b.Content {
+		mediaTypes = append(mediaTypes, mediaType)
+	}
+	sort.Strings(mediaTypes)
+	for _, mediaType := range mediaTypes {
+		if IsJSONMediaType(mediaType) {
+			return mediaType, true
+		}
+	}
+	return "", false
+}
+
+// getRequestBody resolves a reference to a request body of the components of the document
+func getRequestBody(source []byte, ref string) (*requestBody, error) {
+	const prefix = "#/components/requestBodies/"
+	if !strings.HasPrefix(ref, prefix) {
+		return nil, fmt.Errorf("unsupported request body reference %s", ref)
+	}
+	var components struct {
+		Components struct {
+			RequestBodies map[string]*requestBody `json:"requestBodies"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(source, &components); err != nil {
+		return nil, err
+	}
+	body, ok := components.Components.RequestBodies[strings.TrimPrefix(ref, prefix)]
+	if !ok || body == nil {
+		return nil, fmt.Errorf("request body reference %s not found", ref)
+	}
+	body.Ref = ref
+	return body, nil
+}
+
+// IsJSONMediaType determines if a media type, with or without parameters, is JSON
+func IsJSONMediaType(value string) bool {
+	mediaType, _, err := mime.ParseMediaType(value)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// escapePointer escapes a token of a JSON pointer used as a URI fragment
+func escapePointer(token string) string {
+	token = strings.ReplaceAll(token, "~", "~0")
+	token = strings.ReplaceAll(token, "/", "~1")
+	return strings.ReplaceAll(token, "%", "%25")
+}
+
+// lessSpecific determines if a path template matches more paths than another one:
+// it has more params or, having the same, a shorter literal part
+func lessSpecific(a, b string) bool {
+	paramsA, paramsB := len(templateParam.FindAllString(a, -1)), len(templateParam.FindAllString(b, -1))
+	if paramsA != paramsB {
+		return paramsA > paramsB
+	}
+	return len(templateParam.ReplaceAllString(a, "")) < len(templateParam.ReplaceAllString(b, ""))
+}
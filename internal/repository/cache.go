@@ -3,34 +3,210 @@ package repository
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	goRedis "github.com/go-redis/redis/v8"
 	"github.com/gotway/gotway/internal/model"
+	"github.com/gotway/gotway/pkg/metrics"
 	"github.com/gotway/gotway/pkg/redis"
+	"github.com/gotway/gotway/pkg/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type CacheRepo interface {
-	Create(cache model.Cache, serviceKey string) error
-	Get(path string, serviceKey string) (model.Cache, error)
-	DeleteByPath(paths []model.CachePath) error
-	DeleteByTags(tags []string) error
+	Create(ctx context.Context, cache model.Cache, serviceKey string, quota model.CacheQuota) error
+	Get(ctx context.Context, path string, serviceKey string) (model.Cache, error)
+	DeleteByPath(ctx context.Context, paths []model.CachePath) error
+	DeleteByTags(ctx context.Context, tags []string) (int64, error)
+	DeleteByFilter(ctx context.Context, filter model.CacheFilter) (int64, error)
+	Find(ctx context.Context, filter model.CacheFilter, page model.CachePage) (model.CacheList, error)
+	Count(ctx context.Context, filter model.CacheFilter) (model.CacheCount, error)
+	Lock(ctx context.Context, path string, serviceKey string, token string, ttl time.Duration) (bool, error)
+	Unlock(ctx context.Context, path string, serviceKey string, token string) error
 }
 
 var (
-	ctx          = context.Background()
 	maxTxRetries = 1000
+	tracer       = otel.Tracer("github.com/gotway/gotway/internal/repository")
+	// unlockScript releases a lock only if it is still held by the same token
+	unlockScript = goRedis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+	// quotaLua keeps the accounting of the caches of every service in its slot: a sorted set of
+	// its caches by expiration, a hash with their sizes and the bytes they use
+	quotaLua = `
+local quotaPrefix, tagIndexPrefix = "` + quotaPrefix + `", "` + tagIndexPrefix + `"
+local function slotKey(prefix, service)
+	return prefix .. "{" .. service .. "}"
+end
+local function release(service, cacheKey)
+	local index = slotKey(quotaPrefix, service)
+	local size = tonumber(redis.call("HGET", index .. "::sizes", cacheKey))
+	redis.call("ZREM", index, cacheKey)
+	if size then
+		redis.call("HDEL", index .. "::sizes", cacheKey)
+		if redis.call("INCRBY", index .. "::bytes", -size) <= 0 then
+			redis.call("DEL", index .. "::bytes")
+		end
+	end
+end
+local function purge(service, now)
+	for _, cacheKey in ipairs(redis.call("ZRANGEBYSCORE", slotKey(quotaPrefix, service), "-inf", now)) do
+		release(service, cacheKey)
+	end
+end
+`
+	// deleteCacheLua deletes a cache along with its tags and removes it from the tag index, the variants
+	// of its path and its quota, all of them belong to the slot of its service
+	deleteCacheLua = quotaLua + `
+local function deleteCache(cacheKey, deleted)
+	local tagsKey = cacheKey .. "::tags"
+	local service = string.match(cacheKey, "^cache::{(.-)}::")
+	if service then
+		for _, tag in ipairs(redis.call("SMEMBERS", tagsKey)) do
+			redis.call("ZREM", slotKey(tagIndexPrefix, service) .. "::" .. tag, cacheKey)
+		end
+		local separator = string.find(cacheKey, "` + model.CacheVariantSeparator + `", 1, true)
+		if separator then
+			redis.call("ZREM", "` + variantsPrefix + `" .. string.sub(cacheKey, #"cache::" + 1, separator - 1), cacheKey)
+		end
+		release(service, cacheKey)
+	end
+	redis.call("DEL", tagsKey)
+	if redis.call("DEL", cacheKey) > 0 then
+		table.insert(deleted, cacheKey)
+	end
+end
+`
+	// deleteKeysScript deletes caches of a service by their keys and returns the ones that existed
+	deleteKeysScript = goRedis.NewScript(deleteCacheLua + `
+local deleted = {}
+for _, cacheKey in ipairs(KEYS) do
+	deleteCache(cacheKey, deleted)
+end
+return deleted`)
+	// deleteTagsScript deletes the caches of a service indexed by some tags, skipping the ones already expired
+	deleteTagsScript = goRedis.NewScript(deleteCacheLua + `
+local deleted = {}
+for _, tagKey in ipairs(KEYS) do
+	redis.call("ZREMRANGEBYSCORE", tagKey, "-inf", ARGV[1])
+	for _, cacheKey in ipairs(redis.call("ZRANGE", tagKey, 0, -1)) do
+		deleteCache(cacheKey, deleted)
+	end
+	redis.call("DEL", tagKey)
+end
+return deleted`)
+	// usageScript purges the expired caches of a service and returns the bytes it uses and how many caches it has
+	usageScript = goRedis.NewScript(quotaLua + `
+purge(ARGV[1], ARGV[2])
+return {tonumber(redis.call("GET", KEYS[1] .. "::bytes")) or 0, redis.call("ZCARD", KEYS[1])}`)
+	// admitScript reserves room for a cache in the quota of its service and the budget of the whole
+	// cache, given the bytes used by the rest of services. The previous version of the cache is deleted
+	// and the caches of the service closest to expire are evicted until it fits in the quota.
+	// It returns the reason why it was rejected, if it was, followed by the evicted caches
+	admitScript = goRedis.NewScript(deleteCacheLua + `
+local cacheKey, index, service = KEYS[1], KEYS[2], ARGV[1]
+local bytesKey = index .. "::bytes"
+local size, expiresAt, expiration, now = tonumber(ARGV[2]), ARGV[3], tonumber(ARGV[4]), ARGV[5]
+local maxBytes, maxEntries, budget, others = tonumber(ARGV[6]), tonumber(ARGV[7]), tonumber(ARGV[8]), tonumber(ARGV[9])
+if maxBytes > 0 and size > maxBytes then
+	return {"quota"}
+end
+purge(service, now)
+deleteCache(cacheKey, {})
+local evicted = {}
+while true do
+	local count = redis.call("ZCARD", index)
+	local bytes = tonumber(redis.call("GET", bytesKey)) or 0
+	if count == 0 or ((maxBytes <= 0 or bytes + size <= maxBytes) and (maxEntries <= 0 or count < maxEntries)) then
+		break
+	end
+	deleteCache(redis.call("ZRANGE", index, 0, 0)[1], evicted)
+end
+if budget > 0 and others + (tonumber(redis.call("GET", bytesKey)) or 0) + size > budget then
+	return {"budget", unpack(evicted)}
+end
+redis.call("ZADD", index, expiresAt, cacheKey)
+redis.call("HSET", index .. "::sizes", cacheKey, size)
+redis.call("INCRBY", bytesKey, size)
+for _, key in ipairs({index, index .. "::sizes", bytesKey}) do
+	if redis.call("PTTL", key) < expiration then
+		redis.call("PEXPIRE", key, expiration)
+	end
+end
+return {"", unpack(evicted)}`)
 )
 
+// deleteBatchSize limits the keys deleted by each script run, so Redis is not blocked for long
+const deleteBatchSize = 500
+
+// findBatchSize is how many caches are read from an index at once when finding caches
+const findBatchSize = 500
+
+// tagIndexPrefix prefixes the sorted sets that index the caches of every service and tag by their expiration
+const tagIndexPrefix = "tag::"
+
+// variantsPrefix prefixes the sorted sets that index the variants of every path by their expiration
+const variantsPrefix = "variants::"
+
+// quotaPrefix prefixes the sorted sets that index the caches of every service by their expiration
+const quotaPrefix = "quota::"
+
+// servicesKey holds the services that have been cached, so their tag indexes and quotas can be found
+const servicesKey = "cache-services"
+
+// usageRefreshInterval is how often the bytes used by every service are read again, purging their
+// expired caches and forgetting the services left without caches
+const usageRefreshInterval = time.Second
+
+type RedisOptions struct {
+	// Compression gzips the bodies of at least CompressionMinSize bytes
+	Compression        bool
+	CompressionMinSize int
+	// MaxBytes is the budget of the whole cache, caches that do not fit are rejected.
+	// It is approximate, as the bytes used by the rest of services are read every usageRefreshInterval
+	MaxBytes int64
+}
+
+// redisUsage holds the bytes used by every service when they were last read, so writes do not
+// read the quota of every service
+type redisUsage struct {
+	mu        sync.Mutex
+	bytes     map[string]int64
+	refreshed time.Time
+}
+
+// CacheRepoRedis stores every cache in a hash, holding its metadata in a compact binary
+// encoding and its body as raw bytes. Caches stored as JSON strings by previous versions,
+// whose keys had no hash tag, are still readable until they expire.
+// The keys of a service share a hash tag, so they belong to the same slot of a cluster
+// and can be used together in transactions and scripts
 type CacheRepoRedis struct {
-	redis redis.Cmdable
+	redis   redis.Cmdable
+	options RedisOptions
+	usage   *redisUsage
 }
 
-func (r CacheRepoRedis) Create(cache model.Cache, serviceKey string) error {
-	bytes, err := json.Marshal(cache)
+func (r CacheRepoRedis) Create(
+	ctx context.Context,
+	cache model.Cache,
+	serviceKey string,
+	quota model.CacheQuota,
+) (err error) {
+	ctx, span := startSpan(ctx, "redis.create")
+	defer func() { tracing.EndSpan(span, ignoreRejected(err)) }()
+
+	fields, err := encodeCache(cache, r.options)
 	if err != nil {
 		return err
 	}
@@ -38,28 +214,272 @@ func (r CacheRepoRedis) Create(cache model.Cache, serviceKey string) error {
 	cacheKey := getCacheRedisKey(cache.Path, serviceKey)
 	tagsKey := getCacheTagsRedisKey(cache.Path, serviceKey)
 	keys := []string{cacheKey, tagsKey}
+	for _, tag := range cache.Tags {
+		keys = append(keys, getTagIndexRedisKey(serviceKey, tag))
+	}
+	var variantsKey string
+	if parts := strings.SplitN(cache.Path, model.CacheVariantSeparator, 2); len(parts) == 2 {
+		variantsKey = getVariantsRedisKey(parts[0], serviceKey)
+		keys = append(keys, variantsKey)
+	}
+	expiration := cache.Expiration()
+	if err := r.admit(ctx, cacheKey, serviceKey, encodedSize(fields), expiration, quota); err != nil {
+		return err
+	}
+	// the service is added once its cache is indexed, so it is added back if it was forgotten meanwhile
+	if err := r.redis.SAdd(ctx, servicesKey, serviceKey).Err(); err != nil {
+		return err
+	}
 
 	txFn := func(tx *goRedis.Tx) error {
+		oldTags, err := tx.SMembers(ctx, tagsKey).Result()
+		if err != nil {
+			return err
+		}
+		tagTTLs := make([]time.Duration, len(cache.Tags))
+		for i, tag := range cache.Tags {
+			if tagTTLs[i], err = tx.PTTL(ctx, getTagIndexRedisKey(serviceKey, tag)).Result(); err != nil {
+				return err
+			}
+		}
+		var variantsTTL time.Duration
+		if variantsKey != "" {
+			if variantsTTL, err = tx.PTTL(ctx, variantsKey).Result(); err != nil {
+				return err
+			}
+		}
+		now := time.Now()
+
 		pipe := tx.TxPipeline()
-		pipe.SAdd(ctx, tagsKey, cache.Tags)
-		pipe.Expire(ctx, tagsKey, time.Duration(cache.TTL))
-		pipe.Set(ctx, cacheKey, string(bytes), time.Duration(cache.TTL))
-		_, err := pipe.Exec(ctx)
+		for _, tag := range oldTags {
+			if !containsString(cache.Tags, tag) {
+				pipe.ZRem(ctx, getTagIndexRedisKey(serviceKey, tag), cacheKey)
+			}
+		}
+		pipe.Del(ctx, tagsKey)
+		if len(cache.Tags) > 0 {
+			pipe.SAdd(ctx, tagsKey, cache.Tags)
+			pipe.Expire(ctx, tagsKey, expiration)
+		}
+		for i, tag := range cache.Tags {
+			tagKey := getTagIndexRedisKey(serviceKey, tag)
+			pipe.ZRemRangeByScore(ctx, tagKey, "-inf", strconv.FormatInt(now.UnixMilli(), 10))
+			pipe.ZAdd(ctx, tagKey, &goRedis.Z{
+				Score:  float64(now.Add(expiration).UnixMilli()),
+				Member: cacheKey,
+			})
+			// the index lives as long as its longest lived cache
+			if tagTTLs[i] < expiration {
+				pipe.PExpire(ctx, tagKey, expiration)
+			}
+		}
+		if variantsKey != "" {
+			pipe.ZRemRangeByScore(ctx, variantsKey, "-inf", strconv.FormatInt(now.UnixMilli(), 10))
+			pipe.ZAdd(ctx, variantsKey, &goRedis.Z{
+				Score:  float64(now.Add(expiration).UnixMilli()),
+				Member: cacheKey,
+			})
+			if variantsTTL < expiration {
+				pipe.PExpire(ctx, variantsKey, expiration)
+			}
+		}
+		pipe.Del(ctx, cacheKey)
+		pipe.HSet(ctx, cacheKey, fields)
+		pipe.Expire(ctx, cacheKey, expiration)
+		_, err = pipe.Exec(ctx)
 		return err
 	}
 
-	return r.redis.OptimisticLockTx(ctx, maxTxRetries, txFn, keys...)
+	if err := r.redis.OptimisticLockTx(ctx, maxTxRetries, txFn, keys...); err != nil {
+		return err
+	}
+	// the legacy cache belongs to another slot, it is deleted so it is not read once the new one is deleted
+	return r.redis.Del(ctx, getLegacyCacheRedisKey(cache.Path, serviceKey)).Err()
+}
+
+// admit reserves room for a cache and indexes it in its service, so caches can be listed and counted
+// without scanning every key. A cache that fails to be stored afterwards keeps its room until it would have expired.
+// The quota is checked atomically, while the budget counts the rest of services as they were last read
+func (r CacheRepoRedis) admit(
+	ctx context.Context,
+	cacheKey string,
+	serviceKey string,
+	size int64,
+	expiration time.Duration,
+	quota model.CacheQuota,
+) error {
+	now := time.Now()
+	others, err := r.getUsage(ctx, serviceKey, now)
+	if err != nil {
+		return err
+	}
+	result, err := admitScript.Run(ctx, r.redis,
+		[]string{cacheKey, getQuotaRedisKey(serviceKey)},
+		serviceKey,
+		size,
+		now.Add(expiration).UnixMilli(),
+		expiration.Milliseconds(),
+		now.UnixMilli(),
+		quota.MaxBytes,
+		quota.MaxEntries,
+		r.options.MaxBytes,
+		others,
+	).Result()
+	if err != nil {
+		return redisCacheError(err)
+	}
+	values, _ := result.([]interface{})
+	if len(values) == 0 {
+		return errors.New("unexpected cache admission result")
+	}
+	evicted := make([]string, 0, len(values)-1)
+	for _, key := range values[1:] {
+		if key, ok := key.(string); ok {
+			evicted = append(evicted, key)
+		}
+	}
+	recordEvictions(evicted)
+
+	switch values[0] {
+	case "quota":
+		return model.ErrCacheQuotaExceeded
+	case "budget":
+		return model.ErrCacheBudgetExceeded
+	}
+	return nil
+}
+
+// getUsage returns the bytes used by every service but one, reading them again every usageRefreshInterval.
+// The service itself is checked by the admission script, along with the cache it stores
+func (r CacheRepoRedis) getUsage(ctx context.Context, exceptService string, now time.Time) (int64, error) {
+	r.usage.mu.Lock()
+	defer r.usage.mu.Unlock()
+
+	if r.usage.bytes == nil || now.Sub(r.usage.refreshed) >= usageRefreshInterval {
+		bytes, err := r.readUsage(ctx, now)
+		if err != nil {
+			return 0, err
+		}
+		r.usage.bytes = bytes
+		r.usage.refreshed = now
+	}
+	var used int64
+	for service, bytes := range r.usage.bytes {
+		if service != exceptService {
+			used += bytes
+		}
+	}
+	return used, nil
+}
+
+// readUsage returns the bytes used by every service, purging their expired caches first.
+// Services left without caches are removed, so they are not read by every purge
+func (r CacheRepoRedis) readUsage(ctx context.Context, now time.Time) (map[string]int64, error) {
+	services, err := r.redis.SMembers(ctx, servicesKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	usage := make(map[string]int64, len(services))
+	if len(services) == 0 {
+		return usage, nil
+	}
+	pipe := r.redis.Pipeline()
+	cmds := make([]*goRedis.Cmd, len(services))
+	for i, service := range services {
+		// scripts are not loaded in pipelines, so they are sent along with their source
+		cmds[i] = usageScript.Eval(ctx, pipe, []string{getQuotaRedisKey(service)}, service, now.UnixMilli())
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+	var empty []string
+	for i, cmd := range cmds {
+		result, err := cmd.Result()
+		if err != nil {
+			return nil, err
+		}
+		values, _ := result.([]interface{})
+		if len(values) != 2 {
+			return nil, errors.New("unexpected cache usage result")
+		}
+		bytes, _ := values[0].(int64)
+		if count, _ := values[1].(int64); count == 0 {
+			empty = append(empty, services[i])
+			continue
+		}
+		usage[services[i]] = bytes
+	}
+	if err := r.removeServices(ctx, empty); err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
+
+// removeServices removes services without caches from the services set. Writes add their service
+// after indexing their cache, so the services that got a cache meanwhile are added back
+func (r CacheRepoRedis) removeServices(ctx context.Context, services []string) error {
+	if len(services) == 0 {
+		return nil
+	}
+	members := make([]interface{}, len(services))
+	for i, service := range services {
+		members[i] = service
+	}
+	if err := r.redis.SRem(ctx, servicesKey, members...).Err(); err != nil {
+		return err
+	}
+	pipe := r.redis.Pipeline()
+	cmds := make([]*goRedis.IntCmd, len(services))
+	for i, service := range services {
+		cmds[i] = pipe.ZCard(ctx, getQuotaRedisKey(service))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+	var cached []interface{}
+	for i, cmd := range cmds {
+		if cmd.Val() > 0 {
+			cached = append(cached, services[i])
+		}
+	}
+	if len(cached) == 0 {
+		return nil
+	}
+	return r.redis.SAdd(ctx, servicesKey, cached...).Err()
 }
 
 // Get gets a cache
-func (r CacheRepoRedis) Get(path string, serviceKey string) (model.Cache, error) {
+func (r CacheRepoRedis) Get(ctx context.Context, path string, serviceKey string) (cache model.Cache, err error) {
+	ctx, span := startSpan(ctx, "redis.get")
+	defer func() { tracing.EndSpan(span, ignoreNotFound(err)) }()
+
 	cacheKey := getCacheRedisKey(path, serviceKey)
 
-	result, err := r.redis.Get(ctx, cacheKey).Result()
+	fields, err := r.redis.HGetAll(ctx, cacheKey).Result()
+	switch {
+	case err != nil:
+		err = redisCacheError(err)
+	case len(fields) == 0:
+		cache, err = r.getLegacy(ctx, getLegacyCacheRedisKey(path, serviceKey))
+	default:
+		cache, err = decodeCache(fields)
+	}
 	if err != nil {
-		return model.Cache{}, redisCacheError(err)
+		if errors.Is(err, model.ErrCacheNotFound) {
+			metrics.CacheTierLookups.WithLabelValues(metrics.CacheTierRedis, metrics.CacheMiss).Inc()
+		}
+		return model.Cache{}, err
 	}
+	metrics.CacheTierLookups.WithLabelValues(metrics.CacheTierRedis, metrics.CacheHit).Inc()
+	return cache, nil
+}
 
+// getLegacy gets a cache stored as a JSON string by a previous version
+func (r CacheRepoRedis) getLegacy(ctx context.Context, legacyKey string) (model.Cache, error) {
+	result, err := r.redis.Get(ctx, legacyKey).Result()
+	if err != nil {
+		return model.Cache{}, redisCacheError(err)
+	}
 	var cache model.Cache
 	if err := json.Unmarshal([]byte(result), &cache); err != nil {
 		return model.Cache{}, err
@@ -68,101 +488,622 @@ func (r CacheRepoRedis) Get(path string, serviceKey string) (model.Cache, error)
 }
 
 // DeleteByPath deletes caches by specifying its path
-func (r CacheRepoRedis) DeleteByPath(paths []model.CachePath) error {
-	cacheKeys := make([]string, len(paths))
-	for index, item := range paths {
-		cacheKeys[index] = getCacheRedisKey(item.Path, item.Service)
+func (r CacheRepoRedis) DeleteByPath(ctx context.Context, paths []model.CachePath) (err error) {
+	ctx, span := startSpan(ctx, "redis.delete-by-path")
+	defer func() { tracing.EndSpan(span, err) }()
+
+	var cacheKeys []string
+	for _, item := range paths {
+		keys, err := r.getPathKeys(ctx, item)
+		if err != nil {
+			return err
+		}
+		legacy, err := r.redis.Del(ctx, getLegacyCacheRedisKey(item.Path, item.Service)).Result()
+		if err != nil {
+			return err
+		}
+		if len(keys) == 0 && legacy == 0 {
+			return &model.ErrCachePathNotFound{
+				CachePath: item,
+			}
+		}
+		cacheKeys = append(cacheKeys, keys...)
+	}
+
+	_, err = r.deleteKeys(ctx, cacheKeys)
+	return err
+}
+
+// getPathKeys returns the key of a path along with the keys of its variants, which are looked up in their index
+func (r CacheRepoRedis) getPathKeys(ctx context.Context, path model.CachePath) ([]string, error) {
+	cacheKey := getCacheRedisKey(path.Path, path.Service)
+	pipe := r.redis.Pipeline()
+	exists := pipe.Exists(ctx, cacheKey)
+	variants := pipe.ZRangeByScore(ctx, getVariantsRedisKey(path.Path, path.Service), &goRedis.ZRangeBy{
+		Min: strconv.FormatInt(time.Now().UnixMilli(), 10),
+		Max: "+inf",
+	})
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
 	}
 
-	ok, notFoundIndex, err := r.redis.AllExist(ctx, cacheKeys...)
+	var keys []string
+	if exists.Val() > 0 {
+		keys = append(keys, cacheKey)
+	}
+	return append(keys, variants.Val()...), nil
+}
+
+// DeleteByTags deletes caches defined by its tags and returns how many were deleted
+func (r CacheRepoRedis) DeleteByTags(ctx context.Context, tags []string) (deleted int64, err error) {
+	ctx, span := startSpan(ctx, "redis.delete-by-tags")
+	defer func() { tracing.EndSpan(span, err) }()
+
+	if len(tags) == 0 {
+		return 0, nil
+	}
+	services, err := r.redis.SMembers(ctx, servicesKey).Result()
 	if err != nil {
-		return err
+		return 0, err
 	}
-	if !ok && notFoundIndex >= 0 {
-		return &model.ErrCachePathNotFound{
-			CachePath: paths[notFoundIndex],
+	sort.Strings(services)
+	now := strconv.FormatInt(time.Now().UnixMilli(), 10)
+
+	// every service indexes its tags in its own slot
+	for _, service := range services {
+		tagKeys := make([]string, len(tags))
+		for i, tag := range tags {
+			tagKeys[i] = getTagIndexRedisKey(service, tag)
 		}
+		count, err := r.deleteCaches(ctx, deleteTagsScript, tagKeys, now)
+		if err != nil {
+			return deleted, err
+		}
+		deleted += count
 	}
+	return deleted, nil
+}
+
+// DeleteByFilter deletes the caches matching a filter and returns how many were deleted
+func (r CacheRepoRedis) DeleteByFilter(ctx context.Context, filter model.CacheFilter) (deleted int64, err error) {
+	ctx, span := startSpan(ctx, "redis.delete-by-filter")
+	defer func() { tracing.EndSpan(span, err) }()
 
-	return r.deleteCaches(cacheKeys...)
+	keys, err := r.findKeys(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	return r.deleteKeys(ctx, keys)
 }
 
-// DeleteByTags deletes caches defined by its tags
-func (r CacheRepoRedis) DeleteByTags(tags []string) error {
-	tmpTagsToDeleteKey := fmt.Sprintf("tmp::tags::delete::%d", time.Now().UnixNano())
-	if err := r.redis.SAdd(ctx, tmpTagsToDeleteKey, tags).Err(); err != nil {
-		return err
+// Find lists a page of the caches matching a filter without fetching their bodies. Services are listed
+// one after another and the caches of every service are read from its indexes, closest to expire first
+func (r CacheRepoRedis) Find(
+	ctx context.Context,
+	filter model.CacheFilter,
+	page model.CachePage,
+) (list model.CacheList, err error) {
+	ctx, span := startSpan(ctx, "redis.find")
+	defer func() { tracing.EndSpan(span, err) }()
+
+	from, err := decodeCursor(page)
+	if err != nil {
+		return model.CacheList{}, err
+	}
+	services, err := r.getServices(ctx, filter)
+	if err != nil {
+		return model.CacheList{}, err
+	}
+	now := time.Now()
+	var found []goRedis.Z
+	for _, service := range services {
+		var start cacheCursor
+		if from.Key != "" {
+			fromService := getServiceKey(from.Key)
+			if service < fromService {
+				continue
+			}
+			if service == fromService {
+				start = from
+			}
+		}
+		caches, err := r.findService(ctx, service, filter, start, page.Limit+1-len(found), now)
+		if err != nil {
+			return model.CacheList{}, err
+		}
+		if found = append(found, caches...); len(found) > page.Limit {
+			found = found[:page.Limit]
+			last := found[len(found)-1]
+			list.Cursor = encodeCursor(cacheCursor{Key: last.Member.(string), ExpiresAt: int64(last.Score)})
+			break
+		}
+	}
+	list.Items = []model.CacheEntry{}
+	if len(found) == 0 {
+		return list, nil
 	}
-	defer func() {
-		_ = r.redis.Del(ctx, tmpTagsToDeleteKey).Err()
-	}()
 
-	var cursor uint64
-	var wg sync.WaitGroup
-	for {
-		var keys []string
-		var err error
-		keys, cursor, err = r.redis.Scan(ctx, cursor, "cache::*::tags", 20).Result()
+	pipe := r.redis.Pipeline()
+	metas := make([]*goRedis.SliceCmd, len(found))
+	sizes := make([]*goRedis.Cmd, len(found))
+	for i, z := range found {
+		metas[i] = pipe.HMGet(ctx, z.Member.(string), fieldMeta)
+		sizes[i] = pipe.Do(ctx, "HSTRLEN", z.Member.(string), fieldBody)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return model.CacheList{}, err
+	}
+	for i, z := range found {
+		encoded, ok := metas[i].Val()[0].(string)
+		if !ok {
+			// expired after being found
+			continue
+		}
+		cache, err := decodeMeta([]byte(encoded))
 		if err != nil {
-			return redisCacheError(err)
+			return model.CacheList{}, err
 		}
+		size, _ := sizes[i].Int64()
+		list.Items = append(list.Items, model.NewCacheEntry(getServiceKey(z.Member.(string)), cache, int(size), now))
+	}
+	return list, nil
+}
+
+// Count counts the caches matching a filter by service. Services and tags are counted by their indexes,
+// while the rest of filters walk the indexes of their services
+func (r CacheRepoRedis) Count(ctx context.Context, filter model.CacheFilter) (count model.CacheCount, err error) {
+	ctx, span := startSpan(ctx, "redis.count")
+	defer func() { tracing.EndSpan(span, err) }()
 
-		if len(keys) > 0 {
-			wg.Add(1)
-			go func(keys []string) {
-				defer wg.Done()
+	services, err := r.getServices(ctx, filter)
+	if err != nil {
+		return model.CacheCount{}, err
+	}
+	now := time.Now()
+	counts := make(map[string]int)
+	if len(filter.Paths) == 0 && len(filter.Tags) <= 1 && filter.Prefix == "" && filter.Pattern == "" {
+		pipe := r.redis.Pipeline()
+		cmds := make([]*goRedis.IntCmd, len(services))
+		for i, service := range services {
+			cmds[i] = pipe.ZCount(ctx, r.getIndexKeys(service, filter)[0], liveScore(now), "+inf")
+		}
+		if len(cmds) > 0 {
+			if _, err := pipe.Exec(ctx); err != nil {
+				return model.CacheCount{}, err
+			}
+		}
+		for i, service := range services {
+			if n := int(cmds[i].Val()); n > 0 {
+				counts[service] = n
+			}
+		}
+		return newCacheCount(counts), nil
+	}
 
-				pipe := r.redis.Pipeline()
-				cmds := make([]*goRedis.StringSliceCmd, len(keys))
-				for i, key := range keys {
-					cmds[i] = pipe.SInter(ctx, key, tmpTagsToDeleteKey)
+	for _, service := range services {
+		if len(filter.Paths) > 0 && len(filter.Tags) == 0 {
+			caches, err := r.findService(ctx, service, filter, cacheCursor{}, -1, now)
+			if err != nil {
+				return model.CacheCount{}, err
+			}
+			counts[service] = len(caches)
+			continue
+		}
+		// caches with several of the tags are in several indexes
+		indexKeys := r.getIndexKeys(service, filter)
+		seen := make(map[string]bool)
+		for _, indexKey := range indexKeys {
+			err := r.walkIndex(ctx, indexKey, cacheCursor{}, now, func(z goRedis.Z) bool {
+				key := z.Member.(string)
+				if seen[key] || !matchesServiceFilter(filter, service, key) {
+					return true
 				}
-				if _, err := pipe.Exec(ctx); err != nil {
-					return
+				if len(indexKeys) > 1 {
+					seen[key] = true
 				}
+				counts[service]++
+				return true
+			})
+			if err != nil {
+				return model.CacheCount{}, err
+			}
+		}
+	}
+	for service, n := range counts {
+		if n == 0 {
+			delete(counts, service)
+		}
+	}
+	return newCacheCount(counts), nil
+}
 
-				for index, cmd := range cmds {
-					intersection := cmd.Val()
-					if len(intersection) > 0 {
-						_ = r.deleteCacheByCacheTagsKey(keys[index])
-					}
+// getServices returns the services whose caches may match a filter, sorted
+func (r CacheRepoRedis) getServices(ctx context.Context, filter model.CacheFilter) ([]string, error) {
+	var services []string
+	switch {
+	case filter.Service != "":
+		services = []string{filter.Service}
+	case len(filter.Paths) > 0:
+		for _, item := range filter.Paths {
+			if !containsString(services, item.Service) {
+				services = append(services, item.Service)
+			}
+		}
+	default:
+		var err error
+		if services, err = r.redis.SMembers(ctx, servicesKey).Result(); err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(services)
+	return services, nil
+}
+
+// getIndexKeys returns the indexes of a service holding the caches that may match a filter:
+// the ones of its tags or the one of its quota, which has all of them
+func (r CacheRepoRedis) getIndexKeys(service string, filter model.CacheFilter) []string {
+	if len(filter.Tags) == 0 {
+		return []string{getQuotaRedisKey(service)}
+	}
+	keys := make([]string, len(filter.Tags))
+	for i, tag := range filter.Tags {
+		keys[i] = getTagIndexRedisKey(service, tag)
+	}
+	return keys
+}
+
+// findService returns the caches of a service matching a filter after a cursor, up to a limit unless it is
+// negative, along with their expiration. Indexes are sorted by expiration and then by key, so the caches of
+// every index are read from the cursor and merged
+func (r CacheRepoRedis) findService(
+	ctx context.Context,
+	service string,
+	filter model.CacheFilter,
+	from cacheCursor,
+	limit int,
+	now time.Time,
+) ([]goRedis.Z, error) {
+	after := func(z goRedis.Z) bool {
+		score := int64(z.Score)
+		return score > from.ExpiresAt || (score == from.ExpiresAt && z.Member.(string) > from.Key)
+	}
+
+	var found []goRedis.Z
+	if len(filter.Paths) > 0 && len(filter.Tags) == 0 {
+		keys, err := r.getServicePathKeys(ctx, service, filter)
+		if err != nil || len(keys) == 0 {
+			return nil, err
+		}
+		pipe := r.redis.Pipeline()
+		scores := make([]*goRedis.FloatCmd, len(keys))
+		for i, key := range keys {
+			scores[i] = pipe.ZScore(ctx, getQuotaRedisKey(service), key)
+		}
+		if _, err := pipe.Exec(ctx); err != nil && err != goRedis.Nil {
+			return nil, err
+		}
+		for i, key := range keys {
+			z := goRedis.Z{Score: scores[i].Val(), Member: key}
+			if scores[i].Err() == nil && z.Score > float64(now.UnixMilli()) && after(z) {
+				found = append(found, z)
+			}
+		}
+	} else {
+		for _, indexKey := range r.getIndexKeys(service, filter) {
+			var caches []goRedis.Z
+			err := r.walkIndex(ctx, indexKey, from, now, func(z goRedis.Z) bool {
+				if after(z) && matchesServiceFilter(filter, service, z.Member.(string)) {
+					caches = append(caches, z)
 				}
-			}(keys)
+				return limit < 0 || len(caches) < limit
+			})
+			if err != nil {
+				return nil, err
+			}
+			found = append(found, caches...)
 		}
-		if cursor == 0 {
-			break
+	}
+
+	sort.Slice(found, func(i, j int) bool {
+		if found[i].Score != found[j].Score {
+			return found[i].Score < found[j].Score
 		}
+		return found[i].Member.(string) < found[j].Member.(string)
+	})
+	// caches with several of the tags are in several indexes
+	unique := found[:0]
+	for i, z := range found {
+		if i == 0 || z.Member != found[i-1].Member {
+			unique = append(unique, z)
+		}
+	}
+	if limit >= 0 && len(unique) > limit {
+		unique = unique[:limit]
 	}
-	wg.Wait()
+	return unique, nil
+}
 
-	return nil
+// getServicePathKeys returns the keys of the paths of a service along with their variants
+func (r CacheRepoRedis) getServicePathKeys(
+	ctx context.Context,
+	service string,
+	filter model.CacheFilter,
+) ([]string, error) {
+	var keys []string
+	for _, item := range filter.Paths {
+		if item.Service != service {
+			continue
+		}
+		pathKeys, err := r.getPathKeys(ctx, item)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, pathKeys...)
+	}
+	return keys, nil
+}
+
+// walkIndex reads the caches of an index that have not expired in batches, starting at the expiration
+// of a cursor, until there are no more or the function returns false
+func (r CacheRepoRedis) walkIndex(
+	ctx context.Context,
+	indexKey string,
+	from cacheCursor,
+	now time.Time,
+	fn func(z goRedis.Z) bool,
+) error {
+	min := liveScore(now)
+	if from.ExpiresAt > now.UnixMilli() {
+		min = strconv.FormatInt(from.ExpiresAt, 10)
+	}
+	for offset := int64(0); ; offset += findBatchSize {
+		batch, err := r.redis.ZRangeByScoreWithScores(ctx, indexKey, &goRedis.ZRangeBy{
+			Min:    min,
+			Max:    "+inf",
+			Offset: offset,
+			Count:  findBatchSize,
+		}).Result()
+		if err != nil {
+			return err
+		}
+		for _, z := range batch {
+			if !fn(z) {
+				return nil
+			}
+		}
+		if len(batch) < findBatchSize {
+			return nil
+		}
+	}
+}
+
+// matchesServiceFilter checks a key of the index of a service against a filter
+func matchesServiceFilter(filter model.CacheFilter, service string, key string) bool {
+	keyService, path, ok := parseCacheKey(key)
+	return ok && keyService == service && filter.MatchPath(service, path)
+}
+
+// liveScore is the minimum expiration, exclusive, of the caches that have not expired
+func liveScore(now time.Time) string {
+	return "(" + strconv.FormatInt(now.UnixMilli(), 10)
 }
 
-func (r CacheRepoRedis) deleteCaches(cacheKeys ...string) error {
+// findKeys returns the keys of the caches matching a filter. Tags are looked up in their index,
+// paths along with their variants and any other filter walks the quota index of its services
+func (r CacheRepoRedis) findKeys(ctx context.Context, filter model.CacheFilter) ([]string, error) {
+	var candidates []string
+	switch {
+	case len(filter.Tags) > 0:
+		services := []string{filter.Service}
+		if filter.Service == "" {
+			var err error
+			if services, err = r.redis.SMembers(ctx, servicesKey).Result(); err != nil {
+				return nil, err
+			}
+		}
+		now := strconv.FormatInt(time.Now().UnixMilli(), 10)
+		pipe := r.redis.Pipeline()
+		var cmds []*goRedis.StringSliceCmd
+		for _, service := range services {
+			for _, tag := range filter.Tags {
+				cmds = append(cmds, pipe.ZRangeByScore(ctx, getTagIndexRedisKey(service, tag), &goRedis.ZRangeBy{
+					Min: now,
+					Max: "+inf",
+				}))
+			}
+		}
+		if len(cmds) > 0 {
+			if _, err := pipe.Exec(ctx); err != nil {
+				return nil, err
+			}
+		}
+		for _, cmd := range cmds {
+			candidates = append(candidates, cmd.Val()...)
+		}
+	case len(filter.Paths) > 0:
+		for _, item := range filter.Paths {
+			keys, err := r.getPathKeys(ctx, item)
+			if err != nil {
+				return nil, err
+			}
+			candidates = append(candidates, keys...)
+		}
+	default:
+		services, err := r.getServices(ctx, filter)
+		if err != nil {
+			return nil, err
+		}
+		now := time.Now()
+		for _, service := range services {
+			err := r.walkIndex(ctx, getQuotaRedisKey(service), cacheCursor{}, now, func(z goRedis.Z) bool {
+				if key, ok := z.Member.(string); ok && matchesServiceFilter(filter, service, key) {
+					candidates = append(candidates, key)
+				}
+				return true
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	seen := make(map[string]bool, len(candidates))
 	var keys []string
-	for _, cacheKey := range cacheKeys {
-		cacheTagsKey := fmt.Sprintf("%s::tags", cacheKey)
-		keys = append(keys, cacheKey, cacheTagsKey)
+	for _, key := range candidates {
+		service, path, ok := parseCacheKey(key)
+		if ok && !seen[key] && filter.MatchPath(service, path) {
+			seen[key] = true
+			keys = append(keys, key)
+		}
 	}
-	if err := r.redis.Del(ctx, keys...).Err(); err != nil {
-		return redisCacheError(err)
+	return keys, nil
+}
+
+// Lock acquires a lock on a cache path that expires after a ttl
+func (r CacheRepoRedis) Lock(
+	ctx context.Context,
+	path string,
+	serviceKey string,
+	token string,
+	ttl time.Duration,
+) (acquired bool, err error) {
+	ctx, span := startSpan(ctx, "redis.lock")
+	defer func() { tracing.EndSpan(span, err) }()
+
+	return r.redis.SetNX(ctx, getCacheLockRedisKey(path, serviceKey), token, ttl).Result()
+}
+
+// Unlock releases a lock on a cache path
+func (r CacheRepoRedis) Unlock(ctx context.Context, path string, serviceKey string, token string) (err error) {
+	ctx, span := startSpan(ctx, "redis.unlock")
+	defer func() { tracing.EndSpan(span, err) }()
+
+	return unlockScript.Run(ctx, r.redis, []string{getCacheLockRedisKey(path, serviceKey)}, token).Err()
+}
+
+// deleteKeys deletes caches by their keys in batches, grouped by service so every batch belongs to one slot
+func (r CacheRepoRedis) deleteKeys(ctx context.Context, keys []string) (int64, error) {
+	services := make(map[string][]string)
+	for _, key := range keys {
+		service := getServiceKey(key)
+		services[service] = append(services[service], key)
 	}
-	return nil
+	names := make([]string, 0, len(services))
+	for service := range services {
+		names = append(names, service)
+	}
+	sort.Strings(names)
+
+	var deleted int64
+	for _, service := range names {
+		serviceKeys := services[service]
+		for start := 0; start < len(serviceKeys); start += deleteBatchSize {
+			end := start + deleteBatchSize
+			if end > len(serviceKeys) {
+				end = len(serviceKeys)
+			}
+			count, err := r.deleteCaches(ctx, deleteKeysScript, serviceKeys[start:end])
+			if err != nil {
+				return deleted, err
+			}
+			deleted += count
+		}
+	}
+	return deleted, nil
 }
 
-func (r CacheRepoRedis) deleteCacheByCacheTagsKey(cacheTagsKey string) error {
-	redisKey := strings.TrimSuffix(cacheTagsKey, "::tags")
-	return r.deleteCaches(redisKey)
+// deleteCaches runs a delete script and records a purge for every cache it deleted
+func (r CacheRepoRedis) deleteCaches(
+	ctx context.Context,
+	script *goRedis.Script,
+	keys []string,
+	args ...interface{},
+) (int64, error) {
+	if len(keys) == 0 {
+		return 0, nil
+	}
+	result, err := script.Run(ctx, r.redis, keys, args...).Result()
+	if err != nil {
+		return 0, redisCacheError(err)
+	}
+	deleted, _ := result.([]interface{})
+	for _, cacheKey := range deleted {
+		if key, ok := cacheKey.(string); ok {
+			metrics.CacheOperations.WithLabelValues(getServiceKey(key), metrics.CachePurge).Inc()
+		}
+	}
+	return int64(len(deleted)), nil
 }
 
+// getCacheRedisKey builds the key of a cache, the service is its hash tag
 func getCacheRedisKey(path, serviceKey string) string {
+	return fmt.Sprintf("cache::{%s}::%s", serviceKey, path)
+}
+
+// getLegacyCacheRedisKey builds the key of a cache stored by a previous version, without hash tag
+func getLegacyCacheRedisKey(path, serviceKey string) string {
 	return fmt.Sprintf("cache::%s::%s", serviceKey, path)
 }
 
+// getServiceKey extracts the service from a key built by getCacheRedisKey
+func getServiceKey(cacheKey string) string {
+	service, _, _ := parseCacheKey(cacheKey)
+	return service
+}
+
 func getCacheTagsRedisKey(path, serviceKey string) string {
 	return fmt.Sprintf("%s::tags", getCacheRedisKey(path, serviceKey))
 }
 
+func getTagIndexRedisKey(serviceKey, tag string) string {
+	return fmt.Sprintf("%s{%s}::%s", tagIndexPrefix, serviceKey, tag)
+}
+
+func getVariantsRedisKey(path, serviceKey string) string {
+	return fmt.Sprintf("%s{%s}::%s", variantsPrefix, serviceKey, path)
+}
+
+func getQuotaRedisKey(serviceKey string) string {
+	return fmt.Sprintf("%s{%s}", quotaPrefix, serviceKey)
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// getCacheLockRedisKey does not share the cache prefix so locks are not scanned along with caches
+func getCacheLockRedisKey(path, serviceKey string) string {
+	return fmt.Sprintf("lock::%s::%s", serviceKey, path)
+}
+
+func startSpan(ctx context.Context, name string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("db.system", "redis")),
+	)
+}
+
+// ignoreNotFound avoids flagging cache misses as failed spans
+func ignoreNotFound(err error) error {
+	if errors.Is(err, model.ErrCacheNotFound) {
+		return nil
+	}
+	return err
+}
+
+// ignoreRejected avoids flagging caches rejected by a limit as failed spans
+func ignoreRejected(err error) error {
+	if errors.Is(err, model.ErrCacheQuotaExceeded) || errors.Is(err, model.ErrCacheBudgetExceeded) {
+		return nil
+	}
+	return err
+}
+
 func redisCacheError(err error) error {
 	if err == nil {
 		return nil
@@ -173,6 +1114,10 @@ func redisCacheError(err error) error {
 	return err
 }
 
-func NewCacheRepoRedis(redis redis.Cmdable) CacheRepo {
-	return CacheRepoRedis{redis}
+func NewCacheRepoRedis(redis redis.Cmdable, options RedisOptions) CacheRepo {
+	return CacheRepoRedis{
+		redis:   redis,
+		options: options,
+		usage:   &redisUsage{},
+	}
 }
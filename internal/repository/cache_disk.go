@@ -0,0 +1,522 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gotway/gotway/internal/model"
+	"github.com/gotway/gotway/pkg/log"
+	"github.com/gotway/gotway/pkg/metrics"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	// entriesBucket holds the caches without their bodies, so they can be scanned cheaply
+	entriesBucket = []byte("entries")
+	bodiesBucket  = []byte("bodies")
+	// usageBucket holds the bytes and entries stored by every service
+	usageBucket = []byte("usage")
+)
+
+type DiskOptions struct {
+	Path          string
+	SweepInterval time.Duration
+	// MaxBytes is the budget of the whole cache, caches that do not fit are rejected
+	MaxBytes int64
+}
+
+type diskEntry struct {
+	Cache     model.Cache `json:"cache"`
+	ExpiresAt time.Time   `json:"expiresAt"`
+}
+
+// CacheRepoDisk stores caches in a bbolt database file, it is meant for
+// single replica deployments with responses too large to be kept in memory
+type CacheRepoDisk struct {
+	options DiskOptions
+	db      *bolt.DB
+	locks   *localLocks
+	now     func() time.Time
+	logger  log.Logger
+}
+
+// Start periodically deletes the expired caches and closes the database once the context is done
+func (r *CacheRepoDisk) Start(ctx context.Context) {
+	r.logger.Info("starting disk cache sweeper")
+	ticker := time.NewTicker(r.options.SweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			r.logger.Info("stopping disk cache sweeper")
+			if err := r.db.Close(); err != nil {
+				r.logger.Error("error closing disk cache ", err)
+			}
+			return
+		case <-ticker.C:
+			if err := r.sweep(); err != nil {
+				r.logger.Error("error deleting expired caches ", err)
+			}
+		}
+	}
+}
+
+// Create stores a cache replacing its previous version. The caches of the service closest to expire
+// are evicted until it fits in its quota, while the ones that do not fit in the budget are rejected
+func (r *CacheRepoDisk) Create(
+	ctx context.Context,
+	cache model.Cache,
+	serviceKey string,
+	quota model.CacheQuota,
+) error {
+	key := []byte(getCacheRedisKey(cache.Path, serviceKey))
+	body := cache.Body
+	cache.Body = nil
+	entry, err := json.Marshal(diskEntry{
+		Cache:     cache,
+		ExpiresAt: r.now().Add(cache.Expiration()),
+	})
+	if err != nil {
+		return err
+	}
+	size := diskEntrySize(key, entry, body)
+	if quota.MaxBytes > 0 && size > quota.MaxBytes {
+		return model.ErrCacheQuotaExceeded
+	}
+
+	var evicted []string
+	err = r.db.Update(func(tx *bolt.Tx) error {
+		if _, err := deleteDiskKeys(tx, [][]byte{key}); err != nil {
+			return err
+		}
+		var err error
+		if evicted, err = r.evict(tx, serviceKey, size, quota); err != nil {
+			return err
+		}
+		if err := r.checkBudget(tx, size); err != nil {
+			return err
+		}
+		if err := tx.Bucket(entriesBucket).Put(key, entry); err != nil {
+			return err
+		}
+		if err := tx.Bucket(bodiesBucket).Put(key, body); err != nil {
+			return err
+		}
+		return addDiskUsage(tx, serviceKey, size, 1)
+	})
+	if err != nil {
+		return err
+	}
+	recordEvictions(evicted)
+	return nil
+}
+
+func (r *CacheRepoDisk) Get(ctx context.Context, path string, serviceKey string) (model.Cache, error) {
+	key := []byte(getCacheRedisKey(path, serviceKey))
+	var entry diskEntry
+	err := r.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(entriesBucket).Get(key)
+		if data == nil {
+			return model.ErrCacheNotFound
+		}
+		if err := json.Unmarshal(data, &entry); err != nil {
+			return err
+		}
+		if !r.now().Before(entry.ExpiresAt) {
+			return model.ErrCacheNotFound
+		}
+		// values are only valid during the transaction
+		entry.Cache.Body = append([]byte{}, tx.Bucket(bodiesBucket).Get(key)...)
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, model.ErrCacheNotFound) {
+			metrics.CacheTierLookups.WithLabelValues(metrics.CacheTierDisk, metrics.CacheMiss).Inc()
+		}
+		return model.Cache{}, err
+	}
+	metrics.CacheTierLookups.WithLabelValues(metrics.CacheTierDisk, metrics.CacheHit).Inc()
+	return entry.Cache, nil
+}
+
+func (r *CacheRepoDisk) DeleteByPath(ctx context.Context, paths []model.CachePath) error {
+	var deleted []string
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		now := r.now()
+		var keys [][]byte
+		for _, item := range paths {
+			pathKeys, err := r.getPathKeys(tx, getCacheRedisKey(item.Path, item.Service), now)
+			if err != nil {
+				return err
+			}
+			if len(pathKeys) == 0 {
+				return &model.ErrCachePathNotFound{
+					CachePath: item,
+				}
+			}
+			keys = append(keys, pathKeys...)
+		}
+		var err error
+		deleted, err = deleteDiskKeys(tx, keys)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	recordPurges(deleted)
+	return nil
+}
+
+func (r *CacheRepoDisk) DeleteByTags(ctx context.Context, tags []string) (int64, error) {
+	var deleted []string
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		keys, err := r.findKeys(tx, func(key []byte, entry diskEntry) bool {
+			for _, tag := range entry.Cache.Tags {
+				for _, t := range tags {
+					if tag == t {
+						return true
+					}
+				}
+			}
+			return false
+		})
+		if err != nil {
+			return err
+		}
+		deleted, err = deleteDiskKeys(tx, keys)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	recordPurges(deleted)
+	return int64(len(deleted)), nil
+}
+
+func (r *CacheRepoDisk) DeleteByFilter(ctx context.Context, filter model.CacheFilter) (int64, error) {
+	var deleted []string
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		now := r.now()
+		keys, err := r.findKeys(tx, func(key []byte, entry diskEntry) bool {
+			return now.Before(entry.ExpiresAt) && matchesFilter(filter, string(key), entry.Cache.Tags)
+		})
+		if err != nil {
+			return err
+		}
+		deleted, err = deleteDiskKeys(tx, keys)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	recordPurges(deleted)
+	return int64(len(deleted)), nil
+}
+
+// Find walks the entries from the cursor, as bbolt keeps keys sorted, until the page is full
+func (r *CacheRepoDisk) Find(
+	ctx context.Context,
+	filter model.CacheFilter,
+	page model.CachePage,
+) (model.CacheList, error) {
+	from, err := decodeCursor(page)
+	if err != nil {
+		return model.CacheList{}, err
+	}
+	list := model.CacheList{Items: []model.CacheEntry{}}
+	err = r.db.View(func(tx *bolt.Tx) error {
+		now := r.now()
+		var last string
+		bodies := tx.Bucket(bodiesBucket)
+		cursor := tx.Bucket(entriesBucket).Cursor()
+		k, v := cursor.Seek([]byte(from.Key))
+		if from.Key != "" && string(k) == from.Key {
+			k, v = cursor.Next()
+		}
+		for ; k != nil; k, v = cursor.Next() {
+			var entry diskEntry
+			if err := json.Unmarshal(v, &entry); err != nil {
+				return err
+			}
+			if !now.Before(entry.ExpiresAt) || !matchesFilter(filter, string(k), entry.Cache.Tags) {
+				continue
+			}
+			if len(list.Items) == page.Limit {
+				list.Cursor = encodeCursor(cacheCursor{Key: last})
+				return nil
+			}
+			last = string(k)
+			size := len(bodies.Get(k))
+			list.Items = append(list.Items, model.NewCacheEntry(getServiceKey(string(k)), entry.Cache, size, now))
+		}
+		return nil
+	})
+	return list, err
+}
+
+func (r *CacheRepoDisk) Count(ctx context.Context, filter model.CacheFilter) (model.CacheCount, error) {
+	services := make(map[string]int)
+	err := r.db.View(func(tx *bolt.Tx) error {
+		now := r.now()
+		return tx.Bucket(entriesBucket).ForEach(func(k, v []byte) error {
+			var entry diskEntry
+			if err := json.Unmarshal(v, &entry); err != nil {
+				return err
+			}
+			if now.Before(entry.ExpiresAt) && matchesFilter(filter, string(k), entry.Cache.Tags) {
+				services[getServiceKey(string(k))]++
+			}
+			return nil
+		})
+	})
+	return newCacheCount(services), err
+}
+
+func (r *CacheRepoDisk) Lock(
+	ctx context.Context,
+	path string,
+	serviceKey string,
+	token string,
+	ttl time.Duration,
+) (bool, error) {
+	return r.locks.lock(getCacheRedisKey(path, serviceKey), token, ttl, r.now()), nil
+}
+
+func (r *CacheRepoDisk) Unlock(ctx context.Context, path string, serviceKey string, token string) error {
+	r.locks.unlock(getCacheRedisKey(path, serviceKey), token)
+	return nil
+}
+
+// getPathKeys returns the keys of a path and its variants that have not expired,
+// they are next to each other as bbolt keeps keys sorted
+func (r *CacheRepoDisk) getPathKeys(tx *bolt.Tx, pathKey string, now time.Time) ([][]byte, error) {
+	var keys [][]byte
+	prefix := []byte(pathKey)
+	cursor := tx.Bucket(entriesBucket).Cursor()
+	for k, v := cursor.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = cursor.Next() {
+		if !matchesPath(string(k), pathKey) {
+			continue
+		}
+		var entry diskEntry
+		if err := json.Unmarshal(v, &entry); err != nil {
+			return nil, err
+		}
+		if now.Before(entry.ExpiresAt) {
+			keys = append(keys, append([]byte{}, k...))
+		}
+	}
+	return keys, nil
+}
+
+// evict deletes the caches of a service closest to expire until another cache fits in its quota
+func (r *CacheRepoDisk) evict(tx *bolt.Tx, serviceKey string, size int64, quota model.CacheQuota) ([]string, error) {
+	if quota.IsEmpty() {
+		return nil, nil
+	}
+	var evicted []string
+	for {
+		usage := getDiskUsage(tx, serviceKey)
+		if usage.entries == 0 ||
+			((quota.MaxBytes <= 0 || usage.bytes+size <= quota.MaxBytes) &&
+				(quota.MaxEntries <= 0 || usage.entries < quota.MaxEntries)) {
+			return evicted, nil
+		}
+		victim, err := r.getFirstToExpire(tx, serviceKey)
+		if err != nil {
+			return nil, err
+		}
+		deleted, err := deleteDiskKeys(tx, [][]byte{victim})
+		if err != nil {
+			return nil, err
+		}
+		evicted = append(evicted, deleted...)
+	}
+}
+
+// getFirstToExpire returns the key of the cache of a service that expires first
+func (r *CacheRepoDisk) getFirstToExpire(tx *bolt.Tx, serviceKey string) ([]byte, error) {
+	var key []byte
+	var expiresAt time.Time
+	prefix := []byte(getCacheRedisKey("", serviceKey))
+	cursor := tx.Bucket(entriesBucket).Cursor()
+	for k, v := cursor.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = cursor.Next() {
+		var entry diskEntry
+		if err := json.Unmarshal(v, &entry); err != nil {
+			return nil, err
+		}
+		if key == nil || entry.ExpiresAt.Before(expiresAt) {
+			key = append([]byte{}, k...)
+			expiresAt = entry.ExpiresAt
+		}
+	}
+	if key == nil {
+		return nil, errors.New("disk cache usage is out of sync")
+	}
+	return key, nil
+}
+
+// checkBudget checks if there is room for another cache, deleting the expired ones if there is not
+func (r *CacheRepoDisk) checkBudget(tx *bolt.Tx, size int64) error {
+	if r.options.MaxBytes <= 0 || getTotalDiskUsage(tx)+size <= r.options.MaxBytes {
+		return nil
+	}
+	if err := r.deleteExpired(tx); err != nil {
+		return err
+	}
+	if getTotalDiskUsage(tx)+size > r.options.MaxBytes {
+		return model.ErrCacheBudgetExceeded
+	}
+	return nil
+}
+
+func (r *CacheRepoDisk) findKeys(tx *bolt.Tx, fn func(key []byte, entry diskEntry) bool) ([][]byte, error) {
+	var keys [][]byte
+	err := tx.Bucket(entriesBucket).ForEach(func(k, v []byte) error {
+		var entry diskEntry
+		if err := json.Unmarshal(v, &entry); err != nil {
+			return err
+		}
+		if fn(k, entry) {
+			keys = append(keys, append([]byte{}, k...))
+		}
+		return nil
+	})
+	return keys, err
+}
+
+func (r *CacheRepoDisk) sweep() error {
+	return r.db.Update(r.deleteExpired)
+}
+
+func (r *CacheRepoDisk) deleteExpired(tx *bolt.Tx) error {
+	now := r.now()
+	keys, err := r.findKeys(tx, func(key []byte, entry diskEntry) bool {
+		return !now.Before(entry.ExpiresAt)
+	})
+	if err != nil {
+		return err
+	}
+	_, err = deleteDiskKeys(tx, keys)
+	return err
+}
+
+// deleteDiskKeys deletes the caches that exist and releases their usage
+func deleteDiskKeys(tx *bolt.Tx, keys [][]byte) ([]string, error) {
+	entries, bodies := tx.Bucket(entriesBucket), tx.Bucket(bodiesBucket)
+	deleted := make([]string, 0, len(keys))
+	for _, key := range keys {
+		entry := entries.Get(key)
+		if entry == nil {
+			continue
+		}
+		size := diskEntrySize(key, entry, bodies.Get(key))
+		if err := entries.Delete(key); err != nil {
+			return nil, err
+		}
+		if err := bodies.Delete(key); err != nil {
+			return nil, err
+		}
+		if err := addDiskUsage(tx, getServiceKey(string(key)), -size, -1); err != nil {
+			return nil, err
+		}
+		deleted = append(deleted, string(key))
+	}
+	return deleted, nil
+}
+
+// diskUsage is what the caches of a service take, encoded as two big endian integers
+type diskUsage struct {
+	bytes   int64
+	entries int64
+}
+
+func getDiskUsage(tx *bolt.Tx, serviceKey string) diskUsage {
+	return decodeDiskUsage(tx.Bucket(usageBucket).Get([]byte(serviceKey)))
+}
+
+func getTotalDiskUsage(tx *bolt.Tx) int64 {
+	var total int64
+	_ = tx.Bucket(usageBucket).ForEach(func(k, v []byte) error {
+		total += decodeDiskUsage(v).bytes
+		return nil
+	})
+	return total
+}
+
+func addDiskUsage(tx *bolt.Tx, serviceKey string, bytes int64, entries int64) error {
+	usage := getDiskUsage(tx, serviceKey)
+	usage.bytes += bytes
+	usage.entries += entries
+	if usage.entries <= 0 {
+		return tx.Bucket(usageBucket).Delete([]byte(serviceKey))
+	}
+	value := make([]byte, 16)
+	binary.BigEndian.PutUint64(value, uint64(usage.bytes))
+	binary.BigEndian.PutUint64(value[8:], uint64(usage.entries))
+	return tx.Bucket(usageBucket).Put([]byte(serviceKey), value)
+}
+
+func decodeDiskUsage(value []byte) diskUsage {
+	if len(value) != 16 {
+		return diskUsage{}
+	}
+	return diskUsage{
+		bytes:   int64(binary.BigEndian.Uint64(value)),
+		entries: int64(binary.BigEndian.Uint64(value[8:])),
+	}
+}
+
+// rebuildDiskUsage accounts the caches stored before the usage was tracked
+func rebuildDiskUsage(tx *bolt.Tx) error {
+	bodies := tx.Bucket(bodiesBucket)
+	return tx.Bucket(entriesBucket).ForEach(func(k, v []byte) error {
+		return addDiskUsage(tx, getServiceKey(string(k)), diskEntrySize(k, v, bodies.Get(k)), 1)
+	})
+}
+
+func diskEntrySize(key []byte, entry []byte, body []byte) int64 {
+	return int64(len(key) + len(entry) + len(body))
+}
+
+func NewCacheRepoDisk(options DiskOptions, logger log.Logger) (*CacheRepoDisk, error) {
+	if err := os.MkdirAll(filepath.Dir(options.Path), 0o755); err != nil {
+		return nil, err
+	}
+	db, err := bolt.Open(options.Path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{entriesBucket, bodiesBucket} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		if tx.Bucket(usageBucket) != nil {
+			return nil
+		}
+		if _, err := tx.CreateBucket(usageBucket); err != nil {
+			return err
+		}
+		return rebuildDiskUsage(tx)
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &CacheRepoDisk{
+		options: options,
+		db:      db,
+		locks:   newLocalLocks(),
+		now:     time.Now,
+		logger:  logger,
+	}, nil
+}
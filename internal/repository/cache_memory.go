@@ -0,0 +1,133 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/gotway/gotway/internal/model"
+	"github.com/gotway/gotway/pkg/metrics"
+)
+
+// CacheRepoMemory keeps caches in the memory of the process,
+// it is meant for single replica deployments and development
+type CacheRepoMemory struct {
+	store *memoryStore
+	locks *localLocks
+	now   func() time.Time
+}
+
+func (r *CacheRepoMemory) Create(
+	ctx context.Context,
+	cache model.Cache,
+	serviceKey string,
+	quota model.CacheQuota,
+) error {
+	return r.store.set(getCacheRedisKey(cache.Path, serviceKey), cache, cache.Expiration(), r.now(), quota)
+}
+
+func (r *CacheRepoMemory) Get(ctx context.Context, path string, serviceKey string) (model.Cache, error) {
+	cache, ok := r.store.get(getCacheRedisKey(path, serviceKey), r.now())
+	if !ok {
+		metrics.CacheTierLookups.WithLabelValues(metrics.CacheTierMemory, metrics.CacheMiss).Inc()
+		return model.Cache{}, model.ErrCacheNotFound
+	}
+	metrics.CacheTierLookups.WithLabelValues(metrics.CacheTierMemory, metrics.CacheHit).Inc()
+	return cache, nil
+}
+
+func (r *CacheRepoMemory) DeleteByPath(ctx context.Context, paths []model.CachePath) error {
+	now := r.now()
+	for _, item := range paths {
+		if !r.store.hasPath(getCacheRedisKey(item.Path, item.Service), now) {
+			return &model.ErrCachePathNotFound{
+				CachePath: item,
+			}
+		}
+	}
+	for _, item := range paths {
+		recordPurges(r.store.deletePath(getCacheRedisKey(item.Path, item.Service)))
+	}
+	return nil
+}
+
+func (r *CacheRepoMemory) DeleteByTags(ctx context.Context, tags []string) (int64, error) {
+	deleted := r.store.deleteTags(tags)
+	recordPurges(deleted)
+	return int64(len(deleted)), nil
+}
+
+func (r *CacheRepoMemory) DeleteByFilter(ctx context.Context, filter model.CacheFilter) (int64, error) {
+	deleted := r.store.deleteFunc(func(entry *memoryEntry) bool {
+		return matchesFilter(filter, entry.key, entry.cache.Tags)
+	})
+	recordPurges(deleted)
+	return int64(len(deleted)), nil
+}
+
+func (r *CacheRepoMemory) Find(
+	ctx context.Context,
+	filter model.CacheFilter,
+	page model.CachePage,
+) (model.CacheList, error) {
+	from, err := decodeCursor(page)
+	if err != nil {
+		return model.CacheList{}, err
+	}
+	now := r.now()
+	keys, caches, cursor := r.store.findFunc(now, page.Limit, func(entry *memoryEntry) bool {
+		return entry.key > from.Key && matchesFilter(filter, entry.key, entry.cache.Tags)
+	})
+	list := model.CacheList{Items: make([]model.CacheEntry, len(keys)), Cursor: cursor}
+	for i, key := range keys {
+		list.Items[i] = model.NewCacheEntry(getServiceKey(key), caches[i], len(caches[i].Body), now)
+	}
+	return list, nil
+}
+
+func (r *CacheRepoMemory) Count(ctx context.Context, filter model.CacheFilter) (model.CacheCount, error) {
+	services := r.store.countFunc(r.now(), func(entry *memoryEntry) bool {
+		return matchesFilter(filter, entry.key, entry.cache.Tags)
+	})
+	return newCacheCount(services), nil
+}
+
+func (r *CacheRepoMemory) Lock(
+	ctx context.Context,
+	path string,
+	serviceKey string,
+	token string,
+	ttl time.Duration,
+) (bool, error) {
+	return r.locks.lock(getCacheRedisKey(path, serviceKey), token, ttl, r.now()), nil
+}
+
+func (r *CacheRepoMemory) Unlock(ctx context.Context, path string, serviceKey string, token string) error {
+	r.locks.unlock(getCacheRedisKey(path, serviceKey), token)
+	return nil
+}
+
+// recordEvictions counts the caches deleted to make room for others
+func recordEvictions(cacheKeys []string) {
+	for _, cacheKey := range cacheKeys {
+		metrics.CacheOperations.WithLabelValues(getServiceKey(cacheKey), metrics.CacheEvict).Inc()
+	}
+}
+
+// recordPurges counts the caches deleted on demand, by the API or an invalidation
+func recordPurges(cacheKeys []string) {
+	for _, cacheKey := range cacheKeys {
+		metrics.CacheOperations.WithLabelValues(getServiceKey(cacheKey), metrics.CachePurge).Inc()
+	}
+}
+
+func NewCacheRepoMemory(options MemoryOptions) CacheRepo {
+	return &CacheRepoMemory{
+		store: newMemoryStore(options.MaxBytes, options.Eviction, func(bytes int64) {
+			metrics.CacheMemoryBytes.Set(float64(bytes))
+		}, func(key string) {
+			recordEvictions([]string{key})
+		}),
+		locks: newLocalLocks(),
+		now:   time.Now,
+	}
+}
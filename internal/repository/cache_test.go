@@ -0,0 +1,120 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	goRedis "github.com/go-redis/redis/v8"
+	"github.com/gotway/gotway/internal/model"
+	"github.com/gotway/gotway/pkg/redis"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedisHashTags(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	client := goRedis.NewClient(&goRedis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	repo := NewCacheRepoRedis(redis.New(client), RedisOptions{MaxBytes: 1 << 20})
+
+	quota := model.CacheQuota{MaxEntries: 10}
+	assert.Nil(t, repo.Create(ctx, newConformanceCache("/products", "products"), "catalog", quota))
+	assert.Nil(t, repo.Create(ctx, newConformanceCache("/stock", "products"), "stock", quota))
+	locked, err := repo.Lock(ctx, "/stock", "stock", "token", time.Minute)
+	assert.Nil(t, err)
+	assert.True(t, locked)
+
+	// keys used together in transactions and scripts belong to the slot of their service
+	for _, key := range server.Keys() {
+		if key == servicesKey || strings.HasPrefix(key, "lock::") {
+			continue
+		}
+		assert.True(t, strings.Contains(key, "{catalog}") || strings.Contains(key, "{stock}"), key)
+	}
+
+	deleted, err := repo.DeleteByTags(ctx, []string{"products"})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), deleted)
+}
+
+func TestRedisBudgetAcrossServices(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	client := goRedis.NewClient(&goRedis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	repo := NewCacheRepoRedis(redis.New(client), RedisOptions{MaxBytes: 1 << 20})
+	assert.Nil(t, repo.Create(ctx, newConformanceCache("/products"), "catalog", model.CacheQuota{}))
+	used, err := server.Get(getQuotaRedisKey("catalog") + "::bytes")
+	assert.Nil(t, err)
+	size, _ := strconv.Atoi(used)
+
+	// the budget fits one of them, but not both
+	repo = NewCacheRepoRedis(redis.New(client), RedisOptions{MaxBytes: int64(size + size/2)})
+	err = repo.Create(ctx, newConformanceCache("/products"), "stock", model.CacheQuota{})
+	assert.True(t, errors.Is(err, model.ErrCacheBudgetExceeded))
+
+	// expired caches of other services are purged once their usage is read again,
+	// and services left without caches are forgotten
+	server.FastForward(time.Minute)
+	repo.(CacheRepoRedis).usage.refreshed = time.Time{}
+	assert.Nil(t, repo.Create(ctx, newConformanceCache("/products"), "stock", model.CacheQuota{}))
+	services, err := server.Members(servicesKey)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"stock"}, services)
+}
+
+func TestRedisUsageRefresh(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	client := goRedis.NewClient(&goRedis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	repo := NewCacheRepoRedis(redis.New(client), RedisOptions{MaxBytes: 1 << 20}).(CacheRepoRedis)
+
+	assert.Nil(t, repo.Create(ctx, newConformanceCache("/products"), "catalog", model.CacheQuota{}))
+	now := time.Now()
+	others, err := repo.getUsage(ctx, "stock", now)
+	assert.Nil(t, err)
+	assert.Zero(t, others, "read before catalog was cached")
+
+	others, err = repo.getUsage(ctx, "stock", now.Add(usageRefreshInterval))
+	assert.Nil(t, err)
+	assert.Positive(t, others)
+	others, err = repo.getUsage(ctx, "catalog", now.Add(usageRefreshInterval))
+	assert.Nil(t, err)
+	assert.Zero(t, others)
+
+	// a service cached while it was being forgotten is added back
+	assert.Nil(t, repo.removeServices(ctx, []string{"catalog"}))
+	services, err := server.Members(servicesKey)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"catalog"}, services)
+}
+
+func TestRedisVariantsIndex(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	client := goRedis.NewClient(&goRedis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	repo := NewCacheRepoRedis(redis.New(client), RedisOptions{})
+
+	variant := "/products" + model.CacheVariantSeparator + "abc"
+	for _, path := range []string{"/products", variant, "/products-featured" + model.CacheVariantSeparator + "abc"} {
+		assert.Nil(t, repo.Create(ctx, newConformanceCache(path), "catalog", model.CacheQuota{}))
+	}
+	variants, err := server.ZMembers(getVariantsRedisKey("/products", "catalog"))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{getCacheRedisKey(variant, "catalog")}, variants)
+
+	assert.Nil(t, repo.DeleteByPath(ctx, []model.CachePath{{Service: "catalog", Path: "/products"}}))
+	assert.False(t, server.Exists(getVariantsRedisKey("/products", "catalog")))
+	_, err = repo.Get(ctx, variant, "catalog")
+	assert.Equal(t, model.ErrCacheNotFound, err)
+	_, err = repo.Get(ctx, "/products-featured"+model.CacheVariantSeparator+"abc", "catalog")
+	assert.Nil(t, err)
+}
@@ -0,0 +1,190 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/gotway/gotway/internal/model"
+	"github.com/gotway/gotway/pkg/log"
+	"github.com/gotway/gotway/pkg/metrics"
+	"github.com/gotway/gotway/pkg/redis"
+)
+
+// invalidationChannel is where replicas announce deletions so the others evict them from memory
+const invalidationChannel = "gotway::cache::invalidations"
+
+type MemoryOptions struct {
+	MaxBytes int64
+	Eviction string
+}
+
+type invalidation struct {
+	Paths  []model.CachePath  `json:"paths,omitempty"`
+	Tags   []string           `json:"tags,omitempty"`
+	Filter *model.CacheFilter `json:"filter,omitempty"`
+}
+
+// CacheRepoTiered keeps the most used caches in memory in front of another repository.
+// Deletions are broadcasted to every replica using Redis pub/sub
+type CacheRepoTiered struct {
+	memory *memoryStore
+	remote CacheRepo
+	redis  redis.Cmdable
+	now    func() time.Time
+	logger log.Logger
+}
+
+// Start listens for the deletions made by every replica
+func (r *CacheRepoTiered) Start(ctx context.Context) {
+	r.logger.Info("starting cache invalidation listener")
+	pubSub := r.redis.Subscribe(ctx, invalidationChannel)
+	defer pubSub.Close()
+
+	messages := pubSub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			r.logger.Info("stopping cache invalidation listener")
+			return
+		case msg, ok := <-messages:
+			if !ok {
+				return
+			}
+			var inv invalidation
+			if err := json.Unmarshal([]byte(msg.Payload), &inv); err != nil {
+				r.logger.Error("error decoding cache invalidation ", err)
+				continue
+			}
+			r.invalidate(inv)
+		}
+	}
+}
+
+// Create stores a cache in the remote repository, which enforces the quotas, and then in memory
+func (r *CacheRepoTiered) Create(
+	ctx context.Context,
+	cache model.Cache,
+	serviceKey string,
+	quota model.CacheQuota,
+) error {
+	if err := r.remote.Create(ctx, cache, serviceKey, quota); err != nil {
+		return err
+	}
+	// the memory only holds the most used caches, not fitting in it is not an error
+	_ = r.memory.set(getCacheRedisKey(cache.Path, serviceKey), cache, cache.Expiration(), r.now(), model.CacheQuota{})
+	return nil
+}
+
+// Get gets a cache from memory if it is still fresh, otherwise from the remote repository
+func (r *CacheRepoTiered) Get(ctx context.Context, path string, serviceKey string) (model.Cache, error) {
+	key := getCacheRedisKey(path, serviceKey)
+	now := r.now()
+	if cache, ok := r.memory.get(key, now); ok && cache.IsFresh(now) {
+		metrics.CacheTierLookups.WithLabelValues(metrics.CacheTierMemory, metrics.CacheHit).Inc()
+		return cache, nil
+	}
+	metrics.CacheTierLookups.WithLabelValues(metrics.CacheTierMemory, metrics.CacheMiss).Inc()
+
+	cache, err := r.remote.Get(ctx, path, serviceKey)
+	if err != nil {
+		return model.Cache{}, err
+	}
+	if cache.IsFresh(now) {
+		_ = r.memory.set(key, cache, cache.Expiration()-cache.Age(now), now, model.CacheQuota{})
+	}
+	return cache, nil
+}
+
+func (r *CacheRepoTiered) DeleteByPath(ctx context.Context, paths []model.CachePath) error {
+	err := r.remote.DeleteByPath(ctx, paths)
+	r.broadcast(ctx, invalidation{Paths: paths})
+	return err
+}
+
+func (r *CacheRepoTiered) DeleteByTags(ctx context.Context, tags []string) (int64, error) {
+	deleted, err := r.remote.DeleteByTags(ctx, tags)
+	r.broadcast(ctx, invalidation{Tags: tags})
+	return deleted, err
+}
+
+func (r *CacheRepoTiered) DeleteByFilter(ctx context.Context, filter model.CacheFilter) (int64, error) {
+	deleted, err := r.remote.DeleteByFilter(ctx, filter)
+	r.broadcast(ctx, invalidation{Filter: &filter})
+	return deleted, err
+}
+
+// Find lists the caches of the remote repository, which has all of them
+func (r *CacheRepoTiered) Find(
+	ctx context.Context,
+	filter model.CacheFilter,
+	page model.CachePage,
+) (model.CacheList, error) {
+	return r.remote.Find(ctx, filter, page)
+}
+
+// Count counts the caches of the remote repository
+func (r *CacheRepoTiered) Count(ctx context.Context, filter model.CacheFilter) (model.CacheCount, error) {
+	return r.remote.Count(ctx, filter)
+}
+
+func (r *CacheRepoTiered) Lock(
+	ctx context.Context,
+	path string,
+	serviceKey string,
+	token string,
+	ttl time.Duration,
+) (bool, error) {
+	return r.remote.Lock(ctx, path, serviceKey, token, ttl)
+}
+
+func (r *CacheRepoTiered) Unlock(ctx context.Context, path string, serviceKey string, token string) error {
+	return r.remote.Unlock(ctx, path, serviceKey, token)
+}
+
+// broadcast evicts the deleted caches from memory and tells the rest of replicas to do the same,
+// caches are evicted locally first so a failure publishing does not affect this replica
+func (r *CacheRepoTiered) broadcast(ctx context.Context, inv invalidation) {
+	r.invalidate(inv)
+	payload, err := json.Marshal(inv)
+	if err != nil {
+		r.logger.Error("error encoding cache invalidation ", err)
+		return
+	}
+	if err := r.redis.Publish(ctx, invalidationChannel, payload).Err(); err != nil {
+		r.logger.Error("error publishing cache invalidation ", err)
+	}
+}
+
+func (r *CacheRepoTiered) invalidate(inv invalidation) {
+	for _, p := range inv.Paths {
+		r.memory.deletePath(getCacheRedisKey(p.Path, p.Service))
+	}
+	if len(inv.Tags) > 0 {
+		r.memory.deleteTags(inv.Tags)
+	}
+	if inv.Filter != nil {
+		r.memory.deleteFunc(func(entry *memoryEntry) bool {
+			return matchesFilter(*inv.Filter, entry.key, entry.cache.Tags)
+		})
+	}
+}
+
+func NewCacheRepoTiered(
+	options MemoryOptions,
+	remote CacheRepo,
+	redis redis.Cmdable,
+	logger log.Logger,
+) *CacheRepoTiered {
+	return &CacheRepoTiered{
+		memory: newMemoryStore(options.MaxBytes, options.Eviction, func(bytes int64) {
+			metrics.CacheMemoryBytes.Set(float64(bytes))
+		}, func(key string) {
+			metrics.CacheMemoryEvictions.WithLabelValues(getServiceKey(key)).Inc()
+		}),
+		remote: remote,
+		redis:  redis,
+		now:    time.Now,
+		logger: logger,
+	}
+}
@@ -0,0 +1,81 @@
+package repository_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gotway/gotway/internal/mocks"
+	"github.com/gotway/gotway/internal/model"
+	"github.com/gotway/gotway/internal/repository"
+	"github.com/gotway/gotway/pkg/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestTieredGet(t *testing.T) {
+	ctx := context.Background()
+	fresh := model.Cache{
+		Path:      "/products",
+		Body:      []byte("{}"),
+		TTL:       model.NewCacheTTL(30),
+		CreatedAt: time.Now(),
+	}
+	stale := fresh
+	stale.Path = "/stock"
+	stale.StaleIfError = model.NewCacheTTL(60)
+	stale.CreatedAt = time.Now().Add(-time.Minute)
+
+	remote := new(mocks.CacheRepo)
+	remote.On("Get", mock.Anything, "/products", "catalog").Return(fresh, nil).Once()
+	remote.On("Get", mock.Anything, "/stock", "catalog").Return(stale, nil).Twice()
+	remote.On("Get", mock.Anything, "/unknown", "catalog").Return(model.Cache{}, model.ErrCacheNotFound)
+
+	repo := repository.NewCacheRepoTiered(
+		repository.MemoryOptions{MaxBytes: 1024, Eviction: repository.EvictionLRU},
+		remote,
+		nil,
+		log.Log,
+	)
+
+	for i := 0; i < 2; i++ {
+		cache, err := repo.Get(ctx, "/products", "catalog")
+		assert.Nil(t, err)
+		assert.Equal(t, fresh.Body, cache.Body)
+
+		cache, err = repo.Get(ctx, "/stock", "catalog")
+		assert.Nil(t, err)
+		assert.Equal(t, stale.Body, cache.Body)
+
+		_, err = repo.Get(ctx, "/unknown", "catalog")
+		assert.ErrorIs(t, err, model.ErrCacheNotFound)
+	}
+
+	remote.AssertNumberOfCalls(t, "Get", 5)
+}
+
+func TestTieredCreate(t *testing.T) {
+	ctx := context.Background()
+	cache := model.Cache{
+		Path:      "/products",
+		Body:      []byte("{}"),
+		TTL:       model.NewCacheTTL(30),
+		CreatedAt: time.Now(),
+	}
+
+	remote := new(mocks.CacheRepo)
+	remote.On("Create", mock.Anything, cache, "catalog", model.CacheQuota{}).Return(nil)
+
+	repo := repository.NewCacheRepoTiered(
+		repository.MemoryOptions{MaxBytes: 1024, Eviction: repository.EvictionLFU},
+		remote,
+		nil,
+		log.Log,
+	)
+
+	assert.Nil(t, repo.Create(ctx, cache, "catalog", model.CacheQuota{}))
+	got, err := repo.Get(ctx, "/products", "catalog")
+	assert.Nil(t, err)
+	assert.Equal(t, cache.Body, got.Body)
+	remote.AssertNotCalled(t, "Get", mock.Anything, mock.Anything, mock.Anything)
+}
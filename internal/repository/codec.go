@@ -0,0 +1,233 @@
+package repository
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gotway/gotway/internal/model"
+)
+
+// Fields of the hash that stores a cache. The body is kept as raw bytes
+// and the rest of metadata is encoded with encodeMeta
+const (
+	fieldMeta     = "meta"
+	fieldBody     = "body"
+	fieldEncoding = "encoding"
+)
+
+const (
+	metaVersion  = 1
+	encodingGzip = "gzip"
+)
+
+var errInvalidMeta = errors.New("invalid cache metadata")
+
+// encodeCache returns the hash fields of a cache
+func encodeCache(cache model.Cache, options RedisOptions) (map[string]interface{}, error) {
+	body := cache.Body
+	encoding := ""
+	if options.Compression && len(body) >= options.CompressionMinSize &&
+		cache.Headers.Get("Content-Encoding") == "" {
+		compressed, err := compress(body)
+		if err != nil {
+			return nil, err
+		}
+		if len(compressed) < len(body) {
+			body = compressed
+			encoding = encodingGzip
+		}
+	}
+	return map[string]interface{}{
+		fieldMeta:     encodeMeta(cache),
+		fieldBody:     body,
+		fieldEncoding: encoding,
+	}, nil
+}
+
+// encodedSize is the number of bytes of the hash fields of a cache
+func encodedSize(fields map[string]interface{}) int64 {
+	var size int64
+	for name, value := range fields {
+		size += int64(len(name))
+		switch v := value.(type) {
+		case []byte:
+			size += int64(len(v))
+		case string:
+			size += int64(len(v))
+		}
+	}
+	return size
+}
+
+// decodeCache builds a cache from its hash fields
+func decodeCache(fields map[string]string) (model.Cache, error) {
+	cache, err := decodeMeta([]byte(fields[fieldMeta]))
+	if err != nil {
+		return model.Cache{}, err
+	}
+	body := []byte(fields[fieldBody])
+	switch fields[fieldEncoding] {
+	case "":
+		cache.Body = body
+	case encodingGzip:
+		if cache.Body, err = decompress(body); err != nil {
+			return model.Cache{}, err
+		}
+	default:
+		return model.Cache{}, errors.New("unknown cache encoding " + strconv.Quote(fields[fieldEncoding]))
+	}
+	return cache, nil
+}
+
+// encodeMeta writes every field of a cache but its body using varints and length prefixed strings
+func encodeMeta(cache model.Cache) []byte {
+	var buf bytes.Buffer
+	buf.WriteByte(metaVersion)
+	writeString(&buf, cache.Path)
+	writeUvarint(&buf, uint64(cache.StatusCode))
+	writeVarint(&buf, int64(cache.TTL))
+	writeVarint(&buf, int64(cache.StaleWhileRevalidate))
+	writeVarint(&buf, int64(cache.StaleIfError))
+	writeVarint(&buf, int64(cache.Revalidate))
+	createdAt := int64(0)
+	if !cache.CreatedAt.IsZero() {
+		createdAt = cache.CreatedAt.UnixNano()
+	}
+	writeVarint(&buf, createdAt)
+	writeStrings(&buf, cache.Tags)
+	writeUvarint(&buf, uint64(len(cache.Headers)))
+	for key, values := range cache.Headers {
+		writeString(&buf, key)
+		writeStrings(&buf, values)
+	}
+	return buf.Bytes()
+}
+
+func decodeMeta(data []byte) (model.Cache, error) {
+	r := bytes.NewReader(data)
+	version, err := r.ReadByte()
+	if err != nil || version != metaVersion {
+		return model.Cache{}, errInvalidMeta
+	}
+
+	var cache model.Cache
+	var ttl, staleWhileRevalidate, staleIfError, revalidate, createdAt int64
+	var status, numHeaders uint64
+	if cache.Path, err = readString(r); err != nil {
+		return model.Cache{}, err
+	}
+	if status, err = binary.ReadUvarint(r); err != nil {
+		return model.Cache{}, errInvalidMeta
+	}
+	for _, v := range []*int64{&ttl, &staleWhileRevalidate, &staleIfError, &revalidate, &createdAt} {
+		if *v, err = binary.ReadVarint(r); err != nil {
+			return model.Cache{}, errInvalidMeta
+		}
+	}
+	if cache.Tags, err = readStrings(r); err != nil {
+		return model.Cache{}, err
+	}
+	if numHeaders, err = binary.ReadUvarint(r); err != nil || numHeaders > uint64(r.Len()) {
+		return model.Cache{}, errInvalidMeta
+	}
+	if numHeaders > 0 {
+		cache.Headers = make(http.Header, numHeaders)
+	}
+	for i := uint64(0); i < numHeaders; i++ {
+		key, err := readString(r)
+		if err != nil {
+			return model.Cache{}, err
+		}
+		if cache.Headers[key], err = readStrings(r); err != nil {
+			return model.Cache{}, err
+		}
+	}
+
+	cache.StatusCode = int(status)
+	cache.TTL = model.CacheTTL(ttl)
+	cache.StaleWhileRevalidate = model.CacheTTL(staleWhileRevalidate)
+	cache.StaleIfError = model.CacheTTL(staleIfError)
+	cache.Revalidate = model.CacheTTL(revalidate)
+	if createdAt != 0 {
+		cache.CreatedAt = time.Unix(0, createdAt).UTC()
+	}
+	return cache, nil
+}
+
+func writeUvarint(buf *bytes.Buffer, v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	buf.Write(b[:binary.PutUvarint(b[:], v)])
+}
+
+func writeVarint(buf *bytes.Buffer, v int64) {
+	var b [binary.MaxVarintLen64]byte
+	buf.Write(b[:binary.PutVarint(b[:], v)])
+}
+
+func writeString(buf *bytes.Buffer, s string) {
+	writeUvarint(buf, uint64(len(s)))
+	buf.WriteString(s)
+}
+
+func writeStrings(buf *bytes.Buffer, values []string) {
+	writeUvarint(buf, uint64(len(values)))
+	for _, v := range values {
+		writeString(buf, v)
+	}
+}
+
+func readString(r *bytes.Reader) (string, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil || n > uint64(r.Len()) {
+		return "", errInvalidMeta
+	}
+	b := make([]byte, n)
+	if _, err := r.Read(b); err != nil && n > 0 {
+		return "", errInvalidMeta
+	}
+	return string(b), nil
+}
+
+func readStrings(r *bytes.Reader) ([]string, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil || n > uint64(r.Len()) {
+		return nil, errInvalidMeta
+	}
+	if n == 0 {
+		return nil, nil
+	}
+	values := make([]string, n)
+	for i := range values {
+		if values[i], err = readString(r); err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+func compress(body []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	if _, err := gw.Write(body); err != nil {
+		return nil, err
+	}
+	if err := gw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decompress(body []byte) ([]byte, error) {
+	gr, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer gr.Close()
+	return ioutil.ReadAll(gr)
+}
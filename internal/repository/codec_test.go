@@ -0,0 +1,150 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	goRedis "github.com/go-redis/redis/v8"
+	"github.com/gotway/gotway/internal/model"
+	"github.com/gotway/gotway/pkg/redis"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCodec(t *testing.T) {
+	cache := model.Cache{
+		Path:       "/products?limit=10" + model.CacheVariantSeparator + "abc",
+		StatusCode: http.StatusOK,
+		Headers: http.Header{
+			"Content-Type": []string{"application/json"},
+			"Vary":         []string{"Accept-Language", "X-Tenant-ID"},
+		},
+		Body:                 []byte(strings.Repeat(`{"name":"sneakers"}`, 100)),
+		TTL:                  model.NewCacheTTL(30),
+		StaleWhileRevalidate: model.NewCacheTTL(10),
+		StaleIfError:         model.NewCacheTTL(60),
+		Revalidate:           model.NewCacheTTL(600),
+		Tags:                 []string{"products", "catalog"},
+		CreatedAt:            time.Date(2022, time.January, 1, 10, 0, 0, 123, time.UTC),
+	}
+
+	tests := []struct {
+		name         string
+		options      RedisOptions
+		headers      http.Header
+		wantEncoding string
+	}{
+		{
+			name: "Uncompressed",
+		},
+		{
+			name:         "Compressed",
+			options:      RedisOptions{Compression: true, CompressionMinSize: 1024},
+			wantEncoding: encodingGzip,
+		},
+		{
+			name:    "Smaller than min size",
+			options: RedisOptions{Compression: true, CompressionMinSize: 1 << 20},
+		},
+		{
+			name:    "Already compressed by the service",
+			options: RedisOptions{Compression: true},
+			headers: http.Header{"Content-Encoding": []string{"br"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := cache
+			if tt.headers != nil {
+				c.Headers = tt.headers
+			}
+
+			fields, err := encodeCache(c, tt.options)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.wantEncoding, fields[fieldEncoding])
+
+			stored := make(map[string]string, len(fields))
+			for key, value := range fields {
+				switch v := value.(type) {
+				case []byte:
+					stored[key] = string(v)
+				case string:
+					stored[key] = v
+				}
+			}
+			decoded, err := decodeCache(stored)
+			assert.Nil(t, err)
+			assert.Equal(t, c, decoded)
+		})
+	}
+}
+
+func TestDecodeInvalidMeta(t *testing.T) {
+	meta := encodeMeta(model.Cache{Path: "/products", Tags: []string{"products"}})
+
+	for _, data := range [][]byte{nil, {0}, meta[:len(meta)-3]} {
+		_, err := decodeMeta(data)
+		assert.Equal(t, errInvalidMeta, err)
+	}
+}
+
+func TestMetaIsSmallerThanJSON(t *testing.T) {
+	cache := model.Cache{
+		Path:       "/products",
+		StatusCode: http.StatusOK,
+		Headers:    http.Header{"Content-Type": []string{"application/json"}},
+		Body:       bytes.Repeat([]byte{0xff}, 1024),
+		TTL:        model.NewCacheTTL(30),
+		Tags:       []string{"products"},
+		CreatedAt:  time.Now(),
+	}
+	legacy, err := json.Marshal(cache)
+	assert.Nil(t, err)
+
+	assert.Less(t, len(encodeMeta(cache))+len(cache.Body), len(legacy))
+}
+
+func TestGetLegacyCache(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	client := goRedis.NewClient(&goRedis.Options{Addr: server.Addr()})
+	defer client.Close()
+	repo := NewCacheRepoRedis(redis.New(client), RedisOptions{})
+
+	cache := model.Cache{
+		Path:       "/products",
+		StatusCode: http.StatusOK,
+		Headers:    http.Header{"Content-Type": []string{"application/json"}},
+		Body:       []byte(`{"name":"sneakers"}`),
+		TTL:        model.NewCacheTTL(30),
+		Tags:       []string{"products"},
+	}
+	legacy, err := json.Marshal(cache)
+	assert.Nil(t, err)
+	// previous versions stored JSON strings under keys without hash tags
+	assert.Nil(t, client.Set(ctx, "cache::catalog::/products", legacy, time.Minute).Err())
+
+	got, err := repo.Get(ctx, "/products", "catalog")
+	assert.Nil(t, err)
+	assert.Equal(t, cache.Body, got.Body)
+	assert.Equal(t, cache.Headers, got.Headers)
+	assert.Equal(t, cache.TTL, got.TTL)
+
+	assert.Nil(t, repo.Create(ctx, cache, "catalog", model.CacheQuota{}))
+	got, err = repo.Get(ctx, "/products", "catalog")
+	assert.Nil(t, err)
+	assert.Equal(t, cache.Body, got.Body)
+	assert.Equal(t, "hash", server.Type(getCacheRedisKey("/products", "catalog")))
+	assert.False(t, server.Exists("cache::catalog::/products"), "replaced by the new cache")
+
+	assert.Nil(t, client.Set(ctx, "cache::catalog::/stock", legacy, time.Minute).Err())
+	assert.Nil(t, repo.DeleteByPath(ctx, []model.CachePath{{Service: "catalog", Path: "/stock"}}))
+	_, err = repo.Get(ctx, "/stock", "catalog")
+	assert.Equal(t, model.ErrCacheNotFound, err)
+}
@@ -0,0 +1,461 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	goRedis "github.com/go-redis/redis/v8"
+	"github.com/gotway/gotway/internal/model"
+	"github.com/gotway/gotway/pkg/log"
+	"github.com/gotway/gotway/pkg/redis"
+	"github.com/stretchr/testify/assert"
+)
+
+// backend is a repository under test along with a way of moving its clock forward
+type backend struct {
+	repo    CacheRepo
+	advance func(d time.Duration)
+}
+
+type clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func newRedisBackend(t *testing.T, options RedisOptions) (backend, redis.Cmdable) {
+	server := miniredis.RunT(t)
+	client := goRedis.NewClient(&goRedis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	redisClient := redis.New(client)
+	return backend{
+		repo:    NewCacheRepoRedis(redisClient, options),
+		advance: server.FastForward,
+	}, redisClient
+}
+
+var backends = map[string]func(t *testing.T) backend{
+	"redis": func(t *testing.T) backend {
+		b, _ := newRedisBackend(t, RedisOptions{})
+		return b
+	},
+	"redis-cluster": func(t *testing.T) backend {
+		// a single node owns every slot, but the client still requires transactions to use one slot
+		server := miniredis.RunT(t)
+		client := goRedis.NewClusterClient(&goRedis.ClusterOptions{Addrs: []string{server.Addr()}})
+		t.Cleanup(func() { client.Close() })
+		return backend{
+			repo:    NewCacheRepoRedis(redis.New(client), RedisOptions{}),
+			advance: server.FastForward,
+		}
+	},
+	"redis-compressed": func(t *testing.T) backend {
+		b, _ := newRedisBackend(t, RedisOptions{Compression: true})
+		return b
+	},
+	"tiered": func(t *testing.T) backend {
+		b, redisClient := newRedisBackend(t, RedisOptions{})
+		c := &clock{now: time.Now()}
+		repo := NewCacheRepoTiered(MemoryOptions{MaxBytes: 1 << 20, Eviction: EvictionLRU}, b.repo, redisClient, log.Log)
+		repo.now = c.Now
+		return backend{
+			repo: repo,
+			advance: func(d time.Duration) {
+				c.Advance(d)
+				b.advance(d)
+			},
+		}
+	},
+	"memory": func(t *testing.T) backend {
+		c := &clock{now: time.Now()}
+		repo := NewCacheRepoMemory(MemoryOptions{MaxBytes: 1 << 20, Eviction: EvictionLRU}).(*CacheRepoMemory)
+		repo.now = c.Now
+		return backend{repo: repo, advance: c.Advance}
+	},
+	"disk": func(t *testing.T) backend {
+		c := &clock{now: time.Now()}
+		repo, err := NewCacheRepoDisk(
+			DiskOptions{Path: filepath.Join(t.TempDir(), "cache", "gotway.db"), SweepInterval: time.Minute},
+			log.Log,
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { repo.db.Close() })
+		repo.now = c.Now
+		return backend{
+			repo: repo,
+			advance: func(d time.Duration) {
+				c.Advance(d)
+				assert.Nil(t, repo.sweep())
+			},
+		}
+	},
+}
+
+func newConformanceCache(path string, tags ...string) model.Cache {
+	return model.Cache{
+		Path:       path,
+		StatusCode: http.StatusOK,
+		Headers:    http.Header{"Content-Type": []string{"application/json"}},
+		Body:       []byte(`{"name":"sneakers"}`),
+		TTL:        model.NewCacheTTL(30),
+		Tags:       tags,
+		CreatedAt:  time.Now().UTC().Truncate(time.Second),
+	}
+}
+
+// TestConformance runs the same suite against every cache backend
+func TestConformance(t *testing.T) {
+	names := make([]string, 0, len(backends))
+	for name := range backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		newBackend := backends[name]
+		t.Run(name, func(t *testing.T) {
+			t.Run("Create and get", func(t *testing.T) {
+				testCreateAndGet(t, newBackend(t))
+			})
+			t.Run("Expiration", func(t *testing.T) {
+				testExpiration(t, newBackend(t))
+			})
+			t.Run("Delete by path", func(t *testing.T) {
+				testDeleteByPath(t, newBackend(t))
+			})
+			t.Run("Delete by tags", func(t *testing.T) {
+				testDeleteByTags(t, newBackend(t))
+			})
+			t.Run("Delete by filter", func(t *testing.T) {
+				testDeleteByFilter(t, newBackend(t))
+			})
+			t.Run("Find", func(t *testing.T) {
+				testFind(t, newBackend(t))
+			})
+			t.Run("Lock", func(t *testing.T) {
+				testLock(t, newBackend(t))
+			})
+			t.Run("Quota", func(t *testing.T) {
+				testQuota(t, newBackend(t))
+			})
+		})
+	}
+}
+
+func testCreateAndGet(t *testing.T, b backend) {
+	ctx := context.Background()
+	cache := newConformanceCache("/products", "products")
+
+	assert.Nil(t, b.repo.Create(ctx, cache, "catalog", model.CacheQuota{}))
+
+	got, err := b.repo.Get(ctx, "/products", "catalog")
+	assert.Nil(t, err)
+	assert.Equal(t, cache.Path, got.Path)
+	assert.Equal(t, cache.StatusCode, got.StatusCode)
+	assert.Equal(t, cache.Headers, got.Headers)
+	assert.Equal(t, cache.Body, got.Body)
+	assert.Equal(t, cache.TTL, got.TTL)
+	assert.Equal(t, cache.Tags, got.Tags)
+	assert.True(t, cache.CreatedAt.Equal(got.CreatedAt))
+
+	_, err = b.repo.Get(ctx, "/products", "stock")
+	assert.True(t, errors.Is(err, model.ErrCacheNotFound))
+	_, err = b.repo.Get(ctx, "/unknown", "catalog")
+	assert.True(t, errors.Is(err, model.ErrCacheNotFound))
+}
+
+func testExpiration(t *testing.T, b backend) {
+	ctx := context.Background()
+	cache := newConformanceCache("/products")
+	cache.StaleIfError = model.NewCacheTTL(30)
+
+	assert.Nil(t, b.repo.Create(ctx, cache, "catalog", model.CacheQuota{}))
+
+	b.advance(45 * time.Second)
+	_, err := b.repo.Get(ctx, "/products", "catalog")
+	assert.Nil(t, err, "kept while it may be served stale")
+
+	b.advance(30 * time.Second)
+	_, err = b.repo.Get(ctx, "/products", "catalog")
+	assert.True(t, errors.Is(err, model.ErrCacheNotFound))
+}
+
+func testDeleteByPath(t *testing.T, b backend) {
+	ctx := context.Background()
+	for _, path := range []string{
+		"/products",
+		"/products" + model.CacheVariantSeparator + "abc",
+		"/products/1",
+	} {
+		assert.Nil(t, b.repo.Create(ctx, newConformanceCache(path), "catalog", model.CacheQuota{}))
+	}
+
+	err := b.repo.DeleteByPath(ctx, []model.CachePath{{Service: "catalog", Path: "/products"}})
+	assert.Nil(t, err)
+
+	for path, wantErr := range map[string]error{
+		"/products": model.ErrCacheNotFound,
+		"/products" + model.CacheVariantSeparator + "abc": model.ErrCacheNotFound,
+		"/products/1": nil,
+	} {
+		_, err := b.repo.Get(ctx, path, "catalog")
+		assert.True(t, errors.Is(err, wantErr), path)
+	}
+
+	err = b.repo.DeleteByPath(ctx, []model.CachePath{{Service: "catalog", Path: "/products"}})
+	var notFound *model.ErrCachePathNotFound
+	assert.True(t, errors.As(err, &notFound))
+}
+
+func testDeleteByTags(t *testing.T, b backend) {
+	ctx := context.Background()
+	assert.Nil(t, b.repo.Create(ctx, newConformanceCache("/products", "products", "catalog"), "catalog", model.CacheQuota{}))
+	assert.Nil(t, b.repo.Create(ctx, newConformanceCache("/products/1", "product", "catalog"), "catalog", model.CacheQuota{}))
+	assert.Nil(t, b.repo.Create(ctx, newConformanceCache("/stock", "stock"), "stock", model.CacheQuota{}))
+	// retagged caches are no longer purged by their previous tags
+	assert.Nil(t, b.repo.Create(ctx, newConformanceCache("/stock/1", "products"), "stock", model.CacheQuota{}))
+	assert.Nil(t, b.repo.Create(ctx, newConformanceCache("/stock/1", "item"), "stock", model.CacheQuota{}))
+
+	deleted, err := b.repo.DeleteByTags(ctx, []string{"products", "stock"})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), deleted)
+
+	_, err = b.repo.Get(ctx, "/products", "catalog")
+	assert.True(t, errors.Is(err, model.ErrCacheNotFound))
+	_, err = b.repo.Get(ctx, "/stock", "stock")
+	assert.True(t, errors.Is(err, model.ErrCacheNotFound))
+	_, err = b.repo.Get(ctx, "/products/1", "catalog")
+	assert.Nil(t, err)
+	_, err = b.repo.Get(ctx, "/stock/1", "stock")
+	assert.Nil(t, err)
+
+	deleted, err = b.repo.DeleteByTags(ctx, []string{"unknown"})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), deleted)
+}
+
+func createFilterCaches(t *testing.T, b backend) {
+	ctx := context.Background()
+	assert.Nil(t, b.repo.Create(ctx, newConformanceCache("/products", "products"), "catalog", model.CacheQuota{}))
+	assert.Nil(t, b.repo.Create(ctx, newConformanceCache("/products/1", "product"), "catalog", model.CacheQuota{}))
+	assert.Nil(t, b.repo.Create(ctx, newConformanceCache("/products/1/reviews", "product"), "catalog", model.CacheQuota{}))
+	assert.Nil(t, b.repo.Create(ctx, newConformanceCache("/stock", "stock"), "stock", model.CacheQuota{}))
+}
+
+func testDeleteByFilter(t *testing.T, b backend) {
+	ctx := context.Background()
+	createFilterCaches(t, b)
+
+	deleted, err := b.repo.DeleteByFilter(ctx, model.CacheFilter{Service: "stock", Tags: []string{"product"}})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), deleted)
+
+	deleted, err = b.repo.DeleteByFilter(ctx, model.CacheFilter{Service: "catalog", Pattern: "/products/*"})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), deleted)
+	_, err = b.repo.Get(ctx, "/products/1", "catalog")
+	assert.True(t, errors.Is(err, model.ErrCacheNotFound))
+
+	deleted, err = b.repo.DeleteByFilter(ctx, model.CacheFilter{Prefix: "/products"})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), deleted)
+	_, err = b.repo.Get(ctx, "/stock", "stock")
+	assert.Nil(t, err)
+
+	// deleted caches are no longer indexed by their tags
+	deleted, err = b.repo.DeleteByTags(ctx, []string{"products", "product"})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), deleted)
+}
+
+func testFind(t *testing.T, b backend) {
+	ctx := context.Background()
+	createFilterCaches(t, b)
+
+	list, err := b.repo.Find(ctx, model.CacheFilter{}, model.CachePage{Limit: 1})
+	assert.Nil(t, err)
+	if assert.Len(t, list.Items, 1) {
+		assert.Equal(t, "/products", list.Items[0].Path)
+	}
+	assert.NotEmpty(t, list.Cursor)
+
+	list, err = b.repo.Find(ctx, model.CacheFilter{}, model.CachePage{Cursor: list.Cursor, Limit: 2})
+	assert.Nil(t, err)
+	if assert.Len(t, list.Items, 2) {
+		entry := list.Items[0]
+		assert.Equal(t, "catalog", entry.Service)
+		assert.Equal(t, "/products/1", entry.Path)
+		assert.Equal(t, http.StatusOK, entry.StatusCode)
+		assert.Equal(t, []string{"product"}, entry.Tags)
+		assert.Equal(t, len(`{"name":"sneakers"}`), entry.Size)
+		assert.Equal(t, model.NewCacheTTL(30), entry.TTL)
+		assert.True(t, entry.TTLRemaining > 0)
+		assert.Equal(t, "/products/1/reviews", list.Items[1].Path)
+	}
+	assert.NotEmpty(t, list.Cursor)
+
+	list, err = b.repo.Find(ctx, model.CacheFilter{}, model.CachePage{Cursor: list.Cursor, Limit: 2})
+	assert.Nil(t, err)
+	if assert.Len(t, list.Items, 1) {
+		assert.Equal(t, "stock", list.Items[0].Service)
+	}
+	assert.Empty(t, list.Cursor, "last page")
+
+	_, err = b.repo.Find(ctx, model.CacheFilter{}, model.CachePage{Cursor: "products", Limit: 2})
+	assert.True(t, errors.Is(err, model.ErrInvalidCacheCursor))
+
+	for name, tt := range map[string]struct {
+		filter model.CacheFilter
+		want   []string
+	}{
+		"service":  {model.CacheFilter{Service: "stock"}, []string{"/stock"}},
+		"prefix":   {model.CacheFilter{Prefix: "/products/"}, []string{"/products/1", "/products/1/reviews"}},
+		"pattern":  {model.CacheFilter{Pattern: "/*"}, []string{"/products", "/stock"}},
+		"tags":     {model.CacheFilter{Tags: []string{"products", "stock"}}, []string{"/products", "/stock"}},
+		"combined": {model.CacheFilter{Service: "catalog", Tags: []string{"product"}, Pattern: "/products/*/reviews"}, []string{"/products/1/reviews"}},
+		"paths":    {model.CacheFilter{Paths: []model.CachePath{{Service: "catalog", Path: "/products"}}}, []string{"/products"}},
+	} {
+		list, err := b.repo.Find(ctx, tt.filter, model.CachePage{Limit: 10})
+		assert.Nil(t, err, name)
+		var paths []string
+		for _, entry := range list.Items {
+			paths = append(paths, entry.Path)
+		}
+		assert.Equal(t, tt.want, paths, name)
+		assert.Empty(t, list.Cursor, name)
+
+		count, err := b.repo.Count(ctx, tt.filter)
+		assert.Nil(t, err, name)
+		assert.Equal(t, len(tt.want), count.TotalCount, name)
+	}
+
+	count, err := b.repo.Count(ctx, model.CacheFilter{})
+	assert.Nil(t, err)
+	assert.Equal(t, model.CacheCount{TotalCount: 4, Services: map[string]int{"catalog": 3, "stock": 1}}, count)
+
+	count, err = b.repo.Count(ctx, model.CacheFilter{Tags: []string{"product", "products"}})
+	assert.Nil(t, err)
+	assert.Equal(t, model.CacheCount{TotalCount: 3, Services: map[string]int{"catalog": 3}}, count)
+
+	b.advance(time.Minute)
+	count, err = b.repo.Count(ctx, model.CacheFilter{})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, count.TotalCount, "expired caches are not counted")
+}
+
+func testLock(t *testing.T, b backend) {
+	ctx := context.Background()
+
+	acquired, err := b.repo.Lock(ctx, "/products", "catalog", "a", time.Second)
+	assert.Nil(t, err)
+	assert.True(t, acquired)
+
+	acquired, err = b.repo.Lock(ctx, "/products", "catalog", "b", time.Second)
+	assert.Nil(t, err)
+	assert.False(t, acquired)
+
+	assert.Nil(t, b.repo.Unlock(ctx, "/products", "catalog", "b"))
+	acquired, err = b.repo.Lock(ctx, "/products", "catalog", "b", time.Second)
+	assert.Nil(t, err)
+	assert.False(t, acquired, "only the holder releases a lock")
+
+	assert.Nil(t, b.repo.Unlock(ctx, "/products", "catalog", "a"))
+	acquired, err = b.repo.Lock(ctx, "/products", "catalog", "b", time.Second)
+	assert.Nil(t, err)
+	assert.True(t, acquired)
+
+	b.advance(2 * time.Second)
+	acquired, err = b.repo.Lock(ctx, "/products", "catalog", "c", time.Second)
+	assert.Nil(t, err)
+	assert.True(t, acquired, "locks expire")
+}
+
+func testQuota(t *testing.T, b backend) {
+	ctx := context.Background()
+	quota := model.CacheQuota{MaxEntries: 2}
+
+	shortLived := newConformanceCache("/products/1")
+	shortLived.TTL = model.NewCacheTTL(10)
+	assert.Nil(t, b.repo.Create(ctx, shortLived, "catalog", quota))
+	assert.Nil(t, b.repo.Create(ctx, newConformanceCache("/products/2"), "catalog", quota))
+	assert.Nil(t, b.repo.Create(ctx, newConformanceCache("/stock/1"), "stock", quota))
+	assert.Nil(t, b.repo.Create(ctx, newConformanceCache("/products/3"), "catalog", quota))
+
+	// the first cache to go is evicted, the tiered memory may keep serving it until it expires
+	assertPaths := func(want []string, msg string) {
+		list, err := b.repo.Find(ctx, model.CacheFilter{Service: "catalog"}, model.CachePage{Limit: 10})
+		assert.Nil(t, err)
+		var paths []string
+		for _, entry := range list.Items {
+			paths = append(paths, entry.Path)
+		}
+		assert.Equal(t, want, paths, msg)
+	}
+	assertPaths([]string{"/products/2", "/products/3"}, "evicted")
+	_, err := b.repo.Get(ctx, "/stock/1", "stock")
+	assert.Nil(t, err, "other services are not evicted")
+
+	assert.Nil(t, b.repo.Create(ctx, newConformanceCache("/products/3"), "catalog", quota))
+	assertPaths([]string{"/products/2", "/products/3"}, "replacing a cache does not take more room")
+
+	assert.Nil(t, b.repo.DeleteByPath(ctx, []model.CachePath{{Service: "catalog", Path: "/products/2"}}))
+	assert.Nil(t, b.repo.Create(ctx, newConformanceCache("/products/4"), "catalog", quota))
+	assertPaths([]string{"/products/3", "/products/4"}, "deleted caches release their room")
+
+	err = b.repo.Create(ctx, newConformanceCache("/products/5"), "catalog", model.CacheQuota{MaxBytes: 1})
+	assert.True(t, errors.Is(err, model.ErrCacheQuotaExceeded))
+	assertPaths([]string{"/products/3", "/products/4"}, "rejected")
+}
+
+func TestBudget(t *testing.T) {
+	ctx := context.Background()
+	for name, newRepo := range map[string]func(maxBytes int64) CacheRepo{
+		"redis": func(maxBytes int64) CacheRepo {
+			b, _ := newRedisBackend(t, RedisOptions{MaxBytes: maxBytes})
+			return b.repo
+		},
+		"memory": func(maxBytes int64) CacheRepo {
+			return NewCacheRepoMemory(MemoryOptions{MaxBytes: maxBytes, Eviction: EvictionLRU})
+		},
+		"disk": func(maxBytes int64) CacheRepo {
+			repo, err := NewCacheRepoDisk(
+				DiskOptions{Path: filepath.Join(t.TempDir(), "gotway.db"), SweepInterval: time.Minute, MaxBytes: maxBytes},
+				log.Log,
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { repo.db.Close() })
+			return repo
+		},
+	} {
+		repo := newRepo(1)
+		err := repo.Create(ctx, newConformanceCache("/products"), "catalog", model.CacheQuota{})
+		assert.True(t, errors.Is(err, model.ErrCacheBudgetExceeded), name)
+		_, err = repo.Get(ctx, "/products", "catalog")
+		assert.True(t, errors.Is(err, model.ErrCacheNotFound), name)
+
+		repo = newRepo(1 << 20)
+		assert.Nil(t, repo.Create(ctx, newConformanceCache("/products"), "catalog", model.CacheQuota{}), name)
+	}
+}
@@ -0,0 +1,102 @@
+package repository
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/gotway/gotway/internal/model"
+)
+
+// cacheCursor is the position of the last cache of a page. Caches are listed by key, except in Redis
+// where they are listed by service and then by expiration, so it keeps the expiration of the cache too
+type cacheCursor struct {
+	Key       string `json:"k"`
+	ExpiresAt int64  `json:"e,omitempty"`
+}
+
+func encodeCursor(cursor cacheCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor decodes the cursor of a page, an empty one starts from the beginning.
+// Pages hold at least one cache
+func decodeCursor(page model.CachePage) (cacheCursor, error) {
+	var cursor cacheCursor
+	if page.Limit < 1 {
+		return cursor, model.ErrInvalidCachePage
+	}
+	if page.Cursor == "" {
+		return cursor, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(page.Cursor)
+	if err != nil {
+		return cursor, model.ErrInvalidCacheCursor
+	}
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.Key == "" {
+		return cursor, model.ErrInvalidCacheCursor
+	}
+	return cursor, nil
+}
+
+// pageKeys keeps the lowest keys added, one more than the limit so it is known whether there is a next page.
+// Keys are inserted in order as they come, rather than sorting all of them
+type pageKeys struct {
+	limit int
+	keys  []string
+}
+
+func newPageKeys(limit int) *pageKeys {
+	return &pageKeys{limit: limit + 1}
+}
+
+func (p *pageKeys) add(key string) {
+	i := sort.SearchStrings(p.keys, key)
+	if i >= p.limit {
+		return
+	}
+	if len(p.keys) < p.limit {
+		p.keys = append(p.keys, "")
+	}
+	copy(p.keys[i+1:], p.keys[i:])
+	p.keys[i] = key
+}
+
+// page returns the keys of the page along with the cursor of the next one, if there are more
+func (p *pageKeys) page() ([]string, string) {
+	if len(p.keys) < p.limit {
+		return p.keys, ""
+	}
+	keys := p.keys[:p.limit-1]
+	return keys, encodeCursor(cacheCursor{Key: keys[len(keys)-1]})
+}
+
+// newCacheCount adds up the caches of every service
+func newCacheCount(services map[string]int) model.CacheCount {
+	count := model.CacheCount{Services: services}
+	for _, n := range services {
+		count.TotalCount += n
+	}
+	return count
+}
+
+// matchesFilter checks a key built by getCacheRedisKey against a filter
+func matchesFilter(filter model.CacheFilter, key string, tags []string) bool {
+	service, path, ok := parseCacheKey(key)
+	return ok && filter.MatchPath(service, path) && filter.MatchTags(tags)
+}
+
+// parseCacheKey splits a key built by getCacheRedisKey into its service and path
+func parseCacheKey(key string) (service string, path string, ok bool) {
+	parts := strings.SplitN(key, "::", 3)
+	if len(parts) < 3 || parts[0] != "cache" {
+		return "", "", false
+	}
+	service = parts[1]
+	if !strings.HasPrefix(service, "{") || !strings.HasSuffix(service, "}") {
+		return "", "", false
+	}
+	return service[1 : len(service)-1], parts[2], true
+}
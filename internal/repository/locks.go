@@ -0,0 +1,41 @@
+package repository
+
+import (
+	"sync"
+	"time"
+)
+
+type localLock struct {
+	token     string
+	expiresAt time.Time
+}
+
+// localLocks are the cache locks of the backends that live in a single process
+type localLocks struct {
+	mu    sync.Mutex
+	locks map[string]localLock
+}
+
+func (l *localLocks) lock(key string, token string, ttl time.Duration, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if lock, ok := l.locks[key]; ok && now.Before(lock.expiresAt) {
+		return false
+	}
+	l.locks[key] = localLock{token: token, expiresAt: now.Add(ttl)}
+	return true
+}
+
+func (l *localLocks) unlock(key string, token string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if lock, ok := l.locks[key]; ok && lock.token == token {
+		delete(l.locks, key)
+	}
+}
+
+func newLocalLocks() *localLocks {
+	return &localLocks{locks: make(map[string]localLock)}
+}
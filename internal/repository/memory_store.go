@@ -0,0 +1,382 @@
+package repository
+
+import (
+	"container/heap"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gotway/gotway/internal/model"
+)
+
+const (
+	// EvictionLRU evicts the least recently used entries first
+	EvictionLRU = "lru"
+	// EvictionLFU evicts the least frequently used entries first, ties are broken by recency
+	EvictionLFU = "lfu"
+)
+
+type memoryEntry struct {
+	key       string
+	cache     model.Cache
+	size      int64
+	expiresAt time.Time
+	hits      uint64
+	lastUsed  uint64
+	index     int
+}
+
+// serviceUsage is what the entries of a service take from the store
+type serviceUsage struct {
+	bytes   int64
+	entries int64
+}
+
+// memoryStore keeps caches in memory within a maximum size in bytes,
+// evicting entries according to a policy when it is full
+type memoryStore struct {
+	mu       sync.Mutex
+	maxBytes int64
+	bytes    int64
+	clock    uint64
+	entries  map[string]*memoryEntry
+	services map[string]*serviceUsage
+	queue    evictionQueue
+	onResize func(bytes int64)
+	onEvict  func(key string)
+}
+
+func (s *memoryStore) get(key string, now time.Time) (model.Cache, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[key]
+	if !ok {
+		return model.Cache{}, false
+	}
+	if !now.Before(entry.expiresAt) {
+		s.remove(entry)
+		return model.Cache{}, false
+	}
+	s.touch(entry)
+	return entry.cache, true
+}
+
+// set stores a cache, evicting the entries of its service that do not fit in the quota
+// and then any entry that does not fit in the store
+func (s *memoryStore) set(
+	key string,
+	cache model.Cache,
+	expiration time.Duration,
+	now time.Time,
+	quota model.CacheQuota,
+) error {
+	size := cacheSize(key, cache)
+	if size > s.maxBytes {
+		s.delete(key)
+		return model.ErrCacheBudgetExceeded
+	}
+	if quota.MaxBytes > 0 && size > quota.MaxBytes {
+		s.delete(key)
+		return model.ErrCacheQuotaExceeded
+	}
+	if expiration <= 0 {
+		s.delete(key)
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	service := getServiceKey(key)
+	entry, ok := s.entries[key]
+	if ok {
+		s.bytes += size - entry.size
+		s.services[service].bytes += size - entry.size
+		entry.cache = cache
+		entry.size = size
+		entry.expiresAt = now.Add(expiration)
+		s.touch(entry)
+	} else {
+		entry = &memoryEntry{
+			key:       key,
+			cache:     cache,
+			size:      size,
+			expiresAt: now.Add(expiration),
+		}
+		s.clock++
+		entry.lastUsed = s.clock
+		s.entries[key] = entry
+		heap.Push(&s.queue, entry)
+		s.bytes += size
+		usage, ok := s.services[service]
+		if !ok {
+			usage = &serviceUsage{}
+			s.services[service] = usage
+		}
+		usage.bytes += size
+		usage.entries++
+	}
+
+	for s.exceeds(service, quota) {
+		s.evict(s.serviceVictim(service, entry))
+	}
+	for s.bytes > s.maxBytes {
+		s.evict(s.victim(entry))
+	}
+	s.resized()
+	return nil
+}
+
+// exceeds checks if the entries of a service do not fit in its quota
+func (s *memoryStore) exceeds(service string, quota model.CacheQuota) bool {
+	usage := s.services[service]
+	return (quota.MaxBytes > 0 && usage.bytes > quota.MaxBytes) ||
+		(quota.MaxEntries > 0 && usage.entries > quota.MaxEntries)
+}
+
+// serviceVictim returns the next entry of a service to evict sparing the one being stored
+func (s *memoryStore) serviceVictim(service string, spare *memoryEntry) *memoryEntry {
+	var victim *memoryEntry
+	for _, entry := range s.entries {
+		if entry == spare || getServiceKey(entry.key) != service {
+			continue
+		}
+		if victim == nil || s.queue.less(entry, victim) {
+			victim = entry
+		}
+	}
+	return victim
+}
+
+// victim returns the next entry to evict sparing the one being stored,
+// which would always be the first one to go when evicting by frequency
+func (s *memoryStore) victim(spare *memoryEntry) *memoryEntry {
+	entries := s.queue.entries
+	if entries[0] != spare {
+		return entries[0]
+	}
+	// the runner-up of a heap is one of the children of its root
+	if len(entries) > 2 && s.queue.Less(2, 1) {
+		return entries[2]
+	}
+	return entries[1]
+}
+
+func (s *memoryStore) delete(keys ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, key := range keys {
+		if entry, ok := s.entries[key]; ok {
+			s.remove(entry)
+		}
+	}
+	s.resized()
+}
+
+// deletePath deletes the cache of a path along with its variants
+func (s *memoryStore) deletePath(key string) []string {
+	return s.deleteFunc(func(entry *memoryEntry) bool {
+		return matchesPath(entry.key, key)
+	})
+}
+
+// deleteTags deletes the caches having any of the tags
+func (s *memoryStore) deleteTags(tags []string) []string {
+	return s.deleteFunc(func(entry *memoryEntry) bool {
+		for _, tag := range entry.cache.Tags {
+			for _, t := range tags {
+				if tag == t {
+					return true
+				}
+			}
+		}
+		return false
+	})
+}
+
+// deleteFunc deletes the entries matching a function and returns their keys
+func (s *memoryStore) deleteFunc(fn func(entry *memoryEntry) bool) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var keys []string
+	for _, entry := range s.entries {
+		if fn(entry) {
+			s.remove(entry)
+			keys = append(keys, entry.key)
+		}
+	}
+	s.resized()
+	return keys
+}
+
+// findFunc returns a page of the caches that have not expired matching a function along with their keys,
+// sorted by key, and the cursor of the next page. Finding caches does not count as using them
+func (s *memoryStore) findFunc(
+	now time.Time,
+	limit int,
+	fn func(entry *memoryEntry) bool,
+) ([]string, []model.Cache, string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	page := newPageKeys(limit)
+	for _, entry := range s.entries {
+		if now.Before(entry.expiresAt) && fn(entry) {
+			page.add(entry.key)
+		}
+	}
+	keys, cursor := page.page()
+	caches := make([]model.Cache, len(keys))
+	for i, key := range keys {
+		caches[i] = s.entries[key].cache
+	}
+	return keys, caches, cursor
+}
+
+// countFunc counts the caches that have not expired matching a function by service
+func (s *memoryStore) countFunc(now time.Time, fn func(entry *memoryEntry) bool) map[string]int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	services := make(map[string]int)
+	for _, entry := range s.entries {
+		if now.Before(entry.expiresAt) && fn(entry) {
+			services[getServiceKey(entry.key)]++
+		}
+	}
+	return services
+}
+
+// hasPath checks if there is a cache for a path or any of its variants
+func (s *memoryStore) hasPath(key string, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, entry := range s.entries {
+		if now.Before(entry.expiresAt) && matchesPath(entry.key, key) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *memoryStore) size() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.bytes
+}
+
+func (s *memoryStore) touch(entry *memoryEntry) {
+	s.clock++
+	entry.lastUsed = s.clock
+	entry.hits++
+	heap.Fix(&s.queue, entry.index)
+}
+
+func (s *memoryStore) remove(entry *memoryEntry) {
+	heap.Remove(&s.queue, entry.index)
+	delete(s.entries, entry.key)
+	s.bytes -= entry.size
+
+	service := getServiceKey(entry.key)
+	if usage, ok := s.services[service]; ok {
+		usage.bytes -= entry.size
+		usage.entries--
+		if usage.entries <= 0 {
+			delete(s.services, service)
+		}
+	}
+}
+
+// evict removes an entry to make room for others
+func (s *memoryStore) evict(entry *memoryEntry) {
+	s.remove(entry)
+	if s.onEvict != nil {
+		s.onEvict(entry.key)
+	}
+}
+
+func (s *memoryStore) resized() {
+	if s.onResize != nil {
+		s.onResize(s.bytes)
+	}
+}
+
+// matchesPath checks if a key is the one of a path or of one of its variants
+func matchesPath(key string, pathKey string) bool {
+	return key == pathKey || strings.HasPrefix(key, pathKey+model.CacheVariantSeparator)
+}
+
+// cacheSize approximates the memory used by a cache
+func cacheSize(key string, cache model.Cache) int64 {
+	size := len(key) + len(cache.Path) + len(cache.Body)
+	for name, values := range cache.Headers {
+		size += len(name)
+		for _, v := range values {
+			size += len(v)
+		}
+	}
+	for _, tag := range cache.Tags {
+		size += len(tag)
+	}
+	return int64(size)
+}
+
+// evictionQueue is a heap whose first entry is the next one to be evicted
+type evictionQueue struct {
+	entries []*memoryEntry
+	lfu     bool
+}
+
+func (q evictionQueue) Len() int { return len(q.entries) }
+
+func (q evictionQueue) Less(i, j int) bool {
+	return q.less(q.entries[i], q.entries[j])
+}
+
+func (q evictionQueue) less(a, b *memoryEntry) bool {
+	if q.lfu && a.hits != b.hits {
+		return a.hits < b.hits
+	}
+	return a.lastUsed < b.lastUsed
+}
+
+func (q evictionQueue) Swap(i, j int) {
+	q.entries[i], q.entries[j] = q.entries[j], q.entries[i]
+	q.entries[i].index = i
+	q.entries[j].index = j
+}
+
+func (q *evictionQueue) Push(x interface{}) {
+	entry := x.(*memoryEntry)
+	entry.index = len(q.entries)
+	q.entries = append(q.entries, entry)
+}
+
+func (q *evictionQueue) Pop() interface{} {
+	old := q.entries
+	n := len(old)
+	entry := old[n-1]
+	old[n-1] = nil
+	q.entries = old[:n-1]
+	return entry
+}
+
+func newMemoryStore(
+	maxBytes int64,
+	policy string,
+	onResize func(bytes int64),
+	onEvict func(key string),
+) *memoryStore {
+	return &memoryStore{
+		maxBytes: maxBytes,
+		entries:  make(map[string]*memoryEntry),
+		services: make(map[string]*serviceUsage),
+		queue:    evictionQueue{lfu: policy == EvictionLFU},
+		onResize: onResize,
+		onEvict:  onEvict,
+	}
+}
@@ -0,0 +1,117 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gotway/gotway/internal/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func newMemoryCache(path string, body string, tags ...string) model.Cache {
+	return model.Cache{
+		Path: path,
+		Body: []byte(body),
+		Tags: tags,
+	}
+}
+
+func TestMemoryStoreEviction(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name        string
+		eviction    string
+		wantEvicted string
+	}{
+		{
+			name:        "LRU",
+			eviction:    EvictionLRU,
+			wantEvicted: "a",
+		},
+		{
+			name:        "LFU",
+			eviction:    EvictionLFU,
+			wantEvicted: "b",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b, c := newMemoryCache("a", "1234"), newMemoryCache("b", "1234"), newMemoryCache("c", "1234")
+			var evicted []string
+			store := newMemoryStore(cacheSize("a", a)*3, tt.eviction, nil, func(key string) {
+				evicted = append(evicted, key)
+			})
+
+			store.set("a", a, time.Minute, now, model.CacheQuota{})
+			store.set("b", b, time.Minute, now, model.CacheQuota{})
+			store.set("c", c, time.Minute, now, model.CacheQuota{})
+			for i := 0; i < 3; i++ {
+				store.get("a", now)
+			}
+			store.get("b", now)
+			store.get("c", now)
+
+			store.set("d", newMemoryCache("d", "1234"), time.Minute, now, model.CacheQuota{})
+
+			_, ok := store.get(tt.wantEvicted, now)
+			assert.False(t, ok)
+			assert.Equal(t, []string{tt.wantEvicted}, evicted)
+			_, ok = store.get("d", now)
+			assert.True(t, ok)
+			assert.LessOrEqual(t, store.size(), store.maxBytes)
+		})
+	}
+}
+
+func TestMemoryStoreExpiration(t *testing.T) {
+	now := time.Now()
+	store := newMemoryStore(1024, EvictionLRU, nil, nil)
+
+	store.set("a", newMemoryCache("a", "{}"), time.Minute, now, model.CacheQuota{})
+
+	_, ok := store.get("a", now.Add(30*time.Second))
+	assert.True(t, ok)
+	_, ok = store.get("a", now.Add(time.Minute))
+	assert.False(t, ok)
+	assert.Equal(t, int64(0), store.size())
+}
+
+func TestMemoryStoreTooBig(t *testing.T) {
+	now := time.Now()
+	store := newMemoryStore(8, EvictionLRU, nil, nil)
+
+	store.set("a", newMemoryCache("a", "too big to fit"), time.Minute, now, model.CacheQuota{})
+
+	_, ok := store.get("a", now)
+	assert.False(t, ok)
+}
+
+func TestMemoryStoreDelete(t *testing.T) {
+	now := time.Now()
+	store := newMemoryStore(1024, EvictionLRU, nil, nil)
+	keys := map[string]model.Cache{
+		"cache::catalog::/products":                 newMemoryCache("/products", "{}", "products"),
+		"cache::catalog::/products::v=abc":          newMemoryCache("/products", "{}", "products"),
+		"cache::catalog::/products/1":               newMemoryCache("/products/1", "{}", "product"),
+		"cache::stock::/stock":                      newMemoryCache("/stock", "{}", "stock"),
+		"cache::catalog::/products-featured::v=abc": newMemoryCache("/products-featured", "{}"),
+	}
+	for key, cache := range keys {
+		store.set(key, cache, time.Minute, now, model.CacheQuota{})
+	}
+
+	store.deletePath("cache::catalog::/products")
+	store.deleteTags([]string{"stock", "unknown"})
+
+	for key, wantOk := range map[string]bool{
+		"cache::catalog::/products":                 false,
+		"cache::catalog::/products::v=abc":          false,
+		"cache::catalog::/products/1":               true,
+		"cache::stock::/stock":                      false,
+		"cache::catalog::/products-featured::v=abc": true,
+	} {
+		_, ok := store.get(key, now)
+		assert.Equal(t, wantOk, ok, key)
+	}
+}
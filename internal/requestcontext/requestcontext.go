@@ -4,15 +4,43 @@ import (
 	"context"
 	"errors"
 	"net/http"
+	"time"
 
+	"github.com/gotway/gotway/internal/model"
 	crdv1alpha1 "github.com/gotway/gotway/pkg/kubernetes/crd/v1alpha1"
+	"github.com/gotway/gotway/pkg/log"
 )
 
+// RequestIDHeader carries the id that correlates a request across the gateway and its upstreams
+const RequestIDHeader = "X-Request-ID"
+
 type requestContextKey string
 
 const (
-	ingressKey  requestContextKey = "service"
-	responseKey requestContextKey = "response"
+	ingressKey   requestContextKey = "service"
+	responseKey  requestContextKey = "response"
+	requestIDKey requestContextKey = "requestId"
+	summaryKey   requestContextKey = "summary"
+	staleKey     requestContextKey = "stale"
+)
+
+// Summary gathers what happened to a request while it goes through the middlewares,
+// it is filled in by inner middlewares and read by outer ones once the request is handled
+type Summary struct {
+	Ingress          string
+	Service          string
+	Upstream         string
+	UpstreamDuration time.Duration
+	CacheStatus      string
+}
+
+const (
+	CacheStatusHit         = "hit"
+	CacheStatusStale       = "stale"
+	CacheStatusRevalidated = "revalidated"
+	CacheStatusCoalesced   = "coalesced"
+	CacheStatusMiss        = "miss"
+	CacheStatusBypass      = "bypass"
 )
 
 func WithIngress(r *http.Request, ingress crdv1alpha1.IngressHTTP) *http.Request {
@@ -23,6 +51,19 @@ func WithResponse(r *http.Request, res *http.Response) *http.Request {
 	return r.WithContext(context.WithValue(r.Context(), responseKey, res))
 }
 
+func WithRequestID(r *http.Request, requestID string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), requestIDKey, requestID))
+}
+
+func WithSummary(r *http.Request, summary *Summary) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), summaryKey, summary))
+}
+
+// WithStaleCache attaches an expired cached response that the service may revalidate
+func WithStaleCache(r *http.Request, cache model.Cache) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), staleKey, cache))
+}
+
 func GetIngress(r *http.Request) (crdv1alpha1.IngressHTTP, error) {
 	ingress, ok := r.Context().Value(ingressKey).(crdv1alpha1.IngressHTTP)
 	if !ok {
@@ -38,3 +79,60 @@ func GetResponse(r *http.Request) (*http.Response, error) {
 	}
 	return res, nil
 }
+
+func GetRequestID(r *http.Request) (string, error) {
+	requestID, ok := r.Context().Value(requestIDKey).(string)
+	if !ok {
+		return "", errors.New("request id not found in request context")
+	}
+	return requestID, nil
+}
+
+func GetStaleCache(r *http.Request) (model.Cache, error) {
+	cache, ok := r.Context().Value(staleKey).(model.Cache)
+	if !ok {
+		return model.Cache{}, errors.New("stale cache not found in request context")
+	}
+	return cache, nil
+}
+
+func GetSummary(r *http.Request) (*Summary, error) {
+	summary, ok := r.Context().Value(summaryKey).(*Summary)
+	if !ok {
+		return nil, errors.New("summary not found in request context")
+	}
+	return summary, nil
+}
+
+// Summarize updates the request summary, if any
+func Summarize(r *http.Request, fn func(*Summary)) {
+	if summary, err := GetSummary(r); err == nil {
+		fn(summary)
+	}
+}
+
+// detachedContext keeps the values of its parent but not its cancellation
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool)         { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}               { return nil }
+func (detachedContext) Err() error                          { return nil }
+func (d detachedContext) Value(key interface{}) interface{} { return d.parent.Value(key) }
+
+// Detach copies a request so it can still be handled once the original one has finished
+func Detach(r *http.Request) *http.Request {
+	detached := r.Clone(detachedContext{r.Context()})
+	detached.Body = http.NoBody
+	return detached
+}
+
+// Logger returns a logger that tags its entries with the request id, if any
+func Logger(r *http.Request, logger log.Logger) log.Logger {
+	requestID, err := GetRequestID(r)
+	if err != nil {
+		return logger
+	}
+	return logger.WithField("requestId", requestID)
+}
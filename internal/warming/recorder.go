@@ -0,0 +1,30 @@
+package warming
+
+import "net/http"
+
+// recorder keeps the status and headers of the response to a warming request, its body is not needed
+type recorder struct {
+	header http.Header
+	status int
+}
+
+func (r *recorder) Header() http.Header {
+	return r.header
+}
+
+func (r *recorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+}
+
+func (r *recorder) Write(p []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return len(p), nil
+}
+
+func newRecorder() *recorder {
+	return &recorder{header: http.Header{}}
+}
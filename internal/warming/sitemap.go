@@ -0,0 +1,64 @@
+package warming
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// sitemapMaxBytes bounds the size of the sitemaps that are read
+const sitemapMaxBytes = 10 << 20
+
+// sitemap is an XML sitemap as in https://www.sitemaps.org/protocol.html
+type sitemap struct {
+	URLs []struct {
+		Loc string `xml:"loc"`
+	} `xml:"url"`
+}
+
+// readSitemap lists the paths of the locations of a sitemap, relative URLs are requested to the service
+func (c *Controller) readSitemap(ctx context.Context, serviceURL string, sitemapURL string) ([]string, error) {
+	if strings.HasPrefix(sitemapURL, "/") {
+		sitemapURL = serviceURL + sitemapURL
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, sitemapURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	res, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("sitemap responded %d", res.StatusCode)
+	}
+	return parseSitemap(io.LimitReader(res.Body, sitemapMaxBytes))
+}
+
+// parseSitemap reads the paths of the locations of a sitemap, along with their queries
+func parseSitemap(r io.Reader) ([]string, error) {
+	var s sitemap
+	if err := xml.NewDecoder(r).Decode(&s); err != nil {
+		return nil, fmt.Errorf("invalid sitemap: %v", err)
+	}
+	seen := make(map[string]bool, len(s.URLs))
+	paths := make([]string, 0, len(s.URLs))
+	for _, u := range s.URLs {
+		loc, err := url.Parse(strings.TrimSpace(u.Loc))
+		if err != nil || loc.Host == "" {
+			continue
+		}
+		path := loc.RequestURI()
+		if !seen[path] {
+			seen[path] = true
+			paths = append(paths, path)
+		}
+	}
+	return paths, nil
+}
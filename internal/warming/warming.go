@@ -0,0 +1,458 @@
+package warming
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gotway/gotway/internal/cache"
+	cacheMw "github.com/gotway/gotway/internal/middleware/cache"
+	"github.com/gotway/gotway/internal/model"
+	kubernetesCtrl "github.com/gotway/gotway/pkg/kubernetes/controller"
+	crdv1alpha1 "github.com/gotway/gotway/pkg/kubernetes/crd/v1alpha1"
+	"github.com/gotway/gotway/pkg/log"
+	"github.com/gotway/gotway/pkg/metrics"
+
+	kubeCache "k8s.io/client-go/tools/cache"
+)
+
+// userAgent identifies the warming requests in the access logs of the gateway and the services
+const userAgent = "gotway-warming"
+
+// minDelay avoids warming the same paths over and over when they are cached for too short
+const minDelay = time.Second
+
+type Options struct {
+	// Interval is how often ingresses are checked for changes and failed paths are retried
+	Interval time.Duration
+	// RefreshBefore is how long before expiring a cached path is warmed again
+	RefreshBefore   time.Duration
+	SitemapInterval time.Duration
+	Timeout         time.Duration
+	// Concurrency is how many paths are warmed at a time
+	Concurrency int
+}
+
+// Controller warms the caches of the paths declared by the ingresses, on startup and before they expire.
+// Paths are requested to the gateway, so they are cached like any other request, using the worker pool
+// of the cache controller
+type Controller struct {
+	options   Options
+	kubeCtrl  *kubernetesCtrl.Controller
+	cacheCtrl cache.Controller
+	client    http.Client
+	mu        sync.Mutex
+	targets   map[string]*target
+	wake      chan struct{}
+	now       func() time.Time
+	logger    log.Logger
+}
+
+// target is the warming state of an ingress
+type target struct {
+	ingress       crdv1alpha1.IngressHTTP
+	sitemapURL    string
+	sitemapPaths  []string
+	sitemapErr    error
+	sitemapReadAt time.Time
+	paths         map[string]*model.CacheWarmingPath
+}
+
+// job is a path due to be warmed
+type job struct {
+	key     string
+	ingress crdv1alpha1.IngressHTTP
+	path    string
+}
+
+// Start warms the paths that are due once the ingresses are synced, sending requests to the gateway handler
+func (c *Controller) Start(ctx context.Context, handler http.Handler) {
+	c.logger.Info("starting cache warming")
+	if !kubeCache.WaitForCacheSync(ctx.Done(), c.kubeCtrl.HasSynced) {
+		c.logger.Info("stopping cache warming")
+		return
+	}
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			c.logger.Info("stopping cache warming")
+			return
+		case <-c.wake:
+			if !timer.Stop() {
+				<-timer.C
+			}
+		case <-timer.C:
+		}
+		c.warm(ctx, handler)
+		timer.Reset(c.untilNext())
+	}
+}
+
+// Refresh warms every path again, for instance after the cache has been flushed
+func (c *Controller) Refresh() {
+	c.mu.Lock()
+	now := c.now()
+	for _, t := range c.targets {
+		for _, p := range t.paths {
+			p.NextWarmAt = now
+		}
+	}
+	c.mu.Unlock()
+
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Status lists the state of the warmed paths of every ingress
+func (c *Controller) Status() []model.CacheWarming {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	keys := make([]string, 0, len(c.targets))
+	for key := range c.targets {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	status := make([]model.CacheWarming, 0, len(keys))
+	for _, key := range keys {
+		t := c.targets[key]
+		warming := model.CacheWarming{
+			Ingress:    key,
+			Service:    t.ingress.Spec.Service.Name,
+			SitemapURL: t.sitemapURL,
+			Paths:      make([]model.CacheWarmingPath, 0, len(t.paths)),
+		}
+		if t.sitemapErr != nil {
+			warming.SitemapError = t.sitemapErr.Error()
+		}
+		for _, p := range t.paths {
+			warming.Paths = append(warming.Paths, *p)
+		}
+		sort.Slice(warming.Paths, func(i, j int) bool {
+			return warming.Paths[i].Path < warming.Paths[j].Path
+		})
+		status = append(status, warming)
+	}
+	return status
+}
+
+// warm syncs the ingresses and warms their paths that are due
+func (c *Controller) warm(ctx context.Context, handler http.Handler) {
+	ingresses, err := c.kubeCtrl.ListIngresses()
+	if err != nil {
+		c.logger.Error("error getting ingresses ", err)
+		return
+	}
+	c.sync(ctx, ingresses)
+	c.warmDue(ctx, handler)
+}
+
+// warmDue requests the paths that are due, as many at a time as the concurrency, and waits for all of them
+func (c *Controller) warmDue(ctx context.Context, handler http.Handler) {
+	jobs := make(chan job)
+	var wg sync.WaitGroup
+	for i := 0; i < c.options.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				c.warmPath(ctx, handler, j)
+			}
+		}()
+	}
+
+	defer func() {
+		close(jobs)
+		wg.Wait()
+	}()
+	for _, j := range c.due() {
+		select {
+		case jobs <- j:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// warmPath requests a path in the worker pool of the cache controller and waits for its response to be
+// stored afterwards, outside of the pool, as storing it takes a worker too
+func (c *Controller) warmPath(ctx context.Context, handler http.Handler, j job) {
+	warmCtx, cancel := context.WithTimeout(ctx, c.options.Timeout)
+	defer cancel()
+
+	type fetched struct {
+		res    *recorder
+		result *cache.StoreResult
+	}
+	// the task may still be running when warming times out, so it hands over what it fetched
+	out := make(chan fetched, 1)
+	err := c.cacheCtrl.Warm(warmCtx, func(ctx context.Context) error {
+		res, result, err := c.request(ctx, handler, j)
+		out <- fetched{res: res, result: result}
+		return err
+	})
+	if ctx.Err() != nil {
+		// stopping
+		return
+	}
+	var f fetched
+	select {
+	case f = <-out:
+	default:
+	}
+	if err == nil {
+		if err = f.result.Wait(warmCtx); err != nil {
+			err = fmt.Errorf("response not cached: %v", err)
+		}
+	}
+	c.record(ctx, j, f.res, err)
+}
+
+// sync tracks the paths of the ingresses that declare them, reading their sitemaps when they are due
+func (c *Controller) sync(ctx context.Context, ingresses []crdv1alpha1.IngressHTTP) {
+	now := c.now()
+	targets := make(map[string]*target)
+	for _, ingress := range ingresses {
+		warming := ingress.Spec.Cache.Warming
+		if warming == nil {
+			continue
+		}
+		key, err := kubeCache.MetaNamespaceKeyFunc(&ingress)
+		if err != nil {
+			c.logger.Errorf("error getting key of ingress %s: %v", ingress.Name, err)
+			continue
+		}
+
+		c.mu.Lock()
+		t, ok := c.targets[key]
+		c.mu.Unlock()
+		if !ok {
+			t = &target{paths: make(map[string]*model.CacheWarmingPath)}
+		}
+		sitemapURL := t.sitemapURL
+		sitemapPaths := t.sitemapPaths
+		sitemapErr := t.sitemapErr
+		sitemapReadAt := t.sitemapReadAt
+		if warming.SitemapURL != sitemapURL {
+			sitemapURL, sitemapPaths, sitemapErr, sitemapReadAt = warming.SitemapURL, nil, nil, time.Time{}
+		}
+		if sitemapURL != "" && (sitemapReadAt.IsZero() || sitemapErr != nil ||
+			now.Sub(sitemapReadAt) >= c.options.SitemapInterval) {
+			paths, err := c.readSitemap(ctx, ingress.Spec.Service.URL, sitemapURL)
+			if err != nil {
+				c.logger.Errorf("error reading sitemap of ingress %s: %v", key, err)
+			} else {
+				sitemapPaths, sitemapReadAt = paths, now
+			}
+			sitemapErr = err
+		}
+
+		c.mu.Lock()
+		t.ingress = ingress
+		t.sitemapURL, t.sitemapPaths, t.sitemapErr, t.sitemapReadAt = sitemapURL, sitemapPaths, sitemapErr, sitemapReadAt
+		paths := make(map[string]*model.CacheWarmingPath)
+		for _, list := range [][]string{warming.Paths, sitemapPaths} {
+			for _, path := range list {
+				if p, ok := t.paths[path]; ok {
+					paths[path] = p
+					continue
+				}
+				paths[path] = &model.CacheWarmingPath{Path: path, Status: model.CacheWarmingPending, NextWarmAt: now}
+			}
+		}
+		t.paths = paths
+		c.mu.Unlock()
+		targets[key] = t
+	}
+
+	c.mu.Lock()
+	c.targets = targets
+	c.mu.Unlock()
+}
+
+// due lists the paths to warm now, the ones of unhealthy services wait until they recover
+func (c *Controller) due() []job {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	var jobs []job
+	for key, t := range c.targets {
+		if !t.ingress.Status.IsServiceHealthy {
+			continue
+		}
+		for path, p := range t.paths {
+			if !now.Before(p.NextWarmAt) {
+				jobs = append(jobs, job{key: key, ingress: t.ingress, path: path})
+			}
+		}
+	}
+	return jobs
+}
+
+// untilNext is how long until the next path is due, ingresses are checked at least every interval
+func (c *Controller) untilNext() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	next := c.options.Interval
+	for _, t := range c.targets {
+		if !t.ingress.Status.IsServiceHealthy {
+			continue
+		}
+		for _, p := range t.paths {
+			if d := p.NextWarmAt.Sub(now); d < next {
+				next = d
+			}
+		}
+	}
+	if next < minDelay {
+		return minDelay
+	}
+	return next
+}
+
+// request sends a request for a path to the gateway, asking for a fresh response so it is cached again.
+// The result tells when the response is cached, as it may be dropped or rejected by a quota
+func (c *Controller) request(
+	ctx context.Context,
+	handler http.Handler,
+	j job,
+) (*recorder, *cache.StoreResult, error) {
+	req, err := newRequest(ctx, j.ingress, j.path)
+	if err != nil {
+		return nil, nil, err
+	}
+	req, result := cache.WithStoreResult(req)
+	res := newRecorder()
+	handler.ServeHTTP(res, req)
+	if res.status == 0 {
+		// handlers that write nothing respond 200
+		res.status = http.StatusOK
+	}
+	if res.status >= http.StatusBadRequest {
+		return res, result, fmt.Errorf("gateway responded %d", res.status)
+	}
+	return res, result, nil
+}
+
+// record keeps the outcome of warming a path and schedules the next time it is warmed:
+// before the cache expires or, if it was not cacheable, in the next interval
+func (c *Controller) record(ctx context.Context, j job, res *recorder, err error) {
+	now := c.now()
+	next := now.Add(c.options.Interval)
+	params := cacheMw.GetParams(j.ingress)
+	if err == nil {
+		if ttl := c.getTTL(ctx, j, res, params); ttl > 0 {
+			next = now.Add(ttl - c.options.RefreshBefore)
+			if half := now.Add(ttl / 2); next.Before(half) {
+				next = half
+			}
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t, ok := c.targets[j.key]
+	if !ok {
+		return
+	}
+	p, ok := t.paths[j.path]
+	if !ok {
+		return
+	}
+	p.NextWarmAt = next
+	p.Error = ""
+	if res != nil {
+		p.StatusCode = res.status
+		p.CacheStatus = res.header.Get(cacheMw.StatusHeader)
+	}
+	if err != nil {
+		c.logger.Errorf("error warming path %s of ingress %s: %v", j.path, j.key, err)
+		p.Status = model.CacheWarmingFailed
+		p.Error = err.Error()
+		p.Failures++
+		metrics.CacheWarms.WithLabelValues(params.Service, metrics.CacheWarmFailed).Inc()
+		return
+	}
+	p.Status = model.CacheWarmingWarmed
+	p.Failures = 0
+	p.LastWarmedAt = &now
+	metrics.CacheWarms.WithLabelValues(params.Service, metrics.CacheWarmed).Inc()
+}
+
+// getTTL is how long the response of a path is cached, zero if it is not cacheable.
+// It is read from the response, as it is stored asynchronously by the cache controller
+func (c *Controller) getTTL(ctx context.Context, j job, res *recorder, params cache.Params) time.Duration {
+	req, err := newRequest(ctx, j.ingress, j.path)
+	if err != nil {
+		return 0
+	}
+	httpResponse := &http.Response{StatusCode: res.status, Header: res.header, Request: req}
+	if !c.cacheCtrl.IsCacheableResponse(req, httpResponse, params) {
+		return 0
+	}
+	return cache.GetResponseTTL(httpResponse, params)
+}
+
+// newRequest builds a request for a path that matches the host and port of an ingress
+func newRequest(ctx context.Context, ingress crdv1alpha1.IngressHTTP, path string) (*http.Request, error) {
+	if !strings.HasPrefix(path, "/") {
+		return nil, fmt.Errorf("path '%s' should start with /", path)
+	}
+	host := ingress.Spec.Match.Host
+	if host == "" {
+		host = "localhost"
+	}
+	u, err := url.Parse(path)
+	if err != nil {
+		return nil, err
+	}
+	u.Scheme = "http"
+	u.Host = host
+	if port := ingress.Spec.Match.Port; port != "" {
+		u.Host = host + ":" + port
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Host = host
+	req.Header.Set("Cache-Control", "no-cache")
+	req.Header.Set("User-Agent", userAgent)
+	return req, nil
+}
+
+func NewController(
+	options Options,
+	kubeCtrl *kubernetesCtrl.Controller,
+	cacheCtrl cache.Controller,
+	logger log.Logger,
+) *Controller {
+	if options.Concurrency < 1 {
+		options.Concurrency = 1
+	}
+	return &Controller{
+		options:   options,
+		kubeCtrl:  kubeCtrl,
+		cacheCtrl: cacheCtrl,
+		client:    http.Client{Timeout: options.Timeout},
+		targets:   make(map[string]*target),
+		wake:      make(chan struct{}, 1),
+		now:       time.Now,
+		logger:    logger,
+	}
+}
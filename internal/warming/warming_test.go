@@ -0,0 +1,311 @@
+package warming
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gotway/gotway/internal/cache"
+	cacheMw "github.com/gotway/gotway/internal/middleware/cache"
+	"github.com/gotway/gotway/internal/mocks"
+	"github.com/gotway/gotway/internal/model"
+	crdv1alpha1 "github.com/gotway/gotway/pkg/kubernetes/crd/v1alpha1"
+	"github.com/gotway/gotway/pkg/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const sitemapXML = `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+	<url><loc>https://catalog.gotway.com/products</loc></url>
+	<url><loc> https://catalog.gotway.com/products?page=2 </loc></url>
+	<url><loc>https://catalog.gotway.com/products</loc></url>
+	<url><loc>/relative</loc></url>
+</urlset>`
+
+func TestParseSitemap(t *testing.T) {
+	tests := []struct {
+		name      string
+		sitemap   string
+		wantPaths []string
+		wantErr   bool
+	}{
+		{
+			name:      "Sitemap",
+			sitemap:   sitemapXML,
+			wantPaths: []string{"/products", "/products?page=2"},
+		},
+		{
+			name:      "Empty",
+			sitemap:   `<urlset></urlset>`,
+			wantPaths: []string{},
+		},
+		{
+			name:    "Invalid",
+			sitemap: `not a sitemap`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			paths, err := parseSitemap(strings.NewReader(tt.sitemap))
+
+			assert.Equal(t, tt.wantErr, err != nil)
+			assert.Equal(t, tt.wantPaths, paths)
+		})
+	}
+}
+
+func newIngress(name string, serviceURL string, warming *crdv1alpha1.CacheWarming) crdv1alpha1.IngressHTTP {
+	return crdv1alpha1.IngressHTTP{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Spec: crdv1alpha1.IngressHTTPSpec{
+			Match:   crdv1alpha1.Match{Host: "catalog.gotway.com"},
+			Service: crdv1alpha1.Service{Name: name, URL: serviceURL},
+			Cache: crdv1alpha1.Cache{
+				TTL:      60,
+				Statuses: []int{http.StatusOK},
+				Warming:  warming,
+			},
+		},
+		Status: crdv1alpha1.IngressHTTPStatus{IsServiceHealthy: true},
+	}
+}
+
+func TestWarm(t *testing.T) {
+	service := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, sitemapXML)
+	}))
+	defer service.Close()
+
+	var mu sync.Mutex
+	var requests []*http.Request
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, r)
+		mu.Unlock()
+		w.Header().Set(cacheMw.StatusHeader, "MISS")
+		switch r.URL.RequestURI() {
+		case "/broken":
+			w.WriteHeader(http.StatusBadGateway)
+		case "/products":
+			w.Header().Set("Cache-Control", "s-maxage=30")
+		}
+	})
+
+	cacheRepo := new(mocks.CacheRepo)
+	cacheCtrl := cache.NewController(cache.Options{NumWorkers: 2, BufferSize: 10}, cacheRepo, log.Log)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go cacheCtrl.Start(ctx)
+
+	now := time.Date(2022, time.June, 1, 0, 0, 0, 0, time.UTC)
+	c := NewController(Options{
+		Interval:        30 * time.Second,
+		RefreshBefore:   10 * time.Second,
+		SitemapInterval: time.Minute,
+		Timeout:         time.Second,
+	}, nil, cacheCtrl, log.Log)
+	c.now = func() time.Time { return now }
+
+	unhealthy := newIngress("stock", service.URL, &crdv1alpha1.CacheWarming{Paths: []string{"/stock"}})
+	unhealthy.Status.IsServiceHealthy = false
+	c.sync(ctx, []crdv1alpha1.IngressHTTP{
+		newIngress("catalog", service.URL, &crdv1alpha1.CacheWarming{
+			Paths:      []string{"/products", "/broken"},
+			SitemapURL: "/sitemap.xml",
+		}),
+		newIngress("offers", service.URL, nil),
+		unhealthy,
+	})
+	c.warmDue(ctx, handler)
+
+	if assert.Len(t, requests, 3) {
+		for _, r := range requests {
+			assert.Equal(t, "catalog.gotway.com", r.Host)
+			assert.Equal(t, "no-cache", r.Header.Get("Cache-Control"))
+			assert.Equal(t, userAgent, r.Header.Get("User-Agent"))
+		}
+	}
+
+	status := c.Status()
+	if assert.Len(t, status, 2) {
+		assert.Equal(t, "default/catalog", status[0].Ingress)
+		assert.Equal(t, "/sitemap.xml", status[0].SitemapURL)
+		assert.Empty(t, status[0].SitemapError)
+		assert.Equal(t, []model.CacheWarmingPath{
+			{
+				Path:        "/broken",
+				Status:      model.CacheWarmingFailed,
+				StatusCode:  http.StatusBadGateway,
+				CacheStatus: "MISS",
+				Error:       "gateway responded 502",
+				Failures:    1,
+				NextWarmAt:  now.Add(30 * time.Second),
+			},
+			{
+				Path:         "/products",
+				Status:       model.CacheWarmingWarmed,
+				StatusCode:   http.StatusOK,
+				CacheStatus:  "MISS",
+				LastWarmedAt: &now,
+				NextWarmAt:   now.Add(20 * time.Second),
+			},
+			{
+				Path:         "/products?page=2",
+				Status:       model.CacheWarmingWarmed,
+				StatusCode:   http.StatusOK,
+				CacheStatus:  "MISS",
+				LastWarmedAt: &now,
+				NextWarmAt:   now.Add(50 * time.Second),
+			},
+		}, status[0].Paths)
+
+		assert.Equal(t, "default/stock", status[1].Ingress)
+		assert.Equal(t, model.CacheWarmingPending, status[1].Paths[0].Status)
+	}
+
+	requests = nil
+	c.warmDue(ctx, handler)
+	assert.Empty(t, requests)
+	assert.Equal(t, 20*time.Second, c.untilNext())
+
+	c.Refresh()
+	c.warmDue(ctx, handler)
+	assert.Len(t, requests, 3)
+}
+
+func TestNewRequest(t *testing.T) {
+	ingress := newIngress("catalog", "http://catalog", nil)
+	ingress.Spec.Match.Port = "9111"
+
+	req, err := newRequest(context.Background(), ingress, "/products?page=2")
+	assert.Nil(t, err)
+	assert.Equal(t, "catalog.gotway.com", req.Host)
+	assert.Equal(t, "9111", req.URL.Port())
+	assert.Equal(t, "/products?page=2", req.URL.RequestURI())
+
+	_, err = newRequest(context.Background(), ingress, "products")
+	assert.NotNil(t, err)
+}
+
+func TestWarmNotCached(t *testing.T) {
+	cacheRepo := new(mocks.CacheRepo)
+	cacheRepo.On("Create", mock.Anything, mock.Anything, "catalog", mock.Anything).
+		Return(model.ErrCacheQuotaExceeded)
+	cacheCtrl := cache.NewController(cache.Options{NumWorkers: 2, BufferSize: 10}, cacheRepo, log.Log)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go cacheCtrl.Start(ctx)
+
+	ingress := newIngress("catalog", "http://catalog", &crdv1alpha1.CacheWarming{Paths: []string{"/products"}})
+	// stores the response like the cache middleware does
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		res := &http.Response{
+			Request:    r,
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Cache-Control": []string{"max-age=60"}},
+			Body:       ioutil.NopCloser(strings.NewReader(`{}`)),
+		}
+		assert.Nil(t, cacheCtrl.HandleResponse(r, res, cacheMw.GetParams(ingress)))
+		w.Header().Set("Cache-Control", "max-age=60")
+	})
+
+	now := time.Date(2022, time.June, 1, 0, 0, 0, 0, time.UTC)
+	c := NewController(Options{Interval: 30 * time.Second, Timeout: time.Second}, nil, cacheCtrl, log.Log)
+	c.now = func() time.Time { return now }
+	c.sync(ctx, []crdv1alpha1.IngressHTTP{ingress})
+	c.warmDue(ctx, handler)
+
+	status := c.Status()
+	if assert.Len(t, status, 1) && assert.Len(t, status[0].Paths, 1) {
+		path := status[0].Paths[0]
+		assert.Equal(t, model.CacheWarmingFailed, path.Status)
+		assert.Equal(t, "response not cached: "+model.ErrCacheQuotaExceeded.Error(), path.Error)
+		assert.Equal(t, now.Add(30*time.Second), path.NextWarmAt)
+	}
+	cacheRepo.AssertExpectations(t)
+}
+
+// TestWarmSingleWorker warms with the only worker of the cache controller, which must be free to store
+// the response it fetched
+func TestWarmSingleWorker(t *testing.T) {
+	cacheRepo := new(mocks.CacheRepo)
+	cacheRepo.On("Create", mock.Anything, mock.Anything, "catalog", mock.Anything).Return(nil)
+	cacheCtrl := cache.NewController(cache.Options{NumWorkers: 1, BufferSize: 1}, cacheRepo, log.Log)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go cacheCtrl.Start(ctx)
+
+	ingress := newIngress("catalog", "http://catalog", &crdv1alpha1.CacheWarming{Paths: []string{"/products"}})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		res := &http.Response{
+			Request:    r,
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Cache-Control": []string{"max-age=60"}},
+			Body:       ioutil.NopCloser(strings.NewReader(`{}`)),
+		}
+		assert.Nil(t, cacheCtrl.HandleResponse(r, res, cacheMw.GetParams(ingress)))
+		w.Header().Set("Cache-Control", "max-age=60")
+	})
+
+	c := NewController(Options{Interval: 30 * time.Second, Timeout: time.Second}, nil, cacheCtrl, log.Log)
+	c.sync(ctx, []crdv1alpha1.IngressHTTP{ingress})
+	c.warmDue(ctx, handler)
+
+	status := c.Status()
+	if assert.Len(t, status, 1) && assert.Len(t, status[0].Paths, 1) {
+		assert.Equal(t, model.CacheWarmingWarmed, status[0].Paths[0].Status)
+		assert.Empty(t, status[0].Paths[0].Error)
+	}
+	cacheRepo.AssertExpectations(t)
+}
+
+func TestWarmConcurrency(t *testing.T) {
+	var mu sync.Mutex
+	var running, maxRunning int
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+	})
+
+	cacheCtrl := cache.NewController(
+		cache.Options{NumWorkers: 10, BufferSize: 10},
+		new(mocks.CacheRepo),
+		log.Log,
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go cacheCtrl.Start(ctx)
+
+	var paths []string
+	for i := 0; i < 10; i++ {
+		paths = append(paths, fmt.Sprintf("/products/%d", i))
+	}
+	c := NewController(Options{Interval: 30 * time.Second, Timeout: time.Second, Concurrency: 2}, nil, cacheCtrl, log.Log)
+	c.sync(ctx, []crdv1alpha1.IngressHTTP{
+		newIngress("catalog", "http://catalog", &crdv1alpha1.CacheWarming{Paths: paths}),
+	})
+	c.warmDue(ctx, handler)
+
+	assert.Equal(t, 2, maxRunning)
+	for _, p := range c.Status()[0].Paths {
+		assert.Equal(t, model.CacheWarmingWarmed, p.Status)
+	}
+}
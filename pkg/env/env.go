@@ -3,6 +3,7 @@ package env
 import (
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -37,6 +38,18 @@ func GetInt(key string, defaultValue int) int {
 	return intVal
 }
 
+func GetFloat64(key string, defaultValue float64) float64 {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return defaultValue
+	}
+	floatVal, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return defaultValue
+	}
+	return floatVal
+}
+
 func GetDuration(key string, defaultValue time.Duration) time.Duration {
 	val := GetInt(key, 0)
 	if val == 0 {
@@ -44,3 +57,17 @@ func GetDuration(key string, defaultValue time.Duration) time.Duration {
 	}
 	return time.Duration(val)
 }
+
+func GetStringSlice(key string, defaultValue []string) []string {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return defaultValue
+	}
+	var values []string
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
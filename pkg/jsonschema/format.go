@@ -0,0 +1,89 @@
+package jsonschema
+
+import (
+	"encoding/base64"
+	"math"
+	"net"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	hostnameRegexp = regexp.MustCompile(`^(?i:[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?)(\.(?i:[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?))*$`)
+	uuidRegexp     = regexp.MustCompile(`^(?i:[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12})$`)
+)
+
+// formats validates the values of the supported formats, values of other types are valid.
+// OpenAPI's float, double, binary and password formats are only annotations
+var formats = map[string]func(interface{}) bool{
+	"date-time": stringFormat(func(s string) bool {
+		_, err := time.Parse(time.RFC3339Nano, s)
+		return err == nil
+	}),
+	"date": stringFormat(func(s string) bool {
+		_, err := time.Parse("2006-01-02", s)
+		return err == nil
+	}),
+	"time": stringFormat(func(s string) bool {
+		_, err := time.Parse("15:04:05.999999999Z07:00", s)
+		return err == nil
+	}),
+	"email": stringFormat(func(s string) bool {
+		address, err := mail.ParseAddress(s)
+		return err == nil && address.Address == s
+	}),
+	"hostname": stringFormat(func(s string) bool {
+		return len(s) <= 253 && hostnameRegexp.MatchString(s)
+	}),
+	"ipv4": stringFormat(func(s string) bool {
+		ip := net.ParseIP(s)
+		return ip != nil && strings.Contains(s, ".") && !strings.Contains(s, ":")
+	}),
+	"ipv6": stringFormat(func(s string) bool {
+		return net.ParseIP(s) != nil && strings.Contains(s, ":")
+	}),
+	"uri": stringFormat(func(s string) bool {
+		u, err := url.Parse(s)
+		return err == nil && u.IsAbs()
+	}),
+	"uri-reference": stringFormat(func(s string) bool {
+		_, err := url.Parse(s)
+		return err == nil
+	}),
+	"uuid": stringFormat(uuidRegexp.MatchString),
+	"regex": stringFormat(func(s string) bool {
+		_, err := regexp.Compile(s)
+		return err == nil
+	}),
+	"byte": stringFormat(func(s string) bool {
+		_, err := base64.StdEncoding.DecodeString(s)
+		return err == nil
+	}),
+	"int32":    integerFormat(math.MinInt32, math.MaxInt32),
+	"int64":    integerFormat(math.MinInt64, math.MaxInt64),
+	"float":    anyFormat,
+	"double":   anyFormat,
+	"binary":   anyFormat,
+	"password": anyFormat,
+}
+
+func stringFormat(valid func(string) bool) func(interface{}) bool {
+	return func(v interface{}) bool {
+		s, ok := v.(string)
+		return !ok || valid(s)
+	}
+}
+
+func integerFormat(min float64, max float64) func(interface{}) bool {
+	return func(v interface{}) bool {
+		n, ok := v.(float64)
+		return !ok || (n == math.Trunc(n) && n >= min && n <= max)
+	}
+}
+
+func anyFormat(interface{}) bool {
+	return true
+}
@@ -0,0 +1,663 @@
+// Package jsonschema implements a validator for the subset of JSON Schema
+// (draft 7) that is commonly used to describe request payloads, including the
+// schemas of OpenAPI 3 documents.
+//
+// Supported keywords: type, enum, const, properties, patternProperties,
+// required, additionalProperties, minProperties, maxProperties, items,
+// minItems, maxItems, uniqueItems, minLength, maxLength, pattern, format,
+// minimum, maximum, exclusiveMinimum, exclusiveMaximum, multipleOf, allOf,
+// anyOf, oneOf, not, $ref and OpenAPI's nullable. References must point to
+// the same document, like #/definitions/product. Annotations such as title or
+// description are ignored, any other keyword fails to compile so schemas are
+// never validated partially.
+package jsonschema
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Schema is a compiled JSON schema
+type Schema struct {
+	types                []string
+	nullable             bool
+	enum                 []interface{}
+	constant             interface{}
+	hasConst             bool
+	properties           map[string]*Schema
+	patternProperties    []patternProperty
+	required             []string
+	minProperties        *int
+	maxProperties        *int
+	additionalProperties *Schema
+	noAdditional         bool
+	items                *Schema
+	minItems             *int
+	maxItems             *int
+	uniqueItems          bool
+	minLength            *int
+	maxLength            *int
+	pattern              *regexp.Regexp
+	format               string
+	minimum              *float64
+	maximum              *float64
+	exclusiveMinimum     *float64
+	exclusiveMaximum     *float64
+	multipleOf           *float64
+	allOf                []*Schema
+	anyOf                []*Schema
+	oneOf                []*Schema
+	not                  *Schema
+	alwaysFalse          bool
+}
+
+type patternProperty struct {
+	pattern *regexp.Regexp
+	schema  *Schema
+}
+
+// ValidationError describes why a document does not conform to a schema
+type ValidationError struct {
+	Path    string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	if e.Path == "" {
+		return e.Message
+	}
+	return fmt.Sprintf("%s: %s", e.Path, e.Message)
+}
+
+// ErrInvalidJSON is returned when the validated document is not valid JSON
+var ErrInvalidJSON = errors.New("invalid JSON document")
+
+// Compile parses a JSON schema document
+func Compile(data []byte) (*Schema, error) {
+	return CompileRef(data, "#")
+}
+
+// CompileRef parses the schema at a JSON pointer of a document, like
+// #/components/schemas/product, resolving its references against the document
+func CompileRef(data []byte, ref string) (*Schema, error) {
+	var root interface{}
+	if err := json.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("error parsing schema: %v", err)
+	}
+	c := &compiler{root: root, refs: make(map[string]*Schema)}
+	return c.compileRef(ref)
+}
+
+// Validate checks that a JSON document conforms to the schema
+func (s *Schema) Validate(data []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var doc interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidJSON, err)
+	}
+	if decoder.More() {
+		return fmt.Errorf("%w: unexpected data after top-level value", ErrInvalidJSON)
+	}
+	return s.validate(normalize(doc), "")
+}
+
+// annotations are keywords that do not affect validation
+var annotations = map[string]bool{
+	"$schema":       true,
+	"$id":           true,
+	"$comment":      true,
+	"title":         true,
+	"description":   true,
+	"default":       true,
+	"examples":      true,
+	"readOnly":      true,
+	"writeOnly":     true,
+	"definitions":   true,
+	"$defs":         true,
+	"deprecated":    true,
+	"example":       true,
+	"discriminator": true,
+	"xml":           true,
+	"externalDocs":  true,
+}
+
+// keywords are the validation keywords supported by the compiler
+var keywords = map[string]bool{
+	"type":                 true,
+	"nullable":             true,
+	"enum":                 true,
+	"const":                true,
+	"properties":           true,
+	"patternProperties":    true,
+	"required":             true,
+	"additionalProperties": true,
+	"minProperties":        true,
+	"maxProperties":        true,
+	"items":                true,
+	"minItems":             true,
+	"maxItems":             true,
+	"uniqueItems":          true,
+	"minLength":            true,
+	"maxLength":            true,
+	"pattern":              true,
+	"format":               true,
+	"minimum":              true,
+	"maximum":              true,
+	"exclusiveMinimum":     true,
+	"exclusiveMaximum":     true,
+	"multipleOf":           true,
+	"allOf":                true,
+	"anyOf":                true,
+	"oneOf":                true,
+	"not":                  true,
+	"$ref":                 true,
+}
+
+// compiler compiles the schemas of a document, every reference is compiled once
+// so recursive schemas refer to themselves
+type compiler struct {
+	root interface{}
+	refs map[string]*Schema
+}
+
+func (c *compiler) compileRef(ref string) (*Schema, error) {
+	if schema, ok := c.refs[ref]; ok {
+		return schema, nil
+	}
+	raw, err := resolvePointer(c.root, ref)
+	if err != nil {
+		return nil, err
+	}
+	schema := &Schema{}
+	c.refs[ref] = schema
+	compiled, err := c.compile(raw)
+	if err != nil {
+		delete(c.refs, ref)
+		return nil, err
+	}
+	*schema = *compiled
+	return schema, nil
+}
+
+func (c *compiler) compile(raw interface{}) (*Schema, error) {
+	switch v := raw.(type) {
+	case bool:
+		return &Schema{alwaysFalse: !v}, nil
+	case map[string]interface{}:
+		return c.compileObject(v)
+	default:
+		return nil, fmt.Errorf("schema must be an object or a boolean, got %T", raw)
+	}
+}
+
+func (c *compiler) compileObject(raw map[string]interface{}) (*Schema, error) {
+	names := make([]string, 0, len(raw))
+	for keyword := range raw {
+		names = append(names, keyword)
+	}
+	sort.Strings(names)
+	for _, keyword := range names {
+		if !keywords[keyword] && !annotations[keyword] && !strings.HasPrefix(keyword, "x-") {
+			return nil, fmt.Errorf("unsupported keyword '%s'", keyword)
+		}
+	}
+	// siblings of a reference are ignored, as in draft 7
+	if ref, ok := raw["$ref"]; ok {
+		name, ok := ref.(string)
+		if !ok {
+			return nil, errors.New("$ref must be a string")
+		}
+		schema, err := c.compileRef(name)
+		if err != nil {
+			return nil, fmt.Errorf("$ref %s: %v", name, err)
+		}
+		return schema, nil
+	}
+
+	s := &Schema{}
+	var err error
+
+	switch t := raw["type"].(type) {
+	case string:
+		s.types = []string{t}
+	case []interface{}:
+		for _, item := range t {
+			name, ok := item.(string)
+			if !ok {
+				return nil, errors.New("type must contain strings")
+			}
+			s.types = append(s.types, name)
+		}
+	}
+	if nullable, ok := raw["nullable"].(bool); ok {
+		s.nullable = nullable
+	}
+	if enum, ok := raw["enum"].([]interface{}); ok {
+		s.enum = enum
+	}
+	if constant, ok := raw["const"]; ok {
+		s.constant = constant
+		s.hasConst = true
+	}
+	if props, ok := raw["properties"].(map[string]interface{}); ok {
+		s.properties = make(map[string]*Schema, len(props))
+		for name, prop := range props {
+			if s.properties[name], err = c.compile(prop); err != nil {
+				return nil, fmt.Errorf("properties.%s: %v", name, err)
+			}
+		}
+	}
+	if props, ok := raw["patternProperties"].(map[string]interface{}); ok {
+		patterns := make([]string, 0, len(props))
+		for pattern := range props {
+			patterns = append(patterns, pattern)
+		}
+		sort.Strings(patterns)
+		for _, pattern := range patterns {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("patternProperties: %v", err)
+			}
+			schema, err := c.compile(props[pattern])
+			if err != nil {
+				return nil, fmt.Errorf("patternProperties.%s: %v", pattern, err)
+			}
+			s.patternProperties = append(s.patternProperties, patternProperty{re, schema})
+		}
+	}
+	if required, ok := raw["required"].([]interface{}); ok {
+		for _, r := range required {
+			name, ok := r.(string)
+			if !ok {
+				return nil, errors.New("required must contain strings")
+			}
+			s.required = append(s.required, name)
+		}
+	}
+	switch additional := raw["additionalProperties"].(type) {
+	case bool:
+		s.noAdditional = !additional
+	case map[string]interface{}:
+		if s.additionalProperties, err = c.compileObject(additional); err != nil {
+			return nil, fmt.Errorf("additionalProperties: %v", err)
+		}
+	}
+	s.minProperties = intKeyword(raw, "minProperties")
+	s.maxProperties = intKeyword(raw, "maxProperties")
+	if items, ok := raw["items"]; ok {
+		if s.items, err = c.compile(items); err != nil {
+			return nil, fmt.Errorf("items: %v", err)
+		}
+	}
+	if unique, ok := raw["uniqueItems"].(bool); ok {
+		s.uniqueItems = unique
+	}
+	s.minItems = intKeyword(raw, "minItems")
+	s.maxItems = intKeyword(raw, "maxItems")
+	s.minLength = intKeyword(raw, "minLength")
+	s.maxLength = intKeyword(raw, "maxLength")
+	if pattern, ok := raw["pattern"].(string); ok {
+		if s.pattern, err = regexp.Compile(pattern); err != nil {
+			return nil, fmt.Errorf("pattern: %v", err)
+		}
+	}
+	if format, ok := raw["format"].(string); ok {
+		if _, ok := formats[format]; !ok {
+			return nil, fmt.Errorf("unsupported format '%s'", format)
+		}
+		s.format = format
+	}
+	s.minimum = floatKeyword(raw, "minimum")
+	s.maximum = floatKeyword(raw, "maximum")
+	s.exclusiveMinimum = floatKeyword(raw, "exclusiveMinimum")
+	s.exclusiveMaximum = floatKeyword(raw, "exclusiveMaximum")
+	s.multipleOf = floatKeyword(raw, "multipleOf")
+
+	for keyword, target := range map[string]*[]*Schema{
+		"allOf": &s.allOf,
+		"anyOf": &s.anyOf,
+		"oneOf": &s.oneOf,
+	} {
+		list, ok := raw[keyword].([]interface{})
+		if !ok {
+			continue
+		}
+		for i, item := range list {
+			sub, err := c.compile(item)
+			if err != nil {
+				return nil, fmt.Errorf("%s[%d]: %v", keyword, i, err)
+			}
+			*target = append(*target, sub)
+		}
+	}
+	if not, ok := raw["not"]; ok {
+		if s.not, err = c.compile(not); err != nil {
+			return nil, fmt.Errorf("not: %v", err)
+		}
+	}
+
+	return s, nil
+}
+
+// resolvePointer resolves a JSON pointer fragment, as in RFC 6901, within a document
+func resolvePointer(root interface{}, ref string) (interface{}, error) {
+	if !strings.HasPrefix(ref, "#") {
+		return nil, errors.New("only references within the same document are supported")
+	}
+	pointer, err := url.PathUnescape(ref[1:])
+	if err != nil {
+		return nil, fmt.Errorf("invalid reference: %v", err)
+	}
+	if pointer == "" {
+		return root, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, errors.New("invalid reference: pointers must start with /")
+	}
+
+	current := root
+	for _, token := range strings.Split(pointer[1:], "/") {
+		token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+		switch v := current.(type) {
+		case map[string]interface{}:
+			next, ok := v[token]
+			if !ok {
+				return nil, errors.New("reference not found")
+			}
+			current = next
+		case []interface{}:
+			i, err := strconv.Atoi(token)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, errors.New("reference not found")
+			}
+			current = v[i]
+		default:
+			return nil, errors.New("reference not found")
+		}
+	}
+	return current, nil
+}
+
+func intKeyword(raw map[string]interface{}, keyword string) *int {
+	if v, ok := raw[keyword].(float64); ok {
+		i := int(v)
+		return &i
+	}
+	return nil
+}
+
+func floatKeyword(raw map[string]interface{}, keyword string) *float64 {
+	if v, ok := raw[keyword].(float64); ok {
+		return &v
+	}
+	return nil
+}
+
+// normalize converts json.Number values into float64 so that documents and
+// schema literals (enum, const) can be compared with reflect.DeepEqual
+func normalize(v interface{}) interface{} {
+	switch t := v.(type) {
+	case json.Number:
+		f, _ := t.Float64()
+		return f
+	case map[string]interface{}:
+		for k, item := range t {
+			t[k] = normalize(item)
+		}
+	case []interface{}:
+		for i, item := range t {
+			t[i] = normalize(item)
+		}
+	}
+	return v
+}
+
+func (s *Schema) validate(doc interface{}, path string) error {
+	if s.alwaysFalse {
+		return &ValidationError{path, "value is not allowed"}
+	}
+	if doc == nil && s.nullable {
+		return nil
+	}
+	if len(s.types) > 0 && !s.matchesType(doc) {
+		return &ValidationError{path, fmt.Sprintf("expected %s, got %s", strings.Join(s.types, " or "), typeOf(doc))}
+	}
+	if s.enum != nil && !containsValue(s.enum, doc) {
+		return &ValidationError{path, "value is not one of the allowed values"}
+	}
+	if s.hasConst && !reflect.DeepEqual(s.constant, doc) {
+		return &ValidationError{path, "value does not match the constant"}
+	}
+
+	var err error
+	switch v := doc.(type) {
+	case map[string]interface{}:
+		err = s.validateObject(v, path)
+	case []interface{}:
+		err = s.validateArray(v, path)
+	case string:
+		err = s.validateString(v, path)
+	case float64:
+		err = s.validateNumber(v, path)
+	}
+	if err != nil {
+		return err
+	}
+
+	return s.validateComposition(doc, path)
+}
+
+func (s *Schema) validateObject(obj map[string]interface{}, path string) error {
+	if s.minProperties != nil && len(obj) < *s.minProperties {
+		return &ValidationError{path, fmt.Sprintf("expected at least %d properties", *s.minProperties)}
+	}
+	if s.maxProperties != nil && len(obj) > *s.maxProperties {
+		return &ValidationError{path, fmt.Sprintf("expected at most %d properties", *s.maxProperties)}
+	}
+	for _, name := range s.required {
+		if _, ok := obj[name]; !ok {
+			return &ValidationError{path, fmt.Sprintf("missing required property '%s'", name)}
+		}
+	}
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		propPath := joinPath(path, name)
+		matched := false
+		if prop, ok := s.properties[name]; ok {
+			if err := prop.validate(obj[name], propPath); err != nil {
+				return err
+			}
+			matched = true
+		}
+		for _, prop := range s.patternProperties {
+			if !prop.pattern.MatchString(name) {
+				continue
+			}
+			if err := prop.schema.validate(obj[name], propPath); err != nil {
+				return err
+			}
+			matched = true
+		}
+		if matched {
+			continue
+		}
+		if s.noAdditional {
+			return &ValidationError{path, fmt.Sprintf("property '%s' is not allowed", name)}
+		}
+		if s.additionalProperties != nil {
+			if err := s.additionalProperties.validate(obj[name], propPath); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Schema) validateArray(arr []interface{}, path string) error {
+	if s.minItems != nil && len(arr) < *s.minItems {
+		return &ValidationError{path, fmt.Sprintf("expected at least %d items", *s.minItems)}
+	}
+	if s.maxItems != nil && len(arr) > *s.maxItems {
+		return &ValidationError{path, fmt.Sprintf("expected at most %d items", *s.maxItems)}
+	}
+	if s.uniqueItems {
+		for i := range arr {
+			for j := i + 1; j < len(arr); j++ {
+				if reflect.DeepEqual(arr[i], arr[j]) {
+					return &ValidationError{path, "items must be unique"}
+				}
+			}
+		}
+	}
+	if s.items != nil {
+		for i, item := range arr {
+			if err := s.items.validate(item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Schema) validateString(str string, path string) error {
+	length := utf8.RuneCountInString(str)
+	if s.minLength != nil && length < *s.minLength {
+		return &ValidationError{path, fmt.Sprintf("expected at least %d characters", *s.minLength)}
+	}
+	if s.maxLength != nil && length > *s.maxLength {
+		return &ValidationError{path, fmt.Sprintf("expected at most %d characters", *s.maxLength)}
+	}
+	if s.pattern != nil && !s.pattern.MatchString(str) {
+		return &ValidationError{path, fmt.Sprintf("does not match pattern '%s'", s.pattern)}
+	}
+	if s.format != "" && !formats[s.format](str) {
+		return &ValidationError{path, fmt.Sprintf("is not a valid %s", s.format)}
+	}
+	return nil
+}
+
+func (s *Schema) validateNumber(n float64, path string) error {
+	if s.minimum != nil && n < *s.minimum {
+		return &ValidationError{path, fmt.Sprintf("must be >= %v", *s.minimum)}
+	}
+	if s.maximum != nil && n > *s.maximum {
+		return &ValidationError{path, fmt.Sprintf("must be <= %v", *s.maximum)}
+	}
+	if s.exclusiveMinimum != nil && n <= *s.exclusiveMinimum {
+		return &ValidationError{path, fmt.Sprintf("must be > %v", *s.exclusiveMinimum)}
+	}
+	if s.exclusiveMaximum != nil && n >= *s.exclusiveMaximum {
+		return &ValidationError{path, fmt.Sprintf("must be < %v", *s.exclusiveMaximum)}
+	}
+	if s.format != "" && !formats[s.format](n) {
+		return &ValidationError{path, fmt.Sprintf("is not a valid %s", s.format)}
+	}
+	if s.multipleOf != nil && *s.multipleOf != 0 {
+		quotient := n / *s.multipleOf
+		if math.Abs(quotient-math.Round(quotient)) > 1e-9 {
+			return &ValidationError{path, fmt.Sprintf("must be a multiple of %v", *s.multipleOf)}
+		}
+	}
+	return nil
+}
+
+func (s *Schema) validateComposition(doc interface{}, path string) error {
+	for _, sub := range s.allOf {
+		if err := sub.validate(doc, path); err != nil {
+			return err
+		}
+	}
+	if len(s.anyOf) > 0 {
+		matched := false
+		for _, sub := range s.anyOf {
+			if sub.validate(doc, path) == nil {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return &ValidationError{path, "value does not match any of the allowed schemas"}
+		}
+	}
+	if len(s.oneOf) > 0 {
+		matches := 0
+		for _, sub := range s.oneOf {
+			if sub.validate(doc, path) == nil {
+				matches++
+			}
+		}
+		if matches != 1 {
+			return &ValidationError{path, "value must match exactly one of the allowed schemas"}
+		}
+	}
+	if s.not != nil && s.not.validate(doc, path) == nil {
+		return &ValidationError{path, "value matches a disallowed schema"}
+	}
+	return nil
+}
+
+func (s *Schema) matchesType(doc interface{}) bool {
+	actual := typeOf(doc)
+	for _, t := range s.types {
+		if t == actual {
+			return true
+		}
+		if t == "number" && actual == "integer" {
+			return true
+		}
+	}
+	return false
+}
+
+func typeOf(doc interface{}) string {
+	switch v := doc.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", doc)
+	}
+}
+
+func containsValue(values []interface{}, doc interface{}) bool {
+	for _, v := range values {
+		if reflect.DeepEqual(v, doc) {
+			return true
+		}
+	}
+	return false
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
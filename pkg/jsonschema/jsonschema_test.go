@@ -0,0 +1,271 @@
+package jsonschema
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const productSchema = `{
+	"type": "object",
+	"required": ["name", "price"],
+	"additionalProperties": false,
+	"properties": {
+		"name": {"type": "string", "minLength": 1, "maxLength": 20},
+		"price": {"type": "integer", "minimum": 0},
+		"color": {"enum": ["white", "black"]},
+		"sizes": {"type": "array", "items": {"type": "string", "pattern": "^[0-9]+$"}, "uniqueItems": true}
+	}
+}`
+
+func TestValidate(t *testing.T) {
+	schema, err := Compile([]byte(productSchema))
+	assert.Nil(t, err)
+
+	tests := []struct {
+		name    string
+		doc     string
+		wantErr string
+	}{
+		{
+			name: "Valid document",
+			doc:  `{"name": "sneakers", "price": 69000, "color": "white", "sizes": ["42", "43"]}`,
+		},
+		{
+			name:    "Missing required property",
+			doc:     `{"name": "sneakers"}`,
+			wantErr: "missing required property 'price'",
+		},
+		{
+			name:    "Wrong type",
+			doc:     `{"name": "sneakers", "price": "free"}`,
+			wantErr: "price: expected integer, got string",
+		},
+		{
+			name:    "Not an integer",
+			doc:     `{"name": "sneakers", "price": 1.5}`,
+			wantErr: "price: expected integer, got number",
+		},
+		{
+			name:    "Below minimum",
+			doc:     `{"name": "sneakers", "price": -1}`,
+			wantErr: "price: must be >= 0",
+		},
+		{
+			name:    "Additional property",
+			doc:     `{"name": "sneakers", "price": 1, "brand": "foo"}`,
+			wantErr: "property 'brand' is not allowed",
+		},
+		{
+			name:    "Enum",
+			doc:     `{"name": "sneakers", "price": 1, "color": "red"}`,
+			wantErr: "color: value is not one of the allowed values",
+		},
+		{
+			name:    "Array item pattern",
+			doc:     `{"name": "sneakers", "price": 1, "sizes": ["42", "XL"]}`,
+			wantErr: "sizes[1]: does not match pattern '^[0-9]+$'",
+		},
+		{
+			name:    "Unique items",
+			doc:     `{"name": "sneakers", "price": 1, "sizes": ["42", "42"]}`,
+			wantErr: "sizes: items must be unique",
+		},
+		{
+			name:    "Empty string",
+			doc:     `{"name": "", "price": 1}`,
+			wantErr: "name: expected at least 1 characters",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := schema.Validate([]byte(tt.doc))
+
+			if tt.wantErr == "" {
+				assert.Nil(t, err)
+				return
+			}
+			assert.EqualError(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestValidateComposition(t *testing.T) {
+	schema, err := Compile([]byte(`{
+		"oneOf": [
+			{"type": "object", "required": ["paths"]},
+			{"type": "object", "required": ["tags"]}
+		],
+		"not": {"type": "object", "required": ["all"]}
+	}`))
+	assert.Nil(t, err)
+
+	assert.Nil(t, schema.Validate([]byte(`{"tags": ["catalog"]}`)))
+	assert.EqualError(
+		t,
+		schema.Validate([]byte(`{"tags": [], "paths": []}`)),
+		"value must match exactly one of the allowed schemas",
+	)
+	assert.EqualError(
+		t,
+		schema.Validate([]byte(`{"tags": [], "all": true}`)),
+		"value matches a disallowed schema",
+	)
+}
+
+func TestValidateInvalidJSON(t *testing.T) {
+	schema, err := Compile([]byte(`{"type": "object"}`))
+	assert.Nil(t, err)
+
+	err = schema.Validate([]byte(`{"name": `))
+	assert.True(t, errors.Is(err, ErrInvalidJSON))
+
+	err = schema.Validate([]byte(`{} {}`))
+	assert.True(t, errors.Is(err, ErrInvalidJSON))
+}
+
+func TestValidateRef(t *testing.T) {
+	schema, err := Compile([]byte(`{
+		"$schema": "http://json-schema.org/draft-07/schema#",
+		"title": "Category",
+		"$ref": "#/definitions/category",
+		"definitions": {
+			"category": {
+				"type": "object",
+				"required": ["name"],
+				"properties": {
+					"name": {"type": "string"},
+					"children": {"type": "array", "items": {"$ref": "#/definitions/category"}}
+				}
+			}
+		}
+	}`))
+	assert.Nil(t, err)
+
+	assert.Nil(t, schema.Validate([]byte(`{"name": "shoes", "children": [{"name": "sneakers"}]}`)))
+	assert.EqualError(
+		t,
+		schema.Validate([]byte(`{"name": "shoes", "children": [{"name": "sneakers", "children": [{}]}]}`)),
+		"children[0].children[0]: missing required property 'name'",
+	)
+}
+
+func TestCompileRef(t *testing.T) {
+	document := []byte(`{
+		"openapi": "3.0.3",
+		"components": {
+			"schemas": {
+				"Product": {
+					"type": "object",
+					"required": ["id"],
+					"properties": {
+						"id": {"type": "integer", "format": "int32"},
+						"color": {"$ref": "#/components/schemas/Color"}
+					}
+				},
+				"Color": {"type": "string", "nullable": true, "example": "white"}
+			}
+		}
+	}`)
+
+	schema, err := CompileRef(document, "#/components/schemas/Product")
+	assert.Nil(t, err)
+	assert.Nil(t, schema.Validate([]byte(`{"id": 1, "color": null}`)))
+	assert.EqualError(t, schema.Validate([]byte(`{"id": 1, "color": 1}`)), "color: expected string, got integer")
+	assert.EqualError(t, schema.Validate([]byte(`{"id": 4294967296}`)), "id: is not a valid int32")
+
+	_, err = CompileRef(document, "#/components/schemas/Missing")
+	assert.NotNil(t, err)
+}
+
+func TestValidateFormat(t *testing.T) {
+	tests := []struct {
+		format  string
+		valid   string
+		invalid string
+	}{
+		{format: "date-time", valid: `"2022-06-01T10:00:00Z"`, invalid: `"2022-06-01 10:00"`},
+		{format: "date", valid: `"2022-06-01"`, invalid: `"01/06/2022"`},
+		{format: "email", valid: `"gotway@gotway.com"`, invalid: `"gotway"`},
+		{format: "uuid", valid: `"3d3a1c6e-8b4f-4d4e-9a8e-2f1b7c9d0e1f"`, invalid: `"3d3a1c6e"`},
+		{format: "ipv4", valid: `"10.0.0.1"`, invalid: `"::1"`},
+		{format: "uri", valid: `"https://gotway.com/products"`, invalid: `"/products"`},
+		{format: "int64", valid: `42`, invalid: `4.2`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			schema, err := Compile([]byte(`{"format": "` + tt.format + `"}`))
+			assert.Nil(t, err)
+
+			assert.Nil(t, schema.Validate([]byte(tt.valid)))
+			assert.EqualError(t, schema.Validate([]byte(tt.invalid)), "is not a valid "+tt.format)
+		})
+	}
+}
+
+func TestValidateProperties(t *testing.T) {
+	schema, err := Compile([]byte(`{
+		"type": "object",
+		"minProperties": 1,
+		"maxProperties": 2,
+		"patternProperties": {"^x-": {"type": "string"}},
+		"additionalProperties": false
+	}`))
+	assert.Nil(t, err)
+
+	assert.Nil(t, schema.Validate([]byte(`{"x-color": "white"}`)))
+	assert.EqualError(t, schema.Validate([]byte(`{}`)), "expected at least 1 properties")
+	assert.EqualError(t, schema.Validate([]byte(`{"x-a": "", "x-b": "", "x-c": ""}`)), "expected at most 2 properties")
+	assert.EqualError(t, schema.Validate([]byte(`{"x-color": 1}`)), "x-color: expected string, got integer")
+	assert.EqualError(t, schema.Validate([]byte(`{"color": "white"}`)), "property 'color' is not allowed")
+}
+
+func TestCompileError(t *testing.T) {
+	tests := []struct {
+		name    string
+		schema  string
+		wantErr string
+	}{
+		{
+			name:    "Invalid pattern",
+			schema:  `{"pattern": "("}`,
+			wantErr: "pattern: error parsing regexp: missing closing ): `(`",
+		},
+		{
+			name:    "Not a schema",
+			schema:  `"string"`,
+			wantErr: "schema must be an object or a boolean, got string",
+		},
+		{
+			name:    "Unsupported keyword",
+			schema:  `{"type": "object", "properties": {"size": {"if": {"type": "string"}}}}`,
+			wantErr: "properties.size: unsupported keyword 'if'",
+		},
+		{
+			name:    "Unsupported format",
+			schema:  `{"format": "color"}`,
+			wantErr: "unsupported format 'color'",
+		},
+		{
+			name:    "Remote reference",
+			schema:  `{"$ref": "https://gotway.com/product.json"}`,
+			wantErr: "$ref https://gotway.com/product.json: only references within the same document are supported",
+		},
+		{
+			name:    "Missing reference",
+			schema:  `{"items": {"$ref": "#/definitions/product"}}`,
+			wantErr: "items: $ref #/definitions/product: reference not found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Compile([]byte(tt.schema))
+
+			assert.EqualError(t, err, tt.wantErr)
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package configmap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gotway/gotway/pkg/log"
+	"github.com/gotway/gotway/pkg/metrics"
+
+	corev1 "k8s.io/api/core/v1"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+type Options struct {
+	// Namespace is the only namespace whose configmaps are watched
+	Namespace    string
+	ResyncPeriod time.Duration
+}
+
+var (
+	ErrConfigMapNotFound    = errors.New("configmap not found")
+	ErrConfigMapKeyNotFound = errors.New("configmap key not found")
+)
+
+type Store struct {
+	options           Options
+	configMapInformer cache.SharedIndexInformer
+	logger            log.Logger
+}
+
+func (s *Store) Run(ctx context.Context) error {
+	defer utilruntime.HandleCrash()
+
+	s.logger.Info("starting configmap informer")
+	go s.configMapInformer.Run(ctx.Done())
+
+	if !cache.WaitForCacheSync(ctx.Done(), s.configMapInformer.HasSynced) {
+		err := errors.New("failed to wait for configmap informer cache to sync")
+		utilruntime.HandleError(err)
+		return err
+	}
+	s.logger.Info("configmap informer ready")
+	metrics.InformerSynced.WithLabelValues("configmap").Set(1)
+	defer metrics.InformerSynced.WithLabelValues("configmap").Set(0)
+
+	<-ctx.Done()
+	s.logger.Info("stopping configmap informer")
+
+	return nil
+}
+
+// Get returns the value stored under key in the configmap namespace/name
+func (s *Store) Get(namespace, name, key string) (string, error) {
+	obj, exists, err := s.configMapInformer.GetIndexer().GetByKey(namespace + "/" + name)
+	if err != nil {
+		return "", err
+	}
+	if !exists {
+		return "", fmt.Errorf("%w: %s/%s", ErrConfigMapNotFound, namespace, name)
+	}
+	configMap, ok := obj.(*corev1.ConfigMap)
+	if !ok {
+		return "", fmt.Errorf("unexpected object %v", obj)
+	}
+	value, ok := configMap.Data[key]
+	if !ok {
+		return "", fmt.Errorf("%w: %s/%s[%s]", ErrConfigMapKeyNotFound, namespace, name, key)
+	}
+	return value, nil
+}
+
+func New(
+	options Options,
+	clientSet kubernetes.Interface,
+	logger log.Logger,
+) *Store {
+	informerFactory := informers.NewSharedInformerFactoryWithOptions(
+		clientSet,
+		options.ResyncPeriod,
+		informers.WithNamespace(options.Namespace),
+	)
+
+	return &Store{
+		options:           options,
+		configMapInformer: informerFactory.Core().V1().ConfigMaps().Informer(),
+		logger:            logger,
+	}
+}
@@ -0,0 +1,56 @@
+package configmap
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gotway/gotway/pkg/log"
+	"github.com/stretchr/testify/assert"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestGet(t *testing.T) {
+	clientSet := fake.NewSimpleClientset(
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "schemas", Namespace: "default"},
+			Data:       map[string]string{"product.json": `{"type": "object"}`},
+		},
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "schemas", Namespace: "catalog"},
+			Data:       map[string]string{"product.json": `{"type": "object"}`},
+		},
+	)
+	store := New(Options{Namespace: "default"}, clientSet, log.Log)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go store.Run(ctx)
+	assert.Eventually(t, func() bool {
+		return store.configMapInformer.HasSynced()
+	}, time.Second, 10*time.Millisecond)
+
+	value, err := store.Get("default", "schemas", "product.json")
+	assert.Nil(t, err)
+	assert.Equal(t, `{"type": "object"}`, value)
+
+	_, err = store.Get("default", "schemas", "missing.json")
+	assert.True(t, errors.Is(err, ErrConfigMapKeyNotFound))
+
+	// only the configmaps of its namespace are watched
+	_, err = store.Get("catalog", "schemas", "product.json")
+	assert.True(t, errors.Is(err, ErrConfigMapNotFound))
+
+	_, err = clientSet.CoreV1().ConfigMaps("default").Update(ctx, &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "schemas", Namespace: "default"},
+		Data:       map[string]string{"product.json": `{"type": "array"}`},
+	}, metav1.UpdateOptions{})
+	assert.Nil(t, err)
+	assert.Eventually(t, func() bool {
+		value, err := store.Get("default", "schemas", "product.json")
+		return err == nil && value == `{"type": "array"}`
+	}, time.Second, 10*time.Millisecond)
+}
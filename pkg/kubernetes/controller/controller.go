@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"regexp"
 	"sync"
 	"time"
 
@@ -11,6 +12,7 @@ import (
 	clientsetv1alpha1 "github.com/gotway/gotway/pkg/kubernetes/crd/v1alpha1/apis/clientset/versioned"
 	informersv1alpha1 "github.com/gotway/gotway/pkg/kubernetes/crd/v1alpha1/apis/informers/externalversions"
 	"github.com/gotway/gotway/pkg/log"
+	"github.com/gotway/gotway/pkg/metrics"
 
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/client-go/tools/cache"
@@ -54,6 +56,8 @@ func (c *Controller) Run(ctx context.Context) error {
 		return err
 	}
 	c.logger.Info("controller ready")
+	metrics.InformerSynced.WithLabelValues("ingresshttp").Set(1)
+	defer metrics.InformerSynced.WithLabelValues("ingresshttp").Set(0)
 
 	<-ctx.Done()
 	c.logger.Info("stopping controller")
@@ -61,6 +65,11 @@ func (c *Controller) Run(ctx context.Context) error {
 	return nil
 }
 
+// HasSynced determines if the ingresses have been listed from the cluster
+func (c *Controller) HasSynced() bool {
+	return c.ingresshttpInformer.HasSynced()
+}
+
 func (c *Controller) ListIngresses() ([]crdv1alpha1.IngressHTTP, error) {
 	c.ingressMux.RLock()
 	defer c.ingressMux.RUnlock()
@@ -76,20 +85,91 @@ func (c *Controller) ListIngresses() ([]crdv1alpha1.IngressHTTP, error) {
 	return ingresses, nil
 }
 
+// FindIngress returns the most specific ingress matching a request: exact paths take precedence
+// over path templates, which take precedence over path prefixes, the longest prefix winning
 func (c *Controller) FindIngress(matchFn IngressMatcher) (crdv1alpha1.IngressHTTP, error) {
 	c.ingressMux.RLock()
 	defer c.ingressMux.RUnlock()
 
+	var found *crdv1alpha1.IngressHTTP
 	for _, obj := range c.ingresshttpInformer.GetIndexer().List() {
-		if ingress, ok := obj.(*crdv1alpha1.IngressHTTP); ok {
-			if matchFn(ingress) {
-				return *ingress, nil
-			}
+		ingress, ok := obj.(*crdv1alpha1.IngressHTTP)
+		if !ok {
+			c.logger.Error(fmt.Sprintf("unexpected object %v", obj))
 			continue
 		}
-		c.logger.Error(fmt.Sprintf("unexpected object %v", obj))
+		if matchFn(ingress) && (found == nil || moreSpecific(ingress, found)) {
+			found = ingress
+		}
+	}
+	if found == nil {
+		return crdv1alpha1.IngressHTTP{}, ErrIngressNotFound
+	}
+	return *found, nil
+}
+
+const (
+	matchAny = iota
+	matchPrefix
+	matchTemplate
+	matchPath
+)
+
+var templateParam = regexp.MustCompile(`\{[^/{}]+\}`)
+
+// specificity ranks how many requests the match of an ingress excludes
+type specificity struct {
+	kind int
+	// params of the path template, the fewer the more specific
+	params int
+	// length of the literal part of the path, the prefix or the template
+	length int
+	// constraints on the method, host and port
+	constraints int
+}
+
+func getSpecificity(match crdv1alpha1.Match) specificity {
+	var s specificity
+	switch {
+	case match.Path != "":
+		s.kind = matchPath
+		s.length = len(match.Path)
+	case match.PathTemplate != "":
+		s.kind = matchTemplate
+		s.params = len(templateParam.FindAllString(match.PathTemplate, -1))
+		s.length = len(templateParam.ReplaceAllString(match.PathTemplate, ""))
+	case match.PathPrefix != "":
+		s.kind = matchPrefix
+		s.length = len(match.PathPrefix)
+	}
+	for _, constraint := range []string{match.Method, match.Host, match.Port} {
+		if constraint != "" {
+			s.constraints++
+		}
+	}
+	return s
+}
+
+// moreSpecific determines if an ingress should be chosen over another one matching the same request.
+// Ties are broken by namespace and name, so the same ingress is always chosen
+func moreSpecific(a, b *crdv1alpha1.IngressHTTP) bool {
+	sa, sb := getSpecificity(a.Spec.Match), getSpecificity(b.Spec.Match)
+	if sa.kind != sb.kind {
+		return sa.kind > sb.kind
+	}
+	if sa.params != sb.params {
+		return sa.params < sb.params
+	}
+	if sa.length != sb.length {
+		return sa.length > sb.length
+	}
+	if sa.constraints != sb.constraints {
+		return sa.constraints > sb.constraints
+	}
+	if a.Namespace != b.Namespace {
+		return a.Namespace < b.Namespace
 	}
-	return crdv1alpha1.IngressHTTP{}, ErrIngressNotFound
+	return a.Name < b.Name
 }
 
 func (c *Controller) UpdateIngressStatus(
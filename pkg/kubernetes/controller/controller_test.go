@@ -0,0 +1,103 @@
+package controller
+
+import (
+	"testing"
+
+	crdv1alpha1 "github.com/gotway/gotway/pkg/kubernetes/crd/v1alpha1"
+	"github.com/gotway/gotway/pkg/kubernetes/crd/v1alpha1/apis/clientset/versioned/fake"
+	"github.com/gotway/gotway/pkg/log"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newIngress(name string, match crdv1alpha1.Match) *crdv1alpha1.IngressHTTP {
+	return &crdv1alpha1.IngressHTTP{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Spec:       crdv1alpha1.IngressHTTPSpec{Match: match},
+	}
+}
+
+func TestFindIngress(t *testing.T) {
+	tests := []struct {
+		name      string
+		ingresses []*crdv1alpha1.IngressHTTP
+		wantName  string
+	}{
+		{
+			name: "Path over template",
+			ingresses: []*crdv1alpha1.IngressHTTP{
+				newIngress("product", crdv1alpha1.Match{PathTemplate: "/products/{id}"}),
+				newIngress("featured", crdv1alpha1.Match{Path: "/products/featured"}),
+				newIngress("catalog", crdv1alpha1.Match{PathPrefix: "/products"}),
+			},
+			wantName: "featured",
+		},
+		{
+			name: "Template over prefix",
+			ingresses: []*crdv1alpha1.IngressHTTP{
+				newIngress("catalog", crdv1alpha1.Match{PathPrefix: "/products/featured"}),
+				newIngress("product", crdv1alpha1.Match{PathTemplate: "/products/{id}"}),
+			},
+			wantName: "product",
+		},
+		{
+			name: "Template with fewer params",
+			ingresses: []*crdv1alpha1.IngressHTTP{
+				newIngress("any", crdv1alpha1.Match{PathTemplate: "/{resource}/{id}"}),
+				newIngress("product", crdv1alpha1.Match{PathTemplate: "/products/{id}"}),
+			},
+			wantName: "product",
+		},
+		{
+			name: "Longest prefix",
+			ingresses: []*crdv1alpha1.IngressHTTP{
+				newIngress("root", crdv1alpha1.Match{}),
+				newIngress("catalog", crdv1alpha1.Match{PathPrefix: "/products"}),
+				newIngress("featured", crdv1alpha1.Match{PathPrefix: "/products/featured"}),
+				newIngress("api", crdv1alpha1.Match{PathPrefix: "/"}),
+			},
+			wantName: "featured",
+		},
+		{
+			name: "More constraints",
+			ingresses: []*crdv1alpha1.IngressHTTP{
+				newIngress("catalog", crdv1alpha1.Match{PathPrefix: "/products"}),
+				newIngress("catalog-get", crdv1alpha1.Match{PathPrefix: "/products", Method: "GET"}),
+			},
+			wantName: "catalog-get",
+		},
+		{
+			name: "Same specificity",
+			ingresses: []*crdv1alpha1.IngressHTTP{
+				newIngress("catalog-b", crdv1alpha1.Match{PathPrefix: "/products"}),
+				newIngress("catalog-a", crdv1alpha1.Match{PathPrefix: "/products"}),
+			},
+			wantName: "catalog-a",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := New(Options{}, fake.NewSimpleClientset(), log.Log)
+			for _, ingress := range tt.ingresses {
+				assert.Nil(t, c.ingresshttpInformer.GetIndexer().Add(ingress))
+			}
+
+			ingress, err := c.FindIngress(func(*crdv1alpha1.IngressHTTP) bool { return true })
+
+			assert.Nil(t, err)
+			assert.Equal(t, tt.wantName, ingress.Name)
+		})
+	}
+}
+
+func TestFindIngressNotFound(t *testing.T) {
+	c := New(Options{}, fake.NewSimpleClientset(), log.Log)
+	assert.Nil(t, c.ingresshttpInformer.GetIndexer().Add(
+		newIngress("catalog", crdv1alpha1.Match{PathPrefix: "/products"}),
+	))
+
+	_, err := c.FindIngress(func(*crdv1alpha1.IngressHTTP) bool { return false })
+
+	assert.ErrorIs(t, err, ErrIngressNotFound)
+}
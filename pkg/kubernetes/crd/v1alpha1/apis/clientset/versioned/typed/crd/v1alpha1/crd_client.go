@@ -34,6 +34,7 @@ import (
 
 type GotwayV1alpha1Interface interface {
 	RESTClient() rest.Interface
+	CacheInvalidationsGetter
 	IngressHTTPsGetter
 }
 
@@ -42,6 +43,10 @@ type GotwayV1alpha1Client struct {
 	restClient rest.Interface
 }
 
+func (c *GotwayV1alpha1Client) CacheInvalidations(namespace string) CacheInvalidationInterface {
+	return newCacheInvalidations(c, namespace)
+}
+
 func (c *GotwayV1alpha1Client) IngressHTTPs(namespace string) IngressHTTPInterface {
 	return newIngressHTTPs(c, namespace)
 }
@@ -0,0 +1,150 @@
+/*
+MIT License
+
+Copyright (c) 2021 Gotway
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+// Code generated by client-gen. DO NOT EDIT.
+
+package fake
+
+import (
+	"context"
+
+	v1alpha1 "github.com/gotway/gotway/pkg/kubernetes/crd/v1alpha1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	labels "k8s.io/apimachinery/pkg/labels"
+	schema "k8s.io/apimachinery/pkg/runtime/schema"
+	types "k8s.io/apimachinery/pkg/types"
+	watch "k8s.io/apimachinery/pkg/watch"
+	testing "k8s.io/client-go/testing"
+)
+
+// FakeCacheInvalidations implements CacheInvalidationInterface
+type FakeCacheInvalidations struct {
+	Fake *FakeGotwayV1alpha1
+	ns   string
+}
+
+var cacheinvalidationsResource = schema.GroupVersionResource{Group: "gotway.io", Version: "v1alpha1", Resource: "cacheinvalidations"}
+
+var cacheinvalidationsKind = schema.GroupVersionKind{Group: "gotway.io", Version: "v1alpha1", Kind: "CacheInvalidation"}
+
+// Get takes name of the cacheInvalidation, and returns the corresponding cacheInvalidation object, and an error if there is any.
+func (c *FakeCacheInvalidations) Get(ctx context.Context, name string, options v1.GetOptions) (result *v1alpha1.CacheInvalidation, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewGetAction(cacheinvalidationsResource, c.ns, name), &v1alpha1.CacheInvalidation{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.CacheInvalidation), err
+}
+
+// List takes label and field selectors, and returns the list of CacheInvalidations that match those selectors.
+func (c *FakeCacheInvalidations) List(ctx context.Context, opts v1.ListOptions) (result *v1alpha1.CacheInvalidationList, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewListAction(cacheinvalidationsResource, cacheinvalidationsKind, c.ns, opts), &v1alpha1.CacheInvalidationList{})
+
+	if obj == nil {
+		return nil, err
+	}
+
+	label, _, _ := testing.ExtractFromListOptions(opts)
+	if label == nil {
+		label = labels.Everything()
+	}
+	list := &v1alpha1.CacheInvalidationList{ListMeta: obj.(*v1alpha1.CacheInvalidationList).ListMeta}
+	for _, item := range obj.(*v1alpha1.CacheInvalidationList).Items {
+		if label.Matches(labels.Set(item.Labels)) {
+			list.Items = append(list.Items, item)
+		}
+	}
+	return list, err
+}
+
+// Watch returns a watch.Interface that watches the requested cacheInvalidations.
+func (c *FakeCacheInvalidations) Watch(ctx context.Context, opts v1.ListOptions) (watch.Interface, error) {
+	return c.Fake.
+		InvokesWatch(testing.NewWatchAction(cacheinvalidationsResource, c.ns, opts))
+
+}
+
+// Create takes the representation of a cacheInvalidation and creates it.  Returns the server's representation of the cacheInvalidation, and an error, if there is any.
+func (c *FakeCacheInvalidations) Create(ctx context.Context, cacheInvalidation *v1alpha1.CacheInvalidation, opts v1.CreateOptions) (result *v1alpha1.CacheInvalidation, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewCreateAction(cacheinvalidationsResource, c.ns, cacheInvalidation), &v1alpha1.CacheInvalidation{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.CacheInvalidation), err
+}
+
+// Update takes the representation of a cacheInvalidation and updates it. Returns the server's representation of the cacheInvalidation, and an error, if there is any.
+func (c *FakeCacheInvalidations) Update(ctx context.Context, cacheInvalidation *v1alpha1.CacheInvalidation, opts v1.UpdateOptions) (result *v1alpha1.CacheInvalidation, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewUpdateAction(cacheinvalidationsResource, c.ns, cacheInvalidation), &v1alpha1.CacheInvalidation{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.CacheInvalidation), err
+}
+
+// UpdateStatus was generated because the type contains a Status member.
+// Add a +genclient:noStatus comment above the type to avoid generating UpdateStatus().
+func (c *FakeCacheInvalidations) UpdateStatus(ctx context.Context, cacheInvalidation *v1alpha1.CacheInvalidation, opts v1.UpdateOptions) (*v1alpha1.CacheInvalidation, error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewUpdateSubresourceAction(cacheinvalidationsResource, "status", c.ns, cacheInvalidation), &v1alpha1.CacheInvalidation{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.CacheInvalidation), err
+}
+
+// Delete takes name of the cacheInvalidation and deletes it. Returns an error if one occurs.
+func (c *FakeCacheInvalidations) Delete(ctx context.Context, name string, opts v1.DeleteOptions) error {
+	_, err := c.Fake.
+		Invokes(testing.NewDeleteAction(cacheinvalidationsResource, c.ns, name), &v1alpha1.CacheInvalidation{})
+
+	return err
+}
+
+// DeleteCollection deletes a collection of objects.
+func (c *FakeCacheInvalidations) DeleteCollection(ctx context.Context, opts v1.DeleteOptions, listOpts v1.ListOptions) error {
+	action := testing.NewDeleteCollectionAction(cacheinvalidationsResource, c.ns, listOpts)
+
+	_, err := c.Fake.Invokes(action, &v1alpha1.CacheInvalidationList{})
+	return err
+}
+
+// Patch applies the patch and returns the patched cacheInvalidation.
+func (c *FakeCacheInvalidations) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts v1.PatchOptions, subresources ...string) (result *v1alpha1.CacheInvalidation, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewPatchSubresourceAction(cacheinvalidationsResource, c.ns, name, pt, data, subresources...), &v1alpha1.CacheInvalidation{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.CacheInvalidation), err
+}
@@ -36,6 +36,10 @@ type FakeGotwayV1alpha1 struct {
 	*testing.Fake
 }
 
+func (c *FakeGotwayV1alpha1) CacheInvalidations(namespace string) v1alpha1.CacheInvalidationInterface {
+	return &FakeCacheInvalidations{c, namespace}
+}
+
 func (c *FakeGotwayV1alpha1) IngressHTTPs(namespace string) v1alpha1.IngressHTTPInterface {
 	return &FakeIngressHTTPs{c, namespace}
 }
@@ -26,4 +26,6 @@ SOFTWARE.
 
 package v1alpha1
 
+type CacheInvalidationExpansion interface{}
+
 type IngressHTTPExpansion interface{}
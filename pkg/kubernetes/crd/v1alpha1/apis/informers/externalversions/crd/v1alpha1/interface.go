@@ -32,6 +32,8 @@ import (
 
 // Interface provides access to all the informers in this group version.
 type Interface interface {
+	// CacheInvalidations returns a CacheInvalidationInformer.
+	CacheInvalidations() CacheInvalidationInformer
 	// IngressHTTPs returns a IngressHTTPInformer.
 	IngressHTTPs() IngressHTTPInformer
 }
@@ -47,6 +49,11 @@ func New(f internalinterfaces.SharedInformerFactory, namespace string, tweakList
 	return &version{factory: f, namespace: namespace, tweakListOptions: tweakListOptions}
 }
 
+// CacheInvalidations returns a CacheInvalidationInformer.
+func (v *version) CacheInvalidations() CacheInvalidationInformer {
+	return &cacheInvalidationInformer{factory: v.factory, namespace: v.namespace, tweakListOptions: v.tweakListOptions}
+}
+
 // IngressHTTPs returns a IngressHTTPInformer.
 func (v *version) IngressHTTPs() IngressHTTPInformer {
 	return &ingressHTTPInformer{factory: v.factory, namespace: v.namespace, tweakListOptions: v.tweakListOptions}
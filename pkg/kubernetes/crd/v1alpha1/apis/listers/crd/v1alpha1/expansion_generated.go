@@ -26,6 +26,14 @@ SOFTWARE.
 
 package v1alpha1
 
+// CacheInvalidationListerExpansion allows custom methods to be added to
+// CacheInvalidationLister.
+type CacheInvalidationListerExpansion interface{}
+
+// CacheInvalidationNamespaceListerExpansion allows custom methods to be added to
+// CacheInvalidationNamespaceLister.
+type CacheInvalidationNamespaceListerExpansion interface{}
+
 // IngressHTTPListerExpansion allows custom methods to be added to
 // IngressHTTPLister.
 type IngressHTTPListerExpansion interface{}
@@ -0,0 +1,50 @@
+package v1alpha1
+
+import metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+type CacheInvalidationPhase string
+
+const (
+	CacheInvalidationRunning   CacheInvalidationPhase = "Running"
+	CacheInvalidationCompleted CacheInvalidationPhase = "Completed"
+	CacheInvalidationFailed    CacheInvalidationPhase = "Failed"
+)
+
+// CacheInvalidationSpec selects the caches of a service to delete,
+// caches matching any of the paths, prefixes or tags are deleted
+type CacheInvalidationSpec struct {
+	Service  string   `json:"service"`
+	Paths    []string `json:"paths,omitempty"`
+	Prefixes []string `json:"prefixes,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+}
+
+type CacheInvalidationStatus struct {
+	Phase CacheInvalidationPhase `json:"phase,omitempty"`
+	// ObservedGeneration is the generation of the spec that was executed,
+	// changing the spec executes the invalidation again
+	ObservedGeneration int64        `json:"observedGeneration,omitempty"`
+	Deleted            int64        `json:"deleted"`
+	Errors             []string     `json:"errors,omitempty"`
+	StartTime          *metav1.Time `json:"startTime,omitempty"`
+	CompletionTime     *metav1.Time `json:"completionTime,omitempty"`
+}
+
+// +genclient
+// +k8s:deepcopy-gen=true
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type CacheInvalidation struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata"`
+
+	Spec   CacheInvalidationSpec   `json:"spec"`
+	Status CacheInvalidationStatus `json:"status"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type CacheInvalidationList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+
+	Items []CacheInvalidation `json:"items"`
+}
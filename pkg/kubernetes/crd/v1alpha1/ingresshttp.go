@@ -3,11 +3,12 @@ package v1alpha1
 import metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 type Match struct {
-	Method     string `json:"method"`
-	Host       string `json:"host"`
-	Port       string `json:"port"`
-	Path       string `json:"path"`
-	PathPrefix string `json:"pathPrefix"`
+	Method       string `json:"method"`
+	Host         string `json:"host"`
+	Port         string `json:"port"`
+	Path         string `json:"path"`
+	PathPrefix   string `json:"pathPrefix"`
+	PathTemplate string `json:"pathTemplate,omitempty"`
 }
 
 type Service struct {
@@ -17,15 +18,105 @@ type Service struct {
 }
 
 type Cache struct {
-	TTL      int64    `json:"ttl"`
-	Statuses []int    `json:"statuses"`
-	Tags     []string `json:"tags"`
+	TTL      int64     `json:"ttl"`
+	Statuses []int     `json:"statuses"`
+	Tags     []string  `json:"tags"`
+	Key      *CacheKey `json:"key,omitempty"`
+	// StaleWhileRevalidate and StaleIfError are defaults in seconds, used when
+	// the Cache-Control header of the response does not define them
+	StaleWhileRevalidate int64 `json:"staleWhileRevalidate,omitempty"`
+	StaleIfError         int64 `json:"staleIfError,omitempty"`
+	// IgnoreOriginHeaders caches responses regardless of their Cache-Control and Expires headers
+	IgnoreOriginHeaders bool             `json:"ignoreOriginHeaders,omitempty"`
+	Invalidate          *CacheInvalidate `json:"invalidate,omitempty"`
+	Limits              *CacheLimits     `json:"limits,omitempty"`
+	Warming             *CacheWarming    `json:"warming,omitempty"`
+}
+
+// CacheWarming lists the paths that are cached on startup and refreshed before they expire
+type CacheWarming struct {
+	Paths []string `json:"paths,omitempty"`
+	// SitemapURL is a sitemap whose locations are warmed too, relative URLs are requested to the service
+	SitemapURL string `json:"sitemapURL,omitempty"`
+}
+
+// CacheLimits override the default limits of the gateway for a service, zero values keep the defaults
+type CacheLimits struct {
+	// MaxEntryBytes is the size of the largest response body that is cached
+	MaxEntryBytes int64 `json:"maxEntryBytes,omitempty"`
+	// MaxBytes and MaxEntries bound the caches of the service, evicting the ones closest to expire
+	MaxBytes   int64 `json:"maxBytes,omitempty"`
+	MaxEntries int64 `json:"maxEntries,omitempty"`
+}
+
+// CacheInvalidate purges caches when a request with an unsafe method succeeds
+type CacheInvalidate struct {
+	Enabled bool `json:"enabled"`
+	// Paths and Tags are purged along with the path of the request
+	Paths []string `json:"paths,omitempty"`
+	Tags  []string `json:"tags,omitempty"`
+}
+
+// CacheKey customizes which parts of a request identify a cached response
+type CacheKey struct {
+	Headers []string `json:"headers,omitempty"`
+	Cookies []string `json:"cookies,omitempty"`
+	// QueryParams restricts the query parameters that are part of the key, all of them are used when empty
+	QueryParams []string `json:"queryParams,omitempty"`
+	// IgnoredQueryParams are left out of the key, a trailing * matches by prefix, e.g. utm_*
+	IgnoredQueryParams []string `json:"ignoredQueryParams,omitempty"`
+}
+
+type Limits struct {
+	MaxRequestBodyBytes int64 `json:"maxRequestBodyBytes"`
+	MaxHeaderBytes      int64 `json:"maxHeaderBytes"`
+	MaxURLLength        int64 `json:"maxURLLength"`
+}
+
+type ConfigMapKeyRef struct {
+	Name string `json:"name"`
+	Key  string `json:"key"`
+}
+
+const (
+	ValidationModeJSONSchema = "jsonSchema"
+	ValidationModeOpenAPI    = "openAPI"
+)
+
+type Validation struct {
+	// Mode is jsonSchema, the default, or openAPI
+	Mode string `json:"mode,omitempty"`
+	// JSONSchema validates request bodies in jsonSchema mode
+	JSONSchema string `json:"jsonSchema,omitempty"`
+	// OpenAPI is a document in JSON or YAML whose operations validate request bodies in openAPI mode
+	OpenAPI string `json:"openAPI,omitempty"`
+	// ConfigMapRef holds the schema or the document instead, depending on the mode
+	ConfigMapRef *ConfigMapKeyRef `json:"configMapRef,omitempty"`
+}
+
+type Compression struct {
+	// Enabled overrides the global setting, which applies when it is not set
+	Enabled      *bool    `json:"enabled,omitempty"`
+	MinSize      int64    `json:"minSize,omitempty"`
+	ContentTypes []string `json:"contentTypes,omitempty"`
+	Level        int      `json:"level,omitempty"`
+}
+
+type Errors struct {
+	Format      string           `json:"format,omitempty"`
+	TemplateRef *ConfigMapKeyRef `json:"templateRef,omitempty"`
+	// InterceptUpstream overrides the global setting, which applies when it is not set
+	InterceptUpstream *bool `json:"interceptUpstream,omitempty"`
 }
 
 type IngressHTTPSpec struct {
-	Match   Match   `json:"match"`
-	Service Service `json:"service"`
-	Cache   Cache   `json:"cache"`
+	Match       Match        `json:"match"`
+	Service     Service      `json:"service"`
+	Cache       Cache        `json:"cache"`
+	Limits      *Limits      `json:"limits,omitempty"`
+	Validation  *Validation  `json:"validation,omitempty"`
+	Compression *Compression `json:"compression,omitempty"`
+	Errors      *Errors      `json:"errors,omitempty"`
 }
 
 type IngressHTTPStatus struct {
@@ -25,6 +25,8 @@ func addKnownTypes(scheme *runtime.Scheme) error {
 	scheme.AddKnownTypes(SchemeGroupVersion,
 		&IngressHTTP{},
 		&IngressHTTPList{},
+		&CacheInvalidation{},
+		&CacheInvalidationList{},
 	)
 	metav1.AddToGroupVersion(scheme, SchemeGroupVersion)
 
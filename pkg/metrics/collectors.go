@@ -0,0 +1,128 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "gotway"
+
+const (
+	CacheHit        = "hit"
+	CacheMiss       = "miss"
+	CacheStore      = "store"
+	CacheEvict      = "evict"
+	CachePurge      = "purge"
+	CacheRevalidate = "revalidate"
+	CacheCoalesce   = "coalesce"
+)
+
+const (
+	CacheRejectEntrySize = "entry_size"
+	CacheRejectQuota     = "quota"
+	CacheRejectBudget    = "budget"
+)
+
+const (
+	CacheDropQueueFull = "queue_full"
+	CacheDropShutdown  = "shutdown"
+)
+
+const (
+	CacheWarmed     = "warmed"
+	CacheWarmFailed = "failed"
+)
+
+const (
+	CacheTierMemory = "memory"
+	CacheTierRedis  = "redis"
+	CacheTierDisk   = "disk"
+)
+
+var (
+	Requests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "requests_total",
+		Help:      "Number of requests handled by the gateway.",
+	}, []string{"ingress", "service", "method", "status"})
+
+	RequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "request_duration_seconds",
+		Help:      "Latency of the requests handled by the gateway.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"ingress", "service", "method", "status"})
+
+	UpstreamDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "upstream_duration_seconds",
+		Help:      "Latency of the requests sent to upstream services.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"service", "method", "status"})
+
+	CacheOperations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_operations_total",
+		Help:      "Number of cache operations by result: hit, miss, store, evict or purge.",
+	}, []string{"service", "operation"})
+
+	CacheRejections = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_rejections_total",
+		Help:      "Number of responses not cached because of a limit: entry_size, quota or budget.",
+	}, []string{"service", "reason"})
+
+	CacheDrops = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_dropped_total",
+		Help:      "Number of responses not cached because they could not be queued: queue_full or shutdown.",
+	}, []string{"service", "reason"})
+
+	CacheWarms = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_warms_total",
+		Help:      "Number of paths requested to warm the cache by result: warmed or failed.",
+	}, []string{"service", "result"})
+
+	CacheTierLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_tier_lookups_total",
+		Help:      "Number of cache lookups by tier and result: hit or miss.",
+	}, []string{"tier", "result"})
+
+	CacheMemoryBytes = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "cache_memory_bytes",
+		Help:      "Approximate size of the caches kept in memory.",
+	})
+
+	CacheMemoryEvictions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_memory_evictions_total",
+		Help:      "Number of caches evicted from the in-memory tier to make room, they are still kept in redis.",
+	}, []string{"service"})
+
+	HealthChecks = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "health_checks_total",
+		Help:      "Number of health checks performed by service and result.",
+	}, []string{"service", "result"})
+
+	ServiceHealthy = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "service_healthy",
+		Help:      "Whether a service passed its last health check.",
+	}, []string{"service"})
+
+	QueueDepth = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "queue_depth",
+		Help:      "Number of items waiting in a worker queue.",
+	}, []string{"queue"})
+
+	InformerSynced = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "informer_synced",
+		Help:      "Whether a Kubernetes informer cache has synced.",
+	}, []string{"informer"})
+)
@@ -0,0 +1,131 @@
+package redis
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	ModeStandalone = "standalone"
+	ModeSentinel   = "sentinel"
+	ModeCluster    = "cluster"
+)
+
+type TLSOptions struct {
+	Enabled bool
+	// CAFile verifies the server certificate instead of the system roots
+	CAFile string
+	// CertFile and KeyFile authenticate the client
+	CertFile string
+	KeyFile  string
+	// ServerName defaults to the host of every address
+	ServerName         string
+	InsecureSkipVerify bool
+}
+
+type Options struct {
+	Mode string
+	// URL configures a standalone server, Username, Password and TLS override it when set
+	URL string
+	// Addrs are the sentinels or the cluster nodes used to discover the rest of them
+	Addrs []string
+	// MasterName is the name of the master monitored by the sentinels
+	MasterName       string
+	Username         string
+	Password         string
+	SentinelPassword string
+	// DB is ignored by clusters, which only have one database
+	DB  int
+	TLS TLSOptions
+}
+
+var ErrNoAddrs = errors.New("redis addresses should be specified")
+
+// NewUniversalClient creates a client for a standalone server, a sentinel monitored master or a cluster
+func NewUniversalClient(options Options) (redis.UniversalClient, error) {
+	tlsConfig, err := getTLSConfig(options.TLS)
+	if err != nil {
+		return nil, fmt.Errorf("error getting redis TLS config %v", err)
+	}
+
+	switch options.Mode {
+	case ModeStandalone, "":
+		opts, err := redis.ParseURL(options.URL)
+		if err != nil {
+			return nil, fmt.Errorf("error getting redis options %v", err)
+		}
+		if options.Username != "" {
+			opts.Username = options.Username
+		}
+		if options.Password != "" {
+			opts.Password = options.Password
+		}
+		if tlsConfig != nil {
+			opts.TLSConfig = tlsConfig
+		}
+		return redis.NewClient(opts), nil
+	case ModeSentinel:
+		if len(options.Addrs) == 0 {
+			return nil, ErrNoAddrs
+		}
+		if options.MasterName == "" {
+			return nil, errors.New("redis sentinel master name should be specified")
+		}
+		return redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:       options.MasterName,
+			SentinelAddrs:    options.Addrs,
+			SentinelPassword: options.SentinelPassword,
+			Username:         options.Username,
+			Password:         options.Password,
+			DB:               options.DB,
+			TLSConfig:        tlsConfig,
+		}), nil
+	case ModeCluster:
+		if len(options.Addrs) == 0 {
+			return nil, ErrNoAddrs
+		}
+		return redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:     options.Addrs,
+			Username:  options.Username,
+			Password:  options.Password,
+			TLSConfig: tlsConfig,
+		}), nil
+	default:
+		return nil, fmt.Errorf("unknown redis mode %s", options.Mode)
+	}
+}
+
+func getTLSConfig(options TLSOptions) (*tls.Config, error) {
+	if !options.Enabled {
+		return nil, nil
+	}
+	config := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         options.ServerName,
+		InsecureSkipVerify: options.InsecureSkipVerify,
+	}
+	if options.CAFile != "" {
+		ca, err := ioutil.ReadFile(options.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("invalid CA file %s", options.CAFile)
+		}
+		config.RootCAs = pool
+	}
+	if options.CertFile != "" || options.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(options.CertFile, options.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
@@ -8,8 +8,10 @@ import (
 	"github.com/go-redis/redis/v8"
 )
 
+// Client wraps a standalone, sentinel or cluster client. In a cluster, the keys of multi-key
+// commands and transactions should share a hash tag so they belong to the same slot
 type Client struct {
-	*redis.Client
+	redis.UniversalClient
 }
 
 type Cmdable interface {
@@ -36,6 +38,7 @@ type Cmdable interface {
 		ctx context.Context,
 		keys ...string,
 	) (allExist bool, notExistsIndex int, err error)
+	Subscribe(ctx context.Context, channels ...string) *redis.PubSub
 }
 
 type RedisTxFn = func(*redis.Tx) error
@@ -94,11 +97,12 @@ func (r *Client) SAddTTL(
 	return err
 }
 
+// AllExist checks the keys in a pipeline rather than a transaction, so they may belong to different slots
 func (r *Client) AllExist(
 	ctx context.Context,
 	keys ...string,
 ) (allExist bool, notExistsIndex int, err error) {
-	pipe := r.TxPipeline()
+	pipe := r.Pipeline()
 	cmds := make([]*redis.IntCmd, len(keys))
 
 	for i, key := range keys {
@@ -127,6 +131,6 @@ func AnyEmptyErr(errs ...error) bool {
 	return false
 }
 
-func New(client *redis.Client) Cmdable {
+func New(client redis.UniversalClient) Cmdable {
 	return &Client{client}
 }
@@ -0,0 +1,121 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/gotway/gotway/pkg/log"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// ExporterOTLP sends spans to an OpenTelemetry collector using OTLP over gRPC
+	ExporterOTLP = "otlp"
+	// ExporterStdout writes spans to stdout, useful for testing without a collector
+	ExporterStdout = "stdout"
+
+	SamplerAlwaysOn     = "always_on"
+	SamplerAlwaysOff    = "always_off"
+	SamplerTraceIDRatio = "traceidratio"
+)
+
+type Options struct {
+	ServiceName  string
+	Exporter     string
+	Endpoint     string
+	Insecure     bool
+	Sampler      string
+	SamplerRatio float64
+}
+
+type Tracing struct {
+	provider *sdktrace.TracerProvider
+	logger   log.Logger
+}
+
+// Stop flushes the pending spans and shuts down the exporter
+func (t *Tracing) Stop() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := t.provider.Shutdown(ctx); err != nil {
+		t.logger.Error("error stopping tracing ", err)
+		return
+	}
+	t.logger.Info("stopped tracing")
+}
+
+// EndSpan ends a span, recording the error if any
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func newExporter(ctx context.Context, options Options) (sdktrace.SpanExporter, error) {
+	switch options.Exporter {
+	case ExporterOTLP:
+		opts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(options.Endpoint)}
+		if options.Insecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		return otlptracegrpc.New(ctx, opts...)
+	case ExporterStdout:
+		return stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter '%s'", options.Exporter)
+	}
+}
+
+func newSampler(options Options) (sdktrace.Sampler, error) {
+	switch options.Sampler {
+	case SamplerAlwaysOn:
+		return sdktrace.ParentBased(sdktrace.AlwaysSample()), nil
+	case SamplerAlwaysOff:
+		return sdktrace.ParentBased(sdktrace.NeverSample()), nil
+	case SamplerTraceIDRatio:
+		return sdktrace.ParentBased(sdktrace.TraceIDRatioBased(options.SamplerRatio)), nil
+	default:
+		return nil, fmt.Errorf("unknown tracing sampler '%s'", options.Sampler)
+	}
+}
+
+// New configures the global tracer provider and the W3C trace context propagator
+func New(ctx context.Context, options Options, logger log.Logger) (*Tracing, error) {
+	sampler, err := newSampler(options)
+	if err != nil {
+		return nil, err
+	}
+	exporter, err := newExporter(ctx, options)
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sampler),
+		sdktrace.WithResource(resource.NewWithAttributes(
+			semconv.SchemaURL,
+			semconv.ServiceNameKey.String(options.ServiceName),
+		)),
+	)
+
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+	logger.Infof("tracing enabled using %s exporter", options.Exporter)
+
+	return &Tracing{provider, logger}, nil
+}